@@ -0,0 +1,633 @@
+package adblock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// resource types of filter options, request of type is matched by rule having its bit
+const (
+	typeScript uint32 = 1 << iota
+	typeImage
+	typeStylesheet
+	typeObject
+	typeXHR
+	typeSubdocument
+	typeFont
+	typeMedia
+	typeWebSocket
+	typePing
+	typeOther
+
+	typeAll = typeOther<<1 - 1
+)
+
+var optionTypes = map[string]uint32{
+	"script":         typeScript,
+	"image":          typeImage,
+	"stylesheet":     typeStylesheet,
+	"css":            typeStylesheet,
+	"object":         typeObject,
+	"xmlhttprequest": typeXHR,
+	"xhr":            typeXHR,
+	"subdocument":    typeSubdocument,
+	"frame":          typeSubdocument,
+	"font":           typeFont,
+	"media":          typeMedia,
+	"websocket":      typeWebSocket,
+	"ping":           typePing,
+	"beacon":         typePing,
+	"other":          typeOther,
+	"all":            typeAll,
+}
+
+// chromeTypes maps lower cased chrome resource types to filter ones, the rest are other
+var chromeTypes = map[string]uint32{
+	"script":     typeScript,
+	"image":      typeImage,
+	"stylesheet": typeStylesheet,
+	"xhr":        typeXHR,
+	"fetch":      typeXHR,
+	"document":   typeSubdocument,
+	"font":       typeFont,
+	"media":      typeMedia,
+	"websocket":  typeWebSocket,
+	"ping":       typePing,
+}
+
+// ignoredOptions don't change what rule matches here
+var ignoredOptions = map[string]bool{
+	"important":  true,
+	"match-case": true,
+	"collapse":   true,
+	"~collapse":  true,
+}
+
+// proceduralSelectors are extended selectors css of browser can't take
+var proceduralSelectors = []string{
+	":-abp-", ":has-text(", ":xpath(", ":style(", ":matches-", ":upward(", ":remove(",
+	":min-text-length(", ":watch-attr(", ":others(", ":if(", ":if-not(", ":nth-ancestor(",
+}
+
+// rule is a network filter, pattern is lower cased with anchors stripped
+type rule struct {
+	pattern      string
+	regexp       *regexp.Regexp
+	domainAnchor bool
+	startAnchor  bool
+	endAnchor    bool
+	types        uint32
+	// 1 is third-party only, -1 is first-party only
+	party      int
+	domains    []string
+	notDomains []string
+	// exception disables element hiding of page, all of it or generic one
+	elemHide    bool
+	genericHide bool
+	// exception of element hiding only doesn't allow requests
+	requests bool
+}
+
+// ruleSet indexes rules by token of pattern, so request is matched against few of them
+type ruleSet struct {
+	tokens map[string][]*rule
+	rest   []*rule
+}
+
+// hidingRule is an element hiding filter, generic one has no domains
+type hidingRule struct {
+	selector   string
+	domains    []string
+	notDomains []string
+}
+
+// Engine matches requests and pages against filter lists of adblock plus syntax, as easylist is
+type Engine struct {
+	block     *ruleSet
+	allow     *ruleSet
+	hiding    []*hidingRule
+	specific  map[string][]*hidingRule
+	exception map[string]map[string]bool
+	// selectors excepted everywhere
+	excepted map[string]bool
+	rules    int
+}
+
+func isTokenChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '%'
+}
+
+// isSeparator is what ^ matches besides end of url
+func isSeparator(c byte) bool {
+	return !isTokenChar(c) && c != '_' && c != '-' && c != '.'
+}
+
+// matchAt matches pattern at start of s, * is any run of chars, ^ is separator or end
+func matchAt(p, s string, end bool) bool {
+
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			p = strings.TrimLeft(p, "*")
+			if len(p) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchAt(p, s[i:], end) {
+					return true
+				}
+			}
+			return false
+		case '^':
+			if len(s) > 0 {
+				if !isSeparator(s[0]) {
+					return false
+				}
+				s = s[1:]
+			}
+			p = p[1:]
+		default:
+			if len(s) == 0 || s[0] != p[0] {
+				return false
+			}
+			p, s = p[1:], s[1:]
+		}
+	}
+	return !end || len(s) == 0
+}
+
+// token is longest token of pattern bounded by its literal chars or anchors, so it's a whole token of url
+func (r *rule) token() string {
+
+	token := ""
+	p := r.pattern
+	for i := 0; i < len(p); {
+		if !isTokenChar(p[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(p) && isTokenChar(p[j]) {
+			j++
+		}
+		before := (i == 0 && (r.startAnchor || r.domainAnchor)) || (i > 0 && p[i-1] != '*')
+		after := (j == len(p) && r.endAnchor) || (j < len(p) && p[j] != '*')
+		if t := p[i:j]; before && after && len(t) > len(token) && t != "http" && t != "https" && t != "www" && t != "com" {
+			token = t
+		}
+		i = j
+	}
+	return token
+}
+
+func matchDomains(host string, domains []string) bool {
+
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOptions checks type, party and domains of page, request is of type
+func (r *rule) matchOptions(t uint32, thirdParty bool, page string) bool {
+
+	if r.types&t == 0 {
+		return false
+	}
+	if (r.party > 0 && !thirdParty) || (r.party < 0 && thirdParty) {
+		return false
+	}
+	if len(r.domains) > 0 && !matchDomains(page, r.domains) {
+		return false
+	}
+	return !matchDomains(page, r.notDomains)
+}
+
+// matchURL matches pattern of rule against lower cased url, host starts at hostStart
+func (r *rule) matchURL(u string, hostStart, hostEnd int) bool {
+
+	switch {
+	case r.regexp != nil:
+		return r.regexp.MatchString(u)
+	case r.domainAnchor:
+		for i := hostStart; i < hostEnd; i++ {
+			if (i == hostStart || u[i-1] == '.') && matchAt(r.pattern, u[i:], r.endAnchor) {
+				return true
+			}
+		}
+		return false
+	case r.startAnchor:
+		return matchAt(r.pattern, u, r.endAnchor)
+	}
+	if r.pattern == "" {
+		return true
+	}
+	first := r.pattern[0]
+	for i := 0; i <= len(u); i++ {
+		if first != '*' && first != '^' && (i == len(u) || u[i] != first) {
+			continue
+		}
+		if matchAt(r.pattern, u[i:], r.endAnchor) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ruleSet) add(r *rule) {
+
+	if t := r.token(); t != "" && r.regexp == nil {
+		s.tokens[t] = append(s.tokens[t], r)
+		return
+	}
+	s.rest = append(s.rest, r)
+}
+
+// match returns first rule matching request, check filters rules by their options
+func (s *ruleSet) match(u string, hostStart, hostEnd int, check func(*rule) bool) *rule {
+
+	seen := make(map[string]bool)
+	for i := 0; i < len(u); {
+		if !isTokenChar(u[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(u) && isTokenChar(u[j]) {
+			j++
+		}
+		t := u[i:j]
+		i = j
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		for _, r := range s.tokens[t] {
+			if check(r) && r.matchURL(u, hostStart, hostEnd) {
+				return r
+			}
+		}
+	}
+	for _, r := range s.rest {
+		if check(r) && r.matchURL(u, hostStart, hostEnd) {
+			return r
+		}
+	}
+	return nil
+}
+
+// site is registrable domain of host, host itself if it has none e.g. ip or localhost
+func site(host string) string {
+
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	if s, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return s
+	}
+	return host
+}
+
+// hostRange finds host in lower cased url, it's empty if url has none
+func hostRange(u string) (int, int) {
+
+	start := strings.Index(u, "://")
+	if start < 0 {
+		return 0, 0
+	}
+	start += 3
+	end := start
+	for end < len(u) && u[end] != '/' && u[end] != '?' && u[end] != '#' && u[end] != ':' {
+		end++
+	}
+	if at := strings.LastIndexByte(u[start:end], '@'); at >= 0 {
+		start += at + 1
+	}
+	return start, end
+}
+
+func hostname(raw string) string {
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func splitDomains(list, sep string) ([]string, []string) {
+
+	var domains, notDomains []string
+	for _, d := range strings.Split(list, sep) {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "" || d == "~":
+		case strings.HasPrefix(d, "~"):
+			notDomains = append(notDomains, d[1:])
+		default:
+			domains = append(domains, d)
+		}
+	}
+	return domains, notDomains
+}
+
+// parseOptions fills rule by options after $, rule with options not supported is skipped
+func (r *rule) parseOptions(options string, exception bool) bool {
+
+	var types, notTypes uint32
+	hidingOnly := false
+	for _, o := range strings.Split(strings.ToLower(options), ",") {
+		o = strings.TrimSpace(o)
+		switch {
+		case o == "" || ignoredOptions[o]:
+		case o == "third-party" || o == "3p":
+			r.party = 1
+		case o == "~third-party" || o == "first-party" || o == "1p":
+			r.party = -1
+		case strings.HasPrefix(o, "domain="):
+			r.domains, r.notDomains = splitDomains(strings.TrimPrefix(o, "domain="), "|")
+		case exception && (o == "elemhide" || o == "ehide"):
+			r.elemHide, hidingOnly = true, true
+		case exception && (o == "generichide" || o == "ghide"):
+			r.genericHide, hidingOnly = true, true
+		case optionTypes[o] != 0:
+			types |= optionTypes[o]
+		case strings.HasPrefix(o, "~") && optionTypes[o[1:]] != 0:
+			notTypes |= optionTypes[o[1:]]
+		default:
+			return false
+		}
+	}
+
+	switch {
+	case types != 0:
+		r.types = types &^ notTypes
+	case hidingOnly:
+		r.types = typeAll
+	default:
+		r.types = typeAll &^ notTypes
+	}
+	r.requests = !hidingOnly || types != 0
+	return r.types != 0
+}
+
+func (e *Engine) addNetwork(line string) {
+
+	exception := strings.HasPrefix(line, "@@")
+	line = strings.TrimPrefix(line, "@@")
+
+	r := &rule{types: typeAll, requests: true}
+	pattern := line
+	// $ of regexp rule is end of line, options come after last /
+	if i := strings.LastIndexByte(line, '$'); i >= 0 && !(strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/")) {
+		pattern = line[:i]
+		if !r.parseOptions(line[i+1:], exception) {
+			return
+		}
+	}
+
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+		if err != nil {
+			return
+		}
+		r.regexp = re
+	} else {
+		pattern = strings.ToLower(pattern)
+		switch {
+		case strings.HasPrefix(pattern, "||"):
+			r.domainAnchor = true
+			pattern = pattern[2:]
+		case strings.HasPrefix(pattern, "|"):
+			r.startAnchor = true
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "|") {
+			r.endAnchor = true
+			pattern = strings.TrimSuffix(pattern, "|")
+		}
+		r.pattern = pattern
+	}
+
+	if exception {
+		e.allow.add(r)
+	} else {
+		e.block.add(r)
+	}
+	e.rules++
+}
+
+func (e *Engine) addHiding(line string, marker int, exception bool) {
+
+	domainList := line[:marker]
+	selector := strings.TrimSpace(line[marker+2:])
+	if exception {
+		selector = strings.TrimSpace(line[marker+3:])
+	}
+	if selector == "" || strings.HasPrefix(selector, "+js(") || strings.HasPrefix(selector, "^") {
+		return
+	}
+	for _, p := range proceduralSelectors {
+		if strings.Contains(selector, p) {
+			return
+		}
+	}
+
+	domains, notDomains := splitDomains(domainList, ",")
+	switch {
+	case exception && len(domains) == 0:
+		e.excepted[selector] = true
+	case exception:
+		for _, d := range domains {
+			if e.exception[d] == nil {
+				e.exception[d] = make(map[string]bool)
+			}
+			e.exception[d][selector] = true
+		}
+	case len(domains) == 0:
+		e.hiding = append(e.hiding, &hidingRule{selector: selector, notDomains: notDomains})
+	default:
+		h := &hidingRule{selector: selector, domains: domains, notDomains: notDomains}
+		for _, d := range domains {
+			e.specific[d] = append(e.specific[d], h)
+		}
+	}
+	e.rules++
+}
+
+// Add takes one line of filter list, comments and filters of extended syntax are skipped
+func (e *Engine) Add(line string) {
+
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+		return
+	}
+	for _, m := range []string{"#?#", "#$#", "#%#", "#@?#", "#@$#", "$$"} {
+		if strings.Contains(line, m) {
+			return
+		}
+	}
+	if i := strings.Index(line, "#@#"); i >= 0 {
+		e.addHiding(line, i, true)
+		return
+	}
+	if i := strings.Index(line, "##"); i >= 0 {
+		e.addHiding(line, i, false)
+		return
+	}
+	e.addNetwork(line)
+}
+
+// Read takes filter list line by line
+func (e *Engine) Read(r io.Reader) error {
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		e.Add(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Rules is count of filters taken
+func (e *Engine) Rules() int {
+	return e.rules
+}
+
+// Blocked tells if request of chrome resource type made by page should fail, page's own
+// requests are first-party ones
+func (e *Engine) Blocked(request, page, resourceType string) bool {
+
+	u := strings.ToLower(request)
+	hostStart, hostEnd := hostRange(u)
+	if hostStart == hostEnd {
+		return false
+	}
+
+	t, ok := chromeTypes[strings.ToLower(resourceType)]
+	if !ok {
+		t = typeOther
+	}
+	pageHost := hostname(page)
+	thirdParty := site(u[hostStart:hostEnd]) != site(pageHost)
+
+	check := func(r *rule) bool { return r.requests && r.matchOptions(t, thirdParty, pageHost) }
+	if e.block.match(u, hostStart, hostEnd, check) == nil {
+		return false
+	}
+	return e.allow.match(u, hostStart, hostEnd, check) == nil
+}
+
+// hidingDisabled tells if page is excepted from element hiding by $elemhide or $generichide
+func (e *Engine) hidingDisabled(page, pageHost string) (bool, bool) {
+
+	u := strings.ToLower(page)
+	hostStart, hostEnd := hostRange(u)
+	all, generic := false, false
+	e.allow.match(u, hostStart, hostEnd, func(r *rule) bool {
+		if !r.elemHide && !r.genericHide {
+			return false
+		}
+		if len(r.domains) > 0 && !matchDomains(pageHost, r.domains) || matchDomains(pageHost, r.notDomains) {
+			return false
+		}
+		ok := r.matchURL(u, hostStart, hostEnd)
+		all = all || (ok && r.elemHide)
+		generic = generic || (ok && r.genericHide)
+		return false
+	})
+	return all, generic
+}
+
+// HidingCSS is style sheet hiding elements of page, one rule per selector, so one the browser
+// can't parse doesn't void others
+func (e *Engine) HidingCSS(page string) string {
+
+	host := hostname(page)
+	all, generic := e.hidingDisabled(page, host)
+	if all {
+		return ""
+	}
+
+	excepted := func(s string) bool {
+		if e.excepted[s] {
+			return true
+		}
+		for h := host; h != ""; {
+			if e.exception[h][s] {
+				return true
+			}
+			i := strings.IndexByte(h, '.')
+			if i < 0 {
+				break
+			}
+			h = h[i+1:]
+		}
+		return false
+	}
+
+	var b strings.Builder
+	seen := make(map[string]bool)
+	write := func(h *hidingRule) {
+		if seen[h.selector] || matchDomains(host, h.notDomains) || excepted(h.selector) {
+			return
+		}
+		seen[h.selector] = true
+		fmt.Fprintf(&b, "%s { display: none !important; }\n", h.selector)
+	}
+
+	for h := host; h != ""; {
+		for _, r := range e.specific[h] {
+			write(r)
+		}
+		i := strings.IndexByte(h, '.')
+		if i < 0 {
+			break
+		}
+		h = h[i+1:]
+	}
+	if !generic {
+		for _, r := range e.hiding {
+			write(r)
+		}
+	}
+	return b.String()
+}
+
+func NewEngine() *Engine {
+	return &Engine{
+		block:     &ruleSet{tokens: make(map[string][]*rule)},
+		allow:     &ruleSet{tokens: make(map[string][]*rule)},
+		specific:  make(map[string][]*hidingRule),
+		exception: make(map[string]map[string]bool),
+		excepted:  make(map[string]bool),
+	}
+}
+
+// Load reads filter lists of files into one engine
+func Load(paths []string) (*Engine, error) {
+
+	e := NewEngine()
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		err = e.Read(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", path, err)
+		}
+	}
+	return e, nil
+}
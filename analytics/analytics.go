@@ -0,0 +1,177 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/common"
+)
+
+type RecorderOptions struct {
+	// events exported at once, queue is flushed when it's reached or by interval seconds
+	BatchSize     int
+	FlushInterval int
+	// events kept while exporter is failing, oldest ones are dropped over it
+	MaxQueue int
+	Timeout  int
+}
+
+// Event is one render with its dimensions, timings and outcome, durations are milliseconds
+type Event struct {
+	Time      time.Time `json:"time"`
+	Job       string    `json:"job"`
+	Tenant    string    `json:"tenant"`
+	Host      string    `json:"host"`
+	Kind      string    `json:"kind"`
+	Preset    string    `json:"preset"`
+	Output    string    `json:"output"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Async     bool      `json:"async"`
+	Cached    bool      `json:"cached"`
+	Partial   bool      `json:"partial"`
+	Status    int       `json:"status"`
+	Page      string    `json:"page"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error"`
+	ErrorCode string    `json:"error_code"`
+	Queued    float64   `json:"queued_ms"`
+	Duration  float64   `json:"duration_ms"`
+	Size      int       `json:"size"`
+}
+
+// ErrRejected is returned by exporter when store refused events themselves, so they aren't retried
+var ErrRejected = errors.New("events are rejected")
+
+// Exporter writes batch of events to analytics store
+type Exporter interface {
+	Export(ctx context.Context, events []*Event) error
+	Kind() string
+}
+
+// Recorder queues render events and exports them in batches, so renders don't wait for store
+type Recorder struct {
+	options  RecorderOptions
+	exporter Exporter
+	logger   sreCommon.Logger
+	meter    sreCommon.Meter
+	events   []*Event
+	flush    chan struct{}
+	mutex    sync.Mutex
+}
+
+func (r *Recorder) updateGauges() {
+	r.meter.Gauge("queued", "Count of queued analytics events", nil, "analytics").Set(float64(len(r.events)))
+}
+
+// Record queues event, export is triggered when batch is full
+func (r *Recorder) Record(e *Event) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.options.MaxQueue > 0 && len(r.events) >= r.options.MaxQueue {
+		r.events = r.events[1:]
+		r.meter.Counter("dropped", "Count of analytics events dropped over queue size", nil, "analytics").Inc()
+	}
+	r.events = append(r.events, e)
+	r.updateGauges()
+
+	if len(r.events) >= r.options.BatchSize {
+		select {
+		case r.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// export sends queued events batch by batch, failed batch is put back to be retried
+func (r *Recorder) export() {
+
+	for {
+		r.mutex.Lock()
+		n := len(r.events)
+		if n == 0 {
+			r.mutex.Unlock()
+			return
+		}
+		if n > r.options.BatchSize {
+			n = r.options.BatchSize
+		}
+		batch := append([]*Event{}, r.events[:n]...)
+		r.events = r.events[n:]
+		r.updateGauges()
+		r.mutex.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.options.Timeout)*time.Second)
+		err := r.exporter.Export(ctx, batch)
+		cancel()
+
+		if errors.Is(err, ErrRejected) {
+			r.logger.Error("Analytics events are rejected by %s, %d are dropped: %v", r.exporter.Kind(), len(batch), err)
+			r.meter.Counter("rejected", "Count of analytics events rejected by store", nil, "analytics").Add(len(batch))
+			continue
+		}
+		if err != nil {
+			r.logger.Error("Couldn't export %d analytics events to %s: %v", len(batch), r.exporter.Kind(), err)
+			r.meter.Counter("errors", "Count of failed analytics exports", nil, "analytics").Inc()
+
+			r.mutex.Lock()
+			r.events = append(batch, r.events...)
+			if r.options.MaxQueue > 0 && len(r.events) > r.options.MaxQueue {
+				r.events = r.events[len(r.events)-r.options.MaxQueue:]
+			}
+			r.updateGauges()
+			r.mutex.Unlock()
+			return
+		}
+		r.meter.Counter("exported", "Count of exported analytics events", nil, "analytics").Add(len(batch))
+	}
+}
+
+func (r *Recorder) Start(wg *sync.WaitGroup) {
+
+	wg.Add(1)
+	go func(wg *sync.WaitGroup) {
+
+		defer wg.Done()
+		r.logger.Info("Start %s analytics recorder...", r.exporter.Kind())
+
+		ticker := time.NewTicker(time.Duration(r.options.FlushInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-r.flush:
+			}
+			r.export()
+		}
+	}(wg)
+}
+
+func NewRecorder(options RecorderOptions, exporter Exporter, observability *common.Observability) *Recorder {
+
+	if exporter == nil {
+		return nil
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 1
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = 10
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 30
+	}
+
+	return &Recorder{
+		options:  options,
+		exporter: exporter,
+		logger:   observability.Logs(),
+		meter:    observability.Metrics(),
+		flush:    make(chan struct{}, 1),
+	}
+}
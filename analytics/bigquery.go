@@ -0,0 +1,268 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopsext/utils"
+)
+
+type BigQueryExporterOptions struct {
+	Project string
+	Dataset string
+	Table   string
+	// service account key json, its token is issued for bigquery insert scope
+	Credentials string
+	Endpoint    string
+	Timeout     int
+}
+
+type bigQueryCredentials struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+type bigQueryToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type bigQueryRow struct {
+	InsertID string `json:"insertId"`
+	JSON     *Event `json:"json"`
+}
+
+type bigQueryInsertResponse struct {
+	InsertErrors []struct {
+		Index  int `json:"index"`
+		Errors []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"insertErrors"`
+}
+
+const (
+	bigQueryScope    = "https://www.googleapis.com/auth/bigquery.insertdata"
+	bigQueryTokenURI = "https://oauth2.googleapis.com/token"
+	bigQueryEndpoint = "https://bigquery.googleapis.com"
+)
+
+// BigQueryExporter streams events by tabledata.insertAll, access token is got by
+// service account jwt and renewed before it expires
+type BigQueryExporter struct {
+	options     BigQueryExporterOptions
+	credentials *bigQueryCredentials
+	key         *rsa.PrivateKey
+	client      *http.Client
+	token       string
+	expires     time.Time
+	mutex       sync.Mutex
+}
+
+func (b *BigQueryExporter) Kind() string {
+	return "bigquery"
+}
+
+func bigQueryEncode(v interface{}) (string, error) {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// assertion is rs256 signed jwt asking for insert scope
+func (b *BigQueryExporter) assertion(now time.Time) (string, error) {
+
+	header, err := bigQueryEncode(map[string]string{"alg": "RS256", "typ": "JWT", "kid": b.credentials.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := bigQueryEncode(map[string]interface{}{
+		"iss":   b.credentials.ClientEmail,
+		"scope": bigQueryScope,
+		"aud":   b.credentials.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := header + "." + claims
+	hash := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, b.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func (b *BigQueryExporter) accessToken(ctx context.Context) (string, error) {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	if b.token != "" && now.Before(b.expires) {
+		return b.token, nil
+	}
+
+	assertion, err := b.assertion(now)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.credentials.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var t bigQueryToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		return "", err
+	}
+	// renewed a minute before it's expired
+	b.token = t.AccessToken
+	b.expires = now.Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+	return b.token, nil
+}
+
+func (b *BigQueryExporter) Export(ctx context.Context, events []*Event) error {
+
+	token, err := b.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	// insert id lets bigquery drop rows of retried batch
+	var rows []*bigQueryRow
+	for _, e := range events {
+		rows = append(rows, &bigQueryRow{InsertID: e.Job, JSON: e})
+	}
+	data, err := json.Marshal(map[string]interface{}{"rows": rows})
+	if err != nil {
+		return err
+	}
+
+	u := fmt.Sprintf("%s/bigquery/v2/projects/%s/datasets/%s/tables/%s/insertAll", strings.TrimRight(b.options.Endpoint, "/"),
+		url.PathEscape(b.options.Project), url.PathEscape(b.options.Dataset), url.PathEscape(b.options.Table))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bigquery returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	// rejected rows aren't retried, they would be rejected again
+	var r bigQueryInsertResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return err
+	}
+	if len(r.InsertErrors) > 0 && len(r.InsertErrors[0].Errors) > 0 {
+		e := r.InsertErrors[0].Errors[0]
+		return fmt.Errorf("%w: %d rows, first is %s %s", ErrRejected, len(r.InsertErrors), e.Reason, e.Message)
+	}
+	return nil
+}
+
+func bigQueryKey(pemKey string) (*rsa.PrivateKey, error) {
+
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("private key is not pem")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not rsa")
+	}
+	return key, nil
+}
+
+func NewBigQueryExporter(options BigQueryExporterOptions) (*BigQueryExporter, error) {
+
+	if utils.IsEmpty(options.Project) || utils.IsEmpty(options.Dataset) || utils.IsEmpty(options.Table) {
+		return nil, nil
+	}
+	if utils.IsEmpty(options.Endpoint) {
+		options.Endpoint = bigQueryEndpoint
+	}
+
+	var credentials bigQueryCredentials
+	if err := json.Unmarshal([]byte(options.Credentials), &credentials); err != nil {
+		return nil, fmt.Errorf("couldn't parse bigquery credentials: %w", err)
+	}
+	if utils.IsEmpty(credentials.TokenURI) {
+		credentials.TokenURI = bigQueryTokenURI
+	}
+	key, err := bigQueryKey(credentials.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse bigquery private key: %w", err)
+	}
+
+	return &BigQueryExporter{
+		options:     options,
+		credentials: &credentials,
+		key:         key,
+		client:      utils.NewHttpClient(options.Timeout, false),
+	}, nil
+}
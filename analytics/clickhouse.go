@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/devopsext/utils"
+)
+
+type ClickHouseExporterOptions struct {
+	// http interface of clickhouse, like http://localhost:8123
+	URL      string
+	Database string
+	Table    string
+	User     string
+	Password string
+	Timeout  int
+}
+
+// ClickHouseExporter inserts events as JSONEachRow over clickhouse http interface,
+// table columns are named as event json fields
+type ClickHouseExporter struct {
+	options ClickHouseExporterOptions
+	client  *http.Client
+}
+
+func (c *ClickHouseExporter) Kind() string {
+	return "clickhouse"
+}
+
+func (c *ClickHouseExporter) table() string {
+
+	if utils.IsEmpty(c.options.Database) {
+		return c.options.Table
+	}
+	return fmt.Sprintf("%s.%s", c.options.Database, c.options.Table)
+}
+
+func (c *ClickHouseExporter) Export(ctx context.Context, events []*Event) error {
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", c.table()))
+	// time is rfc 3339 which clickhouse doesn't take by default
+	query.Set("date_time_input_format", "best_effort")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.options.URL, "/")+"/?"+query.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if !utils.IsEmpty(c.options.User) {
+		req.Header.Set("X-ClickHouse-User", c.options.User)
+		req.Header.Set("X-ClickHouse-Key", c.options.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("clickhouse returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		// malformed rows, nothing to retry
+		if resp.StatusCode == http.StatusBadRequest {
+			err = fmt.Errorf("%w: %v", ErrRejected, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func NewClickHouseExporter(options ClickHouseExporterOptions) *ClickHouseExporter {
+
+	if utils.IsEmpty(options.URL) || utils.IsEmpty(options.Table) {
+		return nil
+	}
+	return &ClickHouseExporter{
+		options: options,
+		client:  utils.NewHttpClient(options.Timeout, false),
+	}
+}
@@ -0,0 +1,78 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/chromedp/chromedp"
+)
+
+// SelectorResult is presence of element asserted by selector, it's passed if element is visible
+type SelectorResult struct {
+	Selector string `json:"selector"`
+	Found    bool   `json:"found"`
+	Visible  bool   `json:"visible"`
+}
+
+// assertSelectorsScript checks selectors and boxes elements in page, green ones are visible,
+// red ones are hidden, selectors not found are listed in red at top left of page
+const assertSelectorsScript = `((selectors) => {
+	const root = document.createElement("div");
+	root.setAttribute("data-webrender-assert", "");
+	root.style.cssText = "position:absolute;left:0;top:0;width:0;height:0;z-index:2147483647;pointer-events:none;";
+	const missing = [];
+	const results = selectors.map((s) => {
+		let el = null;
+		try {
+			el = document.querySelector(s);
+		} catch (e) {}
+		if (!el) {
+			missing.push(s);
+			return {selector: s, found: false, visible: false};
+		}
+		const rect = el.getBoundingClientRect();
+		const style = getComputedStyle(el);
+		const visible = rect.width > 0 && rect.height > 0 && style.visibility !== "hidden" && style.display !== "none";
+		const color = visible ? "#00c853" : "#d50000";
+		const box = document.createElement("div");
+		box.style.cssText = "position:absolute;box-sizing:border-box;border:3px " + (visible ? "solid " : "dashed ") + color + ";" +
+			"left:" + (rect.left + scrollX - 3) + "px;top:" + (rect.top + scrollY - 3) + "px;" +
+			"width:" + (Math.max(rect.width, 0) + 6) + "px;height:" + (Math.max(rect.height, 0) + 6) + "px;";
+		const label = document.createElement("div");
+		label.textContent = s;
+		label.style.cssText = "position:absolute;left:0;bottom:100%%;padding:1px 4px;font:12px monospace;white-space:nowrap;color:#fff;background:" + color + ";";
+		box.appendChild(label);
+		root.appendChild(box);
+		return {selector: s, found: true, visible: visible};
+	});
+	if (missing.length > 0) {
+		const list = document.createElement("div");
+		list.style.cssText = "position:absolute;left:" + scrollX + "px;top:" + scrollY + "px;padding:4px 8px;font:12px monospace;white-space:pre;color:#fff;background:#d50000;";
+		list.textContent = "missing:\n" + missing.join("\n");
+		root.appendChild(list);
+	}
+	document.documentElement.appendChild(root);
+	return results;
+})(%s)`
+
+// assertSelectorsAction runs after dom is grabbed, so boxes are in image only
+func (c *ChromeBrowser) assertSelectorsAction(r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		selectors, err := json.Marshal(c.options.AssertSelectors)
+		if err != nil {
+			return err
+		}
+		if err := chromedp.Evaluate(fmt.Sprintf(assertSelectorsScript, selectors), &r.Selectors).Do(ctx); err != nil {
+			return err
+		}
+		for _, s := range r.Selectors {
+			if !s.Visible {
+				c.debug("Asserted selector %s isn't visible, found %v", s.Selector, s.Found)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,72 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/chromedp"
+)
+
+func (c *ChromeBrowser) hasAuth() bool {
+	return c.options.Username != "" || c.options.Password != ""
+}
+
+// listenAuth answers basic and digest challenges of target origin only, so credentials don't go to
+// other hosts, and challenges of proxy. Wrong credentials are given once, not to loop. Paused
+// requests are continued here unless blocked listener resolves them
+func (c *ChromeBrowser) listenAuth(ctx context.Context, u *url.URL, resolve bool) {
+
+	origin := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	_, proxyUsername, proxyPassword := proxyServer(c.options.Proxy)
+
+	var mutex sync.Mutex
+	answered := make(map[string]bool)
+
+	ectx := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		switch e := ev.(type) {
+		case *fetch.EventAuthRequired:
+			go func() {
+				response := &fetch.AuthChallengeResponse{Response: fetch.AuthChallengeResponseResponseCancelAuth}
+
+				mutex.Lock()
+				switch {
+				case e.AuthChallenge.Source == fetch.AuthChallengeSourceProxy:
+					if (proxyUsername != "" || proxyPassword != "") && !answered[e.AuthChallenge.Origin] {
+						answered[e.AuthChallenge.Origin] = true
+						response = &fetch.AuthChallengeResponse{
+							Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+							Username: proxyUsername,
+							Password: proxyPassword,
+						}
+					}
+				case c.hasAuth() && e.AuthChallenge.Origin == origin && !answered[origin]:
+					answered[origin] = true
+					response = &fetch.AuthChallengeResponse{
+						Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+						Username: c.options.Username,
+						Password: c.options.Password,
+					}
+				}
+				mutex.Unlock()
+
+				if err := fetch.ContinueWithAuth(e.RequestID, response).Do(ectx); err != nil {
+					c.logger.Debug("Couldn't answer auth challenge of %s: %v", e.AuthChallenge.Origin, err)
+				}
+			}()
+		case *fetch.EventRequestPaused:
+			if !resolve {
+				return
+			}
+			go func() {
+				if err := c.continueRequest(ectx, e, u); err != nil {
+					c.logger.Debug("Couldn't continue intercepted request %s: %v", e.Request.URL, err)
+				}
+			}()
+		}
+	})
+}
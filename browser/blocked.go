@@ -0,0 +1,251 @@
+package browser
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"golang.org/x/net/publicsuffix"
+)
+
+// BlockedContact is a host of blocked domain page tried to contact
+type BlockedContact struct {
+	Domain string `json:"domain"`
+	Host   string `json:"host"`
+	Count  int    `json:"count"`
+}
+
+var errBlockedDomain = errors.New("domain is blocked")
+
+// HostFilter tells why host mustn't be contacted e.g. it resolves to internal address, empty allows it
+type HostFilter func(host string) string
+
+// RequestFilter blocks requests and hides elements of page, e.g. by ad and tracker filter lists
+type RequestFilter interface {
+	// Blocked tells if request of chrome resource type made by page should fail
+	Blocked(request, page, resourceType string) bool
+	// HidingCSS is style sheet hiding elements of page
+	HidingCSS(page string) string
+}
+
+// hidingScript adds style sheet of request filter to page
+const hidingScript = `((css) => {
+	const style = document.createElement("style");
+	style.setAttribute("data-webrender-hiding", "");
+	style.textContent = css;
+	(document.head || document.documentElement).appendChild(style);
+})(%s)`
+
+// BlockTypes are resource types requests of which can be blocked, document of page can't
+var BlockTypes = []network.ResourceType{
+	network.ResourceTypeStylesheet,
+	network.ResourceTypeImage,
+	network.ResourceTypeMedia,
+	network.ResourceTypeFont,
+	network.ResourceTypeScript,
+	network.ResourceTypeXHR,
+	network.ResourceTypeFetch,
+	network.ResourceTypeWebSocket,
+	network.ResourceTypeManifest,
+	network.ResourceTypeTextTrack,
+	network.ResourceTypeOther,
+}
+
+// BlockType returns resource type by its name in any case, empty if it can't be blocked
+func BlockType(name string) network.ResourceType {
+
+	for _, t := range BlockTypes {
+		if strings.EqualFold(string(t), name) {
+			return t
+		}
+	}
+	return ""
+}
+
+type chromeBlocked struct {
+	mutex    sync.Mutex
+	contacts map[string]*BlockedContact
+}
+
+// matchDomain matches host by glob, plain domain matches its subdomains as well
+func matchDomain(pattern, host string) bool {
+
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	host = strings.ToLower(host)
+	if ok, _ := path.Match(pattern, host); ok {
+		return true
+	}
+	domain := strings.TrimPrefix(pattern, "*.")
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// BlockedDomain returns first domain pattern matching host
+func BlockedDomain(domains []string, host string) string {
+
+	for _, d := range domains {
+		if matchDomain(d, host) {
+			return d
+		}
+	}
+	return ""
+}
+
+func (b *chromeBlocked) add(domain, host string) {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	c, ok := b.contacts[host]
+	if !ok {
+		c = &BlockedContact{Domain: domain, Host: host}
+		b.contacts[host] = c
+	}
+	c.Count++
+}
+
+func (b *chromeBlocked) list() []*BlockedContact {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var r []*BlockedContact
+	for _, c := range b.contacts {
+		v := *c
+		r = append(r, &v)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Host < r[j].Host })
+	return r
+}
+
+// intercepts is true if paused requests are resolved by blocked listener
+func (c *ChromeBrowser) intercepts() bool {
+	return len(c.options.BlockedDomains) > 0 || len(c.options.BlockedTypes) > 0 || c.options.BlockThirdParty ||
+		c.options.RequestFilter != nil || c.options.HTML != "" || c.options.HostHeader != "" || c.options.HostFilter != nil
+}
+
+// blockedType is true if resource of type is blocked by options
+func (c *ChromeBrowser) blockedType(t network.ResourceType) bool {
+
+	for _, name := range c.options.BlockedTypes {
+		if BlockType(name) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// site is registrable domain of host, host itself if it has none e.g. ip or localhost
+func site(host string) string {
+
+	host = strings.ToLower(host)
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	if s, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return s
+	}
+	return host
+}
+
+// listenBlocked resolves requests paused by fetch domain, ones to blocked domains fail and are
+// reported, ones of blocked types, of other sites than target's and ones of request filter fail
+// silently as they're blocked to speed render up or to clean it. Documents aren't third-party,
+// frames of other sites are loaded, page itself isn't filtered. Page is answered by html of
+// options if it's set, so it has origin of url and its relative links are resolved against it.
+// Requests to hosts of host filter fail, redirects are paused as new requests, so they're checked too
+func (c *ChromeBrowser) listenBlocked(ctx context.Context, u *url.URL, b *chromeBlocked) {
+
+	target := site(u.Hostname())
+	page := chromedp.FromContext(ctx).Target.TargetID
+
+	// request of page has no fragment and has path at least
+	document := *u
+	document.Fragment, document.RawFragment = "", ""
+	if document.Path == "" {
+		document.Path = "/"
+	}
+
+	ectx := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		e, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		go func() {
+			host := ""
+			if u, err := url.Parse(e.Request.URL); err == nil {
+				host = u.Hostname()
+			}
+			domain := BlockedDomain(c.options.BlockedDomains, host)
+			thirdParty := c.options.BlockThirdParty && e.ResourceType != network.ResourceTypeDocument && site(host) != target
+			// main frame id is target id
+			main := e.ResourceType == network.ResourceTypeDocument && string(e.FrameID) == string(page)
+			filtered := c.options.RequestFilter != nil && !main && c.options.RequestFilter.Blocked(e.Request.URL, u.String(), string(e.ResourceType))
+
+			var err error
+			switch {
+			case main && c.options.HTML != "" && e.Request.URL == document.String():
+				err = fetch.FulfillRequest(e.RequestID, http.StatusOK).
+					WithResponseHeaders([]*fetch.HeaderEntry{{Name: "Content-Type", Value: "text/html; charset=utf-8"}}).
+					WithBody(base64.StdEncoding.EncodeToString([]byte(c.options.HTML))).
+					Do(ectx)
+			case c.options.HostFilter != nil && c.deniedHost(host, e.Request.URL):
+				err = fetch.FailRequest(e.RequestID, network.ErrorReasonBlockedByClient).Do(ectx)
+			case domain != "":
+				b.add(domain, host)
+				err = fetch.FailRequest(e.RequestID, network.ErrorReasonBlockedByClient).Do(ectx)
+			case thirdParty || filtered || c.blockedType(e.ResourceType):
+				c.debug("Request %s of %s is blocked", e.Request.URL, e.ResourceType)
+				err = fetch.FailRequest(e.RequestID, network.ErrorReasonBlockedByClient).Do(ectx)
+			default:
+				err = c.continueRequest(ectx, e, u)
+			}
+			if err != nil {
+				c.logger.Debug("Couldn't resolve intercepted request %s: %v", e.Request.URL, err)
+			}
+		}()
+	})
+}
+
+func (c *ChromeBrowser) deniedHost(host, request string) bool {
+
+	v := c.options.HostFilter(host)
+	if v != "" {
+		c.logger.Warn("Request %s is refused: %s", request, v)
+	}
+	return v != ""
+}
+
+// hidingAction hides elements request filter has selectors of for page
+func (c *ChromeBrowser) hidingAction(u *url.URL) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		css := c.options.RequestFilter.HidingCSS(u.String())
+		if css == "" {
+			return nil
+		}
+		data, err := json.Marshal(css)
+		if err != nil {
+			return err
+		}
+		return chromedp.Evaluate(fmt.Sprintf(hidingScript, data), nil).Do(ctx)
+	})
+}
+
+func newChromeBlocked() *chromeBlocked {
+	return &chromeBlocked{contacts: make(map[string]*BlockedContact)}
+}
@@ -0,0 +1,222 @@
+package browser
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/devopsext/webrender/common"
+)
+
+const BrowserKindChrome = "chrome"
+
+const (
+	BrowserCacheDisabled = "disabled"
+	BrowserCacheBypass   = "bypass"
+)
+
+const (
+	ColorSchemeDark  = "dark"
+	ColorSchemeLight = "light"
+)
+
+type BrowserImage struct {
+	Kind         string
+	FinalURL     string
+	Data         []byte
+	DOM          string
+	DOMTruncated bool
+	DOMSnapshot  []byte
+	Partial      bool
+	Status       int
+	Page         string
+	PageReason   string
+	Captcha      *Captcha
+	Coverage     []*Coverage
+	Trace        []byte
+	Memory       *Memory
+	HeapSnapshot []byte
+	Performance  *Performance
+	Waterfall    []*Resource
+	Har          *Har
+	Console      []*ConsoleMessage
+	Blocked      []*BlockedContact
+	Selectors    []*SelectorResult
+	Stages       []*Stage
+}
+
+type BrowserOptions struct {
+	Width     int
+	Height    int
+	UserAgent string
+	JsCode    string
+	Timeout   int
+	Delay     int
+	FullPage  bool
+	Quality   int
+	Path      string
+	Proxy     string
+	// load or network idle, idle time is quiet period in milliseconds
+	WaitUntil string
+	IdleTime  int
+	// js expression polled till it's truthy, up to wait timeout seconds
+	WaitExpression string
+	WaitTimeout    int
+	// scroll to bottom by steps of pixels with delay in milliseconds, up to max pixels
+	Scroll      bool
+	ScrollStep  int
+	ScrollDelay int
+	ScrollMax   int
+	// position in pixels page is scrolled to right before capture, e.g. to reproduce viewport of user
+	ScrollX int
+	ScrollY int
+	// devtools url of running chrome, ws:// or http:// to look it up
+	RemoteURL  string
+	Headers    []string
+	HeadersMap map[string]interface{}
+	Cookies    map[string]string
+
+	// host header of requests to url host, e.g. url of ip or balancer before dns is switched
+	HostHeader string
+
+	// process profile of flags, sandbox and fonts, e.g. container
+	Environment string
+
+	// http basic or digest credentials of target origin
+	Username string
+	Password string
+
+	// storage items of target origin set before page scripts run
+	LocalStorage   map[string]string
+	SessionStorage map[string]string
+
+	// url patterns not to be loaded, * is a wildcard
+	BlockedURLs []string
+	// selectors of consent buttons clicked after load
+	ConsentSelectors []string
+
+	// http codes to screenshot (used as a filter)
+	ScreenshotCodes []int
+	AsPDF           bool
+	// layout of pdf, paper, margins, scale and pages
+	PDF PDFOptions
+	// output format instead of screenshot, svg only for now
+	Format string
+	// document rendered instead of the one of url, url is its origin and base of its links
+	HTML string
+	// element to capture instead of whole page
+	Selector string
+	// horizontal one stitches captures of element of selector scrolled horizontally, or of
+	// the largest horizontally scrolling one
+	Direction string
+
+	// seconds of navigation till load, of waits after it and of capture, bound by timeout as well
+	NavigationTimeout int
+	SettleTimeout     int
+	CaptureTimeout    int
+
+	// return whatever loaded when timeout exceeded, otherwise fail
+	Partial bool
+
+	// patterns to flag error and challenge pages
+	ErrorTexts         []string
+	ErrorSelectors     []string
+	ChallengeTexts     []string
+	ChallengeSelectors []string
+
+	// optional hook to solve detected captcha
+	CaptchaSolver CaptchaSolver
+
+	// user agent client hints, brands are in form of name:version
+	AcceptLanguage           string
+	UserAgentBrands          []string
+	UserAgentPlatform        string
+	UserAgentPlatformVersion string
+	UserAgentArchitecture    string
+	UserAgentModel           string
+	UserAgentMobile          bool
+
+	// disabled, bypass or empty to use cache
+	BrowserCache string
+
+	// block, unregister or empty to keep service workers as is
+	ServiceWorkers string
+
+	// permissions to grant for target origin, -deny suffix denies permission
+	Permissions []string
+
+	// prefers-color-scheme of page, dark, light or empty to keep browser one
+	ColorScheme string
+
+	// scripts of page don't run, so fallback of page without js is captured
+	JsDisabled bool
+
+	// grab outer html, cut to max size if it's set
+	CaptureDOM bool
+	MaxDOMSize int
+
+	// capture dom snapshot with layout and computed styles listed
+	DOMSnapshot    bool
+	SnapshotStyles []string
+
+	// collect js and css coverage
+	Coverage bool
+
+	// record chrome trace of categories listed
+	Trace           bool
+	TraceCategories []string
+
+	// read js heap usage, optionally with heap snapshot
+	Memory       bool
+	HeapSnapshot bool
+
+	// read load timing, paints, layout shifts and main thread work
+	Performance bool
+
+	// collect compact network log of page resources, or full one as har
+	Waterfall bool
+	Har       bool
+
+	// collect console messages and uncaught exceptions
+	Console bool
+
+	// domains never to be contacted, requests to them are failed and reported
+	BlockedDomains []string
+
+	// resource types and requests to other sites than target's to be failed, so render is faster
+	BlockedTypes    []string
+	BlockThirdParty bool
+
+	// ads and trackers filter, its requests fail and its elements are hidden
+	RequestFilter RequestFilter
+	// hosts requests of render mustn't reach, redirects and subresources are checked as well
+	HostFilter HostFilter
+
+	// elements which must be there and visible, they are boxed in screenshot
+	AssertSelectors []string
+
+	// log page and network events of this render at info level
+	Debug bool
+
+	// dir to record devtools protocol messages of render to, they are replayed by replay server
+	RecordDir string
+
+	// receiver of milestones, console errors and exceptions of render as they happen
+	Events EventFunc
+
+	// console and network event types logged at debug level, percent of them sampled
+	EventLogTypes  []string
+	EventLogSample int
+
+	// fake browser latency and its jitter in milliseconds, percent of urls failed
+	FakeLatency     int
+	FakeJitter      int
+	FakeFailureRate int
+}
+
+// Browser renders url with options it was created with, ctx cancels rendering
+type Browser interface {
+	Kind() string
+	Image(ctx context.Context, url *url.URL) (*BrowserImage, error)
+}
+
+type NewBrowserFunc = func(options BrowserOptions, observability *common.Observability) Browser
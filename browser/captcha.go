@@ -0,0 +1,181 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/devopsext/utils"
+)
+
+type Captcha struct {
+	Kind    string `json:"kind"`
+	SiteKey string `json:"siteKey,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Solved  bool   `json:"solved"`
+}
+
+// CaptchaSolver is implemented by external solving services, returned token is put into the page
+type CaptchaSolver interface {
+	Solve(ctx context.Context, captcha *Captcha) (string, error)
+}
+
+// captchaDetectScript flags only visible challenges, invisible recaptcha v3 badge and hidden widgets are skipped
+const captchaDetectScript = `(() => {
+	const checks = [
+		["recaptcha", ".g-recaptcha,iframe[src*='google.com/recaptcha'],iframe[src*='recaptcha.net']"],
+		["hcaptcha", ".h-captcha,iframe[src*='hcaptcha.com']"],
+		["turnstile", ".cf-turnstile,iframe[src*='challenges.cloudflare.com']"],
+		["funcaptcha", "#FunCaptcha,iframe[src*='arkoselabs.com'],iframe[src*='funcaptcha.com']"],
+		["geetest", ".geetest_holder,.geetest_panel"]
+	];
+	const visible = (el) => {
+		if (el.closest(".grecaptcha-badge") || el.getAttribute("data-size") === "invisible") {
+			return false;
+		}
+		if (el.tagName === "IFRAME" && /[?&]size=invisible/.test(el.src)) {
+			return false;
+		}
+		const style = window.getComputedStyle(el);
+		if (style.display === "none" || style.visibility === "hidden" || style.opacity === "0") {
+			return false;
+		}
+		const rect = el.getBoundingClientRect();
+		return rect.width > 0 && rect.height > 0;
+	};
+	for (const [kind, sel] of checks) {
+		if (Array.from(document.querySelectorAll(sel)).some(visible)) {
+			const el = document.querySelector("[data-sitekey]");
+			return {kind: kind, siteKey: el ? el.getAttribute("data-sitekey") : "", url: document.location.href};
+		}
+	}
+	return null;
+})()`
+
+const captchaInjectScript = `((kind, token) => {
+	const names = {
+		recaptcha: ["g-recaptcha-response"],
+		hcaptcha: ["h-captcha-response", "g-recaptcha-response"],
+		turnstile: ["cf-turnstile-response"]
+	};
+	for (const name of (names[kind] || [])) {
+		document.querySelectorAll("[name='" + name + "']").forEach((el) => { el.value = token; });
+	}
+	const el = document.querySelector("[data-callback]");
+	if (el && typeof window[el.getAttribute("data-callback")] === "function") {
+		window[el.getAttribute("data-callback")](token);
+	}
+	return true;
+})(%s, %s)`
+
+func (c *ChromeBrowser) detectCaptcha(ctx context.Context) *Captcha {
+
+	var captcha *Captcha
+	if err := chromedp.Evaluate(captchaDetectScript, &captcha).Do(ctx); err != nil {
+		c.logger.Debug("Couldn't detect captcha: %v", err)
+		return nil
+	}
+	return captcha
+}
+
+func (c *ChromeBrowser) solveCaptcha(ctx context.Context, captcha *Captcha) error {
+
+	token, err := c.options.CaptchaSolver.Solve(ctx, captcha)
+	if err != nil {
+		return err
+	}
+
+	kind, err := json.Marshal(captcha.Kind)
+	if err != nil {
+		return err
+	}
+	tok, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	if err := chromedp.Evaluate(fmt.Sprintf(captchaInjectScript, kind, tok), nil).Do(ctx); err != nil {
+		return err
+	}
+	captcha.Solved = true
+	return nil
+}
+
+// captchaAction detects captcha on the page and tries to solve it if solver is configured
+func (c *ChromeBrowser) captchaAction(r *BrowserImage) chromedp.ActionFunc {
+
+	return func(ctx context.Context) error {
+
+		r.Captcha = c.detectCaptcha(ctx)
+		if r.Captcha == nil || c.options.CaptchaSolver == nil {
+			return nil
+		}
+
+		if err := c.solveCaptcha(ctx, r.Captcha); err != nil {
+			c.logger.Warn("Couldn't solve %s captcha: %v", r.Captcha.Kind, err)
+			return nil
+		}
+
+		// let the page react on the token
+		if c.options.Delay > 0 {
+			return chromedp.Sleep(time.Duration(c.options.Delay) * time.Second).Do(ctx)
+		}
+		return nil
+	}
+}
+
+type HttpCaptchaSolver struct {
+	url    string
+	client *http.Client
+}
+
+type httpCaptchaSolverResponse struct {
+	Token string `json:"token"`
+}
+
+// Solve posts captcha as json to solver url and expects {"token": "..."} back
+func (s *HttpCaptchaSolver) Solve(ctx context.Context, captcha *Captcha) (string, error) {
+
+	body, err := json.Marshal(captcha)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("captcha solver returned %s", resp.Status)
+	}
+
+	var r httpCaptchaSolverResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", err
+	}
+	if r.Token == "" {
+		return "", errors.New("captcha solver returned empty token")
+	}
+	return r.Token, nil
+}
+
+func NewHttpCaptchaSolver(url string, timeout int) *HttpCaptchaSolver {
+
+	return &HttpCaptchaSolver{
+		url:    url,
+		client: utils.NewHttpClient(timeout, false),
+	}
+}
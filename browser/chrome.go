@@ -3,96 +3,294 @@ package browser
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/css"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/fetch"
 	"github.com/chromedp/cdproto/inspector"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/cdproto/page"
-	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/cdproto/tracing"
 	"github.com/chromedp/chromedp"
 	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
 	"github.com/devopsext/webrender/common"
 )
 
-type ChromeBrowserImage struct {
-	Data []byte
-	DOM  string
+type ChromeBrowser struct {
+	options BrowserOptions
+	pool    *ChromePool
+	idle    *chromeIdle
+	logger  sreCommon.Logger
+	meter   sreCommon.Meter
 }
 
-type ChromeBrowserOptions struct {
-	Width      int
-	Height     int
-	UserAgent  string
-	JsCode     string
-	Timeout    int
-	Delay      int
-	FullPage   bool
-	Path       string
-	Proxy      string
-	Headers    []string
-	HeadersMap map[string]interface{}
-
-	// http codes to screenshot (used as a filter)
-	ScreenshotCodes []int
-	AsPDF           bool
+// elementAction captures element matched by selector, missing element fails right away
+// instead of waiting for it till timeout
+func (c *ChromeBrowser) elementAction(r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		var nodes []*cdp.Node
+		if err := chromedp.Nodes(c.options.Selector, &nodes, chromedp.ByQuery, chromedp.AtLeast(0)).Do(ctx); err != nil {
+			return err
+		}
+		if len(nodes) == 0 {
+			return fmt.Errorf("%w: %s", ErrSelectorNotFound, c.options.Selector)
+		}
+		return chromedp.Screenshot(c.options.Selector, &r.Data, chromedp.ByQuery).Do(ctx)
+	})
 }
 
-type ChromeBrowser struct {
-	options ChromeBrowserOptions
-	logger  sreCommon.Logger
-	meter   sreCommon.Meter
+// debug logs at info level for debug renders, so one request is seen without global debug
+func (c *ChromeBrowser) debug(format string, args ...interface{}) {
+
+	if c.options.Debug {
+		c.logger.Info("[debug] "+format, args...)
+		return
+	}
+	c.logger.Debug(format, args...)
+}
+
+// domAction grabs outer html cut to max dom size
+func (c *ChromeBrowser) domAction(r *BrowserImage) chromedp.Action {
+
+	if c.options.MaxDOMSize <= 0 {
+		return chromedp.OuterHTML(":root", &r.DOM, chromedp.ByQueryAll)
+	}
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		script := fmt.Sprintf(`(() => {
+			const h = document.documentElement.outerHTML;
+			return {dom: h.substring(0, %d), truncated: h.length > %d};
+		})()`, c.options.MaxDOMSize, c.options.MaxDOMSize)
+
+		var res struct {
+			DOM       string `json:"dom"`
+			Truncated bool   `json:"truncated"`
+		}
+		if err := chromedp.Evaluate(script, &res).Do(ctx); err != nil {
+			return err
+		}
+		r.DOM = res.DOM
+		r.DOMTruncated = res.Truncated
+		return nil
+	})
 }
 
 // buildTasks builds the chromedp tasks slice
-func (c *ChromeBrowser) buildTasks(url *url.URL, doNavigate bool, buf *[]byte, dom *string) chromedp.Tasks {
+func (c *ChromeBrowser) buildTasks(url *url.URL, doNavigate bool, r *BrowserImage) chromedp.Tasks {
 	var actions chromedp.Tasks
+	// actions up to these are of navigation and of waits after it, capture ones follow
+	var navigationEnd, settleEnd int
 
 	if len(c.options.HeadersMap) > 0 {
 		actions = append(actions, network.Enable(), network.SetExtraHTTPHeaders(network.Headers(c.options.HeadersMap)))
 	}
 
+	switch c.options.BrowserCache {
+	case BrowserCacheDisabled:
+		actions = append(actions, network.Enable(), network.SetCacheDisabled(true))
+	case BrowserCacheBypass:
+		// hard reload, nothing from cache or service workers
+		actions = append(actions, network.Enable(), network.SetCacheDisabled(true), network.SetBypassServiceWorker(true))
+	}
+
+	if doNavigate && len(c.options.Cookies) > 0 {
+		actions = append(actions, network.Enable(), c.cookiesAction(url))
+	}
+
+	if doNavigate && c.hasWebStorage() {
+		actions = append(actions, c.webStorageAction(url))
+	}
+
+	if doNavigate && len(c.options.BlockedURLs) > 0 {
+		actions = append(actions, network.Enable(), network.SetBlockedURLS(c.options.BlockedURLs))
+	}
+
+	if doNavigate && c.options.ServiceWorkers != "" {
+		actions = append(actions, network.Enable(), c.serviceWorkersAction(url))
+	}
+
+	if doNavigate && len(c.options.Permissions) > 0 {
+		actions = append(actions, c.permissionsAction(url))
+	}
+
+	if doNavigate && c.hasUserAgentMetadata() {
+		actions = append(actions, c.userAgentAction())
+	}
+
+	if doNavigate && c.options.JsDisabled {
+		actions = append(actions, emulation.SetScriptExecutionDisabled(true))
+	}
+
+	if doNavigate && c.options.ColorScheme != "" {
+		actions = append(actions, emulation.SetEmulatedMedia().WithFeatures([]*emulation.MediaFeature{
+			{Name: "prefers-color-scheme", Value: c.options.ColorScheme},
+		}))
+	}
+
+	// pooled or remote process is shared, so window size and user agent are set per tab
+	if doNavigate && (c.pool != nil || c.options.RemoteURL != "") {
+		actions = append(actions, emulation.SetDeviceMetricsOverride(int64(c.options.Width), int64(c.options.Height), 1, false))
+		if c.options.UserAgent != "" && !c.hasUserAgentMetadata() {
+			actions = append(actions, emulation.SetUserAgentOverride(c.options.UserAgent))
+		}
+	}
+
+	// coverage is tracked from the very first script
+	cov := &chromeCoverage{sheets: make(map[css.StyleSheetID]*css.StyleSheetHeader)}
+	if doNavigate && c.options.Coverage {
+		actions = append(actions, c.startCoverageAction(cov))
+	}
+
+	tr := &chromeTrace{complete: make(chan *tracing.EventTracingComplete, 1)}
+	if doNavigate && c.options.Trace {
+		actions = append(actions, c.startTraceAction(tr))
+	}
+
+	// requests are paused till blocked or auth listener resolves them
+	auth := c.hasAuth() || c.hasProxyAuth()
+	if doNavigate && (c.intercepts() || auth) {
+		actions = append(actions, fetch.Enable().WithHandleAuthRequests(auth))
+	}
+
 	if doNavigate {
 		actions = append(actions, chromedp.Navigate(url.String()))
+		navigationEnd = len(actions)
+		if c.options.RequestFilter != nil {
+			actions = append(actions, c.hidingAction(url))
+		}
 		if len(c.options.JsCode) > 0 {
 			actions = append(actions, chromedp.Evaluate(c.options.JsCode, nil))
 		}
-		if c.options.Delay > 0 {
+		if !utils.IsEmpty(c.options.WaitExpression) {
+			actions = append(actions, c.waitExpressionAction(r))
+		}
+		// lazy content is requested by scroll, so idle and delay wait for it as well
+		if c.options.Scroll {
+			actions = append(actions, c.scrollAction())
+		}
+		// network idle replaces fixed delay
+		switch {
+		case c.waitNetworkIdle():
+			actions = append(actions, c.networkIdleAction(c.idle))
+		case c.options.Delay > 0:
 			actions = append(actions, chromedp.Sleep(time.Duration(c.options.Delay)*time.Second))
 		}
 		actions = append(actions, chromedp.Stop())
+		if len(c.options.ConsentSelectors) > 0 {
+			actions = append(actions, c.consentAction())
+		}
+		if c.options.Coverage {
+			actions = append(actions, c.takeCoverageAction(cov, r))
+		}
+		if c.options.Trace {
+			actions = append(actions, c.endTraceAction(tr, r))
+		}
+		if c.options.Memory || c.options.HeapSnapshot {
+			actions = append(actions, c.memoryAction(r))
+		}
+		if c.options.Performance {
+			actions = append(actions, c.performanceAction(r))
+		}
+		settleEnd = len(actions)
 	}
 
+	// look for captcha before grabbing anything
+	actions = append(actions, c.captchaAction(r))
+
 	// grab the dom
-	actions = append(actions, chromedp.OuterHTML(":root", dom, chromedp.ByQueryAll))
+	if c.options.CaptureDOM {
+		actions = append(actions, c.domAction(r))
+	}
+
+	if c.options.DOMSnapshot {
+		actions = append(actions, c.snapshotAction(r))
+	}
+
+	// flag chrome error pages and challenges
+	actions = append(actions, chromedp.ActionFunc(func(ctx context.Context) error {
+		if err := chromedp.Location(&r.FinalURL).Do(ctx); err != nil {
+			c.logger.Debug("Couldn't get location: %v", err)
+		}
+		r.Page, r.PageReason = c.detectPage(ctx)
+		if r.Page == "" && r.Captcha != nil && !r.Captcha.Solved {
+			r.Page, r.PageReason = PageChallenge, fmt.Sprintf("captcha %s", r.Captcha.Kind)
+		}
+		return nil
+	}))
+
+	if c.options.hasScrollTo() {
+		actions = append(actions, c.scrollToAction())
+	}
+
+	// boxes of asserted elements go to capture, not to dom
+	if len(c.options.AssertSelectors) > 0 {
+		actions = append(actions, c.assertSelectorsAction(r))
+	}
+
+	// svg replaces screenshot and pdf
+	if c.options.Format == FormatSVG {
+		actions = append(actions, c.svgAction(r))
+		return c.stageTasks(r, actions, navigationEnd, settleEnd)
+	}
 
 	// should we print as pdf?
 	if c.options.AsPDF {
+		actions = append(actions, c.printAction(r))
+
+		return c.stageTasks(r, actions, navigationEnd, settleEnd)
+	}
+
+	if c.options.Direction == DirectionHorizontal {
+		actions = append(actions, c.stitchAction(r))
+		return c.stageTasks(r, actions, navigationEnd, settleEnd)
+	}
+
+	// element is captured by its bounding box as png
+	if c.options.Selector != "" {
+		actions = append(actions, c.elementAction(r))
+		return c.stageTasks(r, actions, navigationEnd, settleEnd)
+	}
+
+	quality := c.options.Quality
+	if quality <= 0 || quality > 100 {
+		quality = 100
+	}
+
+	// otherwise screenshot as png, or jpeg if quality is lower than 100
+	switch {
+	case c.options.FullPage:
+		actions = append(actions, chromedp.FullScreenshot(&r.Data, quality))
+	case quality < 100:
 		actions = append(actions, chromedp.ActionFunc(func(ctx context.Context) error {
 			var err error
-			*buf, _, err = page.PrintToPDF().
-				WithDisplayHeaderFooter(true).
+			r.Data, err = page.CaptureScreenshot().
+				WithFormat(page.CaptureScreenshotFormatJpeg).
+				WithQuality(int64(quality)).
 				Do(ctx)
 			return err
 		}))
-
-		return actions
+	default:
+		actions = append(actions, chromedp.CaptureScreenshot(&r.Data))
 	}
 
-	// otherwise screenshot as png
-	if c.options.FullPage {
-		actions = append(actions, chromedp.FullScreenshot(buf, 100))
-	} else {
-		actions = append(actions, chromedp.CaptureScreenshot(buf))
-	}
-
-	return actions
+	return c.stageTasks(r, actions, navigationEnd, settleEnd)
 }
 
 // https://github.com/chromedp/examples/blob/255873ca0d76b00e0af8a951a689df3eb4f224c3/screenshot/main.go
-func (c *ChromeBrowser) Image(url *url.URL) (*ChromeBrowserImage, error) {
+func (c *ChromeBrowser) Image(ctx context.Context, url *url.URL) (_ *BrowserImage, err error) {
 
-	r := &ChromeBrowserImage{}
+	r := &BrowserImage{}
 
 	// setup chromedp default options
 	options := []chromedp.ExecAllocatorOption{}
@@ -102,18 +300,66 @@ func (c *ChromeBrowser) Image(url *url.URL) (*ChromeBrowserImage, error) {
 	options = append(options, chromedp.Flag("ignore-certificate-errors", true)) // RIP shittyproxy.go
 	options = append(options, chromedp.WindowSize(c.options.Width, c.options.Height))
 
-	if c.options.Path != "" {
-		options = append(options, chromedp.ExecPath(c.options.Path))
+	if path := discoverPath(BrowserKindChrome, c.options.Path); path != "" {
+		options = append(options, chromedp.ExecPath(path))
 	}
+	options = append(options, chromedp.ModifyCmdFunc(processAttr))
+	options = append(options, chromeEnvironment(c.options.Environment)...)
 
-	if c.options.Proxy != "" {
-		options = append(options, chromedp.ProxyServer(c.options.Proxy))
+	proxy, _, _ := proxyServer(c.options.Proxy)
+	if proxy != "" {
+		options = append(options, chromedp.ProxyServer(proxy))
 	}
 
-	actx, acancel := chromedp.NewExecAllocator(context.Background(), options...)
-	defer acancel()
-	browserCtx, cancelBrowserCtx := chromedp.NewContext(actx)
-	defer cancelBrowserCtx()
+	var browserCtx context.Context
+	var cancelBrowserCtx context.CancelFunc
+	var crashed atomic.Bool
+
+	// pooled process is shared by renders, so its messages aren't recorded
+	var contextOptions []chromedp.ContextOption
+	if c.options.RecordDir != "" && c.pool == nil {
+		rec, err := newCDPRecorder(c.options.RecordDir, url)
+		if err != nil {
+			c.logger.Error("Couldn't record cdp session: %v", err)
+		} else {
+			defer rec.close()
+			c.debug("Recording cdp session to %s", rec.path)
+			contextOptions = append(contextOptions, chromedp.WithBrowserOption(chromedp.WithBrowserDebugf(rec.debugf)))
+		}
+	}
+
+	switch {
+	case c.options.RemoteURL != "":
+		// remote chrome is shared, so every render gets its own browser context
+		actx, acancel := chromedp.NewRemoteAllocator(ctx, c.options.RemoteURL)
+		defer acancel()
+		connCtx, cancelConnCtx := chromedp.NewContext(actx, contextOptions...)
+		defer cancelConnCtx()
+		if err := chromedp.Run(connCtx); err != nil {
+			return nil, fmt.Errorf("couldn't connect to remote chrome: %w", err)
+		}
+		// proxy of remote chrome is set per browser context
+		browserCtx, cancelBrowserCtx = chromedp.NewContext(connCtx, chromedp.WithNewBrowserContext(func(p *target.CreateBrowserContextParams) *target.CreateBrowserContextParams {
+			if proxy != "" {
+				return p.WithProxyServer(proxy)
+			}
+			return p
+		}))
+		defer cancelBrowserCtx()
+	case c.pool != nil:
+		tabCtx, cancel, release, err := c.pool.tab(ctx, c.options)
+		if err != nil {
+			return nil, err
+		}
+		// error is what pool tells failing instance by
+		defer func() { release(err) }()
+		browserCtx, cancelBrowserCtx = tabCtx, cancel
+	default:
+		actx, acancel := chromedp.NewExecAllocator(ctx, options...)
+		defer acancel()
+		browserCtx, cancelBrowserCtx = chromedp.NewContext(actx, contextOptions...)
+		defer cancelBrowserCtx()
+	}
 
 	// create the initial context to act as the 'tab', where we will perform the initial navigation
 	// if this context loads successfully, then the screenshot will have been captured
@@ -132,12 +378,14 @@ func (c *ChromeBrowser) Image(url *url.URL) (*ChromeBrowserImage, error) {
 	// prevent browser crashes from locking the context (prevents hanging)
 	chromedp.ListenTarget(browserCtx, func(ev interface{}) {
 		if _, ok := ev.(*inspector.EventTargetCrashed); ok {
+			crashed.Store(true)
 			cancelBrowserCtx()
 		}
 	})
 
 	chromedp.ListenTarget(tabCtx, func(ev interface{}) {
 		if _, ok := ev.(*inspector.EventTargetCrashed); ok {
+			crashed.Store(true)
 			cancelTabCtx()
 		}
 	})
@@ -155,47 +403,84 @@ func (c *ChromeBrowser) Image(url *url.URL) (*ChromeBrowserImage, error) {
 		}
 	})
 
-	// log console.* events, as well as any thrown exceptions
-	chromedp.ListenTarget(tabCtx, func(ev interface{}) {
-		switch ev := ev.(type) {
-		case *runtime.EventConsoleAPICalled:
+	// log console.* events, thrown exceptions and network events kept by event log filter
+	chromedp.ListenTarget(tabCtx, c.logEvent)
+
+	// keep a keyed reference so we can map network logs to requestid's and
+	// update them as responses are received
+	var navMutex sync.Mutex
+	var navRequestID network.RequestID
+	navErrorText := ""
+	navStatus := 0
 
-			// use a buffer to read each arg passed to the console.* call
-			c.logger.Debug("%v", ev)
+	wf := newChromeWaterfall()
+	har := newChromeHar(url.String())
+
+	c.idle = newChromeIdle()
+	if c.waitNetworkIdle() {
+		chromedp.ListenTarget(tabCtx, c.idle.listen)
+	}
 
-		case *runtime.EventExceptionThrown:
-		default:
-			//c.logger.Debug("%v", ev)
+	console := newChromeConsole()
+	if c.options.Console {
+		chromedp.ListenTarget(tabCtx, console.listen)
+	}
+	if c.options.Events != nil {
+		console.events = c.options.Events
+		chromedp.ListenTarget(tabCtx, c.pageEvents)
+		if !c.options.Console {
+			chromedp.ListenTarget(tabCtx, console.listen)
 		}
-	})
+	}
 
-	// keep a keyed reference so we can map network logs to requestid's and
-	// update them as responses are received
+	blocked := newChromeBlocked()
+	if c.intercepts() {
+		c.listenBlocked(tabCtx, url, blocked)
+	}
+	if c.hasAuth() || c.hasProxyAuth() {
+		c.listenAuth(tabCtx, url, !c.intercepts())
+	}
 
 	// log network events
 	chromedp.ListenTarget(tabCtx, func(ev interface{}) {
+		if c.options.Waterfall {
+			wf.listen(ev)
+		}
+		if c.options.Har {
+			har.listen(ev)
+		}
 		switch ev := ev.(type) {
 		// http
 		case *network.EventRequestWillBeSent:
 			// record a fresh request that will be sent
-			c.logger.Debug("%v", ev)
+			navMutex.Lock()
+			if navRequestID == "" && ev.Type == network.ResourceTypeDocument {
+				navRequestID = ev.RequestID
+			}
+			navMutex.Unlock()
 		case *network.EventResponseReceived:
 			// update the networkLog map with updated information about response
-			c.logger.Debug("%v", ev)
+			navMutex.Lock()
+			if ev.RequestID == navRequestID && ev.Response != nil {
+				navStatus = int(ev.Response.Status)
+			}
+			navMutex.Unlock()
 		case *network.EventLoadingFailed:
 			// update the network map with the error experienced
-			c.logger.Debug("%v", ev)
-		// websockets
-		case *network.EventWebSocketCreated:
-		case *network.EventWebSocketHandshakeResponseReceived:
-		case *network.EventWebSocketFrameError:
-		default:
-			// c.logger.Debug("%v", ev)
+			navMutex.Lock()
+			if ev.RequestID == navRequestID {
+				navErrorText = ev.ErrorText
+			}
+			navMutex.Unlock()
 		}
 	})
 
 	// perform navigation on the tab context and attempt to take a clean screenshot
-	err := chromedp.Run(tabCtx, c.buildTasks(url, true, &r.Data, &r.DOM))
+	err = chromedp.Run(tabCtx, c.buildTasks(url, true, r))
+
+	if errors.Is(err, context.DeadlineExceeded) && !c.options.Partial {
+		return nil, fmt.Errorf("timeout exceeded: %w", err)
+	}
 
 	if errors.Is(err, context.DeadlineExceeded) {
 		// if the context timeout exceeded (e.g. on a long page load) then
@@ -211,24 +496,75 @@ func (c *ChromeBrowser) Image(url *url.URL) (*ChromeBrowserImage, error) {
 		// listen for crashes on this backup context as well
 		chromedp.ListenTarget(newTabCtx, func(ev interface{}) {
 			if _, ok := ev.(*inspector.EventTargetCrashed); ok {
+				crashed.Store(true)
 				cancelNewTabCtx()
 			}
 		})
 
+		// fetch stays enabled on the tab while listeners of expired context are gone, paused
+		// requests are resolved on this one so they are still filtered and capture doesn't hang
+		if c.intercepts() {
+			c.listenBlocked(newTabCtx, url, blocked)
+		}
+		if c.hasAuth() || c.hasProxyAuth() {
+			c.listenAuth(newTabCtx, url, !c.intercepts())
+		}
+
+		// requests of expired tab are never finished, so idle is tracked anew
+		c.idle = newChromeIdle()
+
 		// attempt to capture the screenshot of the tab and replace error accordingly
-		err = chromedp.Run(newTabCtx, c.buildTasks(url, false, &r.Data, &r.DOM))
+		err = chromedp.Run(newTabCtx, c.buildTasks(url, false, r))
+		r.Partial = true
+	}
+
+	if crashed.Load() {
+		return nil, fmt.Errorf("%w: %v", ErrCrashed, err)
+	}
+
+	// classify main document failures, chrome renders its own error page otherwise
+	navMutex.Lock()
+	navErr := newNavigationError(navErrorText)
+	r.Status = navStatus
+	navMutex.Unlock()
+
+	if c.options.Waterfall {
+		r.Waterfall = wf.list()
+	}
+	if c.options.Har {
+		r.Har = har.har()
+	}
+	if c.options.Console {
+		r.Console = console.list()
+	}
+	r.Blocked = blocked.list()
+
+	if err != nil && navErr == nil {
+		navErr = newNavigationError(err.Error())
+	}
+
+	if navErr != nil {
+		return nil, navErr
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
+	if len(c.options.ScreenshotCodes) > 0 && r.Status > 0 && !utils.Contains(c.options.ScreenshotCodes, r.Status) {
+		return nil, &StatusError{Status: r.Status}
+	}
+
 	// close the tab so that we dont receive more network events
 	cancelTabCtx()
 	return r, nil
 }
 
-func NewChromeBrowser(options ChromeBrowserOptions, observability *common.Observability) *ChromeBrowser {
+func (c *ChromeBrowser) Kind() string {
+	return BrowserKindChrome
+}
+
+func NewChromeBrowser(options BrowserOptions, observability *common.Observability) Browser {
 
 	return &ChromeBrowser{
 		options: options,
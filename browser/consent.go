@@ -0,0 +1,45 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// consentScript clicks first visible element of selectors
+const consentScript = `((selectors) => {
+	for (const s of selectors) {
+		const el = document.querySelector(s);
+		if (el && el.offsetParent !== null) {
+			el.click();
+			return s;
+		}
+	}
+	return "";
+})(%s)`
+
+// consentAction dismisses consent banners, page is given a second to settle after click
+func (c *ChromeBrowser) consentAction() chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		selectors, err := json.Marshal(c.options.ConsentSelectors)
+		if err != nil {
+			return err
+		}
+
+		var clicked string
+		if err := chromedp.Evaluate(fmt.Sprintf(consentScript, selectors), &clicked).Do(ctx); err != nil {
+			return err
+		}
+		if clicked == "" {
+			return nil
+		}
+
+		c.logger.Debug("Consent clicked by %s", clicked)
+		return chromedp.Sleep(time.Second).Do(ctx)
+	})
+}
@@ -0,0 +1,168 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+)
+
+const (
+	consoleMaxMessages = 500
+	consoleMaxText     = 2000
+)
+
+// ConsoleMessage is console api call or uncaught exception of page, lines are 1-based
+type ConsoleMessage struct {
+	Type   string    `json:"type"`
+	Text   string    `json:"text"`
+	URL    string    `json:"url,omitempty"`
+	Line   int64     `json:"line,omitempty"`
+	Column int64     `json:"column,omitempty"`
+	Stack  []string  `json:"stack,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// ConsoleTypeException is type of uncaught exception messages, others are console api ones
+const ConsoleTypeException = "exception"
+
+type chromeConsole struct {
+	mutex    sync.Mutex
+	messages []*ConsoleMessage
+	dropped  int
+	// errors and exceptions are told to followers of render
+	events EventFunc
+}
+
+// consoleArg turns console call argument into text, strings are taken unquoted
+func consoleArg(arg *runtime.RemoteObject) string {
+
+	if arg == nil {
+		return ""
+	}
+	if len(arg.Value) > 0 {
+		var s string
+		if err := json.Unmarshal(arg.Value, &s); err == nil {
+			return s
+		}
+		return string(arg.Value)
+	}
+	if arg.UnserializableValue != "" {
+		return string(arg.UnserializableValue)
+	}
+	if arg.Description != "" {
+		return arg.Description
+	}
+	return arg.Type.String()
+}
+
+func consoleStack(trace *runtime.StackTrace) []string {
+
+	if trace == nil {
+		return nil
+	}
+	var r []string
+	for _, f := range trace.CallFrames {
+		name := f.FunctionName
+		if name == "" {
+			name = "(anonymous)"
+		}
+		r = append(r, fmt.Sprintf("%s %s:%d:%d", name, f.URL, f.LineNumber+1, f.ColumnNumber+1))
+	}
+	return r
+}
+
+func consoleTime(t *runtime.Timestamp) time.Time {
+
+	if t == nil {
+		return time.Now().UTC()
+	}
+	return t.Time().UTC()
+}
+
+func (c *chromeConsole) add(m *ConsoleMessage) {
+
+	if len(m.Text) > consoleMaxText {
+		m.Text = m.Text[:consoleMaxText]
+	}
+	if m.Type == "error" || m.Type == ConsoleTypeException {
+		c.events.Event(RenderEventConsole, "%s: %s", m.Type, m.Text)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.messages) >= consoleMaxMessages {
+		c.dropped++
+		return
+	}
+	c.messages = append(c.messages, m)
+}
+
+func (c *chromeConsole) listen(ev interface{}) {
+
+	switch ev := ev.(type) {
+	case *runtime.EventConsoleAPICalled:
+		var args []string
+		for _, arg := range ev.Args {
+			args = append(args, consoleArg(arg))
+		}
+		m := &ConsoleMessage{
+			Type:  ev.Type.String(),
+			Text:  strings.Join(args, " "),
+			Stack: consoleStack(ev.StackTrace),
+			Time:  consoleTime(ev.Timestamp),
+		}
+		if ev.StackTrace != nil && len(ev.StackTrace.CallFrames) > 0 {
+			f := ev.StackTrace.CallFrames[0]
+			m.URL = f.URL
+			m.Line = f.LineNumber + 1
+			m.Column = f.ColumnNumber + 1
+		}
+		c.add(m)
+
+	case *runtime.EventExceptionThrown:
+		d := ev.ExceptionDetails
+		if d == nil {
+			return
+		}
+		// exception description has message and stack, text is just "Uncaught"
+		text := d.Text
+		if d.Exception != nil && d.Exception.Description != "" {
+			text = d.Exception.Description
+		}
+		c.add(&ConsoleMessage{
+			Type:   ConsoleTypeException,
+			Text:   text,
+			URL:    d.URL,
+			Line:   d.LineNumber + 1,
+			Column: d.ColumnNumber + 1,
+			Stack:  consoleStack(d.StackTrace),
+			Time:   consoleTime(ev.Timestamp),
+		})
+	}
+}
+
+// list returns messages in order they came, messages over limit are told of by last one
+func (c *chromeConsole) list() []*ConsoleMessage {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	r := append([]*ConsoleMessage{}, c.messages...)
+	if c.dropped > 0 {
+		r = append(r, &ConsoleMessage{
+			Type: "warning",
+			Text: fmt.Sprintf("%d more messages are dropped", c.dropped),
+			Time: time.Now().UTC(),
+		})
+	}
+	return r
+}
+
+func newChromeConsole() *chromeConsole {
+	return &chromeConsole{}
+}
@@ -0,0 +1,24 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// cookiesAction sets cookies for url before navigation
+func (c *ChromeBrowser) cookiesAction(u *url.URL) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		for name, value := range c.options.Cookies {
+			if err := network.SetCookie(name, value).WithURL(u.String()).Do(ctx); err != nil {
+				return fmt.Errorf("couldn't set cookie %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
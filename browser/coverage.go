@@ -0,0 +1,142 @@
+package browser
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/chromedp/cdproto/css"
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/profiler"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	CoverageJS  = "js"
+	CoverageCSS = "css"
+)
+
+// Coverage is used and total bytes of script or stylesheet
+type Coverage struct {
+	URL   string `json:"url"`
+	Type  string `json:"type"`
+	Total int64  `json:"total"`
+	Used  int64  `json:"used"`
+}
+
+type chromeCoverage struct {
+	sheets map[css.StyleSheetID]*css.StyleSheetHeader
+	mutex  sync.Mutex
+}
+
+// startCoverageAction enables precise js coverage and css rule tracking before navigation
+func (c *ChromeBrowser) startCoverageAction(cov *chromeCoverage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		// stylesheet sizes are known from their headers only
+		chromedp.ListenTarget(ctx, func(ev interface{}) {
+			if e, ok := ev.(*css.EventStyleSheetAdded); ok && e.Header != nil {
+				cov.mutex.Lock()
+				cov.sheets[e.Header.StyleSheetID] = e.Header
+				cov.mutex.Unlock()
+			}
+		})
+
+		if err := profiler.Enable().Do(ctx); err != nil {
+			return err
+		}
+		if _, err := profiler.StartPreciseCoverage().WithCallCount(false).WithDetailed(true).Do(ctx); err != nil {
+			return err
+		}
+		if err := dom.Enable().Do(ctx); err != nil {
+			return err
+		}
+		if err := css.Enable().Do(ctx); err != nil {
+			return err
+		}
+		return css.StartRuleUsageTracking().Do(ctx)
+	})
+}
+
+// scriptUsed counts bytes of executed ranges, nested ranges override their parents
+func scriptUsed(s *profiler.ScriptCoverage) (int64, int64) {
+
+	var ranges []*profiler.CoverageRange
+	total := int64(0)
+	for _, f := range s.Functions {
+		for _, r := range f.Ranges {
+			ranges = append(ranges, r)
+			if r.EndOffset > total {
+				total = r.EndOffset
+			}
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].StartOffset != ranges[j].StartOffset {
+			return ranges[i].StartOffset < ranges[j].StartOffset
+		}
+		return ranges[i].EndOffset > ranges[j].EndOffset
+	})
+
+	used := make([]bool, total)
+	for _, r := range ranges {
+		for i := r.StartOffset; i < r.EndOffset; i++ {
+			used[i] = r.Count > 0
+		}
+	}
+
+	n := int64(0)
+	for _, u := range used {
+		if u {
+			n++
+		}
+	}
+	return total, n
+}
+
+// takeCoverageAction collects coverage, it's skipped if tracking wasn't started in this tab
+func (c *ChromeBrowser) takeCoverageAction(cov *chromeCoverage, r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		scripts, _, err := profiler.TakePreciseCoverage().Do(ctx)
+		if err != nil {
+			c.logger.Debug("Couldn't take js coverage: %v", err)
+			return nil
+		}
+		for _, s := range scripts {
+			// evaluated snippets have no url
+			if s.URL == "" {
+				continue
+			}
+			total, used := scriptUsed(s)
+			r.Coverage = append(r.Coverage, &Coverage{URL: s.URL, Type: CoverageJS, Total: total, Used: used})
+		}
+
+		rules, err := css.StopRuleUsageTracking().Do(ctx)
+		if err != nil {
+			c.logger.Debug("Couldn't take css coverage: %v", err)
+			return nil
+		}
+
+		used := make(map[css.StyleSheetID]int64)
+		for _, u := range rules {
+			if u.Used {
+				used[u.StyleSheetID] += int64(u.EndOffset - u.StartOffset)
+			}
+		}
+
+		cov.mutex.Lock()
+		defer cov.mutex.Unlock()
+		for id, h := range cov.sheets {
+			u := &Coverage{URL: h.SourceURL, Type: CoverageCSS, Total: int64(h.Length), Used: used[id]}
+			if u.Used > u.Total {
+				u.Used = u.Total
+			}
+			r.Coverage = append(r.Coverage, u)
+		}
+		return nil
+	})
+}
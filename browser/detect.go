@@ -0,0 +1,93 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	PageError     = "error"
+	PageChallenge = "challenge"
+)
+
+// pageTextScript is title and visible text of page, markup and scripts don't match texts
+const pageTextScript = `document.title + "\n" + (document.body ? document.body.innerText : "")`
+
+func (c *ChromeBrowser) hasSelector(ctx context.Context, selector string) bool {
+
+	sel, err := json.Marshal(selector)
+	if err != nil {
+		return false
+	}
+
+	found := false
+	err = chromedp.Evaluate(fmt.Sprintf("document.querySelector(%s) !== null", sel), &found).Do(ctx)
+	if err != nil {
+		c.logger.Debug("Couldn't check selector %s: %v", selector, err)
+		return false
+	}
+	return found
+}
+
+func findText(text string, texts []string) string {
+
+	lower := strings.ToLower(text)
+	for _, t := range texts {
+		if strings.Contains(lower, strings.ToLower(t)) {
+			return t
+		}
+	}
+	return ""
+}
+
+func (c *ChromeBrowser) findSelector(ctx context.Context, selectors []string) string {
+
+	for _, s := range selectors {
+		if c.hasSelector(ctx, s) {
+			return s
+		}
+	}
+	return ""
+}
+
+// detectPage returns page kind and reason if the page looks like an error or challenge,
+// texts are matched against page text, so it works without dom capture
+func (c *ChromeBrowser) detectPage(ctx context.Context) (string, string) {
+
+	href := ""
+	if err := chromedp.Evaluate("document.location.href", &href).Do(ctx); err != nil {
+		c.logger.Debug("Couldn't get location: %v", err)
+	}
+
+	if strings.HasPrefix(href, "chrome-error://") || c.hasSelector(ctx, "#main-frame-error") {
+		return PageError, "chrome error page"
+	}
+
+	text := ""
+	if len(c.options.ChallengeTexts) > 0 || len(c.options.ErrorTexts) > 0 {
+		if err := chromedp.Evaluate(pageTextScript, &text).Do(ctx); err != nil {
+			c.logger.Debug("Couldn't get page text: %v", err)
+		}
+	}
+
+	if s := c.findSelector(ctx, c.options.ChallengeSelectors); s != "" {
+		return PageChallenge, fmt.Sprintf("selector %s", s)
+	}
+
+	if t := findText(text, c.options.ChallengeTexts); t != "" {
+		return PageChallenge, fmt.Sprintf("text %s", t)
+	}
+
+	if s := c.findSelector(ctx, c.options.ErrorSelectors); s != "" {
+		return PageError, fmt.Sprintf("selector %s", s)
+	}
+
+	if t := findText(text, c.options.ErrorTexts); t != "" {
+		return PageError, fmt.Sprintf("text %s", t)
+	}
+	return "", ""
+}
@@ -0,0 +1,28 @@
+package browser
+
+import (
+	"os"
+	"os/exec"
+)
+
+// discoverPath returns configured path or the first browser of kind found by platform conventions,
+// empty path of chrome is left to chromedp lookup
+func discoverPath(kind, path string) string {
+
+	if path != "" {
+		return path
+	}
+	for _, location := range browserLocations(kind) {
+		if location == "" {
+			continue
+		}
+		if found, err := exec.LookPath(location); err == nil {
+			return found
+		}
+		// bundles and install dirs aren't in PATH, LookPath takes names only there
+		if info, err := os.Stat(location); err == nil && !info.IsDir() {
+			return location
+		}
+	}
+	return ""
+}
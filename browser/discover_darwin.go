@@ -0,0 +1,38 @@
+package browser
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// browserLocations are app bundles of system and user applications
+func browserLocations(kind string) []string {
+
+	var apps []string
+	switch kind {
+	case BrowserKindChrome:
+		apps = []string{
+			"Google Chrome.app/Contents/MacOS/Google Chrome",
+			"Chromium.app/Contents/MacOS/Chromium",
+			"Google Chrome Canary.app/Contents/MacOS/Google Chrome Canary",
+		}
+	case BrowserKindFirefox:
+		apps = []string{
+			"Firefox.app/Contents/MacOS/firefox",
+			"Firefox Nightly.app/Contents/MacOS/firefox",
+		}
+	}
+
+	dirs := []string{"/Applications"}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, "Applications"))
+	}
+
+	var locations []string
+	for _, dir := range dirs {
+		for _, app := range apps {
+			locations = append(locations, filepath.Join(dir, app))
+		}
+	}
+	return locations
+}
@@ -0,0 +1,18 @@
+//go:build !darwin && !windows
+
+package browser
+
+// browserLocations of chrome are left to chromedp, firefox is packaged under several names
+func browserLocations(kind string) []string {
+
+	if kind != BrowserKindFirefox {
+		return nil
+	}
+	return []string{
+		"firefox",
+		"firefox-esr",
+		"/usr/lib/firefox/firefox",
+		"/usr/lib/firefox-esr/firefox-esr",
+		"/snap/bin/firefox",
+	}
+}
@@ -0,0 +1,54 @@
+package browser
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// appPath reads install path registered by browser installer for machine or user
+func appPath(exe string) []string {
+
+	var paths []string
+	for _, root := range []registry.Key{registry.LOCAL_MACHINE, registry.CURRENT_USER} {
+		k, err := registry.OpenKey(root, `SOFTWARE\Microsoft\Windows\CurrentVersion\App Paths\`+exe, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		if v, _, err := k.GetStringValue(""); err == nil && v != "" {
+			paths = append(paths, v)
+		}
+		k.Close()
+	}
+	return paths
+}
+
+// browserLocations are registered install paths, then default install dirs of machine and user
+func browserLocations(kind string) []string {
+
+	var exe string
+	var dirs []string
+	switch kind {
+	case BrowserKindChrome:
+		exe = "chrome.exe"
+		dirs = []string{`Google\Chrome\Application`, `Chromium\Application`}
+	case BrowserKindFirefox:
+		exe = "firefox.exe"
+		dirs = []string{`Mozilla Firefox`, `Firefox Nightly`}
+	default:
+		return nil
+	}
+
+	locations := appPath(exe)
+	for _, env := range []string{"ProgramFiles", "ProgramFiles(x86)", "LOCALAPPDATA"} {
+		root := os.Getenv(env)
+		if root == "" {
+			continue
+		}
+		for _, dir := range dirs {
+			locations = append(locations, filepath.Join(root, dir, exe))
+		}
+	}
+	return append(locations, exe)
+}
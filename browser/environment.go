@@ -0,0 +1,104 @@
+package browser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	EnvironmentDefault   = ""
+	EnvironmentContainer = "container"
+)
+
+var Environments = []string{EnvironmentDefault, EnvironmentContainer}
+
+// fontDirs are font locations of debian, alpine and distroless images
+var fontDirs = []string{
+	"/usr/share/fonts",
+	"/usr/local/share/fonts",
+	"/usr/share/fonts-droid",
+	"/opt/fonts",
+}
+
+var (
+	fontConfigOnce sync.Once
+	fontConfigFile string
+)
+
+// containerFontConfig writes fontconfig file of present font dirs when image has none of its own,
+// distroless and alpine images ship fonts without config, so pages render with no glyphs
+func containerFontConfig() string {
+
+	fontConfigOnce.Do(func() {
+
+		if os.Getenv("FONTCONFIG_FILE") != "" || os.Getenv("FONTCONFIG_PATH") != "" {
+			return
+		}
+		if _, err := os.Stat("/etc/fonts/fonts.conf"); err == nil {
+			return
+		}
+
+		var b strings.Builder
+		b.WriteString("<?xml version=\"1.0\"?>\n<!DOCTYPE fontconfig SYSTEM \"fonts.dtd\">\n<fontconfig>\n")
+		for _, dir := range fontDirs {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				fmt.Fprintf(&b, "  <dir>%s</dir>\n", dir)
+			}
+		}
+		fmt.Fprintf(&b, "  <cachedir>%s</cachedir>\n</fontconfig>\n", filepath.Join(os.TempDir(), "webrender-fontconfig"))
+
+		path := filepath.Join(os.TempDir(), "webrender-fonts.conf")
+		if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+			return
+		}
+		fontConfigFile = path
+	})
+	return fontConfigFile
+}
+
+// containerEnv gives browser writable home and fonts, container users often have neither
+func containerEnv() []string {
+
+	var env []string
+	if home, err := os.UserHomeDir(); err != nil || !writable(home) {
+		env = append(env, "HOME="+os.TempDir())
+	}
+	if file := containerFontConfig(); file != "" {
+		env = append(env, "FONTCONFIG_FILE="+file)
+	}
+	return env
+}
+
+func writable(dir string) bool {
+
+	f, err := os.CreateTemp(dir, ".webrender-")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
+// chromeEnvironment are flags of environment, containers have no user namespaces for sandbox
+// and zygote, crash reporter needs database dir which read only images lack
+func chromeEnvironment(environment string) []chromedp.ExecAllocatorOption {
+
+	if environment != EnvironmentContainer {
+		return nil
+	}
+	return []chromedp.ExecAllocatorOption{
+		chromedp.NoSandbox,
+		chromedp.Flag("no-zygote", true),
+		chromedp.Flag("disable-crash-reporter", true),
+		chromedp.Flag("crash-dumps-dir", os.TempDir()),
+		chromedp.Flag("disable-software-rasterizer", true),
+		chromedp.Flag("font-render-hinting", "none"),
+		chromedp.Env(containerEnv()...),
+	}
+}
@@ -0,0 +1,153 @@
+package browser
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+const (
+	NavigationErrorDNS               = "dns_error"
+	NavigationErrorConnectionRefused = "connection_refused"
+	NavigationErrorConnectionReset   = "connection_reset"
+	NavigationErrorConnectionTimeout = "connection_timeout"
+	NavigationErrorTLS               = "tls_error"
+	NavigationErrorBlockedByClient   = "blocked_by_client"
+	NavigationErrorAborted           = "aborted"
+	NavigationErrorUnknown           = "unknown"
+)
+
+// ErrCrashed is returned when browser or tab crashed during rendering
+var ErrCrashed = errors.New("browser crashed")
+
+// ErrSelectorNotFound is returned when page has no element to capture
+var ErrSelectorNotFound = errors.New("selector not found")
+
+// ErrDeniedHost is returned when request goes to host of host filter e.g. internal one
+var ErrDeniedHost = errors.New("host is denied")
+
+// ErrNothingToStitch is returned when horizontal capture finds no element scrolling horizontally
+var ErrNothingToStitch = errors.New("nothing scrolls horizontally")
+
+type NavigationError struct {
+	Code string
+	Text string
+}
+
+// StatusError is returned when main document status isn't in screenshot codes
+type StatusError struct {
+	Status int
+}
+
+var netErrorRegexp = regexp.MustCompile(`net::ERR_[A-Z0-9_]+`)
+var firefoxErrorRegexp = regexp.MustCompile(`about:(neterror|certerror)\?e=([A-Za-z0-9]+)`)
+
+func (e *NavigationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Text)
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d is not in screenshot codes", e.Status)
+}
+
+// NavigationErrorCode maps chrome net::ERR_* text to a stable error code
+func NavigationErrorCode(text string) string {
+
+	s := strings.TrimPrefix(netErrorRegexp.FindString(text), "net::ERR_")
+	switch {
+	case s == "":
+		return NavigationErrorUnknown
+	case s == "NAME_NOT_RESOLVED", s == "NAME_RESOLUTION_FAILED", strings.HasPrefix(s, "DNS_"):
+		return NavigationErrorDNS
+	case s == "CONNECTION_REFUSED":
+		return NavigationErrorConnectionRefused
+	case s == "CONNECTION_RESET", s == "CONNECTION_CLOSED", s == "EMPTY_RESPONSE":
+		return NavigationErrorConnectionReset
+	case s == "CONNECTION_TIMED_OUT", s == "TIMED_OUT":
+		return NavigationErrorConnectionTimeout
+	case strings.HasPrefix(s, "CERT_"), strings.HasPrefix(s, "SSL_"), strings.HasPrefix(s, "BAD_SSL_"):
+		return NavigationErrorTLS
+	case s == "BLOCKED_BY_CLIENT", s == "BLOCKED_BY_ADMINISTRATOR", s == "BLOCKED_BY_RESPONSE":
+		return NavigationErrorBlockedByClient
+	case s == "ABORTED":
+		return NavigationErrorAborted
+	}
+	return NavigationErrorUnknown
+}
+
+// newNavigationError returns nil if text doesn't contain chrome net error
+func newNavigationError(text string) *NavigationError {
+
+	s := netErrorRegexp.FindString(text)
+	if s == "" {
+		return nil
+	}
+	return &NavigationError{
+		Code: NavigationErrorCode(s),
+		Text: s,
+	}
+}
+
+// newFirefoxNavigationError maps firefox about:neterror page to chrome error codes, returns nil if there is none
+func newFirefoxNavigationError(text string) *NavigationError {
+
+	m := firefoxErrorRegexp.FindStringSubmatch(text)
+	if m == nil {
+		return nil
+	}
+
+	code := NavigationErrorUnknown
+	switch e := m[2]; {
+	case m[1] == "certerror", strings.HasPrefix(e, "nss"), strings.HasPrefix(e, "cert"):
+		code = NavigationErrorTLS
+	case e == "dnsNotFound":
+		code = NavigationErrorDNS
+	case e == "connectionFailure":
+		code = NavigationErrorConnectionRefused
+	case e == "netReset", e == "netInterrupt":
+		code = NavigationErrorConnectionReset
+	case e == "netTimeout":
+		code = NavigationErrorConnectionTimeout
+	case e == "blockedByPolicy":
+		code = NavigationErrorBlockedByClient
+	}
+	return &NavigationError{
+		Code: code,
+		Text: m[0],
+	}
+}
+
+// newHttpNavigationError maps go http client errors to chrome error codes, returns nil if there is none
+func newHttpNavigationError(err error) *NavigationError {
+
+	var dnsErr *net.DNSError
+	var certErr *x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var netErr net.Error
+
+	code := ""
+	switch {
+	case errors.As(err, &dnsErr):
+		code = NavigationErrorDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		code = NavigationErrorConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		code = NavigationErrorConnectionReset
+	case errors.As(err, &certErr), errors.As(err, &hostErr), strings.Contains(err.Error(), "tls:"):
+		code = NavigationErrorTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		code = NavigationErrorConnectionTimeout
+	case errors.Is(err, errBlockedDomain):
+		code = NavigationErrorBlockedByClient
+	default:
+		return nil
+	}
+	return &NavigationError{
+		Code: code,
+		Text: err.Error(),
+	}
+}
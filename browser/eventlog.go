@@ -0,0 +1,111 @@
+package browser
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/runtime"
+)
+
+// event types logged by chrome listeners, errors are 4xx and 5xx responses,
+// failures are requests which didn't get any response
+const (
+	EventLogConsole    = "console"
+	EventLogExceptions = "exceptions"
+	EventLogRequests   = "requests"
+	EventLogResponses  = "responses"
+	EventLogErrors     = "errors"
+	EventLogFailures   = "failures"
+	EventLogWebSockets = "websockets"
+)
+
+var eventLogTypes = []string{EventLogConsole, EventLogExceptions, EventLogRequests, EventLogResponses,
+	EventLogErrors, EventLogFailures, EventLogWebSockets}
+
+// EventLogViolations reports unknown event log types
+func EventLogViolations(types []string) []string {
+
+	var v []string
+	for _, t := range types {
+		known := false
+		for _, k := range eventLogTypes {
+			if strings.EqualFold(t, k) {
+				known = true
+			}
+		}
+		if !known {
+			v = append(v, fmt.Sprintf("event log type %s is unknown", t))
+		}
+	}
+	return v
+}
+
+// eventTypes tells which log types event is of, nil is for events which aren't logged
+func eventTypes(ev interface{}) []string {
+
+	switch ev := ev.(type) {
+	case *runtime.EventConsoleAPICalled:
+		return []string{EventLogConsole}
+	case *runtime.EventExceptionThrown:
+		return []string{EventLogExceptions}
+	case *network.EventRequestWillBeSent:
+		return []string{EventLogRequests}
+	case *network.EventResponseReceived:
+		if ev.Response != nil && ev.Response.Status >= 400 {
+			return []string{EventLogResponses, EventLogErrors}
+		}
+		return []string{EventLogResponses}
+	case *network.EventLoadingFailed:
+		return []string{EventLogFailures}
+	case *network.EventWebSocketCreated, *network.EventWebSocketHandshakeResponseReceived, *network.EventWebSocketFrameError:
+		return []string{EventLogWebSockets}
+	}
+	return nil
+}
+
+// eventLogged filters event by types and samples it, no types are default ones,
+// which is anything but exceptions and websockets, sample is percent of events
+func eventLogged(ev interface{}, types []string, sample int) bool {
+
+	kinds := eventTypes(ev)
+	if len(kinds) == 0 {
+		return false
+	}
+
+	if len(types) == 0 {
+		types = []string{EventLogConsole, EventLogRequests, EventLogResponses, EventLogFailures}
+	}
+
+	matched := false
+	for _, k := range kinds {
+		for _, t := range types {
+			if strings.EqualFold(k, t) {
+				matched = true
+			}
+		}
+	}
+	if !matched {
+		return false
+	}
+
+	if sample <= 0 || sample >= 100 {
+		return true
+	}
+	return rand.Intn(100) < sample
+}
+
+// logEvent logs console and network events kept by filter and sampling, debug render logs them all
+func (c *ChromeBrowser) logEvent(ev interface{}) {
+
+	if c.options.Debug {
+		if len(eventTypes(ev)) > 0 {
+			c.debug("%v", ev)
+		}
+		return
+	}
+	if eventLogged(ev, c.options.EventLogTypes, c.options.EventLogSample) {
+		c.logger.Debug("%v", ev)
+	}
+}
@@ -0,0 +1,47 @@
+package browser
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+)
+
+// render event types, stage and page ones are told by browser, render ones by its caller
+const (
+	RenderEventStage   = "stage"
+	RenderEventPage    = "page"
+	RenderEventConsole = "console"
+	RenderEventRender  = "render"
+	RenderEventRetry   = "retry"
+)
+
+// RenderEvent is a milestone of render told to its followers as it happens
+type RenderEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+}
+
+// EventFunc receives events of render, it's called by listeners, so it mustn't block
+type EventFunc func(e *RenderEvent)
+
+// Event tells event to func if there is one
+func (f EventFunc) Event(typ, format string, args ...interface{}) {
+
+	if f == nil {
+		return
+	}
+	f(&RenderEvent{Time: time.Now().UTC(), Type: typ, Message: fmt.Sprintf(format, args...)})
+}
+
+// pageEvents tells of page lifecycle
+func (c *ChromeBrowser) pageEvents(ev interface{}) {
+
+	switch ev.(type) {
+	case *page.EventDomContentEventFired:
+		c.options.Events.Event(RenderEventPage, "dom content loaded")
+	case *page.EventLoadEventFired:
+		c.options.Events.Event(RenderEventPage, "loaded")
+	}
+}
@@ -0,0 +1,178 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/common"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const BrowserKindFake = "fake"
+
+// FakeBrowser renders nothing, it makes image of url after latency and fails some of urls,
+// everything is derived from url hash, so the same url behaves the same way every time
+type FakeBrowser struct {
+	options BrowserOptions
+	logger  sreCommon.Logger
+	meter   sreCommon.Meter
+}
+
+// fakeFailures are taken by url hash when url is chosen to fail
+var fakeFailures = []func(u *url.URL) error{
+	func(u *url.URL) error {
+		return &NavigationError{Code: NavigationErrorConnectionRefused, Text: "net::ERR_CONNECTION_REFUSED"}
+	},
+	func(u *url.URL) error {
+		return fmt.Errorf("timeout exceeded: %w", context.DeadlineExceeded)
+	},
+	func(u *url.URL) error {
+		return fmt.Errorf("%w: fake crash of %s", ErrCrashed, u.Host)
+	},
+}
+
+func (f *FakeBrowser) hash(u *url.URL) uint64 {
+
+	h := fnv.New64a()
+	h.Write([]byte(u.String()))
+	return h.Sum64()
+}
+
+// latency is fake latency plus up to jitter, both in milliseconds
+func (f *FakeBrowser) latency(hash uint64) time.Duration {
+
+	ms := f.options.FakeLatency
+	if f.options.FakeJitter > 0 {
+		ms += int(hash % uint64(f.options.FakeJitter+1))
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// failure tells if url fails, failure rate is percent of urls
+func (f *FakeBrowser) failure(u *url.URL, hash uint64) error {
+
+	if f.options.FakeFailureRate <= 0 {
+		return nil
+	}
+	// upper bits choose failure, so it doesn't depend on jitter
+	if int((hash>>32)%100) >= f.options.FakeFailureRate {
+		return nil
+	}
+	return fakeFailures[(hash>>16)%uint64(len(fakeFailures))](u)
+}
+
+func (f *FakeBrowser) draw(u *url.URL, hash uint64) ([]byte, error) {
+
+	width, height := f.options.Width, f.options.Height
+	if width <= 0 {
+		width = 1280
+	}
+	if height <= 0 {
+		height = 720
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	background := color.RGBA{R: uint8(hash), G: uint8(hash >> 8), B: uint8(hash >> 16), A: 255}
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	// text is readable on any background
+	text := color.Black
+	if int(background.R)+int(background.G)+int(background.B) < 384 {
+		text = color.White
+	}
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(text),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(simpleMargin, simpleMargin+simpleLineHeight),
+	}
+	d.DrawString(u.String())
+
+	var buf bytes.Buffer
+	var err error
+	if f.options.Quality > 0 && f.options.Quality < 100 {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: f.options.Quality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), err
+}
+
+func (f *FakeBrowser) Image(ctx context.Context, u *url.URL) (*BrowserImage, error) {
+
+	timeout := time.Duration(f.options.Timeout) * time.Second
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	hash := f.hash(u)
+	latency := f.latency(hash)
+	f.meter.Counter("renders", "Count of all fake browser renders", nil, "fake", "browser").Inc()
+
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timeout exceeded: %w", ctx.Err())
+		}
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+
+	if err := f.failure(u, hash); err != nil {
+		f.logger.Debug("Fake browser fails %s: %v", u, err)
+		return nil, err
+	}
+
+	r := &BrowserImage{
+		FinalURL: u.String(),
+		Status:   200,
+	}
+
+	if f.options.CaptureDOM {
+		title := html.EscapeString(u.String())
+		r.DOM = fmt.Sprintf("<html><head><title>%s</title></head><body><h1>%s</h1></body></html>", title, title)
+	}
+
+	if f.options.AsPDF {
+		r.Data = simplePDF([]*simpleBlock{{Text: u.String(), Heading: true}})
+		return r, nil
+	}
+
+	var err error
+	r.Data, err = f.draw(u, hash)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (f *FakeBrowser) Kind() string {
+	return BrowserKindFake
+}
+
+func NewFakeBrowser(options BrowserOptions, observability *common.Observability) Browser {
+
+	return &FakeBrowser{
+		options: options,
+		logger:  observability.Logs(),
+		meter:   observability.Metrics(),
+	}
+}
@@ -0,0 +1,399 @@
+package browser
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+const BrowserKindFirefox = "firefox"
+
+// time given to firefox to start and accept marionette connection
+const firefoxStartTimeout = 30 * time.Second
+
+// FirefoxBrowser renders by headless firefox driven over marionette
+type FirefoxBrowser struct {
+	options BrowserOptions
+	logger  sreCommon.Logger
+	meter   sreCommon.Meter
+}
+
+type firefoxValue struct {
+	Value json.RawMessage `json:"value"`
+}
+
+func freePort() (int, error) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (f *FirefoxBrowser) prefs(port int) string {
+
+	prefs := map[string]interface{}{
+		"marionette.port":                            port,
+		"browser.shell.checkDefaultBrowser":          false,
+		"datareporting.policy.dataSubmissionEnabled": false,
+		"toolkit.telemetry.reportingpolicy.firstRun": false,
+		"browser.startup.homepage_override.mstone":   "ignore",
+	}
+
+	if !utils.IsEmpty(f.options.UserAgent) {
+		prefs["general.useragent.override"] = f.options.UserAgent
+	}
+	if !utils.IsEmpty(f.options.AcceptLanguage) {
+		prefs["intl.accept_languages"] = f.options.AcceptLanguage
+	}
+	if f.options.JsDisabled {
+		prefs["javascript.enabled"] = false
+	}
+	// content override is 0 for dark and 1 for light
+	switch f.options.ColorScheme {
+	case ColorSchemeDark:
+		prefs["layout.css.prefers-color-scheme.content-override"] = 0
+	case ColorSchemeLight:
+		prefs["layout.css.prefers-color-scheme.content-override"] = 1
+	}
+	if f.options.BrowserCache == BrowserCacheDisabled || f.options.BrowserCache == BrowserCacheBypass {
+		prefs["browser.cache.disk.enable"] = false
+		prefs["browser.cache.memory.enable"] = false
+	}
+
+	if u, err := url.Parse(f.options.Proxy); err == nil && u.Hostname() != "" && u.Scheme == ProxySchemeSOCKS5 {
+		port, _ := strconv.Atoi(u.Port())
+		prefs["network.proxy.type"] = 1
+		prefs["network.proxy.socks"] = u.Hostname()
+		prefs["network.proxy.socks_port"] = port
+		prefs["network.proxy.socks_version"] = 5
+		prefs["network.proxy.socks_remote_dns"] = true
+	} else if err == nil && u.Hostname() != "" {
+		port, _ := strconv.Atoi(u.Port())
+		prefs["network.proxy.type"] = 1
+		prefs["network.proxy.http"] = u.Hostname()
+		prefs["network.proxy.http_port"] = port
+		prefs["network.proxy.ssl"] = u.Hostname()
+		prefs["network.proxy.ssl_port"] = port
+	}
+
+	// content sandbox needs user namespaces, containers render by software
+	if f.options.Environment == EnvironmentContainer {
+		prefs["security.sandbox.content.level"] = 0
+		prefs["gfx.webrender.software"] = true
+	}
+
+	var b strings.Builder
+	for k, v := range prefs {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(&b, "user_pref(%q, %s);\n", k, data)
+	}
+	return b.String()
+}
+
+// start launches firefox with temporary profile, returned func kills it and removes profile
+func (f *FirefoxBrowser) start(ctx context.Context) (*marionette, *exec.Cmd, func(), error) {
+
+	port, err := freePort()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	profile, err := os.MkdirTemp("", "webrender-firefox-")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(profile) }
+
+	if err := os.WriteFile(filepath.Join(profile, "user.js"), []byte(f.prefs(port)), 0600); err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+
+	path := discoverPath(BrowserKindFirefox, f.options.Path)
+	if utils.IsEmpty(path) {
+		path = BrowserKindFirefox
+	}
+
+	cmd := exec.Command(path, "--marionette", "--headless", "--no-remote", "--profile", profile,
+		fmt.Sprintf("--window-size=%d,%d", f.options.Width, f.options.Height))
+	processAttr(cmd)
+	if f.options.Environment == EnvironmentContainer {
+		cmd.Env = append(os.Environ(), containerEnv()...)
+	}
+	if err := cmd.Start(); err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		cleanup()
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, firefoxStartTimeout)
+	defer cancel()
+
+	m, err := dialMarionette(dialCtx, fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		stop()
+		return nil, nil, nil, err
+	}
+	return m, cmd, func() { m.Close(); stop() }, nil
+}
+
+func (f *FirefoxBrowser) value(ctx context.Context, m *marionette, name string, params interface{}, v interface{}) error {
+
+	var r firefoxValue
+	if err := m.call(ctx, name, params, &r); err != nil {
+		return err
+	}
+	if v == nil || len(r.Value) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Value, v)
+}
+
+func (f *FirefoxBrowser) script(ctx context.Context, m *marionette, script string, v interface{}) error {
+
+	params := map[string]interface{}{
+		"script": script,
+		"args":   []interface{}{},
+	}
+	return f.value(ctx, m, "WebDriver:ExecuteScript", params, v)
+}
+
+func (f *FirefoxBrowser) navigate(ctx context.Context, m *marionette, u *url.URL) error {
+
+	if err := m.call(ctx, "WebDriver:Navigate", map[string]interface{}{"url": u.String()}, nil); err != nil {
+		return err
+	}
+
+	if len(f.options.Cookies) == 0 {
+		return nil
+	}
+
+	// cookies need document of their domain, so page is reloaded with them
+	for name, value := range f.options.Cookies {
+		cookie := map[string]interface{}{
+			"cookie": map[string]interface{}{
+				"name":  name,
+				"value": value,
+			},
+		}
+		if err := m.call(ctx, "WebDriver:AddCookie", cookie, nil); err != nil {
+			return fmt.Errorf("couldn't set cookie %s: %w", name, err)
+		}
+	}
+	return m.call(ctx, "WebDriver:Refresh", nil, nil)
+}
+
+// detectPage looks for firefox error pages, challenge and error texts of page text or selectors
+func (f *FirefoxBrowser) detectPage(ctx context.Context, m *marionette) (string, string) {
+
+	href := ""
+	if err := f.script(ctx, m, "return document.location.href", &href); err != nil {
+		f.logger.Debug("Couldn't get location: %v", err)
+	}
+	if strings.HasPrefix(href, "about:neterror") || strings.HasPrefix(href, "about:certerror") {
+		return PageError, "firefox error page"
+	}
+
+	find := func(selectors []string) string {
+		for _, s := range selectors {
+			sel, _ := json.Marshal(s)
+			found := false
+			if err := f.script(ctx, m, fmt.Sprintf("return document.querySelector(%s) !== null", sel), &found); err == nil && found {
+				return s
+			}
+		}
+		return ""
+	}
+
+	text := ""
+	if len(f.options.ChallengeTexts) > 0 || len(f.options.ErrorTexts) > 0 {
+		if err := f.script(ctx, m, "return "+pageTextScript, &text); err != nil {
+			f.logger.Debug("Couldn't get page text: %v", err)
+		}
+	}
+
+	if s := find(f.options.ChallengeSelectors); s != "" {
+		return PageChallenge, fmt.Sprintf("selector %s", s)
+	}
+	if t := findText(text, f.options.ChallengeTexts); t != "" {
+		return PageChallenge, fmt.Sprintf("text %s", t)
+	}
+	if s := find(f.options.ErrorSelectors); s != "" {
+		return PageError, fmt.Sprintf("selector %s", s)
+	}
+	if t := findText(text, f.options.ErrorTexts); t != "" {
+		return PageError, fmt.Sprintf("text %s", t)
+	}
+	return "", ""
+}
+
+func (f *FirefoxBrowser) capture(ctx context.Context, m *marionette, r *BrowserImage) error {
+
+	if f.options.CaptureDOM {
+		if err := f.value(ctx, m, "WebDriver:GetPageSource", nil, &r.DOM); err != nil {
+			return err
+		}
+		if f.options.MaxDOMSize > 0 && len(r.DOM) > f.options.MaxDOMSize {
+			r.DOM = r.DOM[:f.options.MaxDOMSize]
+			r.DOMTruncated = true
+		}
+	}
+
+	if err := f.value(ctx, m, "WebDriver:GetCurrentURL", nil, &r.FinalURL); err != nil {
+		f.logger.Debug("Couldn't get location: %v", err)
+	}
+	r.Page, r.PageReason = f.detectPage(ctx, m)
+
+	if f.options.hasScrollTo() {
+		if err := f.scrollTo(ctx, m); err != nil {
+			return err
+		}
+	}
+
+	var data string
+	if f.options.AsPDF {
+		params := f.options.PDF.firefoxPrintParams()
+		if err := f.value(ctx, m, "WebDriver:Print", params, &data); err != nil {
+			return err
+		}
+	} else {
+		params := map[string]interface{}{
+			"full": f.options.FullPage,
+			"hash": false,
+		}
+		if err := f.value(ctx, m, "WebDriver:TakeScreenshot", params, &data); err != nil {
+			return err
+		}
+	}
+
+	image, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return err
+	}
+	r.Data = image
+	return nil
+}
+
+func (f *FirefoxBrowser) Image(ctx context.Context, u *url.URL) (*BrowserImage, error) {
+
+	r := &BrowserImage{}
+
+	if len(f.options.HeadersMap) > 0 {
+		f.logger.Debug("Firefox doesn't support extra headers, they are ignored")
+	}
+
+	m, cmd, stop, err := f.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	// render and fallback capture have their own timeouts as chrome does
+	timeout := time.Duration(f.options.Timeout) * time.Second
+	runCtx, cancel := context.WithTimeout(ctx, 2*timeout+firefoxStartTimeout)
+	defer cancel()
+
+	capabilities := map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"alwaysMatch": map[string]interface{}{
+				"acceptInsecureCerts": true,
+				"pageLoadStrategy":    "normal",
+				"timeouts": map[string]interface{}{
+					"pageLoad": timeout.Milliseconds(),
+					"script":   timeout.Milliseconds(),
+				},
+			},
+		},
+	}
+	if err := m.call(runCtx, "WebDriver:NewSession", capabilities, nil); err != nil {
+		return nil, f.exitErr(cmd, err)
+	}
+
+	err = f.navigate(runCtx, m, u)
+
+	var merr *marionetteError
+	if errors.As(err, &merr) && merr.Code == "timeout" {
+		if !f.options.Partial {
+			return nil, fmt.Errorf("timeout exceeded: %w", context.DeadlineExceeded)
+		}
+		r.Partial = true
+		err = nil
+	}
+
+	if err != nil {
+		if navErr := newFirefoxNavigationError(err.Error()); navErr != nil {
+			return nil, navErr
+		}
+		return nil, f.exitErr(cmd, err)
+	}
+
+	if !r.Partial {
+		if len(f.options.JsCode) > 0 {
+			if err := f.script(runCtx, m, f.options.JsCode, nil); err != nil {
+				return nil, err
+			}
+		}
+		if !utils.IsEmpty(f.options.WaitExpression) {
+			if err := f.waitExpression(runCtx, m, r); err != nil {
+				return nil, err
+			}
+		}
+		if f.options.Delay > 0 {
+			select {
+			case <-runCtx.Done():
+				return nil, runCtx.Err()
+			case <-time.After(time.Duration(f.options.Delay) * time.Second):
+			}
+		}
+	}
+
+	if err := f.capture(runCtx, m, r); err != nil {
+		return nil, f.exitErr(cmd, err)
+	}
+	return r, nil
+}
+
+// exitErr reports crash when firefox process is gone
+func (f *FirefoxBrowser) exitErr(cmd *exec.Cmd, err error) error {
+
+	if cmd.ProcessState != nil || (cmd.Process != nil && cmd.Process.Signal(syscall.Signal(0)) != nil) {
+		return fmt.Errorf("%w: %v", ErrCrashed, err)
+	}
+	return err
+}
+
+func (f *FirefoxBrowser) Kind() string {
+	return BrowserKindFirefox
+}
+
+func NewFirefoxBrowser(options BrowserOptions, observability *common.Observability) Browser {
+
+	return &FirefoxBrowser{
+		options: options,
+		logger:  observability.Logs(),
+		meter:   observability.Metrics(),
+	}
+}
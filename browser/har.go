@@ -0,0 +1,400 @@
+package browser
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+)
+
+// Har is http archive 1.2 document, http://www.softwareishard.com/blog/har-12-spec/
+type Har struct {
+	Log *HarLog `json:"log"`
+}
+
+type HarLog struct {
+	Version string      `json:"version"`
+	Creator *HarCreator `json:"creator"`
+	Pages   []*HarPage  `json:"pages"`
+	Entries []*HarEntry `json:"entries"`
+}
+
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HarPage struct {
+	StartedDateTime time.Time       `json:"startedDateTime"`
+	ID              string          `json:"id"`
+	Title           string          `json:"title"`
+	PageTimings     *HarPageTimings `json:"pageTimings"`
+}
+
+type HarPageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+type HarEntry struct {
+	Pageref         string       `json:"pageref"`
+	StartedDateTime time.Time    `json:"startedDateTime"`
+	Time            float64      `json:"time"`
+	Request         *HarRequest  `json:"request"`
+	Response        *HarResponse `json:"response"`
+	Cache           struct{}     `json:"cache"`
+	Timings         *HarTimings  `json:"timings"`
+	ServerIPAddress string       `json:"serverIPAddress,omitempty"`
+	ResourceType    string       `json:"_resourceType,omitempty"`
+	Error           string       `json:"_error,omitempty"`
+}
+
+type HarNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HarRequest struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HarNameValue `json:"cookies"`
+	Headers     []*HarNameValue `json:"headers"`
+	QueryString []*HarNameValue `json:"queryString"`
+	PostData    *HarPostData    `json:"postData,omitempty"`
+	HeadersSize int             `json:"headersSize"`
+	BodySize    int             `json:"bodySize"`
+}
+
+type HarPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HarResponse struct {
+	Status      int             `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HarNameValue `json:"cookies"`
+	Headers     []*HarNameValue `json:"headers"`
+	Content     *HarContent     `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int             `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+type HarContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+// HarTimings are milliseconds of request phases, -1 is for phases which don't apply
+type HarTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+const HarPageID = "page_1"
+
+// harRedacted are headers carrying credentials, their values aren't exported
+var harRedacted = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+type chromeHarEntry struct {
+	entry    *HarEntry
+	started  float64
+	response float64
+}
+
+type chromeHar struct {
+	mutex         sync.Mutex
+	url           string
+	start         float64
+	started       time.Time
+	onContentLoad float64
+	onLoad        float64
+	entries       []*HarEntry
+	requests      map[network.RequestID]*chromeHarEntry
+}
+
+// harNoResponse is for failed and unfinished requests, har requires response anyway
+func harNoResponse() *HarResponse {
+	return &HarResponse{
+		Cookies:     []*HarNameValue{},
+		Headers:     []*HarNameValue{},
+		Content:     &HarContent{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+}
+
+func harHeaders(headers network.Headers) []*HarNameValue {
+
+	r := []*HarNameValue{}
+	for k, v := range headers {
+		value, _ := v.(string)
+		if harRedacted[strings.ToLower(k)] {
+			value = "redacted"
+		}
+		// multiple values are joined by new line
+		for _, s := range strings.Split(value, "\n") {
+			r = append(r, &HarNameValue{Name: k, Value: s})
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	return r
+}
+
+func harQuery(raw string) []*HarNameValue {
+
+	r := []*HarNameValue{}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return r
+	}
+	for k, vs := range u.Query() {
+		for _, v := range vs {
+			r = append(r, &HarNameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	return r
+}
+
+func harVersion(protocol string) string {
+
+	switch strings.ToLower(protocol) {
+	case "":
+		return "HTTP/1.1"
+	case "h2":
+		return "HTTP/2"
+	case "h3":
+		return "HTTP/3"
+	}
+	return strings.ToUpper(protocol)
+}
+
+func harHeader(headers network.Headers, name string) string {
+
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			s, _ := v.(string)
+			return s
+		}
+	}
+	return ""
+}
+
+// harPhase returns -1 for phase chrome didn't report
+func harPhase(start, end float64) float64 {
+	if start < 0 || end < start {
+		return -1
+	}
+	return millis((end - start) / 1000)
+}
+
+func (h *chromeHar) response(e *chromeHarEntry, resp *network.Response, at float64) {
+
+	e.response = at
+	e.entry.Response = &HarResponse{
+		Status:      int(resp.Status),
+		StatusText:  resp.StatusText,
+		HTTPVersion: harVersion(resp.Protocol),
+		Cookies:     []*HarNameValue{},
+		Headers:     harHeaders(resp.Headers),
+		Content:     &HarContent{MimeType: resp.MimeType},
+		RedirectURL: harHeader(resp.Headers, "Location"),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	e.entry.Request.HTTPVersion = e.entry.Response.HTTPVersion
+	e.entry.ServerIPAddress = resp.RemoteIPAddress
+
+	t := resp.Timing
+	if t == nil {
+		return
+	}
+	e.entry.Timings = &HarTimings{
+		Blocked: harPhase(0, t.DNSStart),
+		DNS:     harPhase(t.DNSStart, t.DNSEnd),
+		Connect: harPhase(t.ConnectStart, t.ConnectEnd),
+		Send:    max(harPhase(t.SendStart, t.SendEnd), 0),
+		Wait:    max(harPhase(t.SendEnd, t.ReceiveHeadersEnd), 0),
+		Receive: 0,
+		SSL:     harPhase(t.SslStart, t.SslEnd),
+	}
+	if e.entry.Timings.Blocked < 0 {
+		e.entry.Timings.Blocked = harPhase(0, t.SendStart)
+	}
+}
+
+// finish closes entry, time is the sum of phases as har wants
+func (h *chromeHar) finish(id network.RequestID, e *chromeHarEntry, at float64, size int64) {
+
+	if e.entry.Response != nil {
+		e.entry.Response.BodySize = size
+		if e.entry.Response.Content.Size == 0 {
+			e.entry.Response.Content.Size = size
+		}
+	}
+	t := e.entry.Timings
+	if e.response > 0 {
+		t.Receive = millis(at - e.response)
+	}
+
+	total := 0.0
+	for _, v := range []float64{t.Blocked, t.DNS, t.Connect, t.Send, t.Wait, t.Receive} {
+		if v > 0 {
+			total += v
+		}
+	}
+	if total == 0 {
+		total = millis(at - e.started)
+	}
+	e.entry.Time = total
+	delete(h.requests, id)
+}
+
+// listen is called for every tab event, redirects are separate entries as in devtools
+func (h *chromeHar) listen(ev interface{}) {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	switch ev := ev.(type) {
+	case *network.EventRequestWillBeSent:
+		if ev.Request == nil || ev.Timestamp == nil {
+			return
+		}
+		at := seconds(ev.Timestamp)
+		if e, ok := h.requests[ev.RequestID]; ok && ev.RedirectResponse != nil {
+			h.response(e, ev.RedirectResponse, at)
+			h.finish(ev.RequestID, e, at, 0)
+		}
+
+		wall := time.Now().UTC()
+		if ev.WallTime != nil {
+			wall = ev.WallTime.Time().UTC()
+		}
+		if len(h.entries) == 0 {
+			h.start = at
+			h.started = wall
+		}
+
+		u := ev.Request.URL + ev.Request.URLFragment
+		entry := &HarEntry{
+			Pageref:         HarPageID,
+			StartedDateTime: wall,
+			Request: &HarRequest{
+				Method:      ev.Request.Method,
+				URL:         u,
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []*HarNameValue{},
+				Headers:     harHeaders(ev.Request.Headers),
+				QueryString: harQuery(u),
+				HeadersSize: -1,
+				BodySize:    len(ev.Request.PostData),
+			},
+			Timings:      &HarTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+			ResourceType: strings.ToLower(string(ev.Type)),
+		}
+		if ev.Request.PostData != "" {
+			entry.Request.PostData = &HarPostData{
+				MimeType: harHeader(ev.Request.Headers, "Content-Type"),
+				Text:     ev.Request.PostData,
+			}
+		}
+		h.entries = append(h.entries, entry)
+		h.requests[ev.RequestID] = &chromeHarEntry{entry: entry, started: at}
+	case *network.EventResponseReceived:
+		if e, ok := h.requests[ev.RequestID]; ok && ev.Response != nil && ev.Timestamp != nil {
+			h.response(e, ev.Response, seconds(ev.Timestamp))
+		}
+	case *network.EventDataReceived:
+		if e, ok := h.requests[ev.RequestID]; ok && e.entry.Response != nil {
+			e.entry.Response.Content.Size += ev.DataLength
+		}
+	case *network.EventLoadingFinished:
+		if e, ok := h.requests[ev.RequestID]; ok && ev.Timestamp != nil {
+			h.finish(ev.RequestID, e, seconds(ev.Timestamp), int64(ev.EncodedDataLength))
+		}
+	case *network.EventLoadingFailed:
+		if e, ok := h.requests[ev.RequestID]; ok && ev.Timestamp != nil {
+			e.entry.Error = ev.ErrorText
+			if e.entry.Response == nil {
+				e.entry.Response = harNoResponse()
+			}
+			h.finish(ev.RequestID, e, seconds(ev.Timestamp), 0)
+		}
+	case *page.EventDomContentEventFired:
+		if ev.Timestamp != nil && len(h.entries) > 0 {
+			h.onContentLoad = millis(seconds(ev.Timestamp) - h.start)
+		}
+	case *page.EventLoadEventFired:
+		if ev.Timestamp != nil && len(h.entries) > 0 {
+			h.onLoad = millis(seconds(ev.Timestamp) - h.start)
+		}
+	}
+}
+
+// har returns archive of requests seen so far, unfinished ones have no time
+func (h *chromeHar) har() *Har {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	entries := make([]*HarEntry, 0, len(h.entries))
+	for _, e := range h.entries {
+		v := *e
+		if v.Response == nil {
+			v.Response = harNoResponse()
+		}
+		entries = append(entries, &v)
+	}
+
+	started := h.started
+	if started.IsZero() {
+		started = time.Now().UTC()
+	}
+	onContentLoad, onLoad := h.onContentLoad, h.onLoad
+	if onContentLoad == 0 {
+		onContentLoad = -1
+	}
+	if onLoad == 0 {
+		onLoad = -1
+	}
+
+	return &Har{
+		Log: &HarLog{
+			Version: "1.2",
+			Creator: &HarCreator{Name: "webrender", Version: "unknown"},
+			Pages: []*HarPage{{
+				StartedDateTime: started,
+				ID:              HarPageID,
+				Title:           h.url,
+				PageTimings:     &HarPageTimings{OnContentLoad: onContentLoad, OnLoad: onLoad},
+			}},
+			Entries: entries,
+		},
+	}
+}
+
+func newChromeHar(url string) *chromeHar {
+	return &chromeHar{
+		url:      url,
+		requests: make(map[network.RequestID]*chromeHarEntry),
+	}
+}
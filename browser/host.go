@@ -0,0 +1,34 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/chromedp/cdproto/fetch"
+)
+
+// continueRequest continues paused request, requests to host of url present host header of options,
+// so page is rendered by ip or balancer as the host it's going to be served by
+func (c *ChromeBrowser) continueRequest(ctx context.Context, e *fetch.EventRequestPaused, u *url.URL) error {
+
+	continued := fetch.ContinueRequest(e.RequestID)
+	if c.options.HostHeader == "" {
+		return continued.Do(ctx)
+	}
+	ru, err := url.Parse(e.Request.URL)
+	if err != nil || !strings.EqualFold(ru.Host, u.Host) {
+		return continued.Do(ctx)
+	}
+
+	// headers of continue replace request ones, so they all are passed
+	headers := []*fetch.HeaderEntry{{Name: "Host", Value: c.options.HostHeader}}
+	for k, v := range e.Request.Headers {
+		if strings.EqualFold(k, "host") {
+			continue
+		}
+		headers = append(headers, &fetch.HeaderEntry{Name: k, Value: fmt.Sprintf("%v", v)})
+	}
+	return continued.WithHeaders(headers).Do(ctx)
+}
@@ -0,0 +1,95 @@
+package browser
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// wait strategies after navigation, network idle allows no pending requests for idle time,
+// network idle 2 allows two of them, as long polls and analytics beacons might never finish
+const (
+	WaitUntilLoad         = "load"
+	WaitUntilNetworkIdle  = "networkidle"
+	WaitUntilNetworkIdle2 = "networkidle2"
+)
+
+const (
+	defaultIdleTime  = 500
+	idlePollInterval = 50 * time.Millisecond
+)
+
+// chromeIdle tracks requests in flight and time of last change
+type chromeIdle struct {
+	mutex   sync.Mutex
+	pending map[network.RequestID]bool
+	changed time.Time
+}
+
+func (i *chromeIdle) listen(ev interface{}) {
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	switch ev := ev.(type) {
+	case *network.EventRequestWillBeSent:
+		// redirect keeps request id, it's in flight still
+		i.pending[ev.RequestID] = true
+	case *network.EventLoadingFinished:
+		delete(i.pending, ev.RequestID)
+	case *network.EventLoadingFailed:
+		delete(i.pending, ev.RequestID)
+	default:
+		return
+	}
+	i.changed = time.Now()
+}
+
+// idle tells if there are no more than allowed requests since quiet period
+func (i *chromeIdle) idle(allowed int, quiet time.Duration) bool {
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return len(i.pending) <= allowed && time.Since(i.changed) >= quiet
+}
+
+// networkIdleAction waits till network is idle, it's bounded by render timeout
+func (c *ChromeBrowser) networkIdleAction(idle *chromeIdle) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		allowed := 0
+		if c.options.WaitUntil == WaitUntilNetworkIdle2 {
+			allowed = 2
+		}
+		quiet := time.Duration(c.options.IdleTime) * time.Millisecond
+		if quiet <= 0 {
+			quiet = defaultIdleTime * time.Millisecond
+		}
+
+		ticker := time.NewTicker(idlePollInterval)
+		defer ticker.Stop()
+		for !idle.idle(allowed, quiet) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+		return nil
+	})
+}
+
+func (c *ChromeBrowser) waitNetworkIdle() bool {
+	return c.options.WaitUntil == WaitUntilNetworkIdle || c.options.WaitUntil == WaitUntilNetworkIdle2
+}
+
+func newChromeIdle() *chromeIdle {
+	return &chromeIdle{
+		pending: make(map[network.RequestID]bool),
+		changed: time.Now(),
+	}
+}
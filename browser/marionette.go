@@ -0,0 +1,163 @@
+package browser
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// marionette is a minimal client of firefox remote protocol, messages are framed as length:json
+type marionette struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	id     int
+	mutex  sync.Mutex
+}
+
+type marionetteError struct {
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *marionetteError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (m *marionette) read() ([]byte, error) {
+
+	size, err := m.reader.ReadString(':')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(size[:len(size)-1])
+	if err != nil {
+		return nil, fmt.Errorf("marionette frame size: %w", err)
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(m.reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (m *marionette) write(v interface{}) error {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = m.conn.Write(append([]byte(strconv.Itoa(len(data))+":"), data...))
+	return err
+}
+
+// call sends command and waits for its response, result might be nil
+func (m *marionette) call(ctx context.Context, name string, params interface{}, result interface{}) error {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Time{}
+	}
+	if err := m.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	// connection is closed on cancel to unblock read
+	stop := context.AfterFunc(ctx, func() { m.conn.Close() })
+	defer stop()
+
+	m.id++
+	id := m.id
+	if err := m.write([]interface{}{0, id, name, params}); err != nil {
+		return m.ctxErr(ctx, err)
+	}
+
+	for {
+		data, err := m.read()
+		if err != nil {
+			return m.ctxErr(ctx, err)
+		}
+
+		var msg []json.RawMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return err
+		}
+		// skip events and stale responses
+		if len(msg) != 4 || string(msg[0]) != "1" || string(msg[1]) != strconv.Itoa(id) {
+			continue
+		}
+
+		if string(msg[2]) != "null" {
+			e := &marionetteError{}
+			if err := json.Unmarshal(msg[2], e); err != nil {
+				return err
+			}
+			return e
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg[3], result)
+	}
+}
+
+func (m *marionette) ctxErr(ctx context.Context, err error) error {
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func (m *marionette) Close() error {
+	return m.conn.Close()
+}
+
+// dialMarionette waits for firefox to listen and reads its greeting
+func dialMarionette(ctx context.Context, addr string) (*marionette, error) {
+
+	var conn net.Conn
+	var err error
+	for {
+		d := net.Dialer{Timeout: time.Second}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("couldn't connect to marionette: %w", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	m := &marionette{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := m.read(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("couldn't read marionette greeting: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,81 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/chromedp/cdproto/heapprofiler"
+	"github.com/chromedp/cdproto/performance"
+	"github.com/chromedp/chromedp"
+)
+
+// Memory is js heap and dom usage of page after load
+type Memory struct {
+	JSHeapUsed  int64 `json:"jsHeapUsed"`
+	JSHeapTotal int64 `json:"jsHeapTotal"`
+	Documents   int64 `json:"documents"`
+	Nodes       int64 `json:"nodes"`
+	Listeners   int64 `json:"listeners"`
+}
+
+// memoryAction reads performance metrics, heap snapshot is taken if it's requested
+func (c *ChromeBrowser) memoryAction(r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		if err := performance.Enable().Do(ctx); err != nil {
+			return err
+		}
+		metrics, err := performance.GetMetrics().Do(ctx)
+		if err != nil {
+			return err
+		}
+
+		m := &Memory{}
+		for _, v := range metrics {
+			switch v.Name {
+			case "JSHeapUsedSize":
+				m.JSHeapUsed = int64(v.Value)
+			case "JSHeapTotalSize":
+				m.JSHeapTotal = int64(v.Value)
+			case "Documents":
+				m.Documents = int64(v.Value)
+			case "Nodes":
+				m.Nodes = int64(v.Value)
+			case "JSEventListeners":
+				m.Listeners = int64(v.Value)
+			}
+		}
+		r.Memory = m
+
+		if !c.options.HeapSnapshot {
+			return nil
+		}
+
+		// chunks are sent before snapshot command returns
+		var buf bytes.Buffer
+		var mutex sync.Mutex
+		lctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		chromedp.ListenTarget(lctx, func(ev interface{}) {
+			if e, ok := ev.(*heapprofiler.EventAddHeapSnapshotChunk); ok {
+				mutex.Lock()
+				buf.WriteString(e.Chunk)
+				mutex.Unlock()
+			}
+		})
+
+		if err := heapprofiler.Enable().Do(ctx); err != nil {
+			return err
+		}
+		if err := heapprofiler.TakeHeapSnapshot().WithReportProgress(false).Do(ctx); err != nil {
+			return err
+		}
+
+		mutex.Lock()
+		r.HeapSnapshot = buf.Bytes()
+		mutex.Unlock()
+		return nil
+	})
+}
@@ -0,0 +1,112 @@
+package browser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// a4 page in points with helvetica text
+const (
+	simplePDFWidth    = 595
+	simplePDFHeight   = 842
+	simplePDFMargin   = 50
+	simplePDFFontSize = 11
+	simplePDFLeading  = 15
+)
+
+// simplePDFText escapes pdf string, non latin characters are replaced as standard fonts don't have them
+func simplePDFText(s string) string {
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteRune('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// simplePDF writes text blocks as minimal pdf document
+func simplePDF(blocks []*simpleBlock) []byte {
+
+	// helvetica average glyph is about half of font size
+	max := (simplePDFWidth - 2*simplePDFMargin) * 2 / simplePDFFontSize
+	perPage := (simplePDFHeight - 2*simplePDFMargin) / simplePDFLeading
+
+	s := &SimpleBrowser{}
+	type line struct {
+		text string
+		bold bool
+	}
+	var lines []line
+	for i, b := range blocks {
+		if i > 0 {
+			lines = append(lines, line{})
+		}
+		for _, l := range s.wrap(b.Text, max) {
+			lines = append(lines, line{text: l, bold: b.Heading})
+		}
+	}
+
+	var pages [][]line
+	for len(lines) > perPage {
+		pages = append(pages, lines[:perPage])
+		lines = lines[perPage:]
+	}
+	pages = append(pages, lines)
+
+	// objects: 1 catalog, 2 pages, 3 font, 4 bold font, then page and content pairs
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	kids := []string{}
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+i*2))
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold >>")
+
+	for i, p := range pages {
+
+		var content strings.Builder
+		content.WriteString("BT\n")
+		fmt.Fprintf(&content, "%d TL\n%d %d Td\n", simplePDFLeading, simplePDFMargin, simplePDFHeight-simplePDFMargin)
+		for _, l := range p {
+			font := "F1"
+			if l.bold {
+				font = "F2"
+			}
+			fmt.Fprintf(&content, "/%s %d Tf\n(%s) Tj T*\n", font, simplePDFFontSize, simplePDFText(l.text))
+		}
+		content.WriteString("ET")
+
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			simplePDFWidth, simplePDFHeight, 6+i*2))
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+
+	offsets := []int{}
+	for i, o := range objects {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
@@ -0,0 +1,114 @@
+package browser
+
+import (
+	"context"
+
+	"github.com/chromedp/cdproto/performance"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// Performance is timing of page load and its main thread work, times are milliseconds
+// since navigation start, durations are milliseconds, cls is layout shift score
+type Performance struct {
+	TTFB             float64 `json:"ttfb"`
+	FCP              float64 `json:"fcp,omitempty"`
+	LCP              float64 `json:"lcp,omitempty"`
+	CLS              float64 `json:"cls"`
+	DOMContentLoaded float64 `json:"domContentLoaded,omitempty"`
+	Load             float64 `json:"load,omitempty"`
+	TaskDuration     float64 `json:"taskDuration"`
+	ScriptDuration   float64 `json:"scriptDuration"`
+	LayoutDuration   float64 `json:"layoutDuration"`
+	StyleDuration    float64 `json:"styleDuration"`
+}
+
+// performanceScript reads navigation and paint timing, buffered observers give entries of
+// largest paint and layout shifts since start, cls is the largest session window of shifts
+const performanceScript = `new Promise((resolve) => {
+	const result = {ttfb: 0, cls: 0};
+	const nav = performance.getEntriesByType("navigation")[0];
+	if (nav) {
+		result.ttfb = nav.responseStart;
+		result.domContentLoaded = nav.domContentLoadedEventEnd;
+		result.load = nav.loadEventEnd;
+	}
+	const fcp = performance.getEntriesByName("first-contentful-paint")[0];
+	if (fcp) {
+		result.fcp = fcp.startTime;
+	}
+	let lcp = 0;
+	const shifts = [];
+	try {
+		new PerformanceObserver((list) => {
+			for (const e of list.getEntries()) {
+				lcp = Math.max(lcp, e.renderTime || e.loadTime || e.startTime);
+			}
+		}).observe({type: "largest-contentful-paint", buffered: true});
+		new PerformanceObserver((list) => {
+			for (const e of list.getEntries()) {
+				if (!e.hadRecentInput) {
+					shifts.push(e);
+				}
+			}
+		}).observe({type: "layout-shift", buffered: true});
+	} catch (e) {}
+	// buffered entries are delivered by task after observe
+	setTimeout(() => {
+		let cls = 0, window = 0, first = 0, last = 0;
+		for (const e of shifts) {
+			if (window && (e.startTime - last > 1000 || e.startTime - first > 5000)) {
+				window = 0;
+			}
+			if (!window) {
+				first = e.startTime;
+			}
+			window += e.value;
+			last = e.startTime;
+			cls = Math.max(cls, window);
+		}
+		if (lcp) {
+			result.lcp = lcp;
+		}
+		result.cls = cls;
+		resolve(result);
+	}, 50);
+})`
+
+// performanceAction reads page timing and main thread durations of performance domain
+func (c *ChromeBrowser) performanceAction(r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		p := &Performance{}
+		err := chromedp.Evaluate(performanceScript, p, func(e *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return e.WithAwaitPromise(true)
+		}).Do(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := performance.Enable().Do(ctx); err != nil {
+			return err
+		}
+		metrics, err := performance.GetMetrics().Do(ctx)
+		if err != nil {
+			return err
+		}
+		// durations are seconds
+		for _, m := range metrics {
+			switch m.Name {
+			case "TaskDuration":
+				p.TaskDuration = m.Value * 1000
+			case "ScriptDuration":
+				p.ScriptDuration = m.Value * 1000
+			case "LayoutDuration":
+				p.LayoutDuration = m.Value * 1000
+			case "RecalcStyleDuration":
+				p.StyleDuration = m.Value * 1000
+			}
+		}
+		r.Performance = p
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	cdpBrowser "github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/chromedp"
+)
+
+// friendly names of permissions which are several permission descriptors
+var permissionAliases = map[string][]string{
+	"clipboard": {"clipboard-read", "clipboard-write"},
+	"camera":    {"camera"},
+	"video":     {"camera"},
+	"audio":     {"microphone"},
+}
+
+// permissionsAction grants or denies permissions for url origin, permission with -deny suffix is denied
+func (c *ChromeBrowser) permissionsAction(u *url.URL) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		origin := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+		for _, p := range c.options.Permissions {
+
+			name := strings.TrimSpace(p)
+			setting := cdpBrowser.PermissionSettingGranted
+			if strings.HasSuffix(name, "-deny") {
+				name = strings.TrimSuffix(name, "-deny")
+				setting = cdpBrowser.PermissionSettingDenied
+			}
+
+			names, ok := permissionAliases[name]
+			if !ok {
+				names = []string{name}
+			}
+
+			for _, n := range names {
+				descriptor := &cdpBrowser.PermissionDescriptor{Name: n}
+				if err := cdpBrowser.SetPermission(descriptor, setting).WithOrigin(origin).Do(ctx); err != nil {
+					return fmt.Errorf("couldn't set permission %s: %w", n, err)
+				}
+			}
+		}
+		return nil
+	})
+}
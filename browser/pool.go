@@ -0,0 +1,345 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/common"
+)
+
+type ChromePoolOptions struct {
+	// count of chrome processes kept warm
+	Size int
+	// seconds after idle process is closed
+	IdleTTL int
+	// renders after process is recycled, 0 means unlimited
+	MaxRenders int
+	// failed renders in a row after process is restarted, 0 means never
+	MaxFailures int
+}
+
+type chromeInstance struct {
+	key      string
+	ctx      context.Context
+	cancel   context.CancelFunc
+	renders  int
+	inUse    int
+	failures int
+	lastUsed time.Time
+	retired  bool
+}
+
+// ChromePool keeps warm chrome processes and hands out isolated tabs of them
+type ChromePool struct {
+	options   ChromePoolOptions
+	instances []*chromeInstance
+	starting  int
+	cond      *sync.Cond
+	logger    sreCommon.Logger
+	meter     sreCommon.Meter
+	mutex     sync.Mutex
+}
+
+func (p *ChromePool) updateGauges() {
+	p.meter.Gauge("instances", "Count of warm chrome instances", nil, "browser", "pool").Set(float64(len(p.instances)))
+}
+
+// start launches new chrome process, only path and proxy are process wide
+func (p *ChromePool) start(options BrowserOptions) (*chromeInstance, error) {
+
+	opts := []chromedp.ExecAllocatorOption{}
+	opts = append(opts, chromedp.DefaultExecAllocatorOptions[:]...)
+	opts = append(opts, chromedp.DisableGPU)
+	opts = append(opts, chromedp.Flag("ignore-certificate-errors", true))
+
+	if path := discoverPath(BrowserKindChrome, options.Path); path != "" {
+		opts = append(opts, chromedp.ExecPath(path))
+	}
+	opts = append(opts, chromedp.ModifyCmdFunc(processAttr))
+	opts = append(opts, chromeEnvironment(options.Environment)...)
+
+	// credentials are given per tab on auth challenge
+	if proxy, _, _ := proxyServer(options.Proxy); proxy != "" {
+		opts = append(opts, chromedp.ProxyServer(proxy))
+	}
+
+	actx, acancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	bctx, bcancel := chromedp.NewContext(actx)
+
+	if err := chromedp.Run(bctx); err != nil {
+		bcancel()
+		acancel()
+		return nil, err
+	}
+
+	p.meter.Counter("started", "Count of started chrome instances", nil, "browser", "pool").Inc()
+
+	return &chromeInstance{
+		key: p.key(options),
+		ctx: bctx,
+		cancel: func() {
+			bcancel()
+			acancel()
+		},
+		lastUsed: time.Now(),
+	}, nil
+}
+
+func (p *ChromePool) key(options BrowserOptions) string {
+	proxy, _, _ := proxyServer(options.Proxy)
+	return options.Path + "|" + proxy
+}
+
+// remove closes instance, must be called under lock
+func (p *ChromePool) remove(inst *chromeInstance) {
+
+	found := false
+	for i, v := range p.instances {
+		if v == inst {
+			p.instances = append(p.instances[:i], p.instances[i+1:]...)
+			found = true
+			break
+		}
+	}
+	// restarted instance is removed while its renders are still released
+	if !found {
+		return
+	}
+	inst.cancel()
+	p.cond.Broadcast()
+	p.meter.Counter("closed", "Count of closed chrome instances", nil, "browser", "pool").Inc()
+	p.updateGauges()
+}
+
+// use takes instance for render, must be called under lock
+func (p *ChromePool) use(inst *chromeInstance) *chromeInstance {
+
+	inst.inUse++
+	inst.renders++
+	if p.options.MaxRenders > 0 && inst.renders >= p.options.MaxRenders {
+		inst.retired = true
+	}
+	return inst
+}
+
+// acquire returns least loaded matching instance, new one is started while pool isn't full,
+// process is started outside of lock in reserved slot, so pool never has more than its size
+func (p *ChromePool) acquire(ctx context.Context, options BrowserOptions) (*chromeInstance, error) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// waiting for free slot ends with client
+	stop := context.AfterFunc(ctx, func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.cond.Broadcast()
+	})
+	defer stop()
+
+	key := p.key(options)
+	failed := false
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// chrome process might exit on its own
+		for _, inst := range append([]*chromeInstance{}, p.instances...) {
+			if inst.ctx.Err() != nil && inst.inUse == 0 {
+				p.remove(inst)
+			}
+		}
+
+		var best *chromeInstance
+		for _, inst := range p.instances {
+			if inst.key != key || inst.retired || inst.ctx.Err() != nil {
+				continue
+			}
+			if best == nil || inst.inUse < best.inUse {
+				best = inst
+			}
+		}
+
+		full := len(p.instances)+p.starting >= p.options.Size
+		if best != nil && (best.inUse == 0 || full || failed) {
+			return p.use(best), nil
+		}
+
+		// pool is full of other keys, give up one idle instance
+		if best == nil && full {
+			for _, inst := range p.instances {
+				if inst.inUse == 0 {
+					p.remove(inst)
+					break
+				}
+			}
+			full = len(p.instances)+p.starting >= p.options.Size
+		}
+
+		// every slot is busy with other keys, wait for one to be released
+		if full {
+			p.cond.Wait()
+			continue
+		}
+
+		p.starting++
+		p.mutex.Unlock()
+		inst, err := p.start(options)
+		p.mutex.Lock()
+		p.starting--
+		p.cond.Broadcast()
+
+		if err != nil {
+			if best == nil {
+				return nil, err
+			}
+			p.logger.Warn("Couldn't start chrome instance, reusing busy one: %v", err)
+			failed = true
+			continue
+		}
+		p.instances = append(p.instances, inst)
+		p.updateGauges()
+		return p.use(inst), nil
+	}
+}
+
+// instanceFailure tells if render failed by browser, errors of page itself don't count
+func instanceFailure(err error) bool {
+
+	var navErr *NavigationError
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &navErr), errors.As(err, &statusErr):
+		return false
+	case errors.Is(err, ErrSelectorNotFound), errors.Is(err, errBlockedDomain), errors.Is(err, context.Canceled):
+		return false
+	}
+	return true
+}
+
+// release returns instance back, crashed or retired instance is closed once it's idle,
+// instance failing in a row is killed at once, so it doesn't fail renders which follow
+func (p *ChromePool) release(inst *chromeInstance, err error) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	inst.inUse--
+	inst.lastUsed = time.Now()
+	p.cond.Broadcast()
+
+	switch {
+	case errors.Is(err, ErrCrashed):
+		inst.retired = true
+	case instanceFailure(err):
+		inst.failures++
+	default:
+		inst.failures = 0
+	}
+
+	// next acquire starts new instance in place of restarted one
+	if p.options.MaxFailures > 0 && inst.failures >= p.options.MaxFailures {
+		p.logger.Warn("Restarting chrome instance after %d failed renders in a row: %v", inst.failures, err)
+		p.meter.Counter("restarted", "Count of chrome instances restarted after failed renders", nil, "browser", "pool").Inc()
+		inst.failures = 0
+		inst.retired = true
+		p.remove(inst)
+		return
+	}
+
+	if inst.retired && inst.inUse <= 0 {
+		p.remove(inst)
+	}
+}
+
+// tab returns isolated browser context of pooled instance, release gives instance back
+func (p *ChromePool) tab(ctx context.Context, options BrowserOptions) (context.Context, context.CancelFunc, func(err error), error) {
+
+	inst, err := p.acquire(ctx, options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	tabCtx, cancel := chromedp.NewContext(inst.ctx, chromedp.WithNewBrowserContext())
+
+	// client disconnect cancels tab as unpooled allocator does
+	stop := context.AfterFunc(ctx, cancel)
+
+	var once sync.Once
+	release := func(err error) {
+		once.Do(func() {
+			stop()
+			cancel()
+			p.release(inst, err)
+		})
+	}
+	return tabCtx, cancel, release, nil
+}
+
+func (p *ChromePool) sweep() {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ttl := time.Duration(p.options.IdleTTL) * time.Second
+	for _, inst := range append([]*chromeInstance{}, p.instances...) {
+		if inst.inUse == 0 && time.Since(inst.lastUsed) > ttl {
+			p.logger.Debug("Closing idle chrome instance")
+			p.remove(inst)
+		}
+	}
+}
+
+// NewBrowser creates chrome browser which renders in pooled instances
+func (p *ChromePool) NewBrowser(options BrowserOptions, observability *common.Observability) Browser {
+
+	return &ChromeBrowser{
+		options: options,
+		pool:    p,
+		logger:  observability.Logs(),
+		meter:   observability.Metrics(),
+	}
+}
+
+func (p *ChromePool) Start(wg *sync.WaitGroup) {
+
+	if p.options.IdleTTL <= 0 {
+		return
+	}
+
+	wg.Add(1)
+	go func(wg *sync.WaitGroup) {
+
+		defer wg.Done()
+		p.logger.Info("Start chrome pool...")
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			p.sweep()
+		}
+	}(wg)
+}
+
+func NewChromePool(options ChromePoolOptions, observability *common.Observability) *ChromePool {
+
+	if options.Size <= 0 {
+		options.Size = 1
+	}
+
+	p := &ChromePool{
+		options: options,
+		logger:  observability.Logs(),
+		meter:   observability.Metrics(),
+	}
+	p.cond = sync.NewCond(&p.mutex)
+	return p
+}
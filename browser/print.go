@@ -0,0 +1,195 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// PDFOptions is layout of printed page, sizes and margins are inches, zero size keeps paper
+// of browser and nil margin keeps its margin, nil background keeps browser default
+type PDFOptions struct {
+	PaperWidth      float64
+	PaperHeight     float64
+	Landscape       bool
+	MarginTop       *float64
+	MarginBottom    *float64
+	MarginLeft      *float64
+	MarginRight     *float64
+	Scale           float64
+	PrintBackground *bool
+	// pages to print e.g. 1-5, 8, 11-13, empty prints all
+	PageRanges string
+	// html of header and footer, {{pageNumber}}, {{totalPages}}, {{date}}, {{title}} and {{url}} are
+	// replaced by values of page, empty keeps default one of browser
+	HeaderTemplate string
+	FooterTemplate string
+	// bookmarks of headings up to depth, h1 to h3 when depth isn't set
+	Outline      bool
+	OutlineDepth int
+}
+
+const (
+	PDFMinScale = 0.1
+	PDFMaxScale = 2.0
+	// headings of outline are h1 to h6
+	PDFMaxOutlineDepth     = 6
+	defaultPDFOutlineDepth = 3
+	// inchCentimeters converts inches of options to centimeters of webdriver print
+	inchCentimeters = 2.54
+)
+
+// pdfPapers are portrait sizes of named papers in inches
+var pdfPapers = map[string][2]float64{
+	"letter":  {8.5, 11},
+	"legal":   {8.5, 14},
+	"tabloid": {11, 17},
+	"ledger":  {17, 11},
+	"a0":      {33.11, 46.81},
+	"a1":      {23.39, 33.11},
+	"a2":      {16.54, 23.39},
+	"a3":      {11.69, 16.54},
+	"a4":      {8.27, 11.69},
+	"a5":      {5.83, 8.27},
+	"a6":      {4.13, 5.83},
+}
+
+// pdfOutlineScript makes headings deeper than depth plain text to accessibility tree, outline of
+// chrome is built of its headings, look of page stays the same
+const pdfOutlineScript = `((depth) => {
+	for (const h of document.querySelectorAll("h1, h2, h3, h4, h5, h6")) {
+		if (Number(h.tagName.substring(1)) > depth && !h.hasAttribute("role")) {
+			h.setAttribute("role", "none");
+		}
+	}
+})(%d)`
+
+// pdfPlaceholders are classes chrome fills elements of header and footer by
+var pdfPlaceholders = []string{"pageNumber", "totalPages", "date", "title", "url"}
+
+// pdfTemplate turns placeholders to elements of classes chrome fills, spaces in braces are allowed
+func pdfTemplate(template string) string {
+
+	for _, name := range pdfPlaceholders {
+		span := fmt.Sprintf(`<span class="%s"></span>`, name)
+		template = strings.ReplaceAll(template, "{{"+name+"}}", span)
+		template = strings.ReplaceAll(template, "{{ "+name+" }}", span)
+	}
+	return template
+}
+
+// PDFPaper returns width and height of named paper, name is case insensitive
+func PDFPaper(name string) (float64, float64, bool) {
+
+	size, ok := pdfPapers[strings.ToLower(strings.TrimSpace(name))]
+	return size[0], size[1], ok
+}
+
+// pageRangesList splits ranges as webdriver print takes them
+func pageRangesList(ranges string) []string {
+
+	var list []string
+	for _, r := range strings.Split(ranges, ",") {
+		if r = strings.ReplaceAll(strings.TrimSpace(r), " ", ""); r != "" {
+			list = append(list, r)
+		}
+	}
+	return list
+}
+
+// firefoxPrintParams are params of webdriver print, background is printed unless it's disabled
+func (o PDFOptions) firefoxPrintParams() map[string]interface{} {
+
+	params := map[string]interface{}{
+		"background":  o.PrintBackground == nil || *o.PrintBackground,
+		"shrinkToFit": true,
+	}
+	if o.Landscape {
+		params["orientation"] = "landscape"
+	}
+	if o.Scale > 0 {
+		params["scale"] = o.Scale
+	}
+	if o.PaperWidth > 0 && o.PaperHeight > 0 {
+		params["page"] = map[string]interface{}{
+			"width":  o.PaperWidth * inchCentimeters,
+			"height": o.PaperHeight * inchCentimeters,
+		}
+	}
+	margin := make(map[string]interface{})
+	for name, v := range map[string]*float64{"top": o.MarginTop, "bottom": o.MarginBottom, "left": o.MarginLeft, "right": o.MarginRight} {
+		if v != nil {
+			margin[name] = *v * inchCentimeters
+		}
+	}
+	if len(margin) > 0 {
+		params["margin"] = margin
+	}
+	if ranges := pageRangesList(o.PageRanges); len(ranges) > 0 {
+		params["pageRanges"] = ranges
+	}
+	return params
+}
+
+// printAction prints page as pdf of layout options
+func (c *ChromeBrowser) printAction(r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		o := c.options.PDF
+		if o.Outline {
+			depth := o.OutlineDepth
+			if depth <= 0 {
+				depth = defaultPDFOutlineDepth
+			}
+			if depth < PDFMaxOutlineDepth {
+				if err := chromedp.Evaluate(fmt.Sprintf(pdfOutlineScript, depth), nil).Do(ctx); err != nil {
+					return err
+				}
+			}
+		}
+
+		params := page.PrintToPDF().
+			WithDisplayHeaderFooter(true).
+			WithLandscape(o.Landscape).
+			WithPageRanges(o.PageRanges)
+		if o.PaperWidth > 0 && o.PaperHeight > 0 {
+			params = params.WithPaperWidth(o.PaperWidth).WithPaperHeight(o.PaperHeight)
+		}
+		if o.MarginTop != nil {
+			params = params.WithMarginTop(*o.MarginTop)
+		}
+		if o.MarginBottom != nil {
+			params = params.WithMarginBottom(*o.MarginBottom)
+		}
+		if o.MarginLeft != nil {
+			params = params.WithMarginLeft(*o.MarginLeft)
+		}
+		if o.MarginRight != nil {
+			params = params.WithMarginRight(*o.MarginRight)
+		}
+		if o.Scale > 0 {
+			params = params.WithScale(o.Scale)
+		}
+		if o.PrintBackground != nil {
+			params = params.WithPrintBackground(*o.PrintBackground)
+		}
+		if o.HeaderTemplate != "" {
+			params = params.WithHeaderTemplate(pdfTemplate(o.HeaderTemplate))
+		}
+		if o.FooterTemplate != "" {
+			params = params.WithFooterTemplate(pdfTemplate(o.FooterTemplate))
+		}
+		// outline is made of structure of tagged pdf
+		if o.Outline {
+			params = params.WithGenerateTaggedPDF(true).WithGenerateDocumentOutline(true)
+		}
+
+		var err error
+		r.Data, _, err = params.Do(ctx)
+		return err
+	})
+}
@@ -0,0 +1,15 @@
+package browser
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// processAttr kills browser with service, as chromedp does by default
+func processAttr(cmd *exec.Cmd) {
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Pdeathsig = syscall.SIGKILL
+}
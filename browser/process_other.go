@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package browser
+
+import "os/exec"
+
+// processAttr has nothing to set, browsers are killed by their stop
+func processAttr(cmd *exec.Cmd) {
+}
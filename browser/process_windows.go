@@ -0,0 +1,37 @@
+package browser
+
+import (
+	"os/exec"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var jobOnce sync.Once
+
+// bindJob puts service in job object closed with it, processes started afterwards
+// belong to the job, so browsers and their children don't outlive crashed service
+func bindJob() error {
+
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return err
+	}
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+	// handle is kept open for life of process, closing it kills the job
+	return windows.AssignProcessToJobObject(job, windows.CurrentProcess())
+}
+
+// processAttr binds service to job before the first browser starts, failure leaves
+// browsers to be killed by their stop
+func processAttr(cmd *exec.Cmd) {
+
+	jobOnce.Do(func() { bindJob() })
+}
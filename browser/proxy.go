@@ -0,0 +1,30 @@
+package browser
+
+import (
+	"net/url"
+)
+
+const (
+	ProxySchemeHTTP   = "http"
+	ProxySchemeHTTPS  = "https"
+	ProxySchemeSOCKS5 = "socks5"
+)
+
+// proxyServer splits proxy url into server and credentials, chrome doesn't take credentials
+// in url, they are given on proxy auth challenge
+func proxyServer(proxy string) (string, string, string) {
+
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy, "", ""
+	}
+	username := u.User.Username()
+	password, _ := u.User.Password()
+	u.User = nil
+	return u.String(), username, password
+}
+
+func (c *ChromeBrowser) hasProxyAuth() bool {
+	_, username, password := proxyServer(c.options.Proxy)
+	return username != "" || password != ""
+}
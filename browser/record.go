@@ -0,0 +1,259 @@
+package browser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CDPDirectionSend    = "send"
+	CDPDirectionReceive = "receive"
+)
+
+// CDPEntry is one protocol message of recorded render, time is milliseconds since start
+type CDPEntry struct {
+	Time      int64           `json:"time"`
+	Direction string          `json:"direction"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// cdpRedactedParams are commands whose params carry headers, cookies, credentials or storage items of request
+var cdpRedactedParams = map[string]bool{
+	"Network.setExtraHTTPHeaders":           true,
+	"Network.setCookie":                     true,
+	"Network.setCookies":                    true,
+	"Storage.setCookies":                    true,
+	"Fetch.continueWithAuth":                true,
+	"Page.addScriptToEvaluateOnNewDocument": true,
+}
+
+// cdpSecretHeaders are redacted wherever headers are in messages, e.g. in network events
+var cdpSecretHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+const cdpRedacted = "[redacted]"
+
+// cdpRecorder writes protocol messages as json lines, it's fed by browser debug logger
+type cdpRecorder struct {
+	mutex   sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	started time.Time
+	path    string
+}
+
+// debugf takes "-> %s" and "<- %s" lines of chromedp connection, others are ignored
+func (r *cdpRecorder) debugf(format string, args ...interface{}) {
+
+	direction := ""
+	switch {
+	case strings.HasPrefix(format, "->"):
+		direction = CDPDirectionSend
+	case strings.HasPrefix(format, "<-"):
+		direction = CDPDirectionReceive
+	default:
+		return
+	}
+	if len(args) == 0 {
+		return
+	}
+	var message []byte
+	switch v := args[0].(type) {
+	case []byte:
+		message = v
+	case string:
+		message = []byte(v)
+	default:
+		return
+	}
+	if !json.Valid(message) {
+		return
+	}
+	message = redactCDP(message)
+
+	data, err := json.Marshal(&CDPEntry{
+		Time:      time.Since(r.started).Milliseconds(),
+		Direction: direction,
+		Message:   message,
+	})
+	if err != nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.writer == nil {
+		return
+	}
+	r.writer.Write(data)
+	r.writer.WriteByte('\n')
+}
+
+// redactCDP drops secrets of message, recording is replayed by method, so params of commands aren't needed
+func redactCDP(message []byte) []byte {
+
+	if !bytes.Contains(message, []byte(`"headers"`)) && !bytes.Contains(message, []byte(`ookies"`)) &&
+		!bytes.Contains(message, []byte(`"method"`)) {
+		return message
+	}
+
+	m := &cdpMessage{}
+	if err := json.Unmarshal(message, m); err != nil {
+		return message
+	}
+	if cdpRedactedParams[m.Method] {
+		m.Params = json.RawMessage(fmt.Sprintf(`{"redacted":%q}`, cdpRedacted))
+		if data, err := json.Marshal(m); err == nil {
+			return data
+		}
+		return message
+	}
+	if !bytes.Contains(message, []byte(`"headers"`)) && !bytes.Contains(message, []byte(`ookies"`)) {
+		return message
+	}
+
+	d := json.NewDecoder(bytes.NewReader(message))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return message
+	}
+	data, err := json.Marshal(redactCDPValue(v))
+	if err != nil {
+		return message
+	}
+	return data
+}
+
+// redactCDPValue walks message, header maps and header entries lose secret values, cookies lose all
+func redactCDPValue(v interface{}) interface{} {
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, kv := range t {
+			switch k {
+			case "cookies", "associatedCookies", "blockedCookies", "exemptedCookies":
+				t[k] = cdpRedacted
+			case "headers":
+				t[k] = redactCDPHeaders(kv)
+			default:
+				t[k] = redactCDPValue(kv)
+			}
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = redactCDPValue(t[i])
+		}
+	}
+	return v
+}
+
+// redactCDPHeaders handles both header map of network events and header entries of fetch domain
+func redactCDPHeaders(v interface{}) interface{} {
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k := range t {
+			if cdpSecretHeaders[strings.ToLower(k)] {
+				t[k] = cdpRedacted
+			}
+		}
+	case []interface{}:
+		for _, e := range t {
+			entry, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if name, ok := entry["name"].(string); ok && cdpSecretHeaders[strings.ToLower(name)] {
+				entry["value"] = cdpRedacted
+			}
+		}
+	}
+	return v
+}
+
+func (r *cdpRecorder) close() error {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.writer == nil {
+		return nil
+	}
+	err := r.writer.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.writer = nil
+	return err
+}
+
+// newCDPRecorder creates recording of render in dir, name is host and start time,
+// recording has pages and network of render, so it's readable by owner only
+func newCDPRecorder(dir string, u *url.URL) (*cdpRecorder, error) {
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("%s-%d.jsonl", recordHost(u.Hostname()), started.UnixNano()))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &cdpRecorder{
+		file:    file,
+		writer:  bufio.NewWriter(file),
+		started: started,
+		path:    path,
+	}, nil
+}
+
+// recordHost keeps host usable as file name
+func recordHost(host string) string {
+
+	host = strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(host)
+	if host == "" {
+		return "page"
+	}
+	return host
+}
+
+// LoadCDPRecording reads recording made with record dir option
+func LoadCDPRecording(path string) ([]*CDPEntry, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []*CDPEntry
+	scanner := bufio.NewScanner(file)
+	// screenshots are single messages of many megabytes
+	scanner.Buffer(make([]byte, 1024*1024), 512*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		e := &CDPEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("line %d of %s: %w", line, path, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
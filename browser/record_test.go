@@ -0,0 +1,104 @@
+package browser
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRedactCDP(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		message string
+		secrets []string
+		keep    []string
+	}{
+		{
+			name:    "extra headers",
+			message: `{"id":1,"sessionId":"S","method":"Network.setExtraHTTPHeaders","params":{"headers":{"X-Token":"header-secret"}}}`,
+			secrets: []string{"header-secret"},
+			keep:    []string{`"id":1`, `"sessionId":"S"`, "Network.setExtraHTTPHeaders"},
+		},
+		{
+			name:    "cookie",
+			message: `{"id":2,"method":"Network.setCookie","params":{"name":"token","value":"cookie-secret","url":"http://replay.test/"}}`,
+			secrets: []string{"cookie-secret"},
+		},
+		{
+			name:    "auth",
+			message: `{"id":3,"method":"Fetch.continueWithAuth","params":{"requestId":"R","authChallengeResponse":{"response":"ProvideCredentials","username":"user","password":"proxy-secret"}}}`,
+			secrets: []string{"proxy-secret"},
+		},
+		{
+			name:    "storage",
+			message: `{"id":4,"method":"Page.addScriptToEvaluateOnNewDocument","params":{"source":"seed(window.localStorage, {\"auth\":\"storage-secret\"})"}}`,
+			secrets: []string{"storage-secret"},
+		},
+		{
+			name:    "request event",
+			message: `{"method":"Network.requestWillBeSent","params":{"requestId":"R","request":{"url":"http://replay.test/","headers":{"Authorization":"Bearer header-secret","Accept":"text/html"}}}}`,
+			secrets: []string{"header-secret"},
+			keep:    []string{`"Accept":"text/html"`, "http://replay.test/"},
+		},
+		{
+			name:    "response event",
+			message: `{"method":"Network.responseReceivedExtraInfo","params":{"requestId":"R","headers":{"set-cookie":"session=server-secret"},"blockedCookies":[{"cookieLine":"session=server-secret"}]}}`,
+			secrets: []string{"server-secret"},
+		},
+		{
+			name:    "header entries",
+			message: `{"id":5,"method":"Fetch.continueRequest","params":{"requestId":"R","headers":[{"name":"Host","value":"replay.test"},{"name":"Cookie","value":"token=cookie-secret"}]}}`,
+			secrets: []string{"cookie-secret"},
+			keep:    []string{`"value":"replay.test"`},
+		},
+		{
+			name:    "screenshot",
+			message: `{"id":6,"result":{"data":"iVBORw0KGgo="}}`,
+			keep:    []string{`{"id":6,"result":{"data":"iVBORw0KGgo="}}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			redacted := string(redactCDP([]byte(tt.message)))
+			if !json.Valid([]byte(redacted)) {
+				t.Fatalf("redacted message isn't json: %s", redacted)
+			}
+			for _, s := range tt.secrets {
+				if strings.Contains(redacted, s) {
+					t.Errorf("redacted message has %s: %s", s, redacted)
+				}
+			}
+			for _, k := range tt.keep {
+				if !strings.Contains(redacted, k) {
+					t.Errorf("redacted message lost %s: %s", k, redacted)
+				}
+			}
+		})
+	}
+}
+
+func TestCDPRecorderFileMode(t *testing.T) {
+
+	u, _ := url.Parse("http://replay.test/")
+	rec, err := newCDPRecorder(t.TempDir(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.debugf("-> %s", []byte(`{"id":1,"method":"Page.enable"}`))
+	if err := rec.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(rec.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("recording mode is %o, not 600", mode)
+	}
+}
@@ -0,0 +1,272 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// cdpMessage is a command, its response or an event
+type cdpMessage struct {
+	ID        int64           `json:"id,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     json.RawMessage `json:"error,omitempty"`
+}
+
+type cdpReplayEntry struct {
+	direction string
+	message   *cdpMessage
+	raw       json.RawMessage
+}
+
+// ReplayServer serves recorded render as devtools endpoint, so browser layer runs against it
+// by remote url without chrome and network. Commands are matched to recorded ones by method
+// in order, each is answered by recorded response and events which followed it
+type ReplayServer struct {
+	entries  []*cdpReplayEntry
+	target   string
+	session  string
+	listener net.Listener
+	server   *http.Server
+	mutex    sync.Mutex
+	missed   []string
+}
+
+// replayConn is a state of one devtools connection, events of recorded sessions
+// go to the session attached last, that's the tab render runs in
+type replayConn struct {
+	server   *ReplayServer
+	ws       *websocket.Conn
+	cursor   int
+	sessions map[string]bool
+	active   string
+}
+
+// attached makes session of attach unique, tab of connection and tab of render are both attached
+func (c *replayConn) attached(session string) string {
+
+	if c.sessions[session] {
+		session = fmt.Sprintf("%s.%d", session, len(c.sessions))
+	}
+	c.sessions[session] = true
+	c.active = session
+	return session
+}
+
+func (c *replayConn) send(m *cdpMessage) error {
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return websocket.Message.Send(c.ws, string(data))
+}
+
+// synthesize answers commands missing in recording, target ones are answered by recorded
+// target and session, as tab of recorded render might be created other way than in replay
+func (c *replayConn) synthesize(cmd *cdpMessage) error {
+
+	s := c.server
+	s.mutex.Lock()
+	s.missed = append(s.missed, cmd.Method)
+	s.mutex.Unlock()
+
+	result := "{}"
+	switch cmd.Method {
+	case "Target.createBrowserContext":
+		result = `{"browserContextId":"replay"}`
+	case "Target.createTarget":
+		result = fmt.Sprintf(`{"targetId":%q}`, s.target)
+	case "Target.attachToTarget":
+		result = fmt.Sprintf(`{"sessionId":%q}`, c.attached(s.session))
+	case "Runtime.evaluate":
+		// attach checks if target is a worker by evaluating self
+		result = `{"result":{"type":"object","className":"Window"}}`
+	}
+	if err := c.send(&cdpMessage{ID: cmd.ID, SessionID: cmd.SessionID, Result: json.RawMessage(result)}); err != nil {
+		return err
+	}
+
+	// first tab is waited for by target discovery
+	if cmd.Method == "Target.setDiscoverTargets" && s.target != "" {
+		params := fmt.Sprintf(`{"targetInfo":{"targetId":%q,"type":"page","title":"","url":"about:blank","attached":false,"canAccessOpener":false}}`, s.target)
+		return c.send(&cdpMessage{Method: "Target.targetCreated", Params: json.RawMessage(params)})
+	}
+	return nil
+}
+
+func (c *replayConn) reply(cmd *cdpMessage) error {
+
+	entries := c.server.entries
+
+	match := -1
+	for i := c.cursor; i < len(entries); i++ {
+		e := entries[i]
+		if e.direction == CDPDirectionSend && e.message.Method == cmd.Method {
+			match = i
+			break
+		}
+	}
+	if match < 0 {
+		return c.synthesize(cmd)
+	}
+	c.cursor = match + 1
+	recorded := entries[match].message.ID
+
+	// events up to the next command are what the command caused
+	next := len(entries)
+	for i := match + 1; i < len(entries); i++ {
+		if entries[i].direction == CDPDirectionSend {
+			next = i
+			break
+		}
+	}
+
+	replied := false
+	for i := match + 1; i < next; i++ {
+		e := entries[i]
+		if e.direction != CDPDirectionReceive {
+			continue
+		}
+		switch {
+		case e.message.Method != "":
+			if err := c.event(e); err != nil {
+				return err
+			}
+		case e.message.ID == recorded:
+			if err := c.respond(cmd, e.message); err != nil {
+				return err
+			}
+			replied = true
+		}
+	}
+	if replied {
+		return nil
+	}
+
+	// response came after later commands were sent
+	for i := next; i < len(entries); i++ {
+		e := entries[i]
+		if e.direction == CDPDirectionReceive && e.message.Method == "" && e.message.ID == recorded {
+			return c.respond(cmd, e.message)
+		}
+	}
+	return c.synthesize(cmd)
+}
+
+func (c *replayConn) event(e *cdpReplayEntry) error {
+
+	if e.message.SessionID == "" || e.message.SessionID == c.active {
+		return websocket.Message.Send(c.ws, string(e.raw))
+	}
+	m := *e.message
+	m.SessionID = c.active
+	return c.send(&m)
+}
+
+func (c *replayConn) respond(cmd, recorded *cdpMessage) error {
+
+	m := *recorded
+	m.ID = cmd.ID
+	m.SessionID = cmd.SessionID
+	if cmd.Method == "Target.attachToTarget" {
+		var result struct {
+			SessionID string `json:"sessionId"`
+		}
+		json.Unmarshal(recorded.Result, &result)
+		m.Result = json.RawMessage(fmt.Sprintf(`{"sessionId":%q}`, c.attached(result.SessionID)))
+	}
+	return c.send(&m)
+}
+
+func (s *ReplayServer) handle(ws *websocket.Conn) {
+
+	defer ws.Close()
+	// screenshots are sent as one message
+	ws.MaxPayloadBytes = 512 * 1024 * 1024
+
+	c := &replayConn{server: s, ws: ws, sessions: make(map[string]bool)}
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			return
+		}
+		cmd := &cdpMessage{}
+		if err := json.Unmarshal(data, cmd); err != nil {
+			return
+		}
+		if err := c.reply(cmd); err != nil {
+			return
+		}
+	}
+}
+
+// URL is a remote url for browser options
+func (s *ReplayServer) URL() string {
+	return fmt.Sprintf("ws://%s/devtools/browser/replay", s.listener.Addr())
+}
+
+// Missed lists methods which weren't found in recording
+func (s *ReplayServer) Missed() []string {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.missed...)
+}
+
+func (s *ReplayServer) Close() error {
+	return s.server.Close()
+}
+
+// NewReplayServer listens on loopback port, recorded page target and session are
+// taken from first attach of recording
+func NewReplayServer(entries []*CDPEntry) (*ReplayServer, error) {
+
+	s := &ReplayServer{}
+
+	sends := make(map[int64]*cdpMessage)
+	for _, e := range entries {
+		m := &cdpMessage{}
+		if err := json.Unmarshal(e.Message, m); err != nil {
+			return nil, err
+		}
+		s.entries = append(s.entries, &cdpReplayEntry{direction: e.Direction, message: m, raw: e.Message})
+
+		switch {
+		case e.Direction == CDPDirectionSend && m.Method == "Target.attachToTarget":
+			sends[m.ID] = m
+		case e.Direction == CDPDirectionReceive && sends[m.ID] != nil && s.session == "":
+			var params struct {
+				TargetID string `json:"targetId"`
+			}
+			var result struct {
+				SessionID string `json:"sessionId"`
+			}
+			json.Unmarshal(sends[m.ID].Params, &params)
+			json.Unmarshal(m.Result, &result)
+			s.target, s.session = params.TargetID, result.SessionID
+		}
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s.listener = listener
+
+	// chromedp sends no origin, handshake accepts any
+	ws := websocket.Server{
+		Handler:   s.handle,
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+	}
+	s.server = &http.Server{Handler: ws}
+	go s.server.Serve(listener)
+	return s, nil
+}
@@ -0,0 +1,126 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/common"
+)
+
+// rerecord passes session through recorder, so replay runs on recording as record dir has it
+func rerecord(t *testing.T, path string) string {
+
+	entries, err := LoadCDPRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse("http://replay.test/")
+	rec, err := newCDPRecorder(t.TempDir(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		format := "<- %s"
+		if e.Direction == CDPDirectionSend {
+			format = "-> %s"
+		}
+		rec.debugf(format, []byte(e.Message))
+	}
+	if err := rec.close(); err != nil {
+		t.Fatal(err)
+	}
+	return rec.path
+}
+
+// fixtures are cdp sessions of render waiting for expression, in format of record dir
+func TestReplayServerWait(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		fixture string
+		partial bool
+	}{
+		{"ready", "wait-ready.jsonl", false},
+		{"timeout", "wait-timeout.jsonl", true},
+	}
+
+	obs := common.NewObservability(common.ObservabilityOptions{}, sreCommon.NewLogs(), sreCommon.NewMetrics())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			path := rerecord(t, filepath.Join("testdata", tt.fixture))
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range []string{"header-secret", "cookie-secret", "storage-secret", "server-secret"} {
+				if bytes.Contains(data, []byte(s)) {
+					t.Errorf("recording has %s", s)
+				}
+			}
+
+			entries, err := LoadCDPRecording(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server, err := NewReplayServer(entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+
+			browser := NewChromeBrowser(BrowserOptions{
+				Width:          64,
+				Height:         48,
+				Timeout:        10,
+				RemoteURL:      server.URL(),
+				WaitExpression: `document.body.dataset.ready === "yes"`,
+				WaitTimeout:    2,
+				Partial:        true,
+				HeadersMap:     map[string]interface{}{"Authorization": "Bearer header-secret"},
+				Cookies:        map[string]string{"token": "cookie-secret"},
+				LocalStorage:   map[string]string{"auth": "storage-secret"},
+			}, obs)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			u, _ := url.Parse("http://replay.test/")
+			image, err := browser.Image(ctx, u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if missed := server.Missed(); len(missed) > 0 {
+				t.Errorf("commands missing in recording: %s", strings.Join(missed, ", "))
+			}
+			if image.Status != 200 {
+				t.Errorf("status is %d, not 200", image.Status)
+			}
+			if image.FinalURL != u.String() {
+				t.Errorf("final url is %s, not %s", image.FinalURL, u)
+			}
+			if image.Partial != tt.partial {
+				t.Errorf("partial is %v, not %v", image.Partial, tt.partial)
+			}
+
+			screenshot, err := png.Decode(bytes.NewReader(image.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := screenshot.Bounds(); b.Dx() != 64 || b.Dy() != 48 {
+				t.Errorf("screenshot is %dx%d, not 64x48", b.Dx(), b.Dy())
+			}
+		})
+	}
+}
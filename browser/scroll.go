@@ -0,0 +1,102 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	defaultScrollDelay = 100
+	defaultScrollMax   = 20000
+)
+
+// scrollScript scrolls by steps till bottom or max, step is viewport height unless set,
+// page is scrolled back to top, so sticky headers are where they belong
+const scrollScript = `(async (step, delay, max) => {
+	step = step > 0 ? step : window.innerHeight;
+	let scrolled = 0;
+	while (scrolled < max) {
+		window.scrollBy(0, step);
+		scrolled += step;
+		await new Promise(r => setTimeout(r, delay));
+		const height = Math.max(document.documentElement.scrollHeight, document.body ? document.body.scrollHeight : 0);
+		if (window.scrollY + window.innerHeight >= height) {
+			break;
+		}
+	}
+	window.scrollTo(0, 0);
+	return scrolled;
+})(%d, %d, %d)`
+
+// scrollToScript scrolls to position, it's returned as page might be shorter or narrower
+const scrollToScript = `((x, y) => {
+	window.scrollTo(x, y);
+	return [Math.round(window.scrollX), Math.round(window.scrollY)];
+})(%d, %d)`
+
+// hasScrollTo is true if page is to be captured scrolled
+func (o BrowserOptions) hasScrollTo() bool {
+	return o.ScrollX > 0 || o.ScrollY > 0
+}
+
+// scrollToAction scrolls viewport to position set, capture is of what's seen there
+func (c *ChromeBrowser) scrollToAction() chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		var position []int
+		if err := chromedp.Evaluate(fmt.Sprintf(scrollToScript, c.options.ScrollX, c.options.ScrollY), &position).Do(ctx); err != nil {
+			return err
+		}
+		if len(position) == 2 && (position[0] != c.options.ScrollX || position[1] != c.options.ScrollY) {
+			c.debug("Scrolled to %d,%d instead of %d,%d, page is smaller", position[0], position[1], c.options.ScrollX, c.options.ScrollY)
+		}
+		return nil
+	})
+}
+
+// scrollTo scrolls viewport of firefox to position set
+func (f *FirefoxBrowser) scrollTo(ctx context.Context, m *marionette) error {
+
+	var position []int
+	script := fmt.Sprintf("return "+scrollToScript+";", f.options.ScrollX, f.options.ScrollY)
+	if err := f.script(ctx, m, script, &position); err != nil {
+		return err
+	}
+	if len(position) == 2 && (position[0] != f.options.ScrollX || position[1] != f.options.ScrollY) {
+		f.logger.Debug("Scrolled to %d,%d instead of %d,%d, page is smaller", position[0], position[1], f.options.ScrollX, f.options.ScrollY)
+	}
+	return nil
+}
+
+// scrollAction scrolls page to bottom, so lazy images and infinite lists are loaded before capture
+func (c *ChromeBrowser) scrollAction() chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		delay := c.options.ScrollDelay
+		if delay <= 0 {
+			delay = defaultScrollDelay
+		}
+		max := c.options.ScrollMax
+		if max <= 0 {
+			max = defaultScrollMax
+		}
+
+		started := time.Now()
+		var scrolled int
+		script := fmt.Sprintf(scrollScript, c.options.ScrollStep, delay, max)
+		err := chromedp.Evaluate(script, &scrolled, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		}).Do(ctx)
+		if err != nil {
+			return err
+		}
+		c.debug("Scrolled %dpx in %s", scrolled, time.Since(started))
+		return nil
+	})
+}
@@ -0,0 +1,43 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/storage"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	ServiceWorkersBlock      = "block"
+	ServiceWorkersUnregister = "unregister"
+)
+
+const serviceWorkersBlockScript = `(() => {
+	if (navigator.serviceWorker) {
+		navigator.serviceWorker.register = () => Promise.reject(new Error("service workers are blocked"));
+	}
+})()`
+
+// serviceWorkersAction blocks registration or unregisters existing service workers of url origin
+func (c *ChromeBrowser) serviceWorkersAction(u *url.URL) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		switch c.options.ServiceWorkers {
+		case ServiceWorkersBlock:
+			if err := network.SetBypassServiceWorker(true).Do(ctx); err != nil {
+				return err
+			}
+			_, err := page.AddScriptToEvaluateOnNewDocument(serviceWorkersBlockScript).Do(ctx)
+			return err
+		case ServiceWorkersUnregister:
+			origin := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+			return storage.ClearDataForOrigin(origin, "service_workers").Do(ctx)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,382 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/net/html"
+)
+
+const BrowserKindSimple = "simple"
+
+// body read limit when max dom size isn't set
+const simpleMaxBodySize = 10 * 1024 * 1024
+
+const (
+	simpleMargin     = 16
+	simpleLineHeight = 17
+)
+
+// SimpleBrowser fetches page over plain http and draws its text, no javascript or css is involved
+type SimpleBrowser struct {
+	options BrowserOptions
+	logger  sreCommon.Logger
+	meter   sreCommon.Meter
+}
+
+type simpleBlock struct {
+	Text    string
+	Heading bool
+}
+
+// blockTags start new text block
+var simpleBlockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "section": true, "article": true,
+	"header": true, "footer": true, "pre": true, "blockquote": true, "table": true, "ul": true, "ol": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "title": true,
+}
+
+var simpleSkipTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true, "iframe": true,
+}
+
+func (s *SimpleBrowser) client() *http.Client {
+
+	transport := &http.Transport{
+		// chrome ignores certificate errors as well
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	if !utils.IsEmpty(s.options.Proxy) {
+		if u, err := url.Parse(s.options.Proxy); err == nil {
+			transport.Proxy = http.ProxyURL(u)
+		}
+	}
+
+	// redirect to blocked domain is refused the way chrome fails it
+	checkRedirect := func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if domain := BlockedDomain(s.options.BlockedDomains, req.URL.Hostname()); domain != "" {
+			return fmt.Errorf("%w: %s by %s", errBlockedDomain, req.URL.Hostname(), domain)
+		}
+		return s.deniedHost(req.URL)
+	}
+	return &http.Client{Transport: transport, CheckRedirect: checkRedirect}
+}
+
+// deniedHost fails request to host of host filter
+func (s *SimpleBrowser) deniedHost(u *url.URL) error {
+
+	if s.options.HostFilter == nil {
+		return nil
+	}
+	if v := s.options.HostFilter(u.Hostname()); v != "" {
+		return fmt.Errorf("%w: %s", ErrDeniedHost, v)
+	}
+	return nil
+}
+
+func (s *SimpleBrowser) request(ctx context.Context, u *url.URL) (*http.Request, error) {
+
+	if err := s.deniedHost(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !utils.IsEmpty(s.options.UserAgent) {
+		req.Header.Set("User-Agent", s.options.UserAgent)
+	}
+	if !utils.IsEmpty(s.options.AcceptLanguage) {
+		req.Header.Set("Accept-Language", s.options.AcceptLanguage)
+	}
+	for k, v := range s.options.HeadersMap {
+		req.Header.Set(k, fmt.Sprintf("%v", v))
+	}
+	if !utils.IsEmpty(s.options.HostHeader) {
+		req.Host = s.options.HostHeader
+	}
+	for k, v := range s.options.Cookies {
+		req.AddCookie(&http.Cookie{Name: k, Value: v})
+	}
+	// there is no challenge round trip, so it's basic only
+	if s.options.Username != "" || s.options.Password != "" {
+		req.SetBasicAuth(s.options.Username, s.options.Password)
+	}
+	if s.options.BrowserCache == BrowserCacheDisabled || s.options.BrowserCache == BrowserCacheBypass {
+		req.Header.Set("Cache-Control", "no-cache")
+	}
+	return req, nil
+}
+
+// blocks walks html and collects visible text split by block elements
+func (s *SimpleBrowser) blocks(doc *html.Node) []*simpleBlock {
+
+	var blocks []*simpleBlock
+	var current strings.Builder
+	heading := false
+
+	flush := func() {
+		text := strings.Join(strings.Fields(current.String()), " ")
+		if text != "" {
+			blocks = append(blocks, &simpleBlock{Text: text, Heading: heading})
+		}
+		current.Reset()
+		heading = false
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+
+		if n.Type == html.ElementNode {
+			if simpleSkipTags[n.Data] {
+				return
+			}
+			if simpleBlockTags[n.Data] {
+				flush()
+				heading = n.Data == "title" || (len(n.Data) == 2 && n.Data[0] == 'h' && n.Data[1] >= '1' && n.Data[1] <= '6')
+			}
+		}
+		if n.Type == html.TextNode {
+			current.WriteString(n.Data)
+			current.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type == html.ElementNode && simpleBlockTags[n.Data] {
+			flush()
+		}
+	}
+	walk(doc)
+	flush()
+	return blocks
+}
+
+// wrap splits text by words to lines of max chars
+func (s *SimpleBrowser) wrap(text string, max int) []string {
+
+	if max < 1 {
+		max = 1
+	}
+
+	var lines []string
+	line := ""
+	for _, w := range strings.Fields(text) {
+		for len([]rune(w)) > max {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			r := []rune(w)
+			lines = append(lines, string(r[:max]))
+			w = string(r[max:])
+		}
+		switch {
+		case line == "":
+			line = w
+		case len([]rune(line))+1+len([]rune(w)) <= max:
+			line += " " + w
+		default:
+			lines = append(lines, line)
+			line = w
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (s *SimpleBrowser) draw(blocks []*simpleBlock) ([]byte, error) {
+
+	face := basicfont.Face7x13
+	width := s.options.Width
+	if width <= 2*simpleMargin {
+		width = 2*simpleMargin + face.Advance
+	}
+	max := (width - 2*simpleMargin) / face.Advance
+
+	type line struct {
+		text string
+		bold bool
+	}
+	var lines []line
+	for i, b := range blocks {
+		if i > 0 {
+			lines = append(lines, line{})
+		}
+		for _, l := range s.wrap(b.Text, max) {
+			lines = append(lines, line{text: l, bold: b.Heading})
+		}
+	}
+
+	height := s.options.Height
+	content := 2*simpleMargin + len(lines)*simpleLineHeight
+	if s.options.FullPage && content > height {
+		height = content
+	}
+	if height <= 0 {
+		height = content
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(color.Black),
+		Face: face,
+	}
+	for i, l := range lines {
+		y := simpleMargin + (i+1)*simpleLineHeight - 4
+		if y > height {
+			break
+		}
+		d.Dot = fixed.P(simpleMargin, y)
+		d.DrawString(l.text)
+		// there is no bold face, so headings are drawn twice
+		if l.bold {
+			d.Dot = fixed.P(simpleMargin+1, y)
+			d.DrawString(l.text)
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if s.options.Quality > 0 && s.options.Quality < 100 {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: s.options.Quality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), err
+}
+
+func (s *SimpleBrowser) Image(ctx context.Context, u *url.URL) (*BrowserImage, error) {
+
+	r := &BrowserImage{}
+
+	timeout := time.Duration(s.options.Timeout) * time.Second
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := s.request(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timeout exceeded: %w", err)
+		}
+		if navErr := newHttpNavigationError(err); navErr != nil {
+			return nil, navErr
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	r.Status = resp.StatusCode
+	r.FinalURL = resp.Request.URL.String()
+	if len(s.options.ScreenshotCodes) > 0 && !utils.Contains(s.options.ScreenshotCodes, r.Status) {
+		return nil, &StatusError{Status: r.Status}
+	}
+
+	limit := int64(simpleMaxBodySize)
+	if s.options.MaxDOMSize > 0 {
+		limit = int64(s.options.MaxDOMSize)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) || !s.options.Partial {
+			return nil, err
+		}
+		r.Partial = true
+	}
+	if int64(len(body)) > limit {
+		body = body[:limit]
+		r.DOMTruncated = true
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+
+	// images are simple documents already
+	if strings.HasPrefix(contentType, "image/") && !s.options.AsPDF {
+		r.Data = body
+		return r, nil
+	}
+
+	var blocks []*simpleBlock
+	if strings.HasPrefix(contentType, "text/plain") {
+		for _, l := range strings.Split(string(body), "\n") {
+			blocks = append(blocks, &simpleBlock{Text: l})
+		}
+	} else {
+		doc, err := html.Parse(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		blocks = s.blocks(doc)
+	}
+
+	if s.options.CaptureDOM {
+		r.DOM = string(body)
+	}
+
+	if t := findText(string(body), s.options.ChallengeTexts); t != "" {
+		r.Page, r.PageReason = PageChallenge, fmt.Sprintf("text %s", t)
+	} else if t := findText(string(body), s.options.ErrorTexts); t != "" {
+		r.Page, r.PageReason = PageError, fmt.Sprintf("text %s", t)
+	}
+
+	if s.options.AsPDF {
+		r.Data = simplePDF(blocks)
+		return r, nil
+	}
+
+	r.Data, err = s.draw(blocks)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *SimpleBrowser) Kind() string {
+	return BrowserKindSimple
+}
+
+func NewSimpleBrowser(options BrowserOptions, observability *common.Observability) Browser {
+
+	return &SimpleBrowser{
+		options: options,
+		logger:  observability.Logs(),
+		meter:   observability.Metrics(),
+	}
+}
@@ -0,0 +1,43 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chromedp/cdproto/domsnapshot"
+	"github.com/chromedp/chromedp"
+)
+
+// computed styles captured when none are configured
+var defaultSnapshotStyles = []string{
+	"display", "visibility", "opacity", "position", "z-index", "overflow",
+	"color", "background-color", "font-family", "font-size", "font-weight", "line-height",
+}
+
+type domSnapshot struct {
+	Documents []*domsnapshot.DocumentSnapshot `json:"documents"`
+	Strings   []string                        `json:"strings"`
+}
+
+// snapshotAction captures dom nodes, layout boxes and computed styles as json
+func (c *ChromeBrowser) snapshotAction(r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		styles := c.options.SnapshotStyles
+		if len(styles) == 0 {
+			styles = defaultSnapshotStyles
+		}
+
+		documents, strings, err := domsnapshot.CaptureSnapshot(styles).
+			WithIncludeDOMRects(true).
+			WithIncludePaintOrder(true).
+			Do(ctx)
+		if err != nil {
+			return err
+		}
+
+		r.DOMSnapshot, err = json.Marshal(&domSnapshot{Documents: documents, Strings: strings})
+		return err
+	})
+}
@@ -0,0 +1,76 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	StageNavigation = "navigation"
+	StageSettle     = "settle"
+	StageCapture    = "capture"
+)
+
+// Stage is time render spent in navigation till load, in waits after load or in capture,
+// durations are milliseconds, budget is zero if stage is bound by render timeout only
+type Stage struct {
+	Name     string `json:"name"`
+	Duration int64  `json:"duration"`
+	Budget   int64  `json:"budget,omitempty"`
+	Exceeded bool   `json:"exceeded,omitempty"`
+}
+
+// stageAction runs actions of stage within its budget of seconds, exceeded budget is a timeout
+// as one of render, so partial render takes whatever page has
+func (c *ChromeBrowser) stageAction(name string, budget int, actions chromedp.Tasks, r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		s := &Stage{Name: name, Budget: int64(budget) * 1000}
+		sctx := ctx
+		if budget > 0 {
+			var cancel context.CancelFunc
+			sctx, cancel = context.WithTimeout(ctx, time.Duration(budget)*time.Second)
+			defer cancel()
+		}
+
+		c.options.Events.Event(RenderEventStage, "%s started", name)
+		started := time.Now()
+		err := actions.Do(sctx)
+		s.Duration = time.Since(started).Milliseconds()
+		s.Exceeded = budget > 0 && ctx.Err() == nil && errors.Is(sctx.Err(), context.DeadlineExceeded)
+		r.Stages = append(r.Stages, s)
+
+		if s.Exceeded {
+			c.debug("Stage %s exceeded its budget of %ds", name, budget)
+			c.options.Events.Event(RenderEventStage, "%s exceeded its budget of %ds", name, budget)
+		}
+		c.options.Events.Event(RenderEventStage, "%s finished in %dms", name, s.Duration)
+		return err
+	})
+}
+
+// stageTasks splits actions into stages, navigation ones end at end of navigation, the ones
+// of waits end at end of settle
+func (c *ChromeBrowser) stageTasks(r *BrowserImage, actions chromedp.Tasks, navigationEnd, settleEnd int) chromedp.Tasks {
+
+	var tasks chromedp.Tasks
+	stages := []struct {
+		name    string
+		budget  int
+		actions chromedp.Tasks
+	}{
+		{StageNavigation, c.options.NavigationTimeout, actions[:navigationEnd]},
+		{StageSettle, c.options.SettleTimeout, actions[navigationEnd:settleEnd]},
+		{StageCapture, c.options.CaptureTimeout, actions[settleEnd:]},
+	}
+	for _, s := range stages {
+		if len(s.actions) > 0 {
+			tasks = append(tasks, c.stageAction(s.name, s.budget, s.actions, r))
+		}
+	}
+	return tasks
+}
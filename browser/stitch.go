@@ -0,0 +1,178 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	DirectionVertical   = "vertical"
+	DirectionHorizontal = "horizontal"
+)
+
+const stitchMaxSteps = 100
+
+// stitchFindScript marks element to scroll, the one of selector or the largest one scrolling
+// horizontally, page itself if it scrolls and nothing else does
+const stitchFindScript = `((selector) => {
+	const scrolls = (e) => e.scrollWidth > e.clientWidth + 1 && ["auto", "scroll"].includes(getComputedStyle(e).overflowX);
+	let el = null;
+	if (selector) {
+		el = document.querySelector(selector);
+	} else {
+		let area = 0;
+		for (const e of document.querySelectorAll("body *")) {
+			if (scrolls(e) && e.clientWidth * e.clientHeight > area) {
+				el = e;
+				area = e.clientWidth * e.clientHeight;
+			}
+		}
+	}
+	const page = document.scrollingElement;
+	if (!el && page && page.scrollWidth > page.clientWidth + 1) {
+		el = page;
+	}
+	if (!el) {
+		return false;
+	}
+	el.setAttribute("data-webrender-stitch", "");
+	if (el !== page) {
+		el.scrollIntoView({block: "nearest", inline: "nearest"});
+	}
+	return true;
+})(%s)`
+
+// stitchStepScript scrolls marked element and returns its visible box in page coordinates
+const stitchStepScript = `((x) => {
+	const el = document.querySelector("[data-webrender-stitch]");
+	el.scrollLeft = x;
+	const d = document.documentElement.getBoundingClientRect();
+	const box = {scroll: el.scrollLeft, scrollWidth: el.scrollWidth};
+	if (el === document.scrollingElement) {
+		return Object.assign(box, {x: -d.left, y: -d.top, width: el.clientWidth, height: el.clientHeight});
+	}
+	const r = el.getBoundingClientRect();
+	return Object.assign(box, {x: r.left + el.clientLeft - d.left, y: r.top + el.clientTop - d.top, width: el.clientWidth, height: el.clientHeight});
+})(%d)`
+
+type stitchBox struct {
+	Scroll      float64 `json:"scroll"`
+	ScrollWidth float64 `json:"scrollWidth"`
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+}
+
+// stitchTile captures visible box of element scrolled to x
+func (c *ChromeBrowser) stitchTile(ctx context.Context, x int, delay time.Duration) (*stitchBox, image.Image, error) {
+
+	box := &stitchBox{}
+	if err := chromedp.Evaluate(fmt.Sprintf(stitchStepScript, x), box).Do(ctx); err != nil {
+		return nil, nil, err
+	}
+	if box.Width < 1 || box.Height < 1 {
+		return nil, nil, fmt.Errorf("%w: element to stitch isn't visible", ErrNothingToStitch)
+	}
+	// lazy cells are given time to render
+	if err := chromedp.Sleep(delay).Do(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	data, err := page.CaptureScreenshot().
+		WithFormat(page.CaptureScreenshotFormatPng).
+		WithCaptureBeyondViewport(true).
+		WithFromSurface(true).
+		WithClip(&page.Viewport{
+			X:      math.Round(box.X),
+			Y:      math.Round(box.Y),
+			Width:  math.Round(box.Width),
+			Height: math.Round(box.Height),
+			Scale:  1,
+		}).
+		Do(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tile, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	return box, tile, nil
+}
+
+// stitchAction scrolls element horizontally by its visible width and puts captures side by side,
+// so wide tables and charts are seen whole, full page screenshot doesn't scroll elements
+func (c *ChromeBrowser) stitchAction(r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		selector, err := json.Marshal(c.options.Selector)
+		if err != nil {
+			return err
+		}
+		var found bool
+		if err := chromedp.Evaluate(fmt.Sprintf(stitchFindScript, selector), &found).Do(ctx); err != nil {
+			return err
+		}
+		if !found && c.options.Selector != "" {
+			return fmt.Errorf("%w: %s", ErrSelectorNotFound, c.options.Selector)
+		}
+		if !found {
+			return ErrNothingToStitch
+		}
+
+		delay := time.Duration(c.options.ScrollDelay) * time.Millisecond
+		if delay <= 0 {
+			delay = defaultScrollDelay * time.Millisecond
+		}
+
+		var canvas *image.RGBA
+		ratio := 1.0
+		x := 0
+		last := -1.0
+		for step := 0; step < stitchMaxSteps; step++ {
+
+			box, tile, err := c.stitchTile(ctx, x, delay)
+			if err != nil {
+				return err
+			}
+			// tiles are in device pixels
+			if canvas == nil {
+				ratio = float64(tile.Bounds().Dx()) / math.Round(box.Width)
+				width := int(math.Round(box.ScrollWidth * ratio))
+				canvas = image.NewRGBA(image.Rect(0, 0, max(width, tile.Bounds().Dx()), tile.Bounds().Dy()))
+			}
+			left := int(math.Round(box.Scroll * ratio))
+			draw.Draw(canvas, tile.Bounds().Add(image.Pt(left, 0)), tile, tile.Bounds().Min, draw.Src)
+
+			// element doesn't scroll further, e.g. it shrank
+			if box.Scroll+box.Width >= box.ScrollWidth-1 || box.Scroll <= last {
+				c.debug("Stitched %d captures of %.0fpx wide element", step+1, box.ScrollWidth)
+				break
+			}
+			last = box.Scroll
+			x = int(box.Scroll + box.Width)
+		}
+
+		var buf bytes.Buffer
+		if c.options.Quality > 0 && c.options.Quality < 100 {
+			err = jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: c.options.Quality})
+		} else {
+			err = png.Encode(&buf, canvas)
+		}
+		r.Data = buf.Bytes()
+		return err
+	})
+}
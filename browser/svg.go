@@ -0,0 +1,61 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/chromedp/chromedp"
+)
+
+const FormatSVG = "svg"
+
+// svgScript clones page or element with inlined computed styles into svg foreignObject
+const svgScript = `((selector) => {
+	const root = selector ? document.querySelector(selector) : document.documentElement;
+	if (!root) {
+		return "";
+	}
+	const rect = selector ? root.getBoundingClientRect() :
+		{width: document.documentElement.scrollWidth, height: document.documentElement.scrollHeight};
+
+	const clone = root.cloneNode(true);
+	const src = [root, ...root.querySelectorAll("*")];
+	const dst = [clone, ...clone.querySelectorAll("*")];
+	src.forEach((el, i) => {
+		const cs = getComputedStyle(el);
+		let style = "";
+		for (const p of cs) {
+			style += p + ":" + cs.getPropertyValue(p) + ";";
+		}
+		dst[i].setAttribute("style", style);
+	});
+	clone.querySelectorAll("script,noscript").forEach((el) => el.remove());
+
+	const w = Math.ceil(rect.width), h = Math.ceil(rect.height);
+	const xhtml = new XMLSerializer().serializeToString(clone);
+	return '<svg xmlns="http://www.w3.org/2000/svg" width="' + w + '" height="' + h + '" viewBox="0 0 ' + w + ' ' + h + '">' +
+		'<foreignObject x="0" y="0" width="100%%" height="100%%">' + xhtml + '</foreignObject></svg>';
+})(%s)`
+
+// svgAction serializes page or selected element to svg, it's experimental as svg viewers render foreignObject differently
+func (c *ChromeBrowser) svgAction(r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		selector, err := json.Marshal(c.options.Selector)
+		if err != nil {
+			return err
+		}
+
+		var svg string
+		if err := chromedp.Evaluate(fmt.Sprintf(svgScript, selector), &svg).Do(ctx); err != nil {
+			return err
+		}
+		if svg == "" {
+			return fmt.Errorf("%w: %s", ErrSelectorNotFound, c.options.Selector)
+		}
+		r.Data = []byte(svg)
+		return nil
+	})
+}
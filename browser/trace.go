@@ -0,0 +1,85 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/chromedp/cdproto/io"
+	"github.com/chromedp/cdproto/tracing"
+	"github.com/chromedp/chromedp"
+)
+
+// categories traced when none are configured, close to devtools performance panel
+var defaultTraceCategories = []string{
+	"devtools.timeline", "v8.execute", "disabled-by-default-devtools.timeline",
+	"disabled-by-default-devtools.timeline.frame", "toplevel", "blink.console", "blink.user_timing",
+	"latencyInfo", "disabled-by-default-devtools.timeline.stack", "disabled-by-default-v8.cpu_profiler",
+}
+
+type chromeTrace struct {
+	complete chan *tracing.EventTracingComplete
+}
+
+// startTraceAction starts tracing to stream, trace is read once tracing is ended
+func (c *ChromeBrowser) startTraceAction(tr *chromeTrace) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		chromedp.ListenTarget(ctx, func(ev interface{}) {
+			if e, ok := ev.(*tracing.EventTracingComplete); ok {
+				select {
+				case tr.complete <- e:
+				default:
+				}
+			}
+		})
+
+		categories := c.options.TraceCategories
+		if len(categories) == 0 {
+			categories = defaultTraceCategories
+		}
+
+		return tracing.Start().
+			WithTransferMode(tracing.TransferModeReturnAsStream).
+			WithStreamFormat(tracing.StreamFormatJSON).
+			WithTraceConfig(&tracing.TraceConfig{IncludedCategories: categories}).
+			Do(ctx)
+	})
+}
+
+// endTraceAction ends tracing and reads json trace to be opened by perfetto or devtools
+func (c *ChromeBrowser) endTraceAction(tr *chromeTrace, r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		if err := tracing.End().Do(ctx); err != nil {
+			return err
+		}
+
+		var e *tracing.EventTracingComplete
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e = <-tr.complete:
+		}
+		if e.Stream == "" {
+			return errors.New("tracing returned no stream")
+		}
+		defer io.Close(e.Stream).Do(ctx)
+
+		var buf bytes.Buffer
+		for {
+			data, eof, err := io.Read(e.Stream).Do(ctx)
+			if err != nil {
+				return err
+			}
+			buf.WriteString(data)
+			if eof {
+				break
+			}
+		}
+		r.Trace = buf.Bytes()
+		return nil
+	})
+}
@@ -0,0 +1,59 @@
+package browser
+
+import (
+	"strings"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+// hasUserAgentHints tells if any client hint is configured
+func (c *ChromeBrowser) hasUserAgentHints() bool {
+
+	o := c.options
+	return len(o.UserAgentBrands) > 0 || o.UserAgentPlatform != "" || o.UserAgentPlatformVersion != "" ||
+		o.UserAgentArchitecture != "" || o.UserAgentModel != "" || o.UserAgentMobile
+}
+
+func (c *ChromeBrowser) hasUserAgentMetadata() bool {
+	return c.hasUserAgentHints() || c.options.AcceptLanguage != ""
+}
+
+// brands are in form of name:version
+func (c *ChromeBrowser) userAgentBrands() []*emulation.UserAgentBrandVersion {
+
+	var brands []*emulation.UserAgentBrandVersion
+	for _, b := range c.options.UserAgentBrands {
+
+		kv := strings.SplitN(b, ":", 2)
+		brand := &emulation.UserAgentBrandVersion{
+			Brand: strings.TrimSpace(kv[0]),
+		}
+		if len(kv) > 1 {
+			brand.Version = strings.TrimSpace(kv[1])
+		}
+		brands = append(brands, brand)
+	}
+	return brands
+}
+
+// userAgentAction overrides user agent client hints (Sec-CH-UA*) and accept language,
+// hints are sent only if they're configured, otherwise browser ones stay
+func (c *ChromeBrowser) userAgentAction() chromedp.Action {
+
+	override := emulation.SetUserAgentOverride(c.options.UserAgent)
+	if c.hasUserAgentHints() {
+		override = override.WithUserAgentMetadata(&emulation.UserAgentMetadata{
+			Brands:          c.userAgentBrands(),
+			Platform:        c.options.UserAgentPlatform,
+			PlatformVersion: c.options.UserAgentPlatformVersion,
+			Architecture:    c.options.UserAgentArchitecture,
+			Model:           c.options.UserAgentModel,
+			Mobile:          c.options.UserAgentMobile,
+		})
+	}
+	if c.options.AcceptLanguage != "" {
+		override = override.WithAcceptLanguage(c.options.AcceptLanguage)
+	}
+	return override
+}
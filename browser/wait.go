@@ -0,0 +1,79 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const waitExpressionInterval = 100 * time.Millisecond
+
+// waitExpressionTimeout is wait timeout, zero leaves it to render timeout
+func waitExpressionTimeout(options BrowserOptions) time.Duration {
+	return time.Duration(options.WaitTimeout) * time.Second
+}
+
+// waitExpressionErr is a timeout, partial render goes on with whatever page has
+func waitExpressionErr(options BrowserOptions, r *BrowserImage) error {
+
+	if options.Partial {
+		r.Partial = true
+		return nil
+	}
+	return fmt.Errorf("%w: wait expression %s isn't truthy", context.DeadlineExceeded, options.WaitExpression)
+}
+
+// waitExpressionAction polls expression in page, apps signal readiness by e.g. window.__renderReady
+func (c *ChromeBrowser) waitExpressionAction(r *BrowserImage) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		// truthy value of any type is taken as a bool
+		var ok bool
+		err := chromedp.Poll(fmt.Sprintf("!!(%s)", c.options.WaitExpression), &ok,
+			chromedp.WithPollingInterval(waitExpressionInterval),
+			chromedp.WithPollingTimeout(waitExpressionTimeout(c.options)),
+		).Do(ctx)
+		if errors.Is(err, chromedp.ErrPollingTimeout) {
+			c.debug("Wait expression %s isn't truthy, it timed out", c.options.WaitExpression)
+			return waitExpressionErr(c.options, r)
+		}
+		return err
+	})
+}
+
+// waitExpression polls expression by marionette script, there is no poll of its own
+func (f *FirefoxBrowser) waitExpression(ctx context.Context, m *marionette, r *BrowserImage) error {
+
+	parent := ctx
+	if timeout := waitExpressionTimeout(f.options); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	script := fmt.Sprintf("return !!(%s);", f.options.WaitExpression)
+	ticker := time.NewTicker(waitExpressionInterval)
+	defer ticker.Stop()
+	for {
+		var ok bool
+		if err := f.script(ctx, m, script, &ok); err != nil && ctx.Err() == nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			// render timeout is the one of whole render, not of wait
+			if err := parent.Err(); err != nil {
+				return fmt.Errorf("timeout exceeded: %w", err)
+			}
+			return waitExpressionErr(f.options, r)
+		case <-ticker.C:
+		}
+	}
+}
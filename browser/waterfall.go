@@ -0,0 +1,154 @@
+package browser
+
+import (
+	"math"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+)
+
+// Resource is a compact network log entry, times are milliseconds since first request
+type Resource struct {
+	URL       string          `json:"url"`
+	Type      string          `json:"type,omitempty"`
+	Status    int             `json:"status,omitempty"`
+	Size      int64           `json:"size"`
+	FromCache bool            `json:"fromCache,omitempty"`
+	Start     float64         `json:"start"`
+	Duration  float64         `json:"duration"`
+	Timing    *ResourceTiming `json:"timing,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// ResourceTiming is a breakdown of request phases in milliseconds, missing phases are 0
+type ResourceTiming struct {
+	DNS     float64 `json:"dns,omitempty"`
+	Connect float64 `json:"connect,omitempty"`
+	SSL     float64 `json:"ssl,omitempty"`
+	Send    float64 `json:"send,omitempty"`
+	Wait    float64 `json:"wait,omitempty"`
+}
+
+type chromeWaterfall struct {
+	mutex     sync.Mutex
+	start     float64
+	resources []*Resource
+	requests  map[network.RequestID]*Resource
+	started   map[network.RequestID]float64
+}
+
+// seconds converts monotonic timestamp to seconds since its epoch
+func seconds(t *cdp.MonotonicTime) float64 {
+	return t.Time().Sub(*cdp.MonotonicTimeEpoch).Seconds()
+}
+
+func phase(start, end float64) float64 {
+	if start < 0 || end < start {
+		return 0
+	}
+	return end - start
+}
+
+// millis rounds seconds to milliseconds with microsecond precision
+func millis(seconds float64) float64 {
+	return math.Round(seconds*1e6) / 1e3
+}
+
+// since converts monotonic seconds to milliseconds since first request
+func (w *chromeWaterfall) since(at float64) float64 {
+	return millis(at - w.start)
+}
+
+func (w *chromeWaterfall) finish(id network.RequestID, r *Resource, at float64) {
+	if started, ok := w.started[id]; ok {
+		r.Duration = millis(at - started)
+	}
+	delete(w.requests, id)
+	delete(w.started, id)
+}
+
+func (w *chromeWaterfall) response(r *Resource, resp *network.Response) {
+
+	r.Status = int(resp.Status)
+	r.FromCache = r.FromCache || resp.FromDiskCache || resp.FromPrefetchCache || resp.FromServiceWorker
+	r.Size = int64(resp.EncodedDataLength)
+
+	t := resp.Timing
+	if t == nil {
+		return
+	}
+	r.Timing = &ResourceTiming{
+		DNS:     phase(t.DNSStart, t.DNSEnd),
+		Connect: phase(t.ConnectStart, t.ConnectEnd),
+		SSL:     phase(t.SslStart, t.SslEnd),
+		Send:    phase(t.SendStart, t.SendEnd),
+		Wait:    phase(t.SendEnd, t.ReceiveHeadersEnd),
+	}
+}
+
+// listen is called for every tab event, redirects are kept as separate entries
+func (w *chromeWaterfall) listen(ev interface{}) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	switch ev := ev.(type) {
+	case *network.EventRequestWillBeSent:
+		if ev.Request == nil || ev.Timestamp == nil {
+			return
+		}
+		at := seconds(ev.Timestamp)
+		if r, ok := w.requests[ev.RequestID]; ok && ev.RedirectResponse != nil {
+			w.response(r, ev.RedirectResponse)
+			w.finish(ev.RequestID, r, at)
+		}
+		if len(w.resources) == 0 {
+			w.start = at
+		}
+		r := &Resource{
+			URL:   ev.Request.URL,
+			Type:  string(ev.Type),
+			Start: w.since(at),
+		}
+		w.resources = append(w.resources, r)
+		w.requests[ev.RequestID] = r
+		w.started[ev.RequestID] = at
+	case *network.EventRequestServedFromCache:
+		if r, ok := w.requests[ev.RequestID]; ok {
+			r.FromCache = true
+		}
+	case *network.EventResponseReceived:
+		if r, ok := w.requests[ev.RequestID]; ok && ev.Response != nil {
+			w.response(r, ev.Response)
+		}
+	case *network.EventLoadingFinished:
+		if r, ok := w.requests[ev.RequestID]; ok && ev.Timestamp != nil {
+			r.Size = int64(ev.EncodedDataLength)
+			w.finish(ev.RequestID, r, seconds(ev.Timestamp))
+		}
+	case *network.EventLoadingFailed:
+		if r, ok := w.requests[ev.RequestID]; ok && ev.Timestamp != nil {
+			r.Error = ev.ErrorText
+			w.finish(ev.RequestID, r, seconds(ev.Timestamp))
+		}
+	}
+}
+
+// list returns resources seen so far, unfinished ones have no duration
+func (w *chromeWaterfall) list() []*Resource {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	r := make([]*Resource, len(w.resources))
+	copy(r, w.resources)
+	return r
+}
+
+func newChromeWaterfall() *chromeWaterfall {
+	return &chromeWaterfall{
+		requests: make(map[network.RequestID]*Resource),
+		started:  make(map[network.RequestID]float64),
+	}
+}
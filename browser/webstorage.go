@@ -0,0 +1,57 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// webStorageScript sets items before page scripts run, other origins of redirects or frames get nothing
+const webStorageScript = `(() => {
+	if (location.origin !== %s) {
+		return;
+	}
+	const seed = (storage, items) => {
+		for (const [k, v] of Object.entries(items)) {
+			storage.setItem(k, v);
+		}
+	};
+	try {
+		seed(window.localStorage, %s);
+		seed(window.sessionStorage, %s);
+	} catch (e) {
+	}
+})()`
+
+func (c *ChromeBrowser) hasWebStorage() bool {
+	return len(c.options.LocalStorage) > 0 || len(c.options.SessionStorage) > 0
+}
+
+// webStorageAction seeds local and session storage of url origin, e.g. with auth tokens of spa
+func (c *ChromeBrowser) webStorageAction(u *url.URL) chromedp.Action {
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+
+		origin, err := json.Marshal(fmt.Sprintf("%s://%s", u.Scheme, u.Host))
+		if err != nil {
+			return err
+		}
+		local, err := json.Marshal(c.options.LocalStorage)
+		if err != nil {
+			return err
+		}
+		session, err := json.Marshal(c.options.SessionStorage)
+		if err != nil {
+			return err
+		}
+		script := fmt.Sprintf(webStorageScript, origin, local, session)
+		if _, err := page.AddScriptToEvaluateOnNewDocument(script).Do(ctx); err != nil {
+			return fmt.Errorf("couldn't seed web storage: %w", err)
+		}
+		return nil
+	})
+}
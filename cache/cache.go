@@ -0,0 +1,13 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache keeps rendered results by key until their ttl is over
+type Cache interface {
+	// Get returns nil data if there is no such key
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, data []byte, ttl time.Duration) error
+}
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/devopsext/utils"
+)
+
+type RedisCacheOptions struct {
+	Addr     string
+	Password string
+	DB       int
+	// prefix of all keys
+	Prefix  string
+	Timeout int
+	// idle connections kept open
+	MaxIdle int
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// RedisCache is a minimal redis client speaking resp, only get, set and lock are needed
+type RedisCache struct {
+	options RedisCacheOptions
+	idle    []*redisConn
+	mutex   sync.Mutex
+}
+
+func (c *redisConn) write(args ...string) error {
+
+	buf := []byte(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, a := range args {
+		buf = append(buf, fmt.Sprintf("$%d\r\n", len(a))...)
+		buf = append(buf, a...)
+		buf = append(buf, "\r\n"...)
+	}
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func (c *redisConn) line() (string, error) {
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return "", errors.New("redis protocol error")
+	}
+	return line[:len(line)-2], nil
+}
+
+// read returns reply, nil bulk string is returned as nil
+func (c *redisConn) read() ([]byte, error) {
+
+	line, err := c.line()
+	if err != nil {
+		return nil, err
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+	return nil, fmt.Errorf("redis reply %q isn't supported", line[0])
+}
+
+func (c *redisConn) do(args ...string) ([]byte, error) {
+
+	if err := c.write(args...); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (r *RedisCache) dial(ctx context.Context) (*redisConn, error) {
+
+	d := net.Dialer{Timeout: time.Duration(r.options.Timeout) * time.Second}
+	conn, err := d.DialContext(ctx, "tcp", r.options.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if !utils.IsEmpty(r.options.Password) {
+		if _, err := c.do("AUTH", r.options.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.options.DB > 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(r.options.DB)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (r *RedisCache) get(ctx context.Context) (*redisConn, error) {
+
+	r.mutex.Lock()
+	if n := len(r.idle); n > 0 {
+		c := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mutex.Unlock()
+		return c, nil
+	}
+	r.mutex.Unlock()
+	return r.dial(ctx)
+}
+
+func (r *RedisCache) put(c *redisConn) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.idle) >= r.options.MaxIdle {
+		c.conn.Close()
+		return
+	}
+	r.idle = append(r.idle, c)
+}
+
+func (r *RedisCache) do(ctx context.Context, args ...string) ([]byte, error) {
+
+	c, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(time.Duration(r.options.Timeout) * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+
+	data, err := c.do(args...)
+
+	// connection is in unknown state after network errors, redis errors keep it usable
+	var rerr redisError
+	if err != nil && !errors.As(err, &rerr) {
+		c.conn.Close()
+		return nil, err
+	}
+	r.put(c)
+	return data, err
+}
+
+func (r *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	return r.do(ctx, "GET", r.options.Prefix+key)
+}
+
+func (r *RedisCache) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+
+	if ttl <= 0 {
+		_, err := r.do(ctx, "SET", r.options.Prefix+key, string(data))
+		return err
+	}
+	_, err := r.do(ctx, "SET", r.options.Prefix+key, string(data), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// lockScript extends lock held by id or takes free one
+const lockScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0`
+
+// Lock is a lock of leader election, check and set are atomic by script
+func (r *RedisCache) Lock(ctx context.Context, key, id string, ttl time.Duration) (bool, error) {
+
+	data, err := r.do(ctx, "EVAL", lockScript, "1", r.options.Prefix+key, id, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	return string(data) == "1", nil
+}
+
+func NewRedisCache(options RedisCacheOptions) *RedisCache {
+
+	if options.Timeout <= 0 {
+		options.Timeout = 5
+	}
+	if options.MaxIdle <= 0 {
+		options.MaxIdle = 4
+	}
+
+	return &RedisCache{
+		options: options,
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+
+	"github.com/devopsext/webrender/common"
+	"github.com/devopsext/webrender/processor"
+)
+
+// render makes one image in process without servers, so it composes with pipes,
+// e.g. webrender render https://example.com --param pdf=true | lp
+func render(args []string) error {
+
+	values := url.Values{}
+	for k, v := range renderOptions.Params {
+		values.Set(k, v)
+	}
+	if len(args) > 0 {
+		values.Set("url", args[0])
+	}
+	if values.Get("url") == "" {
+		return errors.New("render url is required")
+	}
+
+	obs := common.NewObservability(observabilityOptions, logs, metrics)
+	jobs := processor.NewJobs(jobsOptions, obs)
+	imageProcessor := processor.NewImageProcessor(imageProcessorOptions, newArtifacts(obs), jobs, obs)
+	if c := newCache(); c != nil {
+		imageProcessor.SetCache(c)
+	}
+
+	response, err := imageProcessor.Render(context.Background(), values)
+	if response == nil {
+		return err
+	}
+	// failed assertions still give image and metadata to see what's wrong
+	if werr := writeRender(response); werr != nil && err == nil {
+		err = werr
+	}
+	return err
+}
+
+func writeRender(response *processor.ImageProcessorResponse) error {
+
+	var out io.Writer = renderStdout
+	if renderOptions.Out != "-" {
+		f, err := os.Create(renderOptions.Out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if _, err := out.Write(response.Data); err != nil {
+		return err
+	}
+
+	meta := *response
+	meta.Data = nil
+	data, err := json.MarshalIndent(&meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if renderOptions.Meta == "" {
+		_, err = os.Stderr.Write(data)
+		return err
+	}
+	return os.WriteFile(renderOptions.Meta, data, 0644)
+}
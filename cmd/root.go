@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -13,9 +14,16 @@ import (
 	sreCommon "github.com/devopsext/sre/common"
 	sreProvider "github.com/devopsext/sre/provider"
 	utils "github.com/devopsext/utils"
+	"github.com/devopsext/webrender/analytics"
+	"github.com/devopsext/webrender/browser"
+	"github.com/devopsext/webrender/cache"
 	"github.com/devopsext/webrender/common"
+	"github.com/devopsext/webrender/delivery"
+	"github.com/devopsext/webrender/leader"
+	"github.com/devopsext/webrender/loadtest"
 	"github.com/devopsext/webrender/processor"
 	"github.com/devopsext/webrender/server"
+	"github.com/devopsext/webrender/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -28,6 +36,9 @@ var metrics = sreCommon.NewMetrics()
 var stdout *sreProvider.Stdout
 var mainWG sync.WaitGroup
 
+// renderStdout is stdout of process, render command moves logs to stderr
+var renderStdout = os.Stdout
+
 type RootOptions struct {
 	Logs    []string
 	Metrics []string
@@ -38,6 +49,11 @@ var rootOptions = RootOptions{
 	Metrics: strings.Split(envGet("METRICS", "prometheus").(string), ","),
 }
 
+var observabilityOptions = common.ObservabilityOptions{
+	MetricsPrefix: envGet("METRICS_PREFIX", "").(string),
+	MetricsLabels: utils.MapGetKeyValues(envGet("METRICS_LABELS", "").(string)),
+}
+
 var stdoutOptions = sreProvider.StdoutOptions{
 	Format:          envGet("STDOUT_FORMAT", "text").(string),
 	Level:           envGet("STDOUT_LEVEL", "info").(string),
@@ -55,6 +71,21 @@ var prometheusOptions = sreProvider.PrometheusOptions{
 var httpServerOptions = server.HttpServerOptions{
 	HealthcheckURL: envGet("HTTP_HEALTHCHECK_URL", "/healthcheck").(string),
 	ImageURL:       envGet("HTTP_IMAGE_URL", "/image").(string),
+	BatchURL:       envGet("HTTP_BATCH_URL", "/images").(string),
+	DeliveryURL:    envGet("HTTP_DELIVERY_URL", "/admin/deliveries,/admin/deliveries/").(string),
+	JobsURL:        envGet("HTTP_JOBS_URL", "/jobs/").(string),
+	ValidateURL:    envGet("HTTP_VALIDATE_URL", "/validate").(string),
+	HarURL:         envGet("HTTP_HAR_URL", "/har").(string),
+	HtmlURL:        envGet("HTTP_HTML_URL", "/render-html").(string),
+	TemplateURL:    envGet("HTTP_TEMPLATE_URL", "/templates/").(string),
+	DiffURL:        envGet("HTTP_DIFF_URL", "/diff").(string),
+	BaselineURL:    envGet("HTTP_BASELINE_URL", "/baselines/").(string),
+	AuditURL:       envGet("HTTP_AUDIT_URL", "/audit").(string),
+	ActivityURL:    envGet("HTTP_ACTIVITY_URL", "/activity").(string),
+	QuotaURL:       envGet("HTTP_QUOTA_URL", "/quota").(string),
+	SchemaURL:      envGet("HTTP_SCHEMA_URL", "/schemas/").(string),
+	LegacyURLs:     envGet("HTTP_LEGACY_URLS", true).(bool),
+	LegacySunset:   envGet("HTTP_LEGACY_SUNSET", "").(string),
 	ServerName:     envGet("HTTP_SERVER_NAME", "").(string),
 	Listen:         envGet("HTTP_LISTEN", ":80").(string),
 	Tls:            envGet("HTTP_TLS", false).(bool),
@@ -62,17 +93,303 @@ var httpServerOptions = server.HttpServerOptions{
 	Cert:           envGet("HTTP_CERT", "").(string),
 	Key:            envGet("HTTP_KEY", "").(string),
 	Chain:          envGet("HTTP_CHAIN", "").(string),
+	APIKeys:        envGet("HTTP_API_KEYS", "").(string),
+	APIKeyHeader:   envGet("HTTP_API_KEY_HEADER", "X-API-Key").(string),
+	APIKeyParam:    envGet("HTTP_API_KEY_PARAM", "apiKey").(string),
+}
+
+var grpcServerOptions = server.GrpcServerOptions{
+	Listen:      envGet("GRPC_LISTEN", "").(string),
+	Tls:         envGet("GRPC_TLS", false).(bool),
+	Cert:        envGet("GRPC_CERT", "").(string),
+	Key:         envGet("GRPC_KEY", "").(string),
+	MaxRecvSize: envGet("GRPC_MAX_RECV_SIZE", 4*1024*1024).(int),
+}
+
+var chromePoolOptions = browser.ChromePoolOptions{
+	Size:        envGet("CHROME_POOL_SIZE", 0).(int),
+	IdleTTL:     envGet("CHROME_POOL_IDLE_TTL", 300).(int),
+	MaxRenders:  envGet("CHROME_POOL_MAX_RENDERS", 100).(int),
+	MaxFailures: envGet("CHROME_POOL_MAX_FAILURES", 5).(int),
+}
+
+var jobsOptions = processor.JobsOptions{
+	MaxJobs:   envGet("JOBS_MAX", 1000).(int),
+	Workers:   envGet("JOBS_WORKERS", 2).(int),
+	QueueSize: envGet("JOBS_QUEUE_SIZE", 100).(int),
+}
+
+var batchProcessorOptions = processor.BatchProcessorOptions{
+	Parallelism: envGet("BATCH_PARALLELISM", 4).(int),
+	MaxItems:    envGet("BATCH_MAX_ITEMS", 100).(int),
+}
+
+var templateProcessorOptions = processor.TemplateProcessorOptions{
+	Templates: envGet("TEMPLATES", "").(string),
 }
 
 var imageProcessorOptions = processor.ImageProcessorOptions{
 	BrowserPath: envGet("IMAGE_BROWSER_PATH", "").(string),
 	BrowserKind: envGet("IMAGE_BROWSER_KIND", "chrome").(string),
+	FirefoxPath: envGet("IMAGE_FIREFOX_PATH", "").(string),
 	Width:       envGet("IMAGE_WIDTH", 1920).(int),
 	Height:      envGet("IMAGE_HEIGHT", 1280).(int),
 	Timeout:     envGet("IMAGE_TIMEOUT", 10).(int),
 	Delay:       envGet("IMAGE_DELAY", 3).(int),
+	WaitUntil:   envGet("IMAGE_WAIT_UNTIL", "").(string),
+	IdleTime:    envGet("IMAGE_IDLE_TIME", 500).(int),
+	WaitTimeout: envGet("IMAGE_WAIT_TIMEOUT", 10).(int),
 	UserAgent:   envGet("IMAGE_USER_AGENT", appName).(string),
 	AsPDF:       envGet("IMAGE_AS_PDF", false).(bool),
+
+	BrowserRemoteURL:    envGet("IMAGE_BROWSER_REMOTE_URL", "").(string),
+	Environment:         envGet("IMAGE_ENVIRONMENT", "").(string),
+	FallbackBrowserKind: envGet("IMAGE_FALLBACK_BROWSER_KIND", "").(string),
+	Partial:             envGet("IMAGE_PARTIAL", true).(bool),
+
+	PartialRetry:       envGet("IMAGE_PARTIAL_RETRY", false).(bool),
+	PartialRetryFactor: envGet("IMAGE_PARTIAL_RETRY_FACTOR", 2).(int),
+
+	NavigationTimeout: envGet("IMAGE_NAVIGATION_TIMEOUT", 0).(int),
+	SettleTimeout:     envGet("IMAGE_SETTLE_TIMEOUT", 0).(int),
+	CaptureTimeout:    envGet("IMAGE_CAPTURE_TIMEOUT", 0).(int),
+
+	Headers:         utils.MapGetKeyValues(envGet("IMAGE_HEADERS", "").(string)),
+	Cookies:         utils.MapGetKeyValues(envGet("IMAGE_COOKIES", "").(string)),
+	ScreenshotCodes: common.StringsToInts(strings.Split(envGet("IMAGE_SCREENSHOT_CODES", "").(string), ",")),
+
+	ErrorTexts:         common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_ERROR_TEXTS", "Access denied,403 Forbidden").(string), ",")),
+	ErrorSelectors:     common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_ERROR_SELECTORS", "").(string), ",")),
+	ChallengeTexts:     common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_CHALLENGE_TEXTS", "Just a moment...,Checking your browser").(string), ",")),
+	ChallengeSelectors: common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_CHALLENGE_SELECTORS", "#challenge-form,#challenge-running,#cf-challenge-running").(string), ",")),
+
+	CaptchaSolverURL:     envGet("IMAGE_CAPTCHA_SOLVER_URL", "").(string),
+	CaptchaSolverTimeout: envGet("IMAGE_CAPTCHA_SOLVER_TIMEOUT", 30).(int),
+
+	ManifestKey: envGet("IMAGE_MANIFEST_KEY", "").(string),
+	Presets:     envGet("IMAGE_PRESETS", "").(string),
+	Tenants:     envGet("IMAGE_TENANTS", "").(string),
+	Domains:     envGet("IMAGE_DOMAINS", "").(string),
+	Rewrites:    envGet("IMAGE_REWRITES", "").(string),
+
+	AcceptLanguage:    envGet("IMAGE_ACCEPT_LANGUAGE", "").(string),
+	UABrands:          common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_UA_BRANDS", "").(string), ",")),
+	UAPlatform:        envGet("IMAGE_UA_PLATFORM", "").(string),
+	UAPlatformVersion: envGet("IMAGE_UA_PLATFORM_VERSION", "").(string),
+	UAArchitecture:    envGet("IMAGE_UA_ARCHITECTURE", "").(string),
+	UAModel:           envGet("IMAGE_UA_MODEL", "").(string),
+	UAMobile:          envGet("IMAGE_UA_MOBILE", false).(bool),
+
+	BrowserCache:   envGet("IMAGE_BROWSER_CACHE", "").(string),
+	ServiceWorkers: envGet("IMAGE_SERVICE_WORKERS", "").(string),
+	Permissions:    common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_PERMISSIONS", "").(string), ",")),
+	ColorScheme:    envGet("IMAGE_COLOR_SCHEME", "").(string),
+
+	AllowedHosts: common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_ALLOWED_HOSTS", "").(string), ",")),
+	MaxWidth:     envGet("IMAGE_MAX_WIDTH", 0).(int),
+	MaxHeight:    envGet("IMAGE_MAX_HEIGHT", 0).(int),
+	MaxTimeout:   envGet("IMAGE_MAX_TIMEOUT", 0).(int),
+
+	Proxy:          envGet("IMAGE_PROXY", "").(string),
+	AllowedProxies: common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_ALLOWED_PROXIES", "").(string), ",")),
+
+	MetricTags: common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_METRIC_TAGS", "").(string), ",")),
+
+	DeniedHosts:    common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_DENIED_HOSTS", "").(string), ",")),
+	BlockPrivate:   envGet("IMAGE_BLOCK_PRIVATE", true).(bool),
+	PrivateAllowed: common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_PRIVATE_ALLOWED", "").(string), ",")),
+
+	BlockedDomains: common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_BLOCKED_DOMAINS", "").(string), ",")),
+
+	AdFilterLists: common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_AD_FILTER_LISTS", "").(string), ",")),
+	BlockAds:      envGet("IMAGE_BLOCK_ADS", false).(bool),
+
+	EventLogTypes:  common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_EVENT_LOG_TYPES", "").(string), ",")),
+	EventLogSample: envGet("IMAGE_EVENT_LOG_SAMPLE", 100).(int),
+
+	FakeLatency:     envGet("IMAGE_FAKE_LATENCY", 200).(int),
+	FakeJitter:      envGet("IMAGE_FAKE_JITTER", 0).(int),
+	FakeFailureRate: envGet("IMAGE_FAKE_FAILURE_RATE", 0).(int),
+
+	CDPRecordDir: envGet("IMAGE_CDP_RECORD_DIR", "").(string),
+
+	MaxConcurrency:       envGet("IMAGE_MAX_CONCURRENCY", 0).(int),
+	MaxClientConcurrency: envGet("IMAGE_MAX_CLIENT_CONCURRENCY", 0).(int),
+	MaxQueue:             envGet("IMAGE_MAX_QUEUE", 0).(int),
+	QueueTimeout:         envGet("IMAGE_QUEUE_TIMEOUT", 30).(int),
+
+	URLNormalizer: common.URLNormalizerOptions{
+		StripParams:   common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_URL_STRIP_PARAMS", "utm_*,gclid,fbclid,mc_cid,mc_eid,_ga").(string), ",")),
+		SortQuery:     envGet("IMAGE_URL_SORT_QUERY", true).(bool),
+		StripFragment: envGet("IMAGE_URL_STRIP_FRAGMENT", true).(bool),
+	},
+
+	FullPage: envGet("IMAGE_FULL_PAGE", true).(bool),
+	Quality:  envGet("IMAGE_QUALITY", 100).(int),
+
+	Scroll:      envGet("IMAGE_SCROLL", false).(bool),
+	ScrollStep:  envGet("IMAGE_SCROLL_STEP", 0).(int),
+	ScrollDelay: envGet("IMAGE_SCROLL_DELAY", 100).(int),
+	ScrollMax:   envGet("IMAGE_SCROLL_MAX", 20000).(int),
+
+	OCRPath:      envGet("IMAGE_OCR_PATH", "tesseract").(string),
+	OCRLanguages: envGet("IMAGE_OCR_LANGUAGES", "eng").(string),
+
+	CaptureDOM: envGet("IMAGE_CAPTURE_DOM", true).(bool),
+	MaxDOMSize: envGet("IMAGE_MAX_DOM_SIZE", 10*1024*1024).(int),
+
+	SnapshotStyles:  common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_SNAPSHOT_STYLES", "").(string), ",")),
+	TraceCategories: common.RemoveEmptyStrings(strings.Split(envGet("IMAGE_TRACE_CATEGORIES", "").(string), ",")),
+
+	Store:            envGet("IMAGE_STORE", false).(bool),
+	StoreKeyTemplate: envGet("IMAGE_STORE_KEY_TEMPLATE", "{{date}}/{{id}}/").(string),
+
+	CacheTTL: envGet("IMAGE_CACHE_TTL", 300).(int),
+
+	CacheControl:     envGet("IMAGE_CACHE_CONTROL", "").(string),
+	Disposition:      envGet("IMAGE_DISPOSITION", "").(string),
+	FilenameTemplate: envGet("IMAGE_FILENAME", "{{host}}-{{date}}.{{ext}}").(string),
+	ResponseHeaders:  utils.MapGetKeyValues(envGet("IMAGE_RESPONSE_HEADERS", "").(string)),
+}
+
+var deliveryQueueOptions = delivery.QueueOptions{
+	Workers:        envGet("DELIVERY_WORKERS", 2).(int),
+	MaxAttempts:    envGet("DELIVERY_MAX_ATTEMPTS", 8).(int),
+	InitialBackoff: envGet("DELIVERY_INITIAL_BACKOFF", 5).(int),
+	MaxBackoff:     envGet("DELIVERY_MAX_BACKOFF", 600).(int),
+	Timeout:        envGet("DELIVERY_TIMEOUT", 30).(int),
+	Dir:            envGet("DELIVERY_DIR", "").(string),
+}
+
+type AnalyticsOptions struct {
+	Kind string
+}
+
+var analyticsOptions = AnalyticsOptions{
+	Kind: envGet("ANALYTICS_KIND", "").(string),
+}
+
+var analyticsRecorderOptions = analytics.RecorderOptions{
+	BatchSize:     envGet("ANALYTICS_BATCH_SIZE", 500).(int),
+	FlushInterval: envGet("ANALYTICS_FLUSH_INTERVAL", 10).(int),
+	MaxQueue:      envGet("ANALYTICS_MAX_QUEUE", 10000).(int),
+	Timeout:       envGet("ANALYTICS_TIMEOUT", 30).(int),
+}
+
+var clickHouseExporterOptions = analytics.ClickHouseExporterOptions{
+	URL:      envGet("ANALYTICS_CLICKHOUSE_URL", "http://localhost:8123").(string),
+	Database: envGet("ANALYTICS_CLICKHOUSE_DATABASE", "default").(string),
+	Table:    envGet("ANALYTICS_CLICKHOUSE_TABLE", "webrender_renders").(string),
+	User:     envGet("ANALYTICS_CLICKHOUSE_USER", "").(string),
+	Password: envGet("ANALYTICS_CLICKHOUSE_PASSWORD", "").(string),
+	Timeout:  envGet("ANALYTICS_CLICKHOUSE_TIMEOUT", 10).(int),
+}
+
+var bigQueryExporterOptions = analytics.BigQueryExporterOptions{
+	Project:     envGet("ANALYTICS_BIGQUERY_PROJECT", "").(string),
+	Dataset:     envGet("ANALYTICS_BIGQUERY_DATASET", "").(string),
+	Table:       envGet("ANALYTICS_BIGQUERY_TABLE", "renders").(string),
+	Credentials: envFileContentExpand("ANALYTICS_BIGQUERY_CREDENTIALS", ""),
+	Endpoint:    envGet("ANALYTICS_BIGQUERY_ENDPOINT", "").(string),
+	Timeout:     envGet("ANALYTICS_BIGQUERY_TIMEOUT", 10).(int),
+}
+
+var loadTestOptions = loadtest.Options{
+	Target:       envGet("LOADTEST_TARGET", "http://127.0.0.1:80").(string),
+	Endpoint:     envGet("LOADTEST_ENDPOINT", "/v1/image").(string),
+	URL:          envGet("LOADTEST_URL", "https://example.com/?n={n}").(string),
+	Kind:         envGet("LOADTEST_KIND", "").(string),
+	RPS:          envGet("LOADTEST_RPS", 10).(int),
+	Duration:     time.Minute,
+	Concurrency:  envGet("LOADTEST_CONCURRENCY", 0).(int),
+	Timeout:      envGet("LOADTEST_TIMEOUT", 60).(int),
+	APIKey:       envGet("LOADTEST_API_KEY", "").(string),
+	APIKeyHeader: envGet("LOADTEST_API_KEY_HEADER", "X-API-Key").(string),
+	Insecure:     envGet("LOADTEST_INSECURE", false).(bool),
+}
+
+type RenderOptions struct {
+	Out    string
+	Meta   string
+	Params map[string]string
+}
+
+var renderOptions = RenderOptions{
+	Out:  envGet("RENDER_OUT", "-").(string),
+	Meta: envGet("RENDER_META", "").(string),
+}
+
+type CacheOptions struct {
+	Kind string
+}
+
+var cacheOptions = CacheOptions{
+	Kind: envGet("CACHE_KIND", "").(string),
+}
+
+// leader election runs jobs once across replicas, its lock is taken in cache redis
+type LeaderOptions struct {
+	Kind string
+}
+
+var leaderOptions = LeaderOptions{
+	Kind: envGet("LEADER_KIND", "").(string),
+}
+
+var electionOptions = leader.ElectionOptions{
+	Key: envGet("LEADER_KEY", "leader").(string),
+	ID:  envGet("LEADER_ID", "").(string),
+	TTL: envGet("LEADER_TTL", 15).(int),
+}
+
+var redisCacheOptions = cache.RedisCacheOptions{
+	Addr:     envGet("CACHE_REDIS_ADDR", "localhost:6379").(string),
+	Password: envGet("CACHE_REDIS_PASSWORD", "").(string),
+	DB:       envGet("CACHE_REDIS_DB", 0).(int),
+	Prefix:   envGet("CACHE_REDIS_PREFIX", "webrender:").(string),
+	Timeout:  envGet("CACHE_REDIS_TIMEOUT", 5).(int),
+	MaxIdle:  envGet("CACHE_REDIS_MAX_IDLE", 4).(int),
+}
+
+type StorageOptions struct {
+	Kind string
+}
+
+var storageOptions = StorageOptions{
+	Kind: envGet("STORAGE_KIND", "").(string),
+}
+
+var fileStorageOptions = storage.FileStorageOptions{
+	Dir: envGet("STORAGE_FILE_DIR", "").(string),
+	URL: envGet("STORAGE_FILE_URL", "").(string),
+}
+
+var s3StorageOptions = storage.S3StorageOptions{
+	Endpoint:      envGet("STORAGE_S3_ENDPOINT", "https://s3.amazonaws.com").(string),
+	Region:        envGet("STORAGE_S3_REGION", "us-east-1").(string),
+	Bucket:        envGet("STORAGE_S3_BUCKET", "").(string),
+	AccessKey:     envGet("STORAGE_S3_ACCESS_KEY", "").(string),
+	SecretKey:     envGet("STORAGE_S3_SECRET_KEY", "").(string),
+	PathStyle:     envGet("STORAGE_S3_PATH_STYLE", false).(bool),
+	URL:           envGet("STORAGE_S3_URL", "").(string),
+	PresignExpiry: envGet("STORAGE_S3_PRESIGN_EXPIRY", 3600).(int),
+	Timeout:       envGet("STORAGE_S3_TIMEOUT", 30).(int),
+}
+
+var artifactsOptions = storage.ArtifactsOptions{
+	Prefix:         envGet("STORAGE_PREFIX", "").(string),
+	TenantPrefix:   envGet("STORAGE_TENANT_PREFIX", "tenants/{tenant}/").(string),
+	DefaultTenant:  envGet("STORAGE_DEFAULT_TENANT", "default").(string),
+	EncryptionKeys: envFileContentExpand("STORAGE_ENCRYPTION_KEYS", ""),
+}
+
+var retentionOptions = storage.RetentionOptions{
+	Interval: envGet("STORAGE_RETENTION_INTERVAL", 3600).(int),
+	RetentionPolicy: storage.RetentionPolicy{
+		MaxAge:   envGet("STORAGE_RETENTION_MAX_AGE", 0).(int),
+		MaxCount: envGet("STORAGE_RETENTION_MAX_COUNT", 0).(int),
+	},
+	Tenants: envFileContentExpand("STORAGE_RETENTION_TENANTS", ""),
 }
 
 func getOnlyEnv(key string) string {
@@ -112,6 +429,64 @@ func interceptSyscall() {
 	}()
 }
 
+func newCache() cache.Cache {
+
+	switch cacheOptions.Kind {
+	case "redis":
+		return cache.NewRedisCache(redisCacheOptions)
+	}
+	return nil
+}
+
+func newElection(obs *common.Observability) *leader.Election {
+
+	switch leaderOptions.Kind {
+	case "redis":
+		return leader.NewElection(electionOptions, cache.NewRedisCache(redisCacheOptions), obs)
+	}
+	return nil
+}
+
+func newAnalytics(obs *common.Observability) *analytics.Recorder {
+
+	var exporter analytics.Exporter
+	switch analyticsOptions.Kind {
+	case "clickhouse":
+		if e := analytics.NewClickHouseExporter(clickHouseExporterOptions); e != nil {
+			exporter = e
+		}
+	case "bigquery":
+		e, err := analytics.NewBigQueryExporter(bigQueryExporterOptions)
+		if err != nil {
+			obs.Error(err)
+			return nil
+		}
+		if e != nil {
+			exporter = e
+		}
+	}
+	return analytics.NewRecorder(analyticsRecorderOptions, exporter, obs)
+}
+
+func newArtifacts(obs *common.Observability) *storage.Artifacts {
+
+	var st storage.Storage
+	switch storageOptions.Kind {
+	case "file":
+		st = storage.NewFileStorage(fileStorageOptions)
+	case "s3":
+		st = storage.NewS3Storage(s3StorageOptions)
+	default:
+		return nil
+	}
+
+	artifacts, err := storage.NewArtifacts(artifactsOptions, st, obs)
+	if err != nil {
+		logs.Panic(err)
+	}
+	return artifacts
+}
+
 func Execute() {
 
 	rootCmd := &cobra.Command{
@@ -119,6 +494,11 @@ func Execute() {
 		Short: "WebRender",
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
 
+			// artifact written to stdout is kept clean of logs
+			if cmd.Name() == "render" && renderOptions.Out == "-" {
+				os.Stdout = os.Stderr
+			}
+
 			stdoutOptions.Version = version
 			stdout = sreProvider.NewStdout(stdoutOptions)
 			if utils.Contains(rootOptions.Logs, "stdout") && stdout != nil {
@@ -139,13 +519,69 @@ func Execute() {
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 
-			obs := common.NewObservability(logs, metrics)
+			obs := common.NewObservability(observabilityOptions, logs, metrics)
+
+			deliveryQueue := delivery.NewQueue(deliveryQueueOptions, obs)
+			deliveryQueue.Start(&mainWG)
+
+			election := newElection(obs)
+			if election != nil {
+				election.Start(&mainWG)
+			}
+
+			artifacts := newArtifacts(obs)
+			if artifacts != nil {
+				retention, err := storage.NewRetention(retentionOptions, artifacts, obs)
+				if err != nil {
+					logs.Panic(err)
+				}
+				if election != nil {
+					retention.SetElection(election)
+				}
+				retention.Start(&mainWG)
+			}
 
 			processors := common.NewProcessors()
-			processors.Add(processor.NewImageProcessor(imageProcessorOptions, obs))
+			jobs := processor.NewJobs(jobsOptions, obs)
+			imageProcessor := processor.NewImageProcessor(imageProcessorOptions, artifacts, jobs, obs)
+			imageProcessor.SetDeliveryQueue(deliveryQueue)
+			if recorder := newAnalytics(obs); recorder != nil {
+				recorder.Start(&mainWG)
+				imageProcessor.SetAnalytics(recorder)
+			}
+			if c := newCache(); c != nil {
+				imageProcessor.SetCache(c)
+			}
+			processors.Add(imageProcessor)
+			jobs.Start(&mainWG, imageProcessor)
+
+			// warm chrome processes instead of one per request, fake browser needs none
+			if chromePoolOptions.Size > 0 && utils.IsEmpty(imageProcessorOptions.BrowserRemoteURL) &&
+				imageProcessorOptions.BrowserKind != browser.BrowserKindFake {
+				pool := browser.NewChromePool(chromePoolOptions, obs)
+				pool.Start(&mainWG)
+				imageProcessor.AddBrowser(browser.BrowserKindChrome, pool.NewBrowser)
+			}
+			processors.Add(processor.NewJobsProcessor(jobs, imageProcessor, obs))
+			processors.Add(processor.NewValidateProcessor(imageProcessor, obs))
+			processors.Add(processor.NewHarProcessor(imageProcessor, obs))
+			processors.Add(processor.NewHtmlProcessor(imageProcessor, obs))
+			processors.Add(processor.NewTemplateProcessor(templateProcessorOptions, imageProcessor, obs))
+			processors.Add(processor.NewDiffProcessor(imageProcessor, obs))
+			processors.Add(processor.NewBaselineProcessor(imageProcessor, obs))
+			processors.Add(processor.NewAuditProcessor(imageProcessor, obs))
+			processors.Add(processor.NewActivityProcessor(jobs, obs))
+			processors.Add(processor.NewQuotaProcessor(imageProcessor, obs))
+			processors.Add(processor.NewSchemaProcessor(obs))
+			processors.Add(processor.NewBatchProcessor(batchProcessorOptions, imageProcessor, obs))
+			processors.Add(processor.NewDeliveryProcessor(deliveryQueue, obs))
 
 			servers := common.NewServers()
 			servers.Add(server.NewHttpServer(httpServerOptions, processors, obs))
+			// grpc is authenticated by keys of http
+			grpcServerOptions.APIKeys = httpServerOptions.APIKeys
+			grpcServerOptions.APIKeyHeader = httpServerOptions.APIKeyHeader
+			servers.Add(server.NewGrpcServer(grpcServerOptions, processor.NewGrpcService(imageProcessor, obs), obs))
 			servers.Start(&mainWG)
 			mainWG.Wait()
 		},
@@ -156,6 +592,9 @@ func Execute() {
 	flags.StringSliceVar(&rootOptions.Logs, "logs", rootOptions.Logs, "Log providers: stdout")
 	flags.StringSliceVar(&rootOptions.Metrics, "metrics", rootOptions.Metrics, "Metric providers: prometheus")
 
+	flags.StringVar(&observabilityOptions.MetricsPrefix, "metrics-prefix", observabilityOptions.MetricsPrefix, "Metrics prefix applied to all metrics")
+	flags.StringToStringVar(&observabilityOptions.MetricsLabels, "metrics-labels", observabilityOptions.MetricsLabels, "Metrics labels applied to all metrics: cluster=name,region=name")
+
 	flags.StringVar(&stdoutOptions.Format, "stdout-format", stdoutOptions.Format, "Stdout format: json, text, template")
 	flags.StringVar(&stdoutOptions.Level, "stdout-level", stdoutOptions.Level, "Stdout level: info, warn, error, debug, panic")
 	flags.StringVar(&stdoutOptions.Template, "stdout-template", stdoutOptions.Template, "Stdout template")
@@ -169,6 +608,21 @@ func Execute() {
 
 	flags.StringVar(&httpServerOptions.HealthcheckURL, "http-healthcheck-url", httpServerOptions.HealthcheckURL, "Http healthcheck url")
 	flags.StringVar(&httpServerOptions.ImageURL, "http-image-url", httpServerOptions.ImageURL, "Http image url")
+	flags.StringVar(&httpServerOptions.BatchURL, "http-batch-url", httpServerOptions.BatchURL, "Http batch image url")
+	flags.StringVar(&httpServerOptions.DeliveryURL, "http-delivery-url", httpServerOptions.DeliveryURL, "Http delivery admin url")
+	flags.StringVar(&httpServerOptions.JobsURL, "http-jobs-url", httpServerOptions.JobsURL, "Http jobs url")
+	flags.StringVar(&httpServerOptions.ValidateURL, "http-validate-url", httpServerOptions.ValidateURL, "Http validate url")
+	flags.StringVar(&httpServerOptions.HarURL, "http-har-url", httpServerOptions.HarURL, "Http har url")
+	flags.StringVar(&httpServerOptions.HtmlURL, "http-html-url", httpServerOptions.HtmlURL, "Http html rendering url")
+	flags.StringVar(&httpServerOptions.TemplateURL, "http-template-url", httpServerOptions.TemplateURL, "Http templates url")
+	flags.StringVar(&httpServerOptions.DiffURL, "http-diff-url", httpServerOptions.DiffURL, "Http visual diff url")
+	flags.StringVar(&httpServerOptions.BaselineURL, "http-baseline-url", httpServerOptions.BaselineURL, "Http visual baselines url")
+	flags.StringVar(&httpServerOptions.AuditURL, "http-audit-url", httpServerOptions.AuditURL, "Http performance audit url")
+	flags.StringVar(&httpServerOptions.ActivityURL, "http-activity-url", httpServerOptions.ActivityURL, "Http render activity events url")
+	flags.StringVar(&httpServerOptions.QuotaURL, "http-quota-url", httpServerOptions.QuotaURL, "Http quota url")
+	flags.StringVar(&httpServerOptions.SchemaURL, "http-schema-url", httpServerOptions.SchemaURL, "Http json schemas url")
+	flags.BoolVar(&httpServerOptions.LegacyURLs, "http-legacy-urls", httpServerOptions.LegacyURLs, "Http urls without version prefix")
+	flags.StringVar(&httpServerOptions.LegacySunset, "http-legacy-sunset", httpServerOptions.LegacySunset, "Http sunset date of urls without version prefix")
 	flags.StringVar(&httpServerOptions.ServerName, "http-server-name", httpServerOptions.ServerName, "Http server name")
 	flags.StringVar(&httpServerOptions.Listen, "http-listen", httpServerOptions.Listen, "Http listen")
 	flags.BoolVar(&httpServerOptions.Tls, "http-tls", httpServerOptions.Tls, "Http TLS")
@@ -176,9 +630,64 @@ func Execute() {
 	flags.StringVar(&httpServerOptions.Cert, "http-cert", httpServerOptions.Cert, "Http cert file or content")
 	flags.StringVar(&httpServerOptions.Key, "http-key", httpServerOptions.Key, "Http key file or content")
 	flags.StringVar(&httpServerOptions.Chain, "http-chain", httpServerOptions.Chain, "Http CA chain file or content")
+	flags.StringVar(&httpServerOptions.APIKeys, "http-api-keys", httpServerOptions.APIKeys, "Http api keys file or content")
+
+	flags.StringVar(&grpcServerOptions.Listen, "grpc-listen", grpcServerOptions.Listen, "Grpc listen, empty disables grpc server")
+	flags.BoolVar(&grpcServerOptions.Tls, "grpc-tls", grpcServerOptions.Tls, "Grpc TLS")
+	flags.StringVar(&grpcServerOptions.Cert, "grpc-cert", grpcServerOptions.Cert, "Grpc cert file or content")
+	flags.StringVar(&grpcServerOptions.Key, "grpc-key", grpcServerOptions.Key, "Grpc key file or content")
 
 	interceptSyscall()
 
+	loadTestCmd := &cobra.Command{
+		Use:   "loadtest",
+		Short: "Send image requests at fixed rate and report latency percentiles and errors",
+		Run: func(cmd *cobra.Command, args []string) {
+
+			fmt.Printf("Sending %d rps to %s for %s...\n", loadTestOptions.RPS, loadTestOptions.Target, loadTestOptions.Duration)
+			report, err := loadtest.NewLoadTest(loadTestOptions).Run(context.Background())
+			if err != nil {
+				logs.Error(err)
+				os.Exit(1)
+			}
+			if err := report.Write(os.Stdout); err != nil {
+				logs.Error(err)
+			}
+		},
+	}
+	// fake browser of target makes it a test of service itself, not of pages
+	ltFlags := loadTestCmd.Flags()
+	ltFlags.StringVar(&loadTestOptions.Target, "target", loadTestOptions.Target, "Load test webrender base url")
+	ltFlags.StringVar(&loadTestOptions.Endpoint, "endpoint", loadTestOptions.Endpoint, "Load test image endpoint")
+	ltFlags.StringVar(&loadTestOptions.URL, "url", loadTestOptions.URL, "Load test page url, {n} is request number")
+	ltFlags.StringVar(&loadTestOptions.Kind, "kind", loadTestOptions.Kind, "Load test browser kind, e.g. fake")
+	ltFlags.IntVar(&loadTestOptions.RPS, "rps", loadTestOptions.RPS, "Load test requests per second")
+	ltFlags.DurationVar(&loadTestOptions.Duration, "duration", loadTestOptions.Duration, "Load test duration")
+	ltFlags.IntVar(&loadTestOptions.Concurrency, "concurrency", loadTestOptions.Concurrency, "Load test requests in flight, zero is ten times rps")
+	ltFlags.IntVar(&loadTestOptions.Timeout, "timeout", loadTestOptions.Timeout, "Load test response timeout in seconds")
+	ltFlags.StringVar(&loadTestOptions.APIKey, "api-key", loadTestOptions.APIKey, "Load test api key")
+	ltFlags.StringVar(&loadTestOptions.APIKeyHeader, "api-key-header", loadTestOptions.APIKeyHeader, "Load test api key header")
+	ltFlags.BoolVar(&loadTestOptions.Insecure, "insecure", loadTestOptions.Insecure, "Load test insecure skip verify")
+	rootCmd.AddCommand(loadTestCmd)
+
+	renderCmd := &cobra.Command{
+		Use:   "render [url]",
+		Short: "Render url once, artifact is written to file or stdout, metadata to file or stderr",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if err := render(args); err != nil {
+				logs.Error(err)
+				os.Exit(1)
+			}
+		},
+	}
+	renderFlags := renderCmd.Flags()
+	renderFlags.StringVar(&renderOptions.Out, "out", renderOptions.Out, "Render artifact file, - is stdout")
+	renderFlags.StringVar(&renderOptions.Meta, "meta", renderOptions.Meta, "Render metadata json file, empty is stderr")
+	renderFlags.StringToStringVar(&renderOptions.Params, "param", renderOptions.Params, "Render request parameters as of image endpoint: width=800,pdf=true")
+	rootCmd.AddCommand(renderCmd)
+
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
 		Short: "Print the version number",
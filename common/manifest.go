@@ -0,0 +1,159 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/devopsext/utils"
+)
+
+type ManifestArtifact struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type Manifest struct {
+	Artifacts  []*ManifestArtifact `json:"artifacts"`
+	Parameters json.RawMessage     `json:"parameters,omitempty"`
+	Timestamp  time.Time           `json:"timestamp"`
+	KeyID      string              `json:"keyId"`
+	Signature  string              `json:"signature,omitempty"`
+}
+
+// ManifestSigner signs manifests with ed25519 service key
+type ManifestSigner struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+func (m *Manifest) AddArtifact(name string, data []byte) {
+
+	sum := sha256.Sum256(data)
+	m.Artifacts = append(m.Artifacts, &ManifestArtifact{
+		Name:   name,
+		Size:   len(data),
+		SHA256: hex.EncodeToString(sum[:]),
+	})
+}
+
+// payload is canonical manifest json without signature, keys are sorted and spaces are removed
+// so manifest decoded from its json is verified as signed one
+func (m *Manifest) payload() ([]byte, error) {
+
+	c := *m
+	c.Signature = ""
+	data, err := json.Marshal(&c)
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func (s *ManifestSigner) Sign(m *Manifest) error {
+
+	m.KeyID = s.keyID
+	m.Signature = ""
+
+	payload, err := m.payload()
+	if err != nil {
+		return err
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload))
+	return nil
+}
+
+func (s *ManifestSigner) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+func VerifyManifest(m *Manifest, key ed25519.PublicKey) error {
+
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return err
+	}
+
+	payload, err := m.payload()
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(key, payload, signature) {
+		return errors.New("manifest signature is invalid")
+	}
+	return nil
+}
+
+func manifestKeyID(key ed25519.PublicKey) string {
+
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// parseManifestKey accepts PKCS8 PEM or base64 encoded ed25519 seed
+func parseManifestKey(raw string) (ed25519.PrivateKey, error) {
+
+	raw = strings.TrimSpace(raw)
+
+	block, _ := pem.Decode([]byte(raw))
+	if block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pk, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("manifest key is not ed25519")
+		}
+		return pk, nil
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("manifest key seed has wrong size")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// NewManifestSigner loads key from file or content, returns nil if key is empty
+func NewManifestSigner(key string) (*ManifestSigner, error) {
+
+	if utils.IsEmpty(key) {
+		return nil, nil
+	}
+
+	raw, err := utils.Content(key)
+	if err != nil {
+		return nil, err
+	}
+
+	pk, err := parseManifestKey(string(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ManifestSigner{
+		key:   pk,
+		keyID: manifestKeyID(pk.Public().(ed25519.PublicKey)),
+	}, nil
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func testManifestSigner(t *testing.T) *ManifestSigner {
+
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	s, err := NewManifestSigner(base64.StdEncoding.EncodeToString(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestManifestVerifyRoundTrip(t *testing.T) {
+
+	type parameters struct {
+		URL     string  `json:"url"`
+		Width   int     `json:"width"`
+		Scale   float64 `json:"scale"`
+		Comment string  `json:"comment"`
+	}
+
+	params, err := json.Marshal(&parameters{
+		URL:     "https://example.com/?a=1&b=<2>",
+		Width:   1280,
+		Scale:   1.5,
+		Comment: "zz before aa",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifest{Parameters: params, Timestamp: time.Now().UTC()}
+	m.AddArtifact("image", []byte("image"))
+
+	s := testManifestSigner(t)
+	if err := s.Sign(m); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		marshal func(v interface{}) ([]byte, error)
+	}{
+		{"compact", json.Marshal},
+		{"indent", func(v interface{}) ([]byte, error) { return json.MarshalIndent(v, "", "  ") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			data, err := tt.marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded Manifest
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyManifest(&decoded, s.PublicKey()); err != nil {
+				t.Fatalf("decoded manifest isn't verified: %v", err)
+			}
+		})
+	}
+}
+
+func TestManifestVerifyTampered(t *testing.T) {
+
+	m := &Manifest{Parameters: json.RawMessage(`{"url":"https://example.com"}`), Timestamp: time.Now().UTC()}
+	m.AddArtifact("image", []byte("image"))
+
+	s := testManifestSigner(t)
+	if err := s.Sign(m); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Parameters = json.RawMessage(`{"url":"https://example.org"}`)
+	if err := VerifyManifest(m, s.PublicKey()); err == nil {
+		t.Fatal("tampered manifest is verified")
+	}
+}
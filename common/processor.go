@@ -1,10 +1,50 @@
 package common
 
 import (
+	"context"
 	"net/http"
 	"reflect"
 )
 
+type apiKeyContextKey struct{}
+
+type tenantContextKey struct{}
+
+type apiVersionContextKey struct{}
+
+// WithAPIKey marks request context with name of api key it's authenticated by
+func WithAPIKey(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, name)
+}
+
+// APIKey returns name of api key request is authenticated by, empty if there is none
+func APIKey(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyContextKey{}).(string)
+	return name
+}
+
+// WithTenant binds request to tenant, so it can't act as another one
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// WithAPIVersion marks request context with api version it came by
+func WithAPIVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, apiVersionContextKey{}, version)
+}
+
+// APIVersion returns api version of request, empty if it didn't come by http server
+func APIVersion(ctx context.Context) string {
+	version, _ := ctx.Value(apiVersionContextKey{}).(string)
+	return version
+}
+
+// Tenant returns tenant request is bound to, empty if it's free to choose
+func Tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
 type Processor interface {
 	Type() string
 }
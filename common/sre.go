@@ -2,11 +2,57 @@ package common
 
 import (
 	sre "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
 )
 
+type ObservabilityOptions struct {
+	MetricsPrefix string
+	MetricsLabels map[string]string
+}
+
 type Observability struct {
+	options ObservabilityOptions
 	logs    *sre.Logs
 	metrics *sre.Metrics
+	meter   *ObservabilityMeter
+}
+
+// ObservabilityMeter applies global prefix and labels to all metrics
+type ObservabilityMeter struct {
+	options ObservabilityOptions
+	metrics *sre.Metrics
+}
+
+func (m *ObservabilityMeter) labels(labels sre.Labels) sre.Labels {
+
+	r := make(sre.Labels)
+	for k, v := range m.options.MetricsLabels {
+		r[k] = v
+	}
+	for k, v := range labels {
+		r[k] = v
+	}
+	return r
+}
+
+func (m *ObservabilityMeter) prefixes(prefixes ...string) []string {
+
+	if utils.IsEmpty(m.options.MetricsPrefix) {
+		return prefixes
+	}
+	return append([]string{m.options.MetricsPrefix}, prefixes...)
+}
+
+func (m *ObservabilityMeter) Counter(name, description string, labels sre.Labels, prefixes ...string) sre.Counter {
+	return m.metrics.Counter(name, description, m.labels(labels), m.prefixes(prefixes...)...)
+}
+
+func (m *ObservabilityMeter) Gauge(name, description string, labels sre.Labels, prefixes ...string) sre.Gauge {
+	return m.metrics.Gauge(name, description, m.labels(labels), m.prefixes(prefixes...)...)
+}
+
+func (m *ObservabilityMeter) Stop() {
+	m.metrics.Stop()
 }
 
 func (o *Observability) Info(obj interface{}, args ...interface{}) {
@@ -37,14 +83,19 @@ func (o *Observability) Logs() *sre.Logs {
 	return o.logs
 }
 
-func (o *Observability) Metrics() *sre.Metrics {
-	return o.metrics
+func (o *Observability) Metrics() sre.Meter {
+	return o.meter
 }
 
-func NewObservability(logs *sre.Logs, metrics *sre.Metrics) *Observability {
+func NewObservability(options ObservabilityOptions, logs *sre.Logs, metrics *sre.Metrics) *Observability {
 
 	return &Observability{
+		options: options,
 		logs:    logs,
 		metrics: metrics,
+		meter: &ObservabilityMeter{
+			options: options,
+			metrics: metrics,
+		},
 	}
 }
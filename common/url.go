@@ -0,0 +1,102 @@
+package common
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+type URLNormalizerOptions struct {
+	// query params to drop, trailing * matches by prefix
+	StripParams   []string
+	SortQuery     bool
+	StripFragment bool
+}
+
+// URLNormalizer makes canonical url to be used in cache keys, dedup and baselines
+type URLNormalizer struct {
+	options URLNormalizerOptions
+}
+
+func (n *URLNormalizer) strip(param string) bool {
+
+	param = strings.ToLower(param)
+	for _, p := range n.options.StripParams {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(param, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+			continue
+		}
+		if param == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize lowercases scheme and host, drops default port, cleans path and query
+func (n *URLNormalizer) Normalize(raw string) (string, error) {
+
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+
+	// resolve dot segments, keep trailing slash as it might mean another resource
+	if u.Path != "" {
+		p := path.Clean(u.Path)
+		if strings.HasSuffix(u.Path, "/") && p != "/" {
+			p += "/"
+		}
+		u.Path = p
+		u.RawPath = ""
+	}
+	if u.Path == "" && u.Host != "" {
+		u.Path = "/"
+	}
+
+	query := u.Query()
+	for k := range query {
+		if n.strip(k) {
+			query.Del(k)
+		}
+	}
+
+	if n.options.SortQuery {
+		// Encode sorts by key, values keep their order
+		u.RawQuery = query.Encode()
+	} else {
+		params := []string{}
+		for _, kv := range strings.Split(u.RawQuery, "&") {
+			k, _, _ := strings.Cut(kv, "=")
+			if dk, err := url.QueryUnescape(k); err == nil {
+				k = dk
+			}
+			if kv == "" || n.strip(k) {
+				continue
+			}
+			params = append(params, kv)
+		}
+		u.RawQuery = strings.Join(params, "&")
+	}
+
+	if n.options.StripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	return u.String(), nil
+}
+
+func NewURLNormalizer(options URLNormalizerOptions) *URLNormalizer {
+	return &URLNormalizer{options: options}
+}
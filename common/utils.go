@@ -1,11 +1,15 @@
 package common
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/devopsext/utils"
 	"gopkg.in/yaml.v2"
@@ -90,3 +94,45 @@ func GetStringKeys(arr map[string]interface{}) []string {
 	}
 	return keys
 }
+
+func StringsToInts(items []string) []int {
+
+	r := []int{}
+
+	for _, v := range items {
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		r = append(r, i)
+	}
+
+	return r
+}
+
+// NormalizeLabel makes label value safe and short
+func NormalizeLabel(s string) string {
+
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+
+	if len(s) > 64 {
+		s = s[:64]
+	}
+	return s
+}
+
+// NewID returns random hex identifier
+func NewID() string {
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
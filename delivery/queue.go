@@ -0,0 +1,394 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+type QueueOptions struct {
+	Workers        int
+	MaxAttempts    int
+	InitialBackoff int
+	MaxBackoff     int
+	Timeout        int
+	// persist queued and dead deliveries, empty keeps them in memory
+	Dir string
+}
+
+type Delivery struct {
+	ID          string            `json:"id"`
+	URL         string            `json:"url"`
+	ContentType string            `json:"contentType,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Body        []byte            `json:"body,omitempty"`
+	Attempts    int               `json:"attempts"`
+	LastError   string            `json:"lastError,omitempty"`
+	Created     time.Time         `json:"created"`
+	NextAt      time.Time         `json:"nextAt"`
+}
+
+// AddressFilter returns why address host resolves to mustn't be delivered to, empty allows it
+type AddressFilter func(host string, ip net.IP) string
+
+// Queue delivers http posts with exponential backoff, exhausted deliveries go to dead list
+type Queue struct {
+	options  QueueOptions
+	client   *http.Client
+	logger   sreCommon.Logger
+	meter    sreCommon.Meter
+	queued   map[string]*Delivery
+	inflight map[string]bool
+	dead     map[string]*Delivery
+	work     chan *Delivery
+	mutex    sync.Mutex
+
+	filter AddressFilter
+}
+
+const (
+	queueDir = "queue"
+	deadDir  = "dead"
+)
+
+func (q *Queue) path(dir, id string) string {
+	return filepath.Join(q.options.Dir, dir, fmt.Sprintf("%s.json", id))
+}
+
+func (q *Queue) persist(dir string, d *Delivery) {
+
+	if utils.IsEmpty(q.options.Dir) {
+		return
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		q.logger.Error("Couldn't marshal delivery %s: %v", d.ID, err)
+		return
+	}
+	if err := os.WriteFile(q.path(dir, d.ID), data, 0600); err != nil {
+		q.logger.Error("Couldn't persist delivery %s: %v", d.ID, err)
+	}
+}
+
+func (q *Queue) unpersist(dir, id string) {
+
+	if utils.IsEmpty(q.options.Dir) {
+		return
+	}
+	if err := os.Remove(q.path(dir, id)); err != nil && !os.IsNotExist(err) {
+		q.logger.Error("Couldn't remove delivery %s: %v", id, err)
+	}
+}
+
+func (q *Queue) load(dir string, m map[string]*Delivery) {
+
+	files, err := filepath.Glob(filepath.Join(q.options.Dir, dir, "*.json"))
+	if err != nil {
+		q.logger.Error(err)
+		return
+	}
+
+	for _, f := range files {
+
+		data, err := os.ReadFile(f)
+		if err != nil {
+			q.logger.Error("Couldn't read delivery %s: %v", f, err)
+			continue
+		}
+		var d Delivery
+		if err := json.Unmarshal(data, &d); err != nil {
+			q.logger.Error("Couldn't unmarshal delivery %s: %v", f, err)
+			continue
+		}
+		m[d.ID] = &d
+	}
+}
+
+func (q *Queue) backoff(attempts int) time.Duration {
+
+	d := time.Duration(q.options.InitialBackoff) * time.Second
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= time.Duration(q.options.MaxBackoff)*time.Second {
+			return time.Duration(q.options.MaxBackoff) * time.Second
+		}
+	}
+	return d
+}
+
+func (q *Queue) updateGauges() {
+	q.meter.Gauge("queued", "Count of queued deliveries", nil, "delivery").Set(float64(len(q.queued)))
+	q.meter.Gauge("dead", "Count of dead deliveries", nil, "delivery").Set(float64(len(q.dead)))
+}
+
+// Add queues delivery to be sent as soon as possible
+func (q *Queue) Add(d *Delivery) {
+
+	if utils.IsEmpty(d.ID) {
+		d.ID = common.NewID()
+	}
+	d.Created = time.Now().UTC()
+	d.NextAt = d.Created
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.queued[d.ID] = d
+	q.persist(queueDir, d)
+	q.updateGauges()
+}
+
+// Dead returns exhausted deliveries ordered by creation time
+func (q *Queue) Dead() []*Delivery {
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	r := []*Delivery{}
+	for _, d := range q.dead {
+		r = append(r, d)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Created.Before(r[j].Created)
+	})
+	return r
+}
+
+func (q *Queue) Queued() int {
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.queued)
+}
+
+// Requeue moves dead delivery back to queue with fresh attempts
+func (q *Queue) Requeue(id string) bool {
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	d, ok := q.dead[id]
+	if !ok {
+		return false
+	}
+
+	delete(q.dead, id)
+	q.unpersist(deadDir, id)
+
+	d.Attempts = 0
+	d.NextAt = time.Now().UTC()
+	q.queued[id] = d
+	q.persist(queueDir, d)
+	q.updateGauges()
+	return true
+}
+
+// SetAddressFilter checks every address deliveries connect to, so redirects and resolving
+// differently on retries don't reach addresses url was refused for
+func (q *Queue) SetAddressFilter(filter AddressFilter) {
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.filter = filter
+}
+
+func (q *Queue) addressFilter() AddressFilter {
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.filter
+}
+
+// dial connects to address resolved and checked once, so it can't resolve to other one in between
+func (q *Queue) dial(ctx context.Context, network, address string) (net.Conn, error) {
+
+	dialer := &net.Dialer{Timeout: time.Duration(q.options.Timeout) * time.Second}
+
+	filter := q.addressFilter()
+	if filter == nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("host %s has no addresses", host)
+	}
+	for _, a := range addrs {
+		if reason := filter(host, a.IP); !utils.IsEmpty(reason) {
+			return nil, fmt.Errorf("delivery refused: %s", reason)
+		}
+	}
+	return dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0].IP.String(), port))
+}
+
+func (q *Queue) send(d *Delivery) error {
+
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return err
+	}
+	if !utils.IsEmpty(d.ContentType) {
+		req.Header.Set("Content-Type", d.ContentType)
+	}
+	for k, v := range d.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("delivery returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (q *Queue) deliver(d *Delivery) {
+
+	err := q.send(d)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	delete(q.inflight, d.ID)
+
+	if err == nil {
+		delete(q.queued, d.ID)
+		q.unpersist(queueDir, d.ID)
+		q.meter.Counter("delivered", "Count of successful deliveries", nil, "delivery").Inc()
+		q.updateGauges()
+		return
+	}
+
+	d.Attempts++
+	d.LastError = err.Error()
+	q.meter.Counter("failures", "Count of failed delivery attempts", nil, "delivery").Inc()
+
+	if d.Attempts >= q.options.MaxAttempts {
+		q.logger.Warn("Delivery %s to %s is dead after %d attempts: %v", d.ID, d.URL, d.Attempts, err)
+		delete(q.queued, d.ID)
+		q.unpersist(queueDir, d.ID)
+		q.dead[d.ID] = d
+		q.persist(deadDir, d)
+		q.meter.Counter("dead", "Count of deliveries moved to dead list", nil, "delivery").Inc()
+		q.updateGauges()
+		return
+	}
+
+	d.NextAt = time.Now().UTC().Add(q.backoff(d.Attempts))
+	q.persist(queueDir, d)
+	q.logger.Debug("Delivery %s to %s failed, next attempt at %s: %v", d.ID, d.URL, d.NextAt, err)
+}
+
+// schedule sends due deliveries to workers
+func (q *Queue) schedule() {
+
+	q.mutex.Lock()
+	now := time.Now().UTC()
+	due := []*Delivery{}
+	for id, d := range q.queued {
+		if q.inflight[id] || d.NextAt.After(now) {
+			continue
+		}
+		q.inflight[id] = true
+		due = append(due, d)
+	}
+	q.mutex.Unlock()
+
+	for _, d := range due {
+		q.work <- d
+	}
+}
+
+func (q *Queue) Start(wg *sync.WaitGroup) {
+
+	if !utils.IsEmpty(q.options.Dir) {
+		for _, dir := range []string{queueDir, deadDir} {
+			if err := os.MkdirAll(filepath.Join(q.options.Dir, dir), 0700); err != nil {
+				q.logger.Error("Couldn't create delivery dir: %v", err)
+			}
+		}
+		q.mutex.Lock()
+		q.load(queueDir, q.queued)
+		q.load(deadDir, q.dead)
+		q.updateGauges()
+		q.mutex.Unlock()
+	}
+
+	for i := 0; i < q.options.Workers; i++ {
+		go func() {
+			for d := range q.work {
+				q.deliver(d)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func(wg *sync.WaitGroup) {
+
+		defer wg.Done()
+		q.logger.Info("Start delivery queue...")
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			q.schedule()
+		}
+	}(wg)
+}
+
+func NewQueue(options QueueOptions, observability *common.Observability) *Queue {
+
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 1
+	}
+
+	q := &Queue{
+		options:  options,
+		logger:   observability.Logs(),
+		meter:    observability.Metrics(),
+		queued:   make(map[string]*Delivery),
+		inflight: make(map[string]bool),
+		dead:     make(map[string]*Delivery),
+		work:     make(chan *Delivery, options.Workers),
+	}
+
+	// redirects aren't followed, their targets aren't checked as delivery url is
+	q.client = &http.Client{
+		Timeout: time.Duration(options.Timeout) * time.Second,
+		Transport: &http.Transport{
+			DialContext:         q.dial,
+			TLSHandshakeTimeout: time.Duration(options.Timeout) * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return q
+}
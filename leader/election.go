@@ -0,0 +1,111 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+// Lock is a lock with ttl shared by replicas, holder keeps it by taking it again before ttl is over
+type Lock interface {
+	// Lock takes free lock or extends the one held by id already
+	Lock(ctx context.Context, key, id string, ttl time.Duration) (bool, error)
+}
+
+type ElectionOptions struct {
+	Key string
+	// identity of replica, host name and pid unless set
+	ID string
+	// seconds lock is held without being extended
+	TTL int
+}
+
+// Election elects one replica to run jobs which should fire once across the fleet
+type Election struct {
+	options ElectionOptions
+	lock    Lock
+	leader  atomic.Bool
+	logger  sreCommon.Logger
+	meter   sreCommon.Meter
+}
+
+// IsLeader tells if replica holds the lock, leadership is lost as soon as it can't be extended
+func (e *Election) IsLeader() bool {
+	return e.leader.Load()
+}
+
+func (e *Election) set(leader bool) {
+
+	if e.leader.Swap(leader) != leader {
+		if leader {
+			e.logger.Info("Replica %s became leader of %s", e.options.ID, e.options.Key)
+			e.meter.Counter("elected", "Count of times replica became leader", nil, "leader").Inc()
+		} else {
+			e.logger.Warn("Replica %s isn't leader of %s anymore", e.options.ID, e.options.Key)
+		}
+	}
+	value := 0.0
+	if leader {
+		value = 1
+	}
+	e.meter.Gauge("leader", "Replica is leader, 1 or 0", nil, "leader").Set(value)
+}
+
+func (e *Election) campaign() {
+
+	ttl := time.Duration(e.options.TTL) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), ttl/3)
+	defer cancel()
+
+	ok, err := e.lock.Lock(ctx, e.options.Key, e.options.ID, ttl)
+	if err != nil {
+		// lock might be over by now, so it's given up rather than held by two replicas
+		e.logger.Error("Couldn't take leader lock %s: %v", e.options.Key, err)
+		e.set(false)
+		return
+	}
+	e.set(ok)
+}
+
+func (e *Election) Start(wg *sync.WaitGroup) {
+
+	wg.Add(1)
+	go func(wg *sync.WaitGroup) {
+
+		defer wg.Done()
+		e.logger.Info("Start leader election of %s as %s...", e.options.Key, e.options.ID)
+
+		// lock is extended three times per ttl, so one failure doesn't lose it
+		ticker := time.NewTicker(time.Duration(e.options.TTL) * time.Second / 3)
+		defer ticker.Stop()
+		for {
+			e.campaign()
+			<-ticker.C
+		}
+	}(wg)
+}
+
+func NewElection(options ElectionOptions, lock Lock, observability *common.Observability) *Election {
+
+	if utils.IsEmpty(options.ID) {
+		host, _ := os.Hostname()
+		options.ID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if options.TTL < 3 {
+		options.TTL = 3
+	}
+
+	return &Election{
+		options: options,
+		lock:    lock,
+		logger:  observability.Logs(),
+		meter:   observability.Metrics(),
+	}
+}
@@ -0,0 +1,281 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/devopsext/utils"
+)
+
+type Options struct {
+	// base url of webrender, endpoint is appended to it
+	Target   string
+	Endpoint string
+	// page rendered, {n} is replaced by request number, so renders don't hit cache
+	URL  string
+	Kind string
+	// requests per second sent whatever responses take, in flight are bounded by concurrency
+	RPS         int
+	Duration    time.Duration
+	Concurrency int
+	// seconds to wait for one response
+	Timeout int
+
+	APIKey       string
+	APIKeyHeader string
+	Insecure     bool
+}
+
+// Report is latency in milliseconds of responded requests and errors by kind
+type Report struct {
+	Sent      int
+	Succeeded int
+	Failed    int
+	// ticks skipped as concurrency is exhausted
+	Dropped int
+	Elapsed time.Duration
+	Min     float64
+	Mean    float64
+	P50     float64
+	P90     float64
+	P95     float64
+	P99     float64
+	Max     float64
+	Errors  map[string]int
+	latency []float64
+}
+
+// LoadTest sends image requests at fixed rate, send rate doesn't wait for responses
+type LoadTest struct {
+	options Options
+	client  *http.Client
+	mutex   sync.Mutex
+	report  *Report
+}
+
+// errorKind groups failures, statuses are kept as they are, transport errors by cause
+func errorKind(status int, err error) string {
+
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return fmt.Sprintf("status %d", status)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case strings.Contains(err.Error(), "connection refused"):
+		return "connection refused"
+	case strings.Contains(err.Error(), "connection reset"), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection reset"
+	}
+	return "transport error"
+}
+
+// percentile takes nearest rank of sorted values
+func percentile(sorted []float64, p float64) float64 {
+
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p/100*float64(len(sorted))+0.5) - 1
+	i = max(0, min(i, len(sorted)-1))
+	return sorted[i]
+}
+
+func (l *LoadTest) requestURL(n int) (string, error) {
+
+	u, err := url.Parse(strings.TrimSuffix(l.options.Target, "/") + l.options.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("url", strings.ReplaceAll(l.options.URL, "{n}", strconv.Itoa(n)))
+	if !utils.IsEmpty(l.options.Kind) {
+		q.Set("kind", l.options.Kind)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (l *LoadTest) send(ctx context.Context, n int) {
+
+	status := 0
+	started := time.Now()
+
+	s, err := l.requestURL(n)
+	if err == nil {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, s, nil)
+		if err == nil {
+			if !utils.IsEmpty(l.options.APIKey) {
+				req.Header.Set(l.options.APIKeyHeader, l.options.APIKey)
+			}
+			var resp *http.Response
+			resp, err = l.client.Do(req)
+			if err == nil {
+				// body is read, so latency covers whole image
+				_, err = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				status = resp.StatusCode
+			}
+		}
+	}
+	elapsed := float64(time.Since(started).Microseconds()) / 1000
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err == nil && status < http.StatusBadRequest {
+		l.report.Succeeded++
+		l.report.latency = append(l.report.latency, elapsed)
+		return
+	}
+	l.report.Failed++
+	l.report.Errors[errorKind(status, err)]++
+	// error responses are responses still, their latency counts
+	if err == nil {
+		l.report.latency = append(l.report.latency, elapsed)
+	}
+}
+
+// Run sends requests till duration passes or ctx is done, in flight requests are waited for
+func (l *LoadTest) Run(ctx context.Context) (*Report, error) {
+
+	if l.options.RPS <= 0 {
+		return nil, errors.New("rps should be positive")
+	}
+	if _, err := l.requestURL(0); err != nil {
+		return nil, fmt.Errorf("target is invalid: %w", err)
+	}
+
+	concurrency := l.options.Concurrency
+	if concurrency <= 0 {
+		concurrency = l.options.RPS * 10
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, l.options.Duration)
+	defer cancel()
+
+	l.report = &Report{Errors: make(map[string]int)}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	started := time.Now()
+	ticker := time.NewTicker(time.Second / time.Duration(l.options.RPS))
+	defer ticker.Stop()
+
+	for n := 0; ; n++ {
+		select {
+		case <-runCtx.Done():
+			wg.Wait()
+			return l.finish(time.Since(started)), nil
+		case <-ticker.C:
+		}
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			l.mutex.Lock()
+			l.report.Dropped++
+			l.mutex.Unlock()
+			continue
+		}
+
+		l.mutex.Lock()
+		l.report.Sent++
+		l.mutex.Unlock()
+
+		wg.Add(1)
+		// requests in flight outlive duration, they are bounded by timeout
+		go func(n int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			l.send(ctx, n)
+		}(n)
+	}
+}
+
+func (l *LoadTest) finish(elapsed time.Duration) *Report {
+
+	r := l.report
+	r.Elapsed = elapsed
+
+	sort.Float64s(r.latency)
+	if len(r.latency) == 0 {
+		return r
+	}
+	sum := 0.0
+	for _, v := range r.latency {
+		sum += v
+	}
+	r.Min = r.latency[0]
+	r.Max = r.latency[len(r.latency)-1]
+	r.Mean = sum / float64(len(r.latency))
+	r.P50 = percentile(r.latency, 50)
+	r.P90 = percentile(r.latency, 90)
+	r.P95 = percentile(r.latency, 95)
+	r.P99 = percentile(r.latency, 99)
+	return r
+}
+
+// Write prints report as table
+func (r *Report) Write(w io.Writer) error {
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	rate := 0.0
+	if r.Elapsed > 0 {
+		rate = float64(r.Sent) / r.Elapsed.Seconds()
+	}
+	fmt.Fprintf(tw, "requests\t%d\t%.1f/s in %s\n", r.Sent, rate, r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(tw, "succeeded\t%d\n", r.Succeeded)
+	fmt.Fprintf(tw, "failed\t%d\n", r.Failed)
+	if r.Dropped > 0 {
+		fmt.Fprintf(tw, "dropped\t%d\tconcurrency exhausted\n", r.Dropped)
+	}
+	fmt.Fprintf(tw, "\nlatency, ms\n")
+	for _, v := range []struct {
+		name  string
+		value float64
+	}{
+		{"min", r.Min}, {"mean", r.Mean}, {"p50", r.P50}, {"p90", r.P90},
+		{"p95", r.P95}, {"p99", r.P99}, {"max", r.Max},
+	} {
+		fmt.Fprintf(tw, "%s\t%.1f\n", v.name, v.value)
+	}
+
+	if len(r.Errors) > 0 {
+		kinds := make([]string, 0, len(r.Errors))
+		for k := range r.Errors {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		fmt.Fprintf(tw, "\nerrors\n")
+		for _, k := range kinds {
+			fmt.Fprintf(tw, "%s\t%d\t%.1f%%\n", k, r.Errors[k], float64(r.Errors[k])*100/float64(max(r.Sent, 1)))
+		}
+	}
+	return tw.Flush()
+}
+
+func NewLoadTest(options Options) *LoadTest {
+
+	if utils.IsEmpty(options.APIKeyHeader) {
+		options.APIKeyHeader = "X-API-Key"
+	}
+	return &LoadTest{
+		options: options,
+		client:  utils.NewHttpClient(options.Timeout, options.Insecure),
+	}
+}
@@ -0,0 +1,232 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+const (
+	ActivityStarted  = "started"
+	ActivityFinished = "finished"
+	ActivityFailed   = "failed"
+)
+
+// activityBuffer is count of activities kept for slow subscriber, newer ones are dropped
+const activityBuffer = 256
+
+// JobActivity is a change of job lifecycle, duration is milliseconds of render
+type JobActivity struct {
+	Type     string            `json:"type"`
+	Time     time.Time         `json:"time"`
+	Job      string            `json:"job"`
+	URL      string            `json:"url,omitempty"`
+	Tenant   string            `json:"tenant,omitempty"`
+	Client   string            `json:"client,omitempty"`
+	Async    bool              `json:"async,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Kind     string            `json:"kind,omitempty"`
+	Status   int               `json:"status,omitempty"`
+	Cached   bool              `json:"cached,omitempty"`
+	Partial  bool              `json:"partial,omitempty"`
+	Duration int64             `json:"duration,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// jobsActivity fans out activities of all jobs to subscribers
+type jobsActivity struct {
+	mutex       sync.Mutex
+	subscribers map[chan *JobActivity]struct{}
+}
+
+// activity makes activity of job, must be called under lock
+func (job *Job) activity(typ string) *JobActivity {
+
+	a := &JobActivity{
+		Type:   typ,
+		Time:   time.Now().UTC(),
+		Job:    job.ID,
+		Client: job.Client,
+		Async:  job.Async,
+		Tags:   job.Tags,
+		Error:  job.Error,
+	}
+	if job.Request != nil {
+		a.URL = job.Request.URL
+		a.Tenant = job.Request.Tenant
+	}
+	if job.Response != nil {
+		a.Kind = job.Response.Kind
+		a.Status = job.Response.Status
+		a.Cached = job.Response.Cached
+		a.Partial = job.Response.Partial
+	}
+	if job.Started != nil && job.Finished != nil {
+		a.Duration = job.Finished.Sub(*job.Started).Milliseconds()
+	}
+	return a
+}
+
+func (s *Jobs) subscribe() chan *JobActivity {
+
+	s.activity.mutex.Lock()
+	defer s.activity.mutex.Unlock()
+
+	c := make(chan *JobActivity, activityBuffer)
+	s.activity.subscribers[c] = struct{}{}
+	return c
+}
+
+func (s *Jobs) unsubscribe(c chan *JobActivity) {
+
+	s.activity.mutex.Lock()
+	defer s.activity.mutex.Unlock()
+
+	delete(s.activity.subscribers, c)
+}
+
+// publish doesn't wait for subscribers, activity is dropped for the ones which fall behind
+func (s *Jobs) publish(a *JobActivity) {
+
+	if a == nil {
+		return
+	}
+
+	s.activity.mutex.Lock()
+	defer s.activity.mutex.Unlock()
+
+	for c := range s.activity.subscribers {
+		select {
+		case c <- a:
+		default:
+			s.meter.Counter("activity_dropped", "Count of all job activities dropped for slow subscribers", nil, "jobs").Inc()
+		}
+	}
+}
+
+// ActivityProcessor streams activity of all jobs as server sent events, it's an operations view,
+// so it's served for requests authenticated by api key only
+type ActivityProcessor struct {
+	jobs     *Jobs
+	logger   sreCommon.Logger
+	meter    sreCommon.Meter
+	requests sreCommon.Counter
+	errors   sreCommon.Counter
+}
+
+var errActivityUnauthorized = errors.New("activity requires api key")
+
+func ActivityProcessorType() string {
+	return "Activity"
+}
+
+func (p *ActivityProcessor) Type() string {
+	return ActivityProcessorType()
+}
+
+// HandleHttpRequest streams activities on GET, key bound to tenant gets activities of that tenant,
+// ?tenant= and ?tag=key:value narrow them as jobs list does
+func (p *ActivityProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	p.requests.Inc()
+
+	if r.Method != http.MethodGet {
+		p.errors.Inc()
+		err := fmt.Errorf("method %s is not allowed", r.Method)
+		http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+		return err
+	}
+	if utils.IsEmpty(common.APIKey(r.Context())) {
+		p.errors.Inc()
+		http.Error(w, errActivityUnauthorized.Error(), http.StatusUnauthorized)
+		return errActivityUnauthorized
+	}
+
+	filter := &JobsFilter{
+		Tags:   make(map[string]string),
+		Tenant: r.URL.Query().Get("tenant"),
+	}
+	for _, t := range r.URL.Query()["tag"] {
+		kv := strings.SplitN(t, ":", 2)
+		if len(kv) > 1 {
+			filter.Tags[kv[0]] = kv[1]
+		} else {
+			filter.Tags[kv[0]] = ""
+		}
+	}
+	if tenant := common.Tenant(r.Context()); !utils.IsEmpty(tenant) {
+		filter.Tenant = tenant
+	}
+
+	c := p.jobs.subscribe()
+	defer p.jobs.unsubscribe(c)
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return err
+	}
+	flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case a := <-c:
+			if !filter.matchActivity(a) {
+				continue
+			}
+			if err := writeEvent(w, a.Type, a); err != nil {
+				return err
+			}
+			flush()
+		case <-time.After(jobFollowKeepalive):
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return err
+			}
+			flush()
+		}
+	}
+}
+
+// matchActivity is match of job by tenant and tags
+func (f *JobsFilter) matchActivity(a *JobActivity) bool {
+
+	if !utils.IsEmpty(f.Tenant) && a.Tenant != f.Tenant {
+		return false
+	}
+	for k, v := range f.Tags {
+		tv, ok := a.Tags[k]
+		if !ok || (v != "" && tv != v) {
+			return false
+		}
+	}
+	return true
+}
+
+func NewActivityProcessor(jobs *Jobs, observability *common.Observability) *ActivityProcessor {
+
+	meter := observability.Metrics()
+	return &ActivityProcessor{
+		jobs:     jobs,
+		logger:   observability.Logs(),
+		meter:    meter,
+		requests: meter.Counter("requests", "Count of all activity processor requests", nil, "activity", "processor"),
+		errors:   meter.Counter("errors", "Count of all activity processor errors", nil, "activity", "processor"),
+	}
+}
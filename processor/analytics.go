@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/analytics"
+	"github.com/devopsext/webrender/browser"
+)
+
+func (p *ImageProcessor) SetAnalytics(recorder *analytics.Recorder) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.analytics = recorder
+}
+
+// record queues analytics event of finished render, it's nothing if recorder isn't set
+func (p *ImageProcessor) record(job *Job, started time.Time, response *ImageProcessorResponse, err error) {
+
+	p.mutex.RLock()
+	recorder := p.analytics
+	p.mutex.RUnlock()
+	if recorder == nil {
+		return
+	}
+
+	r := job.Request
+	options := p.browserOptions(r)
+	now := time.Now().UTC()
+
+	e := &analytics.Event{
+		Time:     now,
+		Job:      job.ID,
+		Tenant:   r.Tenant,
+		Kind:     r.Kind,
+		Preset:   r.Preset,
+		Output:   r.Output,
+		Width:    options.Width,
+		Height:   options.Height,
+		Async:    job.Async,
+		Outcome:  JobDone,
+		Queued:   float64(started.Sub(job.Created).Microseconds()) / 1e3,
+		Duration: float64(now.Sub(started).Microseconds()) / 1e3,
+	}
+	if utils.IsEmpty(e.Kind) {
+		e.Kind = p.options.BrowserKind
+	}
+	if u, perr := url.Parse(r.URL); perr == nil {
+		e.Host = u.Hostname()
+	}
+
+	if response != nil {
+		e.Kind = response.Kind
+		e.Cached = response.Cached
+		e.Partial = response.Partial
+		e.Status = response.Status
+		e.Page = response.Page
+		e.Size = len(response.Data)
+	}
+
+	if err != nil {
+		e.Outcome = JobFailed
+		e.Error = err.Error()
+
+		var navErr *browser.NavigationError
+		var statusErr *browser.StatusError
+		switch {
+		case errors.As(err, &navErr):
+			e.ErrorCode = navErr.Code
+		case errors.As(err, &statusErr):
+			e.ErrorCode = "status"
+			e.Status = statusErr.Status
+		}
+	}
+	recorder.Record(e)
+}
@@ -0,0 +1,181 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/browser"
+	"golang.org/x/net/html"
+)
+
+const (
+	AssertionText     = "text"
+	AssertionNotText  = "notText"
+	AssertionSelector = "selector"
+)
+
+// Assertion is an expectation of request checked against rendered page
+type Assertion struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Passed bool   `json:"passed"`
+}
+
+// AssertionError fails render which doesn't meet expectations
+type AssertionError struct {
+	Assertions []*Assertion
+}
+
+func (e *AssertionError) Error() string {
+
+	var failed []string
+	for _, a := range e.Assertions {
+		if !a.Passed {
+			failed = append(failed, fmt.Sprintf("%s %q", a.Kind, a.Value))
+		}
+	}
+	return fmt.Sprintf("assertions failed: %s", strings.Join(failed, ", "))
+}
+
+func hasTextAssertions(r *ImageProcessorRequest) bool {
+	return len(r.AssertText) > 0 || len(r.AssertNotText) > 0
+}
+
+// domText is text content of html without scripts and styles, whitespace is collapsed
+func domText(dom string) string {
+
+	var b strings.Builder
+	skip := 0
+	z := html.NewTokenizer(strings.NewReader(dom))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case html.StartTagToken:
+			if name, _ := z.TagName(); string(name) == "script" || string(name) == "style" {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); (string(name) == "script" || string(name) == "style") && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+				b.WriteByte(' ')
+			}
+		}
+	}
+}
+
+// ocrText recognizes text of image by tesseract, languages are in its form, e.g. eng+deu
+func (p *ImageProcessor) ocrText(ctx context.Context, data []byte, languages string) (string, error) {
+
+	cmd := exec.CommandContext(ctx, p.options.OCRPath, "stdin", "stdout", "-l", languages)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ocr failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.Join(strings.Fields(string(out)), " "), nil
+}
+
+// assertText checks texts against dom and, if ocr is on, text recognized in image
+func (p *ImageProcessor) assertText(ctx context.Context, r *ImageProcessorRequest, image *browser.BrowserImage) ([]*Assertion, error) {
+
+	if !hasTextAssertions(r) {
+		return nil, nil
+	}
+
+	text := domText(image.DOM)
+	if r.OCR != nil && *r.OCR {
+		languages := r.OCRLanguages
+		if utils.IsEmpty(languages) {
+			languages = p.options.OCRLanguages
+		}
+		ocr, err := p.ocrText(ctx, image.Data, languages)
+		if err != nil {
+			return nil, err
+		}
+		text = text + " " + ocr
+	}
+
+	var assertions []*Assertion
+	for _, s := range r.AssertText {
+		s = strings.Join(strings.Fields(s), " ")
+		assertions = append(assertions, &Assertion{Kind: AssertionText, Value: s, Passed: strings.Contains(text, s)})
+	}
+	for _, s := range r.AssertNotText {
+		s = strings.Join(strings.Fields(s), " ")
+		assertions = append(assertions, &Assertion{Kind: AssertionNotText, Value: s, Passed: !strings.Contains(text, s)})
+	}
+	return assertions, nil
+}
+
+// selectorAssertions are results of asserted selectors, element must be visible to pass
+func selectorAssertions(image *browser.BrowserImage) []*Assertion {
+
+	var assertions []*Assertion
+	for _, s := range image.Selectors {
+		assertions = append(assertions, &Assertion{Kind: AssertionSelector, Value: s.Selector, Passed: s.Visible})
+	}
+	return assertions
+}
+
+// assertionsErr is nil if all assertions passed
+func assertionsErr(assertions []*Assertion) error {
+
+	for _, a := range assertions {
+		if !a.Passed {
+			return &AssertionError{Assertions: assertions}
+		}
+	}
+	return nil
+}
+
+func isAssertionErr(err error) bool {
+	var aerr *AssertionError
+	return errors.As(err, &aerr)
+}
+
+// statusWriter sends status with first write, so writers of response set their headers before
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+
+	if !w.wrote {
+		w.WriteHeader(w.status)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *statusWriter) Flush() {
+
+	if !w.wrote {
+		w.WriteHeader(w.status)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
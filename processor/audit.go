@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/browser"
+	"github.com/devopsext/webrender/common"
+)
+
+// AuditProcessorResponse is load performance of page, screenshot is added when asked
+type AuditProcessorResponse struct {
+	URL         string               `json:"url"`
+	FinalURL    string               `json:"finalUrl,omitempty"`
+	Kind        string               `json:"kind,omitempty"`
+	Status      int                  `json:"status,omitempty"`
+	Job         string               `json:"job,omitempty"`
+	Performance *browser.Performance `json:"performance"`
+	Stages      []*browser.Stage     `json:"stages,omitempty"`
+	Data        []byte               `json:"data,omitempty"`
+}
+
+// AuditProcessor renders request of image endpoint with performance collected, it answers
+// by web vitals and timing of page load instead of image
+type AuditProcessor struct {
+	image    *ImageProcessor
+	logger   sreCommon.Logger
+	meter    sreCommon.Meter
+	requests sreCommon.Counter
+	errors   sreCommon.Counter
+}
+
+func AuditProcessorType() string {
+	return "Audit"
+}
+
+func (p *AuditProcessor) Type() string {
+	return AuditProcessorType()
+}
+
+// HandleHttpRequest takes parameters of image endpoint, screenshot=true keeps image in response
+func (p *AuditProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	p.requests.Inc()
+
+	request, err := p.image.resolve(r)
+	if err != nil {
+		p.errors.Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return err
+	}
+	performance := true
+	request.Performance = &performance
+	request.Async = false
+	request.CallbackURL = ""
+	request.Output = ""
+
+	err = p.image.checkPolicy(request)
+	if err != nil {
+		p.errors.Inc()
+		http.Error(w, err.Error(), p.image.errorStatus(w, "audit", err))
+		return err
+	}
+
+	job := p.image.jobs.Add(request)
+	w.Header().Set("X-Webrender-Job", job.ID)
+
+	client := limiterClient(request.Tenant, r.RemoteAddr)
+	p.image.jobs.update(job.ID, func(job *Job) {
+		job.Client = client
+	})
+
+	response, err := p.image.RenderJob(r.Context(), job.ID)
+	if err != nil {
+		p.errors.Inc()
+		http.Error(w, err.Error(), p.image.errorStatus(w, "audit", err))
+		return err
+	}
+
+	audit := &AuditProcessorResponse{
+		URL:         request.URL,
+		FinalURL:    response.FinalURL,
+		Kind:        response.Kind,
+		Status:      response.Status,
+		Job:         job.ID,
+		Performance: response.Performance,
+		Stages:      response.Stages,
+	}
+	if screenshot, err := strconv.ParseBool(r.URL.Query().Get("screenshot")); err == nil && screenshot {
+		audit.Data = response.Data
+	}
+
+	data, err := json.Marshal(audit)
+	if err != nil {
+		p.errors.Inc()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
+
+func NewAuditProcessor(image *ImageProcessor, observability *common.Observability) *AuditProcessor {
+
+	meter := observability.Metrics()
+	return &AuditProcessor{
+		image:    image,
+		logger:   observability.Logs(),
+		meter:    meter,
+		requests: meter.Counter("requests", "Count of all audit processor requests", nil, "audit", "processor"),
+		errors:   meter.Counter("errors", "Count of all audit processor errors", nil, "audit", "processor"),
+	}
+}
@@ -0,0 +1,392 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/common"
+	"github.com/devopsext/webrender/storage"
+)
+
+const (
+	defaultMinSimilarity = 0.999
+	baselineMetaFile     = "baseline.json"
+)
+
+// Baseline is approved render of name, request is kept without credentials
+type Baseline struct {
+	Name    string                 `json:"name"`
+	Request *ImageProcessorRequest `json:"request,omitempty"`
+	Image   *storage.Artifact      `json:"image"`
+	Width   int                    `json:"width"`
+	Height  int                    `json:"height"`
+	Job     string                 `json:"job,omitempty"`
+	Created time.Time              `json:"created"`
+}
+
+type BaselineListItem struct {
+	Name     string    `json:"name"`
+	Modified time.Time `json:"modified"`
+}
+
+// BaselineCompareRequest renders request or the one of baseline, pixels within threshold are the same,
+// comparison passes when similarity is at least min similarity
+type BaselineCompareRequest struct {
+	Request       *ImageProcessorRequest `json:"request,omitempty"`
+	Threshold     *float64               `json:"threshold,omitempty"`
+	MinSimilarity *float64               `json:"minSimilarity,omitempty"`
+}
+
+type BaselineCompareResponse struct {
+	Name          string            `json:"name"`
+	Pass          bool              `json:"pass"`
+	Similarity    float64           `json:"similarity"`
+	MinSimilarity float64           `json:"minSimilarity"`
+	Threshold     float64           `json:"threshold"`
+	DiffPixels    int               `json:"diffPixels"`
+	TotalPixels   int               `json:"totalPixels"`
+	Job           string            `json:"job,omitempty"`
+	Diff          *storage.Artifact `json:"diff,omitempty"`
+}
+
+// BaselineProcessor keeps named baselines in storage and compares renders to them, failed comparison
+// is 422, so pipelines gate deploys by status
+type BaselineProcessor struct {
+	image    *ImageProcessor
+	logger   sreCommon.Logger
+	meter    sreCommon.Meter
+	requests sreCommon.Counter
+	errors   sreCommon.Counter
+}
+
+var (
+	errUnknownBaseline     = errors.New("unknown baseline")
+	errInvalidBaselineName = errors.New("baseline name is invalid")
+	errBaselineNoRequest   = errors.New("baseline has no request to render")
+	baselineNameRe         = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+func BaselineProcessorType() string {
+	return "Baseline"
+}
+
+func (p *BaselineProcessor) Type() string {
+	return BaselineProcessorType()
+}
+
+func baselineDir(name string) string {
+	return storage.BaselinesDir + name + "/"
+}
+
+func (p *BaselineProcessor) get(ctx context.Context, name string) (*Baseline, error) {
+
+	if p.image.artifacts == nil {
+		return nil, errStorageNotConfigured
+	}
+	tenant := common.Tenant(ctx)
+	data, err := p.image.artifacts.Get(ctx, tenant, p.image.artifacts.TenantPrefix(tenant)+baselineDir(name)+baselineMetaFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errUnknownBaseline, name)
+	}
+	b := &Baseline{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("could not decode baseline %s: %w", name, err)
+	}
+	return b, nil
+}
+
+func (p *BaselineProcessor) list(ctx context.Context) ([]*BaselineListItem, error) {
+
+	if p.image.artifacts == nil {
+		return nil, errStorageNotConfigured
+	}
+	objects, err := p.image.artifacts.Storage().List(ctx, p.image.artifacts.TenantPrefix(common.Tenant(ctx))+storage.BaselinesDir)
+	if err != nil {
+		return nil, err
+	}
+	items := []*BaselineListItem{}
+	for _, o := range objects {
+		if path.Base(o.Key) != baselineMetaFile {
+			continue
+		}
+		items = append(items, &BaselineListItem{Name: path.Base(path.Dir(o.Key)), Modified: o.Modified})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
+
+// save renders request and keeps it as baseline of name, previous one is replaced
+func (p *BaselineProcessor) save(ctx context.Context, client, name string, r *ImageProcessorRequest) (*Baseline, error) {
+
+	if p.image.artifacts == nil {
+		return nil, errStorageNotConfigured
+	}
+	img, response, job, err := p.image.renderImage(ctx, client, r)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant := common.Tenant(ctx)
+	ext, contentType := p.image.contentExt(response.Data)
+	a, err := p.image.artifacts.Put(ctx, tenant, baselineDir(name)+"image."+ext, response.Data, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("could not store baseline %s: %w", name, err)
+	}
+
+	b := &Baseline{
+		Name:    name,
+		Request: publicRequest(r),
+		Image:   a,
+		Width:   img.Bounds().Dx(),
+		Height:  img.Bounds().Dy(),
+		Job:     job,
+		Created: time.Now().UTC(),
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.image.artifacts.Put(ctx, tenant, baselineDir(name)+baselineMetaFile, data, "application/json"); err != nil {
+		return nil, fmt.Errorf("could not store baseline %s: %w", name, err)
+	}
+	return b, nil
+}
+
+func (p *BaselineProcessor) delete(ctx context.Context, name string) error {
+
+	if p.image.artifacts == nil {
+		return errStorageNotConfigured
+	}
+	objects, err := p.image.artifacts.Storage().List(ctx, p.image.artifacts.TenantPrefix(common.Tenant(ctx))+baselineDir(name))
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("%w: %s", errUnknownBaseline, name)
+	}
+	for _, o := range objects {
+		if err := p.image.artifacts.Storage().Delete(ctx, o.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compare renders request against baseline, diff image of failed comparison is stored as render artifact
+func (p *BaselineProcessor) compare(ctx context.Context, client, name string, request *BaselineCompareRequest) (*BaselineCompareResponse, error) {
+
+	b, err := p.get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	r := request.Request
+	if r == nil {
+		if b.Request == nil {
+			return nil, errBaselineNoRequest
+		}
+		copied := *b.Request
+		r = &copied
+	}
+
+	base, err := p.image.storedImage(ctx, b.Image.Key)
+	if err != nil {
+		return nil, err
+	}
+	target, _, job, err := p.image.renderImage(ctx, client, r)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &BaselineCompareResponse{
+		Name:          name,
+		Threshold:     defaultDiffThreshold,
+		MinSimilarity: defaultMinSimilarity,
+		Job:           job,
+	}
+	if request.Threshold != nil {
+		response.Threshold = *request.Threshold
+	}
+	if request.MinSimilarity != nil {
+		response.MinSimilarity = *request.MinSimilarity
+	}
+
+	diff, err := diffResponse(base, target, response.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	response.Similarity = diff.Similarity
+	response.DiffPixels = diff.DiffPixels
+	response.TotalPixels = diff.TotalPixels
+	response.Pass = diff.Similarity >= response.MinSimilarity
+
+	if !response.Pass {
+		a, err := p.image.artifacts.Put(ctx, common.Tenant(ctx), fmt.Sprintf("diffs/%s/%s.png", name, job), diff.Data, "image/png")
+		if err != nil {
+			p.logger.Error("Couldn't store diff of baseline %s: %v", name, err)
+		}
+		response.Diff = a
+	}
+
+	labels := make(sreCommon.Labels)
+	labels["result"] = "pass"
+	if !response.Pass {
+		labels["result"] = "fail"
+	}
+	p.meter.Counter("compares", "Count of all baseline comparisons", labels, "baseline", "processor").Inc()
+	return response, nil
+}
+
+func (p *BaselineProcessor) writeJson(w http.ResponseWriter, status int, v interface{}) error {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not marshal baseline: %v", err), http.StatusInternalServerError)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
+
+func (p *BaselineProcessor) writeErr(w http.ResponseWriter, err error) error {
+
+	status := p.image.errorStatus(w, "baseline", err)
+	switch {
+	case errors.Is(err, errUnknownBaseline):
+		status = http.StatusNotFound
+	case errors.Is(err, errInvalidBaselineName), errors.Is(err, errBaselineNoRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, errDiffNotImage):
+		status = http.StatusUnprocessableEntity
+	}
+	http.Error(w, err.Error(), status)
+	return err
+}
+
+// readBody validates and decodes json body, empty body is empty object
+func (p *BaselineProcessor) readBody(r *http.Request, schema string, v interface{}) error {
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBadRequestBody, err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("{}")
+	}
+	if err := validateBody(schema, data); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", errBadRequestBody, err)
+	}
+	return nil
+}
+
+func (p *BaselineProcessor) handle(w http.ResponseWriter, r *http.Request) error {
+
+	ctx := r.Context()
+	client := limiterClient(common.Tenant(ctx), r.RemoteAddr)
+
+	if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/") {
+		items, err := p.list(ctx)
+		if err != nil {
+			return p.writeErr(w, err)
+		}
+		return p.writeJson(w, http.StatusOK, items)
+	}
+
+	compare := strings.HasSuffix(r.URL.Path, "/compare")
+	name := path.Base(r.URL.Path)
+	if compare {
+		name = path.Base(path.Dir(r.URL.Path))
+	}
+	if !baselineNameRe.MatchString(name) {
+		return p.writeErr(w, fmt.Errorf("%w: %s", errInvalidBaselineName, name))
+	}
+
+	switch {
+	case r.Method == http.MethodPost && compare:
+		var request BaselineCompareRequest
+		if err := p.readBody(r, "baseline-compare.json", &request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return err
+		}
+		response, err := p.compare(ctx, client, name, &request)
+		if err != nil {
+			return p.writeErr(w, err)
+		}
+		status := http.StatusOK
+		if !response.Pass {
+			status = http.StatusUnprocessableEntity
+		}
+		return p.writeJson(w, status, response)
+
+	case r.Method == http.MethodGet:
+		b, err := p.get(ctx, name)
+		if err != nil {
+			return p.writeErr(w, err)
+		}
+		return p.writeJson(w, http.StatusOK, b)
+
+	case r.Method == http.MethodPut:
+		var request ImageProcessorRequest
+		if err := p.readBody(r, "image.json", &request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return err
+		}
+		b, err := p.save(ctx, client, name, &request)
+		if err != nil {
+			return p.writeErr(w, err)
+		}
+		return p.writeJson(w, http.StatusOK, b)
+
+	case r.Method == http.MethodDelete:
+		if err := p.delete(ctx, name); err != nil {
+			return p.writeErr(w, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	err := fmt.Errorf("method %s is not allowed", r.Method)
+	http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+	return err
+}
+
+// HandleHttpRequest lists baselines on GET .../, returns baseline on GET .../{name}, saves render of
+// request as baseline on PUT .../{name}, deletes it on DELETE .../{name} and compares render to it
+// on POST .../{name}/compare
+func (p *BaselineProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	p.requests.Inc()
+	err := p.handle(w, r)
+	if err != nil {
+		p.errors.Inc()
+	}
+	return err
+}
+
+func NewBaselineProcessor(image *ImageProcessor, observability *common.Observability) *BaselineProcessor {
+
+	meter := observability.Metrics()
+	return &BaselineProcessor{
+		image:    image,
+		logger:   observability.Logs(),
+		meter:    meter,
+		requests: meter.Counter("requests", "Count of all baseline processor requests", nil, "baseline", "processor"),
+		errors:   meter.Counter("errors", "Count of all baseline processor errors", nil, "baseline", "processor"),
+	}
+}
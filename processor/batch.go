@@ -0,0 +1,291 @@
+package processor
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+	"github.com/devopsext/webrender/storage"
+)
+
+type BatchProcessorOptions struct {
+	// renders of batch running at once
+	Parallelism int
+	// requests accepted in one batch
+	MaxItems int
+}
+
+type BatchProcessorItem struct {
+	Index       int                 `json:"index"`
+	URL         string              `json:"url"`
+	Job         string              `json:"job,omitempty"`
+	Status      string              `json:"status"`
+	Error       string              `json:"error,omitempty"`
+	File        string              `json:"file,omitempty"`
+	ContentType string              `json:"contentType,omitempty"`
+	Partial     bool                `json:"partial,omitempty"`
+	Page        string              `json:"page,omitempty"`
+	Artifacts   []*storage.Artifact `json:"artifacts,omitempty"`
+	Manifest    *common.Manifest    `json:"manifest,omitempty"`
+
+	data []byte
+}
+
+type BatchProcessorResponse struct {
+	Items  []*BatchProcessorItem `json:"items"`
+	Done   int                   `json:"done"`
+	Failed int                   `json:"failed"`
+}
+
+// BatchProcessor renders list of image requests with bounded parallelism,
+// results are returned as zip archive or json of stored artifacts
+type BatchProcessor struct {
+	options     BatchProcessorOptions
+	image       *ImageProcessor
+	logger      sreCommon.Logger
+	meter       sreCommon.Meter
+	requests    sreCommon.Counter
+	errors      sreCommon.Counter
+	items       sreCommon.Counter
+	failedItems sreCommon.Counter
+}
+
+var errBatchEmpty = errors.New("batch has no requests")
+
+func BatchProcessorType() string {
+	return "Batch"
+}
+
+func (p *BatchProcessor) Type() string {
+	return BatchProcessorType()
+}
+
+// render runs one request as image endpoint does, failure is kept in item
+func (p *BatchProcessor) render(ctx context.Context, client, output string, item *BatchProcessorItem, r *ImageProcessorRequest) {
+
+	fail := func(err error) {
+		item.Status = JobFailed
+		item.Error = err.Error()
+	}
+
+	item.URL = r.URL
+	if err := p.image.defaults(r); err != nil {
+		fail(err)
+		return
+	}
+	item.URL = r.URL
+
+	// json has nothing but stored artifacts to refer to
+	r.Async = false
+	r.CallbackURL = ""
+	r.Output = ""
+	if output == "json" {
+		store := true
+		r.Store = &store
+	}
+
+	if err := p.image.checkPolicy(r); err != nil {
+		fail(err)
+		return
+	}
+
+	job := p.image.jobs.Add(r)
+	p.image.jobs.update(job.ID, func(job *Job) {
+		job.Client = client
+	})
+	item.Job = job.ID
+
+	response, err := p.image.RenderJob(ctx, job.ID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	ext, contentType := p.image.contentExt(response.Data)
+
+	item.Status = JobDone
+	// index keeps entries unique whatever template is
+	item.File = fmt.Sprintf("%03d-%s", item.Index, p.image.filename(r, job.ID, ext))
+	item.ContentType = contentType
+	item.Partial = response.Partial
+	item.Page = response.Page
+	item.Artifacts = response.Artifacts
+	item.Manifest = response.Manifest
+	item.data = response.Data
+}
+
+func (p *BatchProcessor) writeJson(w http.ResponseWriter, response *BatchProcessorResponse) error {
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
+
+func (p *BatchProcessor) writeZip(w http.ResponseWriter, response *BatchProcessorResponse) error {
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="batch.zip"`)
+
+	zw := zip.NewWriter(w)
+	for _, item := range response.Items {
+		if item.Status != JobDone {
+			continue
+		}
+		f, err := zw.Create(item.File)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(item.data); err != nil {
+			return err
+		}
+	}
+
+	// results of all items including failed ones
+	data, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (p *BatchProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	p.requests.Inc()
+
+	if r.Method != http.MethodPost {
+		p.errors.Inc()
+		http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+		return fmt.Errorf("method %s is not allowed", r.Method)
+	}
+
+	var list []*ImageProcessorRequest
+	data, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = validateBody("batch.json", data)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &list)
+	}
+	if err != nil {
+		p.errors.Inc()
+		if !p.image.badRequest(err) {
+			err = fmt.Errorf("%w: %v", errBadRequestBody, err)
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return err
+	}
+	if len(list) == 0 {
+		p.errors.Inc()
+		http.Error(w, errBatchEmpty.Error(), http.StatusBadRequest)
+		return errBatchEmpty
+	}
+	if p.options.MaxItems > 0 && len(list) > p.options.MaxItems {
+		p.errors.Inc()
+		err := fmt.Errorf("batch has %d requests, max is %d", len(list), p.options.MaxItems)
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return err
+	}
+
+	output := r.URL.Query().Get("output")
+	if output == "json" && p.image.artifacts == nil {
+		p.errors.Inc()
+		http.Error(w, errStorageNotConfigured.Error(), http.StatusBadRequest)
+		return errStorageNotConfigured
+	}
+
+	parallelism := p.options.Parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	response := &BatchProcessorResponse{}
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+
+	for i, request := range list {
+		item := &BatchProcessorItem{Index: i}
+		response.Items = append(response.Items, item)
+		if request == nil {
+			item.Status = JobFailed
+			item.Error = "request is empty"
+			continue
+		}
+
+		if tenant := common.Tenant(r.Context()); !utils.IsEmpty(tenant) {
+			request.Tenant = tenant
+		}
+
+		// tenant of each request is a client of its own
+		client := limiterClient(request.Tenant, r.RemoteAddr)
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item *BatchProcessorItem, request *ImageProcessorRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			p.render(r.Context(), client, output, item, request)
+		}(item, request)
+	}
+	wg.Wait()
+
+	for _, item := range response.Items {
+		p.items.Inc()
+		if item.Status == JobDone {
+			response.Done++
+		} else {
+			response.Failed++
+			p.failedItems.Inc()
+		}
+	}
+
+	// client disconnect cancels rendering, nothing to respond
+	if err := r.Context().Err(); err != nil {
+		p.errors.Inc()
+		return err
+	}
+
+	if output == "json" {
+		err = p.writeJson(w, response)
+	} else {
+		err = p.writeZip(w, response)
+	}
+	if err != nil {
+		p.errors.Inc()
+		p.logger.Error("Couldn't write batch response: %v", err)
+	}
+	return err
+}
+
+func NewBatchProcessor(options BatchProcessorOptions, image *ImageProcessor, observability *common.Observability) *BatchProcessor {
+
+	meter := observability.Metrics()
+	return &BatchProcessor{
+		options:     options,
+		image:       image,
+		logger:      observability.Logs(),
+		meter:       meter,
+		requests:    meter.Counter("requests", "Count of all batch processor requests", nil, "batch", "processor"),
+		errors:      meter.Counter("errors", "Count of all batch processor errors", nil, "batch", "processor"),
+		items:       meter.Counter("items", "Count of all batch processor items", nil, "batch", "processor"),
+		failedItems: meter.Counter("failed_items", "Count of all batch processor failed items", nil, "batch", "processor"),
+	}
+}
@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/devopsext/webrender/browser"
+	"github.com/devopsext/webrender/cache"
+)
+
+type imageCacheEntry struct {
+	Created  time.Time               `json:"created"`
+	Response *ImageProcessorResponse `json:"response"`
+	// response misses dom, it's needed by hashes
+	DOM         string          `json:"dom,omitempty"`
+	DOMSnapshot json.RawMessage `json:"domSnapshot,omitempty"`
+	Trace       []byte          `json:"trace,omitempty"`
+}
+
+// cacheKey hashes request with canonical url, parameters that don't change result are dropped
+func (p *ImageProcessor) cacheKey(r *ImageProcessorRequest) (string, error) {
+
+	key := *r
+	key.URL = p.URLKey(r.URL)
+	key.Cache = nil
+	key.MaxAge = 0
+	key.Async = false
+	key.Store = nil
+	key.CallbackURL = ""
+	key.Output = ""
+	key.Disposition = ""
+	key.Filename = ""
+	key.Tags = nil
+
+	data, err := json.Marshal(&key)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func (p *ImageProcessor) cached(r *ImageProcessorRequest) bool {
+	return p.cache != nil && r.Cache != nil && *r.Cache
+}
+
+// fromCache returns cached image and response if they are younger than max age
+func (p *ImageProcessor) fromCache(ctx context.Context, r *ImageProcessorRequest) (*browser.BrowserImage, *ImageProcessorResponse) {
+
+	key, err := p.cacheKey(r)
+	if err != nil {
+		p.logger.Error("Couldn't make cache key: %v", err)
+		return nil, nil
+	}
+
+	data, err := p.cache.Get(ctx, key)
+	if err != nil {
+		p.logger.Error("Couldn't get cache %s: %v", key, err)
+		return nil, nil
+	}
+
+	misses := p.meter.Counter("cache_misses", "Count of all image processor cache misses", nil, "image", "processor")
+	if data == nil {
+		misses.Inc()
+		return nil, nil
+	}
+
+	var e imageCacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.Response == nil {
+		p.logger.Error("Couldn't unmarshal cache %s: %v", key, err)
+		misses.Inc()
+		return nil, nil
+	}
+
+	if r.MaxAge > 0 && time.Since(e.Created) > time.Duration(r.MaxAge)*time.Second {
+		misses.Inc()
+		return nil, nil
+	}
+	p.meter.Counter("cache_hits", "Count of all image processor cache hits", nil, "image", "processor").Inc()
+
+	response := e.Response
+	response.Cached = true
+	response.DOMSnapshot = e.DOMSnapshot
+	response.Trace = e.Trace
+
+	image := &browser.BrowserImage{
+		Kind:        response.Kind,
+		FinalURL:    response.FinalURL,
+		Data:        response.Data,
+		DOM:         e.DOM,
+		DOMSnapshot: e.DOMSnapshot,
+		Trace:       e.Trace,
+		Partial:     response.Partial,
+		Status:      response.Status,
+		Page:        response.Page,
+		PageReason:  response.PageReason,
+		Captcha:     response.Captcha,
+		Coverage:    response.Coverage,
+		Har:         response.Har,
+		Console:     response.Console,
+	}
+	return image, response
+}
+
+// toCache keeps complete renders only, partial and flagged pages are rendered again
+func (p *ImageProcessor) toCache(ctx context.Context, r *ImageProcessorRequest, image *browser.BrowserImage, response *ImageProcessorResponse) {
+
+	if response.Partial || response.Page != "" {
+		return
+	}
+
+	key, err := p.cacheKey(r)
+	if err != nil {
+		p.logger.Error("Couldn't make cache key: %v", err)
+		return
+	}
+
+	data, err := json.Marshal(&imageCacheEntry{
+		Created:     time.Now().UTC(),
+		Response:    response,
+		DOM:         image.DOM,
+		DOMSnapshot: image.DOMSnapshot,
+		Trace:       image.Trace,
+	})
+	if err != nil {
+		p.logger.Error("Couldn't marshal cache %s: %v", key, err)
+		return
+	}
+
+	if err := p.cache.Set(ctx, key, data, time.Duration(p.options.CacheTTL)*time.Second); err != nil {
+		p.logger.Error("Couldn't set cache %s: %v", key, err)
+	}
+}
+
+// SetCache enables request results cache
+func (p *ImageProcessor) SetCache(c cache.Cache) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.cache = c
+}
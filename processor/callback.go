@@ -0,0 +1,101 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"github.com/devopsext/webrender/delivery"
+)
+
+var errCallbacksNotConfigured = errors.New("callbacks are not configured")
+
+// ImageProcessorCallback is posted to request callback url once job is finished,
+// url is final one after redirects, requested url is the one of request
+type ImageProcessorCallback struct {
+	Job          string                  `json:"job"`
+	Status       string                  `json:"status"`
+	Error        string                  `json:"error,omitempty"`
+	URL          string                  `json:"url"`
+	RequestedURL string                  `json:"requestedUrl"`
+	Duration     float64                 `json:"duration"`
+	ContentType  string                  `json:"contentType,omitempty"`
+	Response     *ImageProcessorResponse `json:"response,omitempty"`
+}
+
+func (p *ImageProcessor) callbackViolations(r *ImageProcessorRequest) []string {
+
+	if r.CallbackURL == "" {
+		return nil
+	}
+	if p.deliveries == nil {
+		return []string{errCallbacksNotConfigured.Error()}
+	}
+	u, err := url.Parse(r.CallbackURL)
+	if err != nil {
+		return []string{"callback url couldn't be parsed"}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return []string{"callback url must be http or https"}
+	}
+	// result is posted by server itself, so it's checked as render target
+	var v []string
+	for _, t := range p.targetViolations(u) {
+		v = append(v, "callback "+t)
+	}
+	return v
+}
+
+// callback queues job result delivery with image data, retries and backoff are up to delivery queue
+func (p *ImageProcessor) callback(id string, response *ImageProcessorResponse) {
+
+	job, ok := p.jobs.Get(id)
+	if !ok || job.Request.CallbackURL == "" || p.deliveries == nil {
+		return
+	}
+
+	c := &ImageProcessorCallback{
+		Job:          job.ID,
+		Status:       job.Status,
+		Error:        job.Error,
+		URL:          job.Request.URL,
+		RequestedURL: job.Request.URL,
+		Response:     response,
+	}
+	if job.Started != nil && job.Finished != nil {
+		c.Duration = job.Finished.Sub(*job.Started).Seconds()
+	}
+	if response != nil {
+		_, c.ContentType = p.contentExt(response.Data)
+		if response.FinalURL != "" {
+			c.URL = response.FinalURL
+		}
+	}
+
+	body, err := json.Marshal(c)
+	if err != nil {
+		p.logger.Error("Couldn't marshal callback of job %s: %v", id, err)
+		return
+	}
+
+	p.deliveries.Add(&delivery.Delivery{
+		URL:         job.Request.CallbackURL,
+		ContentType: "application/json",
+		Headers: map[string]string{
+			"X-Webrender-Job": job.ID,
+		},
+		Body: body,
+	})
+	p.meter.Counter("callbacks", "Count of all image processor queued callbacks", nil, "image", "processor").Inc()
+	p.logger.Debug("Callback of job %s queued to %s", id, job.Request.CallbackURL)
+}
+
+// SetDeliveryQueue enables request callbacks delivered by queue
+func (p *ImageProcessor) SetDeliveryQueue(queue *delivery.Queue) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.deliveries = queue
+	if queue != nil && p.options.BlockPrivate {
+		queue.SetAddressFilter(p.deliveryAddress)
+	}
+}
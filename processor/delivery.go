@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+	"github.com/devopsext/webrender/delivery"
+)
+
+type DeliveryProcessorResponse struct {
+	Queued int                  `json:"queued"`
+	Dead   []*delivery.Delivery `json:"dead"`
+}
+
+var errDeliveryForbidden = errors.New("deliveries require api key not bound to tenant")
+
+// DeliveryProcessor exposes admin api of delivery queue
+type DeliveryProcessor struct {
+	queue  *delivery.Queue
+	logger sreCommon.Logger
+	meter  sreCommon.Meter
+}
+
+func DeliveryProcessorType() string {
+	return "Delivery"
+}
+
+func (p *DeliveryProcessor) Type() string {
+	return DeliveryProcessorType()
+}
+
+func (p *DeliveryProcessor) list(w http.ResponseWriter) error {
+
+	response := &DeliveryProcessorResponse{
+		Queued: p.queue.Queued(),
+		Dead:   []*delivery.Delivery{},
+	}
+
+	// bodies might be huge images
+	for _, d := range p.queue.Dead() {
+		c := *d
+		c.Body = nil
+		response.Dead = append(response.Dead, &c)
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not marshal deliveries: %v", err), http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
+
+// HandleHttpRequest lists deliveries on GET and requeues dead one on POST .../{id}/requeue,
+// deliveries are of all tenants so only admin key can see them
+func (p *DeliveryProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	if utils.IsEmpty(common.APIKey(r.Context())) || !utils.IsEmpty(common.Tenant(r.Context())) {
+		http.Error(w, errDeliveryForbidden.Error(), http.StatusForbidden)
+		return errDeliveryForbidden
+	}
+
+	switch {
+	case r.Method == http.MethodGet:
+		return p.list(w)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/requeue"):
+		id := path.Base(path.Dir(r.URL.Path))
+		if !p.queue.Requeue(id) {
+			err := fmt.Errorf("dead delivery %s not found", id)
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+
+	err := fmt.Errorf("method %s is not allowed", r.Method)
+	http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+	return err
+}
+
+func NewDeliveryProcessor(queue *delivery.Queue, observability *common.Observability) *DeliveryProcessor {
+
+	return &DeliveryProcessor{
+		queue:  queue,
+		logger: observability.Logs(),
+		meter:  observability.Metrics(),
+	}
+}
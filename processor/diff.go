@@ -0,0 +1,317 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+const (
+	defaultDiffThreshold = 0.1
+	// maxColorDelta is YIQ delta of black and white
+	maxColorDelta = 35215.0
+)
+
+// DiffProcessorRequest compares target render with base render or stored baseline image,
+// threshold is perceived color difference from 0 to 1 pixels are taken as the same within
+type DiffProcessorRequest struct {
+	Base      *ImageProcessorRequest `json:"base,omitempty"`
+	Target    *ImageProcessorRequest `json:"target"`
+	Baseline  string                 `json:"baseline,omitempty"`
+	Threshold *float64               `json:"threshold,omitempty"`
+	Output    string                 `json:"output,omitempty"`
+}
+
+type DiffProcessorResponse struct {
+	Similarity  float64 `json:"similarity"`
+	DiffPixels  int     `json:"diffPixels"`
+	TotalPixels int     `json:"totalPixels"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	BaseJob     string  `json:"baseJob,omitempty"`
+	TargetJob   string  `json:"targetJob,omitempty"`
+	Data        []byte  `json:"data,omitempty"`
+}
+
+// DiffProcessor renders two requests, or one against stored baseline, and returns image of their
+// differences, it's what visual regression tests are built of
+type DiffProcessor struct {
+	image    *ImageProcessor
+	logger   sreCommon.Logger
+	meter    sreCommon.Meter
+	requests sreCommon.Counter
+	errors   sreCommon.Counter
+}
+
+var (
+	errDiffNoBase   = errors.New("diff requires base request or baseline")
+	errDiffNotImage = errors.New("only images can be compared")
+)
+
+func DiffProcessorType() string {
+	return "Diff"
+}
+
+func (p *DiffProcessor) Type() string {
+	return DiffProcessorType()
+}
+
+// yiq converts color blended over white to luma and chroma
+func yiq(c color.Color) (float64, float64, float64) {
+
+	r, g, b, a := c.RGBA()
+	// premultiplied values over white are value plus transparent part of white
+	rf := float64(r+0xffff-a) / 257
+	gf := float64(g+0xffff-a) / 257
+	bf := float64(b+0xffff-a) / 257
+
+	y := rf*0.29889531 + gf*0.58662247 + bf*0.11448223
+	i := rf*0.59597799 - gf*0.27417610 - bf*0.32180189
+	q := rf*0.21147017 - gf*0.52261711 + bf*0.31114694
+	return y, i, q
+}
+
+// colorDelta is perceived difference of colors, weights are of pixelmatch
+func colorDelta(a, b color.Color) float64 {
+
+	y1, i1, q1 := yiq(a)
+	y2, i2, q2 := yiq(b)
+	dy, di, dq := y1-y2, i1-i2, q1-q2
+	return 0.5053*dy*dy + 0.299*di*di + 0.1957*dq*dq
+}
+
+// diffImages draws faded base with different pixels in red, area of one image only is different
+func diffImages(base, target image.Image, threshold float64) (*image.RGBA, int) {
+
+	bb, tb := base.Bounds(), target.Bounds()
+	width := max(bb.Dx(), tb.Dx())
+	height := max(bb.Dy(), tb.Dy())
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	limit := maxColorDelta * threshold * threshold
+	red := color.RGBA{R: 255, A: 255}
+	diff := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+
+			bp := image.Pt(bb.Min.X+x, bb.Min.Y+y)
+			tp := image.Pt(tb.Min.X+x, tb.Min.Y+y)
+			if !bp.In(bb) || !tp.In(tb) {
+				out.Set(x, y, red)
+				diff++
+				continue
+			}
+
+			bc := base.At(bp.X, bp.Y)
+			if colorDelta(bc, target.At(tp.X, tp.Y)) > limit {
+				out.Set(x, y, red)
+				diff++
+				continue
+			}
+			luma, _, _ := yiq(bc)
+			v := uint8(255 + (luma-255)*0.1)
+			out.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return out, diff
+}
+
+// renderImage runs one request as image endpoint does and decodes its image
+func (p *ImageProcessor) renderImage(ctx context.Context, client string, r *ImageProcessorRequest) (image.Image, *ImageProcessorResponse, string, error) {
+
+	if tenant := common.Tenant(ctx); !utils.IsEmpty(tenant) {
+		r.Tenant = tenant
+	}
+	if err := p.defaults(r); err != nil {
+		return nil, nil, "", err
+	}
+	r.Async = false
+	r.CallbackURL = ""
+	r.Output = ""
+	if err := p.checkPolicy(r); err != nil {
+		return nil, nil, "", err
+	}
+
+	job := p.jobs.Add(r)
+	p.jobs.update(job.ID, func(job *Job) {
+		job.Client = client
+	})
+	response, err := p.RenderJob(ctx, job.ID)
+	if err != nil {
+		return nil, nil, job.ID, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(response.Data))
+	if err != nil {
+		return nil, nil, job.ID, fmt.Errorf("%w: %v", errDiffNotImage, err)
+	}
+	return img, response, job.ID, nil
+}
+
+// storedImage reads stored image of tenant
+func (p *ImageProcessor) storedImage(ctx context.Context, key string) (image.Image, error) {
+
+	if p.artifacts == nil {
+		return nil, errStorageNotConfigured
+	}
+	data, err := p.artifacts.Get(ctx, common.Tenant(ctx), key)
+	if err != nil {
+		return nil, fmt.Errorf("could not get image %s: %w", key, err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: image %s: %v", errDiffNotImage, key, err)
+	}
+	return img, nil
+}
+
+// diffResponse compares images, threshold is perceived color difference from 0 to 1
+func diffResponse(base, target image.Image, threshold float64) (*DiffProcessorResponse, error) {
+
+	out, diff := diffImages(base, target, threshold)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, err
+	}
+
+	response := &DiffProcessorResponse{
+		Width:      out.Bounds().Dx(),
+		Height:     out.Bounds().Dy(),
+		DiffPixels: diff,
+		Similarity: 1,
+		Data:       buf.Bytes(),
+	}
+	response.TotalPixels = response.Width * response.Height
+	if response.TotalPixels > 0 {
+		response.Similarity = 1 - float64(diff)/float64(response.TotalPixels)
+	}
+	return response, nil
+}
+
+func (p *DiffProcessor) compare(ctx context.Context, client string, request *DiffProcessorRequest) (*DiffProcessorResponse, error) {
+
+	var base, target image.Image
+	var baseJob, targetJob string
+	var baseErr, targetErr error
+
+	// renders of both sides run at once
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		target, _, targetJob, targetErr = p.image.renderImage(ctx, client, request.Target)
+	}()
+	if request.Base != nil {
+		base, _, baseJob, baseErr = p.image.renderImage(ctx, client, request.Base)
+	} else {
+		base, baseErr = p.image.storedImage(ctx, request.Baseline)
+	}
+	wg.Wait()
+
+	if baseErr != nil {
+		return nil, fmt.Errorf("base: %w", baseErr)
+	}
+	if targetErr != nil {
+		return nil, fmt.Errorf("target: %w", targetErr)
+	}
+
+	threshold := defaultDiffThreshold
+	if request.Threshold != nil {
+		threshold = *request.Threshold
+	}
+	response, err := diffResponse(base, target, threshold)
+	if err != nil {
+		return nil, err
+	}
+	response.BaseJob = baseJob
+	response.TargetJob = targetJob
+	return response, nil
+}
+
+// HandleHttpRequest compares renders of posted request, diff image is returned with similarity
+// in headers, json output has them both
+func (p *DiffProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	p.requests.Inc()
+
+	if r.Method != http.MethodPost {
+		p.errors.Inc()
+		err := fmt.Errorf("method %s is not allowed", r.Method)
+		http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+		return err
+	}
+
+	var request DiffProcessorRequest
+	data, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = validateBody("diff.json", data)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &request)
+	}
+	if err == nil && request.Base == nil && utils.IsEmpty(request.Baseline) {
+		err = errDiffNoBase
+	}
+	if err != nil {
+		p.errors.Inc()
+		if !p.image.badRequest(err) && !errors.Is(err, errDiffNoBase) {
+			err = fmt.Errorf("%w: %v", errBadRequestBody, err)
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return err
+	}
+
+	response, err := p.compare(r.Context(), limiterClient(common.Tenant(r.Context()), r.RemoteAddr), &request)
+	if err != nil {
+		p.errors.Inc()
+		status := p.image.errorStatus(w, "diff", err)
+		if errors.Is(err, errDiffNotImage) {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, err.Error(), status)
+		return err
+	}
+
+	p.meter.Counter("diff_pixels", "Count of all different pixels of diff processor", nil, "diff", "processor").Add(response.DiffPixels)
+
+	if request.Output == "json" {
+		data, err := json.Marshal(response)
+		if err == nil {
+			w.Header().Set("Content-Type", "application/json")
+			_, err = w.Write(data)
+		}
+		return err
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("X-Webrender-Similarity", strconv.FormatFloat(response.Similarity, 'f', 6, 64))
+	w.Header().Set("X-Webrender-Diff-Pixels", strconv.Itoa(response.DiffPixels))
+	_, err = w.Write(response.Data)
+	return err
+}
+
+func NewDiffProcessor(image *ImageProcessor, observability *common.Observability) *DiffProcessor {
+
+	meter := observability.Metrics()
+	return &DiffProcessor{
+		image:    image,
+		logger:   observability.Logs(),
+		meter:    meter,
+		requests: meter.Counter("requests", "Count of all diff processor requests", nil, "diff", "processor"),
+		errors:   meter.Counter("errors", "Count of all diff processor errors", nil, "diff", "processor"),
+	}
+}
@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+// ImageProcessorDomain is a render profile of hosts matched by glob
+type ImageProcessorDomain struct {
+	Match                 string `yaml:"match"`
+	ImageProcessorRequest `yaml:",inline"`
+}
+
+func loadDomains(domains string) ([]*ImageProcessorDomain, error) {
+
+	var list []*ImageProcessorDomain
+	if utils.IsEmpty(domains) {
+		return list, nil
+	}
+	if _, err := common.LoadYaml(domains, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// matchHost matches host by glob, *.example.com matches example.com as well
+func matchHost(pattern, host string) bool {
+
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if ok, _ := path.Match(pattern, host); ok {
+		return true
+	}
+	return strings.HasPrefix(pattern, "*.") && host == strings.TrimPrefix(pattern, "*.")
+}
+
+// applyDomain merges first matching domain profile under request parameters
+func (p *ImageProcessor) applyDomain(r *ImageProcessorRequest) {
+
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, d := range p.domains {
+		if !matchHost(d.Match, host) {
+			continue
+		}
+		mergeRequest(r, &d.ImageProcessorRequest)
+
+		labels := make(sreCommon.Labels)
+		labels["domain"] = common.NormalizeLabel(d.Match)
+		p.meter.Counter("domains", "Count of all image processor requests by domain profile", labels, "image", "processor").Inc()
+		return
+	}
+}
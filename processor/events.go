@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/devopsext/webrender/browser"
+)
+
+const (
+	jobMaxEvents       = 500
+	jobFollowKeepalive = 15 * time.Second
+)
+
+type jobEventsKey struct{}
+
+// withEvents makes renders of ctx tell their events to job
+func (s *Jobs) withEvents(ctx context.Context, id string) context.Context {
+
+	f := browser.EventFunc(func(e *browser.RenderEvent) {
+		s.event(id, e)
+	})
+	return context.WithValue(ctx, jobEventsKey{}, f)
+}
+
+// renderEvents returns events receiver of job rendered by ctx, nil func drops them
+func renderEvents(ctx context.Context) browser.EventFunc {
+
+	f, _ := ctx.Value(jobEventsKey{}).(browser.EventFunc)
+	return f
+}
+
+// event keeps event of job, events over limit are dropped
+func (s *Jobs) event(id string, e *browser.RenderEvent) {
+
+	s.update(id, func(job *Job) {
+		if len(job.events) < jobMaxEvents {
+			job.events = append(job.events, e)
+		}
+	})
+}
+
+// notify wakes followers of job, must be called under lock
+func (job *Job) notify() {
+
+	if job.changed != nil {
+		close(job.changed)
+		job.changed = nil
+	}
+}
+
+// follow returns events of job since from, its copy and channel closed on its next change,
+// channel is nil when job is finished
+func (s *Jobs) follow(id string, from int) ([]*browser.RenderEvent, *Job, <-chan struct{}, bool) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, nil, nil, false
+	}
+	var events []*browser.RenderEvent
+	if from < len(job.events) {
+		events = append(events, job.events[from:]...)
+	}
+	c := *job
+	if job.Status == JobDone || job.Status == JobFailed {
+		return events, &c, nil, true
+	}
+	if job.changed == nil {
+		job.changed = make(chan struct{})
+	}
+	return events, &c, job.changed, true
+}
+
+func writeEvent(w http.ResponseWriter, typ string, v interface{}) error {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ, data)
+	return err
+}
+
+// followJob streams events of job as server sent events till it's finished, status event
+// is current job at start and end
+func (p *JobsProcessor) followJob(w http.ResponseWriter, r *http.Request, id string) error {
+
+	if job, ok := p.jobs.Get(id); ok && !jobOfTenant(r.Context(), job) {
+		err := fmt.Errorf("job %s not found", id)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return err
+	}
+
+	events, job, changed, ok := p.jobs.follow(id, 0)
+	if !ok {
+		err := fmt.Errorf("job %s not found", id)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return err
+	}
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if err := writeEvent(w, "status", job.public()); err != nil {
+		return err
+	}
+
+	sent := 0
+	for {
+		for _, e := range events {
+			if err := writeEvent(w, e.Type, e); err != nil {
+				return err
+			}
+		}
+		sent += len(events)
+
+		if changed == nil {
+			err := writeEvent(w, "status", job.public())
+			flush()
+			return err
+		}
+		flush()
+
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-changed:
+		case <-time.After(jobFollowKeepalive):
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return err
+			}
+		}
+		events, job, changed, ok = p.jobs.follow(id, sent)
+		if !ok {
+			return nil
+		}
+	}
+}
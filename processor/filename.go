@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+const (
+	defaultFilenameTemplate = "{{host}}-{{date}}.{{ext}}"
+	defaultStoreKeyTemplate = "{{date}}/{{id}}/"
+)
+
+// filenameReplacer drops path separators and quotes, so name can't escape download dir
+var filenameReplacer = strings.NewReplacer("/", "_", "\\", "_", "\"", "", "\r", "", "\n", "")
+
+var namePathRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+const nameMaxPath = 100
+
+// nameVars are values of name template placeholders
+type nameVars struct {
+	job        string
+	ext        string
+	dateLayout string
+}
+
+// namePath turns url path into single safe segment, root is index
+func namePath(u *url.URL) string {
+
+	s := strings.Trim(u.Path, "/")
+	s = strings.Trim(namePathRegexp.ReplaceAllString(s, "_"), "_")
+	if len(s) > nameMaxPath {
+		s = s[:nameMaxPath]
+	}
+	if s == "" {
+		return "index"
+	}
+	return s
+}
+
+// expandName fills template {{name}} placeholders, they are host, path, date, ts or timestamp, id, job, viewport, width, height, ext and urlhash
+func (p *ImageProcessor) expandName(template string, r *ImageProcessorRequest, vars nameVars) string {
+
+	host, path := "", "index"
+	if u, err := url.Parse(r.URL); err == nil {
+		host = u.Hostname()
+		path = namePath(u)
+	}
+
+	width, height := r.Width, r.Height
+	if width <= 0 {
+		width = p.options.Width
+	}
+	if height <= 0 {
+		height = p.options.Height
+	}
+
+	id := vars.job
+	if utils.IsEmpty(id) {
+		id = common.NewID()
+	}
+	hash := sha256.Sum256([]byte(p.URLKey(r.URL)))
+	now := time.Now().UTC()
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	values := map[string]string{
+		"host":      host,
+		"path":      path,
+		"date":      now.Format(vars.dateLayout),
+		"ts":        ts,
+		"timestamp": ts,
+		"id":        id,
+		"job":       vars.job,
+		"viewport":  fmt.Sprintf("%dx%d", width, height),
+		"width":     strconv.Itoa(width),
+		"height":    strconv.Itoa(height),
+		"ext":       vars.ext,
+		"urlhash":   hex.EncodeToString(hash[:8]),
+	}
+
+	var pairs []string
+	for k, v := range values {
+		pairs = append(pairs, "{{"+k+"}}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// filename makes download and bundle entry name by request or configured template
+func (p *ImageProcessor) filename(r *ImageProcessorRequest, job, ext string) string {
+
+	template := r.Filename
+	if utils.IsEmpty(template) {
+		template = p.options.FilenameTemplate
+	}
+	if utils.IsEmpty(template) {
+		template = defaultFilenameTemplate
+	}
+	name := p.expandName(template, r, nameVars{job: job, ext: ext, dateLayout: "2006-01-02"})
+	return filenameReplacer.Replace(name)
+}
+
+// storeKey makes artifacts prefix of job by store key template, {{date}} is a path there
+func (p *ImageProcessor) storeKey(r *ImageProcessorRequest, job string) string {
+
+	template := p.options.StoreKeyTemplate
+	if utils.IsEmpty(template) {
+		template = defaultStoreKeyTemplate
+	}
+
+	key := p.expandName(template, r, nameVars{job: job, dateLayout: "2006/01/02"})
+	if !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	return key
+}
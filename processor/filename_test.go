@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImageProcessorStoreKey(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"default", "", time.Now().UTC().Format("2006/01/02") + "/job1/"},
+		{"job", "{{host}}/{{job}}", "example.com/job1/"},
+		{"single braces", "{host}/{{id}}", "{host}/job1/"},
+	}
+
+	r := &ImageProcessorRequest{URL: "https://example.com/page"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			p := testImageProcessor(ImageProcessorOptions{StoreKeyTemplate: tt.template}, nil)
+			if key := p.storeKey(r, "job1"); key != tt.want {
+				t.Errorf("key is %s, not %s", key, tt.want)
+			}
+		})
+	}
+
+	p := testImageProcessor(ImageProcessorOptions{}, nil)
+	if name := p.filename(r, "job1", "png"); !strings.HasPrefix(name, "example.com-") || !strings.HasSuffix(name, ".png") {
+		t.Errorf("filename is %s", name)
+	}
+}
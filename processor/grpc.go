@@ -0,0 +1,268 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/api"
+	"github.com/devopsext/webrender/browser"
+	"github.com/devopsext/webrender/common"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// chunk size of streamed image data
+const grpcChunkSize = 64 * 1024
+
+const grpcErrorDomain = "webrender"
+
+var errJobNotFound = errors.New("job not found")
+
+// GrpcService serves render requests over grpc by image processor and its jobs
+type GrpcService struct {
+	api.UnimplementedWebrenderServer
+	image  *ImageProcessor
+	logger sreCommon.Logger
+	meter  sreCommon.Meter
+}
+
+func (s *GrpcService) request(in *api.RenderRequest) *ImageProcessorRequest {
+
+	r := &ImageProcessorRequest{
+		Preset:      in.GetPreset(),
+		URL:         in.GetUrl(),
+		Kind:        in.GetKind(),
+		Width:       int(in.GetWidth()),
+		Height:      int(in.GetHeight()),
+		UserAgent:   in.GetUserAgent(),
+		Timeout:     int(in.GetTimeout()),
+		Delay:       int(in.GetDelay()),
+		AsPDF:       in.Pdf,
+		FullPage:    in.FullPage,
+		Quality:     int(in.GetQuality()),
+		Cookies:     in.GetCookies(),
+		Partial:     in.Partial,
+		Store:       in.Store,
+		Tenant:      in.GetTenant(),
+		Cache:       in.Cache,
+		MaxAge:      int(in.GetMaxAge()),
+		CallbackURL: in.GetCallbackUrl(),
+		Format:      in.GetFormat(),
+		Selector:    in.GetSelector(),
+		Block:       in.GetBlock(),
+	}
+
+	if len(in.GetHeaders()) > 0 {
+		r.Headers = make(map[string]interface{})
+		for k, v := range in.GetHeaders() {
+			r.Headers[k] = v
+		}
+	}
+	return r
+}
+
+// client records tenant or peer host of job to limit its renders
+func (s *GrpcService) client(ctx context.Context, id string, r *ImageProcessorRequest) {
+
+	addr := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	client := limiterClient(r.Tenant, addr)
+	s.image.jobs.update(id, func(job *Job) {
+		job.Client = client
+	})
+}
+
+// prepare applies defaults and policies as http endpoint does, key bound to tenant renders as that tenant
+func (s *GrpcService) prepare(ctx context.Context, in *api.RenderRequest) (*ImageProcessorRequest, error) {
+
+	r := s.request(in)
+	if tenant := common.Tenant(ctx); !utils.IsEmpty(tenant) {
+		r.Tenant = tenant
+	}
+	if err := s.image.defaults(r); err != nil {
+		return nil, err
+	}
+	if err := s.image.checkPolicy(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// error maps processing error to grpc status, browser failures carry error info details
+func (s *GrpcService) error(err error) error {
+
+	code := codes.Internal
+	var info *errdetails.ErrorInfo
+
+	var statusErr *browser.StatusError
+	var navErr *browser.NavigationError
+
+	switch {
+	case s.image.badRequest(err):
+		code = codes.InvalidArgument
+	case errors.Is(err, errJobNotFound), errors.Is(err, browser.ErrSelectorNotFound):
+		code = codes.NotFound
+	case errors.Is(err, errJobsQueueFull), errors.Is(err, errClientLimit), errors.Is(err, errTenantQuota):
+		code = codes.ResourceExhausted
+	case errors.Is(err, errRenderQueueFull), errors.Is(err, errRenderQueueTimeout):
+		code = codes.Unavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.As(err, &statusErr):
+		code = codes.FailedPrecondition
+		info = &errdetails.ErrorInfo{
+			Reason:   "STATUS",
+			Domain:   grpcErrorDomain,
+			Metadata: map[string]string{"status": strconv.Itoa(statusErr.Status)},
+		}
+	case errors.As(err, &navErr):
+		code = codes.Unavailable
+		info = &errdetails.ErrorInfo{
+			Reason: navErr.Code,
+			Domain: grpcErrorDomain,
+		}
+	}
+
+	st := status.New(code, err.Error())
+	if info != nil {
+		if d, derr := st.WithDetails(info); derr == nil {
+			st = d
+		}
+	}
+	return st.Err()
+}
+
+func (s *GrpcService) meta(job string, response *ImageProcessorResponse) *api.RenderMeta {
+
+	m := &api.RenderMeta{
+		Job:        job,
+		Kind:       response.Kind,
+		FinalUrl:   response.FinalURL,
+		Status:     int32(response.Status),
+		Partial:    response.Partial,
+		Page:       response.Page,
+		PageReason: response.PageReason,
+		Cached:     response.Cached,
+	}
+	if len(response.Data) > 0 {
+		_, m.ContentType = s.image.contentExt(response.Data)
+	}
+	for _, a := range response.Artifacts {
+		m.Artifacts = append(m.Artifacts, &api.Artifact{
+			Name:      a.Name,
+			Key:       a.Key,
+			Url:       a.URL,
+			Size:      int64(a.Size),
+			Encrypted: a.Encrypted,
+		})
+	}
+	return m
+}
+
+func (s *GrpcService) job(job *Job) *api.Job {
+
+	j := &api.Job{
+		Id:      job.ID,
+		Status:  job.Status,
+		Url:     job.Request.URL,
+		Error:   job.Error,
+		Async:   job.Async,
+		Created: timestamppb.New(job.Created),
+	}
+	if job.Started != nil {
+		j.Started = timestamppb.New(*job.Started)
+	}
+	if job.Finished != nil {
+		j.Finished = timestamppb.New(*job.Finished)
+	}
+	if job.Response != nil {
+		j.Result = s.meta(job.ID, job.Response)
+	}
+	return j
+}
+
+func (s *GrpcService) Render(in *api.RenderRequest, stream api.Webrender_RenderServer) error {
+
+	r, err := s.prepare(stream.Context(), in)
+	if err != nil {
+		return s.error(err)
+	}
+	r.Async = false
+
+	job := s.image.jobs.Add(r)
+	s.client(stream.Context(), job.ID, r)
+
+	// client cancel stops rendering
+	response, err := s.image.RenderJob(stream.Context(), job.ID)
+	if err != nil {
+		return s.error(err)
+	}
+
+	if err := stream.Send(&api.RenderChunk{Chunk: &api.RenderChunk_Meta{Meta: s.meta(job.ID, response)}}); err != nil {
+		return err
+	}
+
+	data := response.Data
+	for len(data) > 0 {
+		n := grpcChunkSize
+		if n > len(data) {
+			n = len(data)
+		}
+		if err := stream.Send(&api.RenderChunk{Chunk: &api.RenderChunk_Data{Data: data[:n]}}); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func (s *GrpcService) RenderAsync(ctx context.Context, in *api.RenderRequest) (*api.Job, error) {
+
+	r, err := s.prepare(ctx, in)
+	if err != nil {
+		return nil, s.error(err)
+	}
+	r.Async = true
+
+	// job is taken before workers start changing it
+	job := s.job(s.image.jobs.Add(r))
+	s.client(ctx, job.Id, r)
+	if !s.image.jobs.Enqueue(job.Id) {
+		s.image.jobs.Finish(job.Id, nil, nil, errJobsQueueFull)
+		return nil, s.error(errJobsQueueFull)
+	}
+	return job, nil
+}
+
+func (s *GrpcService) GetJob(ctx context.Context, in *api.JobRequest) (*api.Job, error) {
+
+	job, ok := s.image.jobs.Get(in.GetId())
+	// jobs of other tenants are not found for key bound to tenant
+	if ok && !jobOfTenant(ctx, job) {
+		ok = false
+	}
+	if !ok {
+		return nil, s.error(fmt.Errorf("%w: %s", errJobNotFound, in.GetId()))
+	}
+	return s.job(job), nil
+}
+
+func NewGrpcService(image *ImageProcessor, observability *common.Observability) *GrpcService {
+
+	return &GrpcService{
+		image:  image,
+		logger: observability.Logs(),
+		meter:  observability.Metrics(),
+	}
+}
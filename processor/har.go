@@ -0,0 +1,104 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/common"
+)
+
+// HarProcessor renders image request and responds with its network log as har 1.2 document
+type HarProcessor struct {
+	image    *ImageProcessor
+	logger   sreCommon.Logger
+	meter    sreCommon.Meter
+	requests sreCommon.Counter
+	errors   sreCommon.Counter
+}
+
+func HarProcessorType() string {
+	return "Har"
+}
+
+func (p *HarProcessor) Type() string {
+	return HarProcessorType()
+}
+
+func (p *HarProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	p.requests.Inc()
+
+	request, err := p.image.resolve(r)
+	if err != nil {
+		p.errors.Inc()
+		http.Error(w, err.Error(), p.image.errorStatus(w, "har", err))
+		return err
+	}
+
+	// har is the only output, it has to be rendered right away
+	har := true
+	request.IncludeHar = &har
+	request.Async = false
+	request.CallbackURL = ""
+	request.Output = ""
+
+	err = p.image.checkPolicy(request)
+	if err != nil {
+		p.errors.Inc()
+		http.Error(w, err.Error(), p.image.errorStatus(w, "har", err))
+		return err
+	}
+
+	job := p.image.jobs.Add(request)
+	w.Header().Set("X-Webrender-Job", job.ID)
+
+	client := limiterClient(request.Tenant, r.RemoteAddr)
+	p.image.jobs.update(job.ID, func(job *Job) {
+		job.Client = client
+	})
+
+	response, err := p.image.RenderJob(r.Context(), job.ID)
+	if err != nil {
+		p.errors.Inc()
+		http.Error(w, err.Error(), p.image.errorStatus(w, "har", err))
+		return err
+	}
+	if response.Har == nil {
+		p.errors.Inc()
+		err = fmt.Errorf("browser %s returned no har", response.Kind)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+
+	data, err := json.Marshal(response.Har)
+	if err != nil {
+		p.errors.Inc()
+		http.Error(w, fmt.Sprintf("could not marshal har: %v", err), http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Set("X-Webrender-Browser", response.Kind)
+	if response.Partial {
+		w.Header().Set("X-Webrender-Partial", "true")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	if err != nil {
+		p.errors.Inc()
+	}
+	return err
+}
+
+func NewHarProcessor(image *ImageProcessor, observability *common.Observability) *HarProcessor {
+
+	meter := observability.Metrics()
+	return &HarProcessor{
+		image:    image,
+		logger:   observability.Logs(),
+		meter:    meter,
+		requests: meter.Counter("requests", "Count of all har processor requests", nil, "har", "processor"),
+		errors:   meter.Counter("errors", "Count of all har processor errors", nil, "har", "processor"),
+	}
+}
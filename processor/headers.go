@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/devopsext/utils"
+)
+
+const (
+	DispositionInline     = "inline"
+	DispositionAttachment = "attachment"
+)
+
+func dispositionViolations(disposition string) []string {
+
+	switch disposition {
+	case "", DispositionInline, DispositionAttachment:
+		return nil
+	}
+	return []string{fmt.Sprintf("disposition %s is unknown", disposition)}
+}
+
+// writeResponseHeaders sets configured headers, disposition is set for raw outputs only
+func (p *ImageProcessor) writeResponseHeaders(w http.ResponseWriter, r *ImageProcessorRequest, job string, response *ImageProcessorResponse) {
+
+	for k, v := range p.options.ResponseHeaders {
+		w.Header().Set(k, v)
+	}
+
+	if !utils.IsEmpty(p.options.CacheControl) {
+		w.Header().Set("Cache-Control", p.options.CacheControl)
+	}
+
+	disposition := r.Disposition
+	if utils.IsEmpty(disposition) {
+		disposition = p.options.Disposition
+	}
+	if utils.IsEmpty(disposition) {
+		return
+	}
+
+	ext := ""
+	switch r.Output {
+	case "json", "multipart", "url":
+		return
+	case "domsnapshot", "trace":
+		ext = "json"
+	default:
+		ext, _ = p.contentExt(response.Data)
+	}
+
+	// non ascii names are encoded as rfc 2231 filename*
+	value := mime.FormatMediaType(disposition, map[string]string{"filename": p.filename(r, job, ext)})
+	if utils.IsEmpty(value) {
+		value = disposition
+	}
+	w.Header().Set("Content-Disposition", value)
+}
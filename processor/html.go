@@ -0,0 +1,149 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+const htmlMaxBodySize = 10 * 1024 * 1024
+
+// htmlBaseURL is origin of documents without base url, it never resolves, so their relative links fail
+const htmlBaseURL = "https://webrender.invalid/"
+
+var errHTMLEmpty = errors.New("html body is empty")
+
+// HtmlProcessor renders html document posted in body, query parameters are ones of image request,
+// url is base of relative links of document and its origin
+type HtmlProcessor struct {
+	image    *ImageProcessor
+	logger   sreCommon.Logger
+	meter    sreCommon.Meter
+	requests sreCommon.Counter
+	errors   sreCommon.Counter
+}
+
+func HtmlProcessorType() string {
+	return "Html"
+}
+
+func (p *HtmlProcessor) Type() string {
+	return HtmlProcessorType()
+}
+
+func (p *HtmlProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	p.requests.Inc()
+
+	if r.Method != http.MethodPost {
+		p.errors.Inc()
+		err := fmt.Errorf("method %s is not allowed", r.Method)
+		http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+		return err
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, htmlMaxBodySize))
+	if err == nil && len(data) == 0 {
+		err = errHTMLEmpty
+	}
+	if err != nil {
+		p.errors.Inc()
+		err = fmt.Errorf("%w: %v", errBadRequestBody, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return err
+	}
+
+	if err := p.image.renderHTML(w, r, "html", string(data), nil); err != nil {
+		p.errors.Inc()
+		return err
+	}
+	return nil
+}
+
+// renderHTML renders document with parameters of query over defaults and writes image as image endpoint does,
+// errors are written to response
+func (p *ImageProcessor) renderHTML(w http.ResponseWriter, r *http.Request, channel, document string, defaults *ImageProcessorRequest) error {
+
+	// body is the document, parameters are taken from query only
+	var request ImageProcessorRequest
+	if err := p.decoder.Decode(&request, r.URL.Query()); err != nil {
+		err = fmt.Errorf("%w: could not decode query: %v", errBadRequestBody, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return err
+	}
+	if defaults != nil {
+		mergeRequest(&request, defaults)
+	}
+	request.Debug = debugRequested(r)
+	if tenant := common.Tenant(r.Context()); !utils.IsEmpty(tenant) {
+		request.Tenant = tenant
+	}
+	if utils.IsEmpty(request.URL) {
+		request.URL = htmlBaseURL
+	}
+	if err := p.defaults(&request); err != nil {
+		http.Error(w, err.Error(), p.errorStatus(w, channel, err))
+		return err
+	}
+
+	// document isn't a part of request key or job, so it's rendered right away and isn't cached
+	request.HTML = document
+	request.Async = false
+	request.Cache = nil
+
+	if err := p.checkPolicy(&request); err != nil {
+		http.Error(w, err.Error(), p.errorStatus(w, channel, err))
+		return err
+	}
+
+	job := p.jobs.Add(&request)
+	w.Header().Set("X-Webrender-Job", job.ID)
+
+	client := limiterClient(request.Tenant, r.RemoteAddr)
+	p.jobs.update(job.ID, func(job *Job) {
+		job.Client = client
+	})
+
+	response, err := p.RenderJob(r.Context(), job.ID)
+	if err != nil {
+		http.Error(w, err.Error(), p.errorStatus(w, channel, err))
+		return err
+	}
+
+	w.Header().Set("X-Webrender-Browser", response.Kind)
+	if response.Partial {
+		w.Header().Set("X-Webrender-Partial", "true")
+	}
+	p.writeResponseHeaders(w, &request, job.ID, response)
+
+	switch request.Output {
+	case "json":
+		err = p.writeJson(w, response)
+	case "multipart":
+		err = p.writeMultipart(w, response)
+	case "url":
+		err = p.writeURL(w, response)
+	default:
+		_, contentType := p.contentExt(response.Data)
+		w.Header().Set("Content-Type", contentType)
+		_, err = w.Write(response.Data)
+	}
+	return err
+}
+
+func NewHtmlProcessor(image *ImageProcessor, observability *common.Observability) *HtmlProcessor {
+
+	meter := observability.Metrics()
+	return &HtmlProcessor{
+		image:    image,
+		logger:   observability.Logs(),
+		meter:    meter,
+		requests: meter.Counter("requests", "Count of all html processor requests", nil, "html", "processor"),
+		errors:   meter.Counter("errors", "Count of all html processor errors", nil, "html", "processor"),
+	}
+}
@@ -1,29 +1,204 @@
 package processor
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-playground/form"
 
 	sreCommon "github.com/devopsext/sre/common"
 	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/adblock"
+	"github.com/devopsext/webrender/analytics"
 	"github.com/devopsext/webrender/browser"
+	"github.com/devopsext/webrender/cache"
 	"github.com/devopsext/webrender/common"
+	"github.com/devopsext/webrender/delivery"
+	"github.com/devopsext/webrender/schema"
+	"github.com/devopsext/webrender/storage"
 )
 
 type ImageProcessorRequest struct {
-	URL       string                 `form:"url"`
-	Kind      string                 `form:"kind,omitempty"`
-	Width     int                    `form:"width,omitempty"`
-	Height    int                    `form:"height,omitempty"`
-	UserAgent string                 `form:"userAgent,omitempty"`
-	Timeout   int                    `form:"timeout,omitempty"`
-	Delay     int                    `form:"delay,omitempty"`
-	AsPDF     bool                   `form:"asPDF,omitempty"`
-	Headers   map[string]interface{} `form:"headers,omitempty"`
+	Preset    string                 `form:"preset,omitempty" yaml:"-" json:"preset,omitempty"`
+	URL       string                 `form:"url" yaml:"url,omitempty" json:"url,omitempty"`
+	Kind      string                 `form:"kind,omitempty" yaml:"kind,omitempty" json:"kind,omitempty"`
+	Width     int                    `form:"width,omitempty" yaml:"width,omitempty" json:"width,omitempty"`
+	Height    int                    `form:"height,omitempty" yaml:"height,omitempty" json:"height,omitempty"`
+	UserAgent string                 `form:"userAgent,omitempty" yaml:"userAgent,omitempty" json:"userAgent,omitempty"`
+	Timeout   int                    `form:"timeout,omitempty" yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Delay     int                    `form:"delay,omitempty" yaml:"delay,omitempty" json:"delay,omitempty"`
+	AsPDF     *bool                  `form:"asPDF,omitempty" yaml:"asPDF,omitempty" json:"asPDF,omitempty"`
+	Headers   map[string]interface{} `form:"headers,omitempty" yaml:"headers,omitempty" json:"headers,omitempty"`
+	Cookies   map[string]string      `form:"cookies,omitempty" yaml:"cookies,omitempty" json:"cookies,omitempty"`
+	Partial   *bool                  `form:"partial,omitempty" yaml:"partial,omitempty" json:"partial,omitempty"`
+	Output    string                 `form:"output,omitempty" yaml:"output,omitempty" json:"output,omitempty"`
+	Format    string                 `form:"format,omitempty" yaml:"format,omitempty" json:"format,omitempty"`
+	Selector  string                 `form:"selector,omitempty" yaml:"selector,omitempty" json:"selector,omitempty"`
+	// horizontal stitches element of selector, or the widest scrolling one, scrolled horizontally
+	Direction string `form:"direction,omitempty" yaml:"direction,omitempty" json:"direction,omitempty"`
+	// partial render is rendered once more with timeout multiplied, the complete one is returned
+	RetryPartial *bool `form:"retryPartial,omitempty" yaml:"retryPartial,omitempty" json:"retryPartial,omitempty"`
+	// page scripts don't run, for no js fallback of page as search engines and screen readers see it
+	JsDisabled *bool `form:"jsDisabled,omitempty" yaml:"jsDisabled,omitempty" json:"jsDisabled,omitempty"`
+	// load, networkidle or networkidle2, idle time is quiet period in milliseconds
+	WaitUntil string `form:"waitUntil,omitempty" yaml:"waitUntil,omitempty" json:"waitUntil,omitempty"`
+	IdleTime  int    `form:"idleTime,omitempty" yaml:"idleTime,omitempty" json:"idleTime,omitempty"`
+	// js expression polled till it's truthy, e.g. window.__renderReady, up to wait timeout seconds
+	WaitExpression string `form:"waitExpression,omitempty" yaml:"waitExpression,omitempty" json:"waitExpression,omitempty"`
+	WaitTimeout    int    `form:"waitTimeout,omitempty" yaml:"waitTimeout,omitempty" json:"waitTimeout,omitempty"`
+	// seconds of navigation till load, of waits after it and of capture, exceeded one is a timeout of render
+	NavigationTimeout int `form:"navigationTimeout,omitempty" yaml:"navigationTimeout,omitempty" json:"navigationTimeout,omitempty"`
+	SettleTimeout     int `form:"settleTimeout,omitempty" yaml:"settleTimeout,omitempty" json:"settleTimeout,omitempty"`
+	CaptureTimeout    int `form:"captureTimeout,omitempty" yaml:"captureTimeout,omitempty" json:"captureTimeout,omitempty"`
+	// inline or attachment, filename is a template of download name
+	Disposition string `form:"disposition,omitempty" yaml:"disposition,omitempty" json:"disposition,omitempty"`
+	Filename    string `form:"filename,omitempty" yaml:"filename,omitempty" json:"filename,omitempty"`
+	// result is posted there once rendered or failed
+	CallbackURL string `form:"callbackUrl,omitempty" yaml:"callbackUrl,omitempty" json:"callbackUrl,omitempty"`
+
+	// proxy url of render, http, https or socks5, credentials are in url
+	Proxy string `form:"proxy,omitempty" yaml:"proxy,omitempty" json:"proxy,omitempty"`
+
+	// host header of navigation, url points to ip or balancer serving that host
+	HostHeader string `form:"hostHeader,omitempty" yaml:"hostHeader,omitempty" json:"hostHeader,omitempty"`
+
+	// http basic or digest credentials of target origin, so they aren't in url
+	Username string `form:"username,omitempty" yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `form:"password,omitempty" yaml:"password,omitempty" json:"password,omitempty"`
+
+	// items of target origin storage set before navigation, e.g. auth tokens of spa
+	LocalStorage   map[string]string `form:"localStorage,omitempty" yaml:"localStorage,omitempty" json:"localStorage,omitempty"`
+	SessionStorage map[string]string `form:"sessionStorage,omitempty" yaml:"sessionStorage,omitempty" json:"sessionStorage,omitempty"`
+
+	AcceptLanguage    string   `form:"acceptLanguage,omitempty" yaml:"acceptLanguage,omitempty" json:"acceptLanguage,omitempty"`
+	UABrands          []string `form:"uaBrands,omitempty" yaml:"uaBrands,omitempty" json:"uaBrands,omitempty"`
+	UAPlatform        string   `form:"uaPlatform,omitempty" yaml:"uaPlatform,omitempty" json:"uaPlatform,omitempty"`
+	UAPlatformVersion string   `form:"uaPlatformVersion,omitempty" yaml:"uaPlatformVersion,omitempty" json:"uaPlatformVersion,omitempty"`
+	UAArchitecture    string   `form:"uaArchitecture,omitempty" yaml:"uaArchitecture,omitempty" json:"uaArchitecture,omitempty"`
+	UAModel           string   `form:"uaModel,omitempty" yaml:"uaModel,omitempty" json:"uaModel,omitempty"`
+	UAMobile          *bool    `form:"uaMobile,omitempty" yaml:"uaMobile,omitempty" json:"uaMobile,omitempty"`
+
+	BrowserCache   string   `form:"browserCache,omitempty" yaml:"browserCache,omitempty" json:"browserCache,omitempty"`
+	ServiceWorkers string   `form:"serviceWorkers,omitempty" yaml:"serviceWorkers,omitempty" json:"serviceWorkers,omitempty"`
+	Permissions    []string `form:"permissions,omitempty" yaml:"permissions,omitempty" json:"permissions,omitempty"`
+	ColorScheme    string   `form:"colorScheme,omitempty" yaml:"colorScheme,omitempty" json:"colorScheme,omitempty"`
+	Block          []string `form:"block,omitempty" yaml:"block,omitempty" json:"block,omitempty"`
+	Consent        []string `form:"consent,omitempty" yaml:"consent,omitempty" json:"consent,omitempty"`
+
+	// resource types e.g. image, font, media, and requests to other sites to fail, when only dom or layout is needed,
+	// ads and trackers are blocked and hidden by filter lists
+	BlockTypes      []string `form:"blockTypes,omitempty" yaml:"blockTypes,omitempty" json:"blockTypes,omitempty"`
+	BlockThirdParty *bool    `form:"blockThirdParty,omitempty" yaml:"blockThirdParty,omitempty" json:"blockThirdParty,omitempty"`
+	BlockAds        *bool    `form:"blockAds,omitempty" yaml:"blockAds,omitempty" json:"blockAds,omitempty"`
+
+	// layout of pdf, paper is a name e.g. a4 or letter, or width and height, sizes and margins are inches
+	Paper           string   `form:"paper,omitempty" yaml:"paper,omitempty" json:"paper,omitempty"`
+	PaperWidth      float64  `form:"paperWidth,omitempty" yaml:"paperWidth,omitempty" json:"paperWidth,omitempty"`
+	PaperHeight     float64  `form:"paperHeight,omitempty" yaml:"paperHeight,omitempty" json:"paperHeight,omitempty"`
+	Landscape       *bool    `form:"landscape,omitempty" yaml:"landscape,omitempty" json:"landscape,omitempty"`
+	MarginTop       *float64 `form:"marginTop,omitempty" yaml:"marginTop,omitempty" json:"marginTop,omitempty"`
+	MarginBottom    *float64 `form:"marginBottom,omitempty" yaml:"marginBottom,omitempty" json:"marginBottom,omitempty"`
+	MarginLeft      *float64 `form:"marginLeft,omitempty" yaml:"marginLeft,omitempty" json:"marginLeft,omitempty"`
+	MarginRight     *float64 `form:"marginRight,omitempty" yaml:"marginRight,omitempty" json:"marginRight,omitempty"`
+	Scale           float64  `form:"scale,omitempty" yaml:"scale,omitempty" json:"scale,omitempty"`
+	PrintBackground *bool    `form:"printBackground,omitempty" yaml:"printBackground,omitempty" json:"printBackground,omitempty"`
+	PageRanges      string   `form:"pageRanges,omitempty" yaml:"pageRanges,omitempty" json:"pageRanges,omitempty"`
+	// html of pdf header and footer with {{pageNumber}}, {{totalPages}}, {{date}}, {{title}} and {{url}} placeholders,
+	// they are shown within top and bottom margins
+	HeaderTemplate string `form:"headerTemplate,omitempty" yaml:"headerTemplate,omitempty" json:"headerTemplate,omitempty"`
+	FooterTemplate string `form:"footerTemplate,omitempty" yaml:"footerTemplate,omitempty" json:"footerTemplate,omitempty"`
+	// pdf bookmarks of page headings, h1 to h3 unless depth is set
+	Outline      *bool `form:"outline,omitempty" yaml:"outline,omitempty" json:"outline,omitempty"`
+	OutlineDepth int   `form:"outlineDepth,omitempty" yaml:"outlineDepth,omitempty" json:"outlineDepth,omitempty"`
+
+	FullPage *bool `form:"fullPage,omitempty" yaml:"fullPage,omitempty" json:"fullPage,omitempty"`
+	Quality  int   `form:"quality,omitempty" yaml:"quality,omitempty" json:"quality,omitempty"`
+	// scroll to bottom before capture, so lazy loaded content is there, step and max are pixels, delay is milliseconds
+	Scroll      *bool `form:"scroll,omitempty" yaml:"scroll,omitempty" json:"scroll,omitempty"`
+	ScrollStep  int   `form:"scrollStep,omitempty" yaml:"scrollStep,omitempty" json:"scrollStep,omitempty"`
+	ScrollDelay int   `form:"scrollDelay,omitempty" yaml:"scrollDelay,omitempty" json:"scrollDelay,omitempty"`
+	ScrollMax   int   `form:"scrollMax,omitempty" yaml:"scrollMax,omitempty" json:"scrollMax,omitempty"`
+	// position in pixels viewport is scrolled to right before capture
+	ScrollX int `form:"scrollX,omitempty" yaml:"scrollX,omitempty" json:"scrollX,omitempty"`
+	ScrollY int `form:"scrollY,omitempty" yaml:"scrollY,omitempty" json:"scrollY,omitempty"`
+
+	// texts page must and mustn't have, render fails otherwise, dom is checked and image is if ocr is set
+	AssertText    []string `form:"assertText,omitempty" yaml:"assertText,omitempty" json:"assertText,omitempty"`
+	AssertNotText []string `form:"assertNotText,omitempty" yaml:"assertNotText,omitempty" json:"assertNotText,omitempty"`
+	OCR           *bool    `form:"ocr,omitempty" yaml:"ocr,omitempty" json:"ocr,omitempty"`
+	OCRLanguages  string   `form:"ocrLanguages,omitempty" yaml:"ocrLanguages,omitempty" json:"ocrLanguages,omitempty"`
+
+	// elements page must show, they are boxed in image, render fails with annotated image otherwise
+	AssertSelectors []string `form:"assertSelectors,omitempty" yaml:"assertSelectors,omitempty" json:"assertSelectors,omitempty"`
+
+	CaptureDOM *bool `form:"captureDOM,omitempty" yaml:"captureDOM,omitempty" json:"captureDOM,omitempty"`
+	Coverage   *bool `form:"coverage,omitempty" yaml:"coverage,omitempty" json:"coverage,omitempty"`
+	Trace      *bool `form:"trace,omitempty" yaml:"trace,omitempty" json:"trace,omitempty"`
+	Memory     *bool `form:"memory,omitempty" yaml:"memory,omitempty" json:"memory,omitempty"`
+	// heap snapshot is stored as artifact, memory is implied
+	HeapSnapshot *bool `form:"heapSnapshot,omitempty" yaml:"heapSnapshot,omitempty" json:"heapSnapshot,omitempty"`
+	Performance  *bool `form:"performance,omitempty" yaml:"performance,omitempty" json:"performance,omitempty"`
+	Waterfall    *bool `form:"waterfall,omitempty" yaml:"waterfall,omitempty" json:"waterfall,omitempty"`
+	IncludeHar   *bool `form:"includeHar,omitempty" yaml:"includeHar,omitempty" json:"includeHar,omitempty"`
+	// console messages and exceptions are returned with json and multipart outputs, and stored
+	Console *bool `form:"console,omitempty" yaml:"console,omitempty" json:"console,omitempty"`
+
+	Async bool `form:"async,omitempty" yaml:"async,omitempty" json:"async,omitempty"`
+
+	Store  *bool  `form:"store,omitempty" yaml:"store,omitempty" json:"store,omitempty"`
+	Tenant string `form:"tenant,omitempty" yaml:"tenant,omitempty" json:"tenant,omitempty"`
+
+	// arbitrary labels of job, e.g. feature, release or test suite, jobs api filters by them
+	Tags map[string]string `form:"tags,omitempty" yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// take result from cache if it's younger than max age seconds, 0 is up to cache ttl
+	Cache  *bool `form:"cache,omitempty" yaml:"cache,omitempty" json:"cache,omitempty"`
+	MaxAge int   `form:"maxAge,omitempty" yaml:"maxAge,omitempty" json:"maxAge,omitempty"`
+
+	// debug is set by header or authorized parameter only, it's not a part of request body
+	Debug bool `form:"-" yaml:"-" json:"-"`
+	// document posted to html endpoint, it's rendered instead of the one of url
+	HTML string `form:"-" yaml:"-" json:"-"`
+}
+
+type ImageProcessorResponse struct {
+	Kind        string                    `json:"kind,omitempty"`
+	FinalURL    string                    `json:"finalUrl,omitempty"`
+	Data        []byte                    `json:"data,omitempty"`
+	Partial     bool                      `json:"partial"`
+	Cached      bool                      `json:"cached,omitempty"`
+	Status      int                       `json:"status,omitempty"`
+	Page        string                    `json:"page,omitempty"`
+	PageReason  string                    `json:"pageReason,omitempty"`
+	Captcha     *browser.Captcha          `json:"captcha,omitempty"`
+	Coverage    []*browser.Coverage       `json:"coverage,omitempty"`
+	Memory      *browser.Memory           `json:"memory,omitempty"`
+	Performance *browser.Performance      `json:"performance,omitempty"`
+	Waterfall   []*browser.Resource       `json:"waterfall,omitempty"`
+	Blocked     []*browser.BlockedContact `json:"blocked,omitempty"`
+	Har         *browser.Har              `json:"har,omitempty"`
+	Console     []*browser.ConsoleMessage `json:"console,omitempty"`
+	Manifest    *common.Manifest          `json:"manifest,omitempty"`
+	Artifacts   []*storage.Artifact       `json:"artifacts,omitempty"`
+	Assertions  []*Assertion              `json:"assertions,omitempty"`
+	Stages      []*browser.Stage          `json:"stages,omitempty"`
+
+	DOMSnapshot json.RawMessage `json:"-"`
+	Trace       []byte          `json:"-"`
 }
 
 type ImageProcessorOptions struct {
@@ -32,18 +207,264 @@ type ImageProcessorOptions struct {
 	UserAgent   string
 	Timeout     int
 	Delay       int
+	WaitUntil   string
+	IdleTime    int
+	WaitTimeout int
 	BrowserPath string
 	BrowserKind string
+	FirefoxPath string
 	AsPDF       bool
+	Partial     bool
+
+	// devtools url of running chrome instead of local binary
+	BrowserRemoteURL string
+
+	// process profile of browsers, container one is for arm64 and distroless or alpine images
+	Environment string
+
+	// browser kind to retry with when browser crashed
+	FallbackBrowserKind string
+
+	// partial render is rendered once more with timeout multiplied by factor
+	PartialRetry       bool
+	PartialRetryFactor int
+
+	// seconds of render stages, zero leaves stage to timeout
+	NavigationTimeout int
+	SettleTimeout     int
+	CaptureTimeout    int
+
+	Headers         map[string]string
+	Cookies         map[string]string
+	ScreenshotCodes []int
+
+	ErrorTexts         []string
+	ErrorSelectors     []string
+	ChallengeTexts     []string
+	ChallengeSelectors []string
+
+	CaptchaSolverURL     string
+	CaptchaSolverTimeout int
+
+	// ed25519 key file or content to sign manifests
+	ManifestKey string
+
+	AcceptLanguage    string
+	UABrands          []string
+	UAPlatform        string
+	UAPlatformVersion string
+	UAArchitecture    string
+	UAModel           string
+	UAMobile          bool
+
+	BrowserCache   string
+	ServiceWorkers string
+	Permissions    []string
+	ColorScheme    string
+
+	FullPage bool
+	Quality  int
+	// scroll step is viewport height unless set
+	Scroll      bool
+	ScrollStep  int
+	ScrollDelay int
+	ScrollMax   int
+
+	// tesseract binary and its languages, e.g. eng+deu
+	OCRPath      string
+	OCRLanguages string
+
+	CaptureDOM bool
+	MaxDOMSize int
+	// computed styles of dom snapshot
+	SnapshotStyles []string
+	// categories of chrome trace
+	TraceCategories []string
+
+	// store artifacts by default
+	Store bool
+	// artifacts prefix template, placeholders are the same as filename ones
+	StoreKeyTemplate string
+
+	// seconds cached results are kept
+	CacheTTL int
+
+	// headers of render response, filename is a template with {{host}}, {{path}}, {{date}}, {{ts}},
+	// {{id}}, {{job}}, {{viewport}}, {{width}}, {{height}}, {{ext}} and {{urlhash}}
+	CacheControl     string
+	Disposition      string
+	FilenameTemplate string
+	ResponseHeaders  map[string]string
+
+	// canonical url rules for cache keys, dedup and baselines
+	URLNormalizer common.URLNormalizerOptions
+
+	// policies, empty hosts allow any and zero limits are unlimited
+	AllowedHosts []string
+	MaxWidth     int
+	MaxHeight    int
+	MaxTimeout   int
+
+	// default proxy and host patterns request proxies must match, empty allow any
+	Proxy          string
+	AllowedProxies []string
+
+	// tag keys counted as metric labels, their values are bounded
+	MetricTags []string
+
+	// hosts never rendered, internal addresses are refused unless host or cidr is in private allowed
+	DeniedHosts    []string
+	BlockPrivate   bool
+	PrivateAllowed []string
+
+	// domains renders must never contact, plain domain blocks its subdomains
+	BlockedDomains []string
+
+	// filter lists of adblock plus syntax e.g. easylist files, ads are blocked by default or by request
+	AdFilterLists []string
+	BlockAds      bool
+
+	// browser event types logged, e.g. failures and errors only, and percent of them logged
+	EventLogTypes  []string
+	EventLogSample int
+
+	// fake browser latency and its jitter in milliseconds, percent of urls failed
+	FakeLatency     int
+	FakeJitter      int
+	FakeFailureRate int
+
+	// dir chrome renders record devtools protocol messages to, empty disables recording
+	CDPRecordDir string
+
+	// browser renders running at once in total and per client, zero is unlimited,
+	// excess renders wait in queue of max size up to queue timeout seconds
+	MaxConcurrency       int
+	MaxClientConcurrency int
+	MaxQueue             int
+	QueueTimeout         int
+
+	// yaml file or content with preset name: request parameters
+	Presets string
+	// yaml file or content with list of domain match and request parameters
+	Domains string
+	// yaml file or content with list of host match and host, scheme or proxy navigation goes to
+	Rewrites string
+	// yaml file or content with tenant name: default headers and cookies
+	Tenants string
 }
 
 type ImageProcessor struct {
 	options       ImageProcessorOptions
+	browsers      map[string]browser.NewBrowserFunc
+	captchaSolver browser.CaptchaSolver
+	adblock       *adblock.Engine
+	signer        *common.ManifestSigner
+	presets       map[string]*ImageProcessorRequest
+	tenants       map[string]*ImageProcessorTenant
+	domains       []*ImageProcessorDomain
+	rewrites      []*ImageProcessorRewrite
+	normalizer    *common.URLNormalizer
+	artifacts     *storage.Artifacts
+	jobs          *Jobs
+	deliveries    *delivery.Queue
+	cache         cache.Cache
+	analytics     *analytics.Recorder
+	limiter       *renderLimiter
+	usage         *tenantUsage
+	decoder       *form.Decoder
 	observability *common.Observability
 	logger        sreCommon.Logger
 	meter         sreCommon.Meter
+	meters        map[string]*imageProcessorMeters
+	counters      *imageProcessorCounters
+	tagValues     map[string]map[string]bool
+	mutex         sync.RWMutex
+}
+
+type imageProcessorMeters struct {
+	channel  string
+	requests sreCommon.Counter
+	errors   sreCommon.Counter
+	partials sreCommon.Counter
+}
+
+const imageProcessorMaxChannels = 32
+
+// imageProcessorCounter is a counter labeled by values known at render time, created once per values
+type imageProcessorCounter struct {
+	meter    sreCommon.Meter
+	name     string
+	help     string
+	labels   []string
+	counters map[string]sreCommon.Counter
+	mutex    sync.Mutex
+}
+
+// imageProcessorCounters are render counters besides channel ones
+type imageProcessorCounters struct {
+	stageTimeouts    *imageProcessorCounter
+	blockedContacts  *imageProcessorCounter
+	fallbacks        *imageProcessorCounter
+	navigationErrors *imageProcessorCounter
+	pages            *imageProcessorCounter
+	rewrites         *imageProcessorCounter
+	partialRetries   *imageProcessorCounter
 }
 
+func newImageProcessorCounter(meter sreCommon.Meter, name, help string, labels ...string) *imageProcessorCounter {
+
+	return &imageProcessorCounter{
+		meter:    meter,
+		name:     name,
+		help:     help,
+		labels:   labels,
+		counters: make(map[string]sreCommon.Counter),
+	}
+}
+
+func newImageProcessorCounters(meter sreCommon.Meter) *imageProcessorCounters {
+
+	return &imageProcessorCounters{
+		stageTimeouts:    newImageProcessorCounter(meter, "stage_timeouts", "Count of all render stages which exceeded their budget", "stage"),
+		blockedContacts:  newImageProcessorCounter(meter, "blocked_contacts", "Count of all requests to blocked domains", "domain"),
+		fallbacks:        newImageProcessorCounter(meter, "fallbacks", "Count of all image processor browser fallbacks", "from", "to"),
+		navigationErrors: newImageProcessorCounter(meter, "navigation_errors", "Count of all image processor navigation errors", "channel", "code"),
+		pages:            newImageProcessorCounter(meter, "pages", "Count of all image processor error and challenge pages", "channel", "page"),
+		rewrites:         newImageProcessorCounter(meter, "rewrites", "Count of all image processor navigations by rewrite rule", "rewrite"),
+		partialRetries:   newImageProcessorCounter(meter, "partial_retries", "Count of all image processor retries of partial renders", "result"),
+	}
+}
+
+// with returns counter of label values given in order of labels
+func (c *imageProcessorCounter) with(values ...string) sreCommon.Counter {
+
+	key := strings.Join(values, "\x00")
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	counter, ok := c.counters[key]
+	if ok {
+		return counter
+	}
+
+	labels := make(sreCommon.Labels)
+	for i, l := range c.labels {
+		if i < len(values) {
+			labels[l] = values[i]
+		}
+	}
+	counter = c.meter.Counter(c.name, c.help, labels, "image", "processor")
+	c.counters[key] = counter
+	return counter
+}
+
+var errUnknownBrowserKind = errors.New("unknown browser kind")
+var errStorageNotConfigured = errors.New("storage is not configured")
+var errBadRequestBody = errors.New("could not decode json body")
+var errInvalidRequestBody = errors.New("json body doesn't match schema")
+var errJobsQueueFull = errors.New("jobs queue is full")
+
 func ImageProcessorType() string {
 	return "Image"
 }
@@ -52,7 +473,45 @@ func (p *ImageProcessor) Type() string {
 	return ImageProcessorType()
 }
 
-func (p *ImageProcessor) chromeImage(r *ImageProcessorRequest) ([]byte, error) {
+// channelMeters creates counters once per channel
+func (p *ImageProcessor) channelMeters(channel string) *imageProcessorMeters {
+
+	channel = common.NormalizeLabel(channel)
+
+	p.mutex.RLock()
+	m, ok := p.meters[channel]
+	p.mutex.RUnlock()
+	if ok {
+		return m
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// keep labels cardinality bounded
+	if len(p.meters) >= imageProcessorMaxChannels {
+		channel = "other"
+	}
+
+	m, ok = p.meters[channel]
+	if ok {
+		return m
+	}
+
+	labels := make(sreCommon.Labels)
+	labels["channel"] = channel
+
+	m = &imageProcessorMeters{
+		channel:  channel,
+		requests: p.meter.Counter("requests", "Count of all image processor requests", labels, "image", "processor"),
+		errors:   p.meter.Counter("errors", "Count of all image processor errors", labels, "image", "processor"),
+		partials: p.meter.Counter("partials", "Count of all image processor partial results", labels, "image", "processor"),
+	}
+	p.meters[channel] = m
+	return m
+}
+
+func (p *ImageProcessor) browserOptions(r *ImageProcessorRequest) browser.BrowserOptions {
 
 	width := r.Width
 	if width == 0 {
@@ -79,93 +538,1175 @@ func (p *ImageProcessor) chromeImage(r *ImageProcessorRequest) ([]byte, error) {
 		delay = p.options.Delay
 	}
 
-	options := browser.ChromeBrowserOptions{
+	waitUntil := r.WaitUntil
+	if utils.IsEmpty(waitUntil) {
+		waitUntil = p.options.WaitUntil
+	}
+	idleTime := r.IdleTime
+	if idleTime == 0 {
+		idleTime = p.options.IdleTime
+	}
+
+	waitTimeout := r.WaitTimeout
+	if waitTimeout == 0 {
+		waitTimeout = p.options.WaitTimeout
+	}
+
+	navigationTimeout := r.NavigationTimeout
+	if navigationTimeout == 0 {
+		navigationTimeout = p.options.NavigationTimeout
+	}
+	settleTimeout := r.SettleTimeout
+	if settleTimeout == 0 {
+		settleTimeout = p.options.SettleTimeout
+	}
+	captureTimeout := r.CaptureTimeout
+	if captureTimeout == 0 {
+		captureTimeout = p.options.CaptureTimeout
+	}
+
+	partial := p.options.Partial
+	if r.Partial != nil {
+		partial = *r.Partial
+	}
+
+	acceptLanguage := r.AcceptLanguage
+	if utils.IsEmpty(acceptLanguage) {
+		acceptLanguage = p.options.AcceptLanguage
+	}
+
+	uaBrands := r.UABrands
+	if len(uaBrands) == 0 {
+		uaBrands = p.options.UABrands
+	}
+
+	uaPlatform := r.UAPlatform
+	if utils.IsEmpty(uaPlatform) {
+		uaPlatform = p.options.UAPlatform
+	}
+
+	uaPlatformVersion := r.UAPlatformVersion
+	if utils.IsEmpty(uaPlatformVersion) {
+		uaPlatformVersion = p.options.UAPlatformVersion
+	}
+
+	uaArchitecture := r.UAArchitecture
+	if utils.IsEmpty(uaArchitecture) {
+		uaArchitecture = p.options.UAArchitecture
+	}
+
+	uaModel := r.UAModel
+	if utils.IsEmpty(uaModel) {
+		uaModel = p.options.UAModel
+	}
+
+	uaMobile := p.options.UAMobile
+	if r.UAMobile != nil {
+		uaMobile = *r.UAMobile
+	}
+
+	browserCache := r.BrowserCache
+	if utils.IsEmpty(browserCache) {
+		browserCache = p.options.BrowserCache
+	}
+
+	serviceWorkers := r.ServiceWorkers
+	if utils.IsEmpty(serviceWorkers) {
+		serviceWorkers = p.options.ServiceWorkers
+	}
+
+	permissions := r.Permissions
+	if len(permissions) == 0 {
+		permissions = p.options.Permissions
+	}
+
+	proxy := r.Proxy
+	if utils.IsEmpty(proxy) {
+		proxy = p.options.Proxy
+	}
+
+	colorScheme := r.ColorScheme
+	if utils.IsEmpty(colorScheme) {
+		colorScheme = p.options.ColorScheme
+	}
+
+	fullPage := p.options.FullPage
+	if r.FullPage != nil {
+		fullPage = *r.FullPage
+	}
+
+	quality := r.Quality
+	if quality == 0 {
+		quality = p.options.Quality
+	}
+
+	scroll := p.options.Scroll
+	if r.Scroll != nil {
+		scroll = *r.Scroll
+	}
+	scrollStep := r.ScrollStep
+	if scrollStep == 0 {
+		scrollStep = p.options.ScrollStep
+	}
+	scrollDelay := r.ScrollDelay
+	if scrollDelay == 0 {
+		scrollDelay = p.options.ScrollDelay
+	}
+	scrollMax := r.ScrollMax
+	if scrollMax == 0 {
+		scrollMax = p.options.ScrollMax
+	}
+
+	asPDF := p.options.AsPDF
+	if r.AsPDF != nil {
+		asPDF = *r.AsPDF
+	}
+
+	// request headers override default ones
+	headers := make(map[string]interface{})
+	for k, v := range p.options.Headers {
+		headers[k] = v
+	}
+	for k, v := range r.Headers {
+		headers[k] = v
+	}
+
+	cookies := make(map[string]string)
+	for k, v := range p.options.Cookies {
+		cookies[k] = v
+	}
+	for k, v := range r.Cookies {
+		cookies[k] = v
+	}
+
+	captureDOM := p.options.CaptureDOM
+	if r.CaptureDOM != nil {
+		captureDOM = *r.CaptureDOM
+	}
+	// text assertions are checked against dom
+	if hasTextAssertions(r) {
+		captureDOM = true
+	}
+
+	// nil engine isn't nil filter
+	var requestFilter browser.RequestFilter
+	blockAds := p.options.BlockAds
+	if r.BlockAds != nil {
+		blockAds = *r.BlockAds
+	}
+	if blockAds && p.adblock != nil {
+		requestFilter = p.adblock
+	}
+
+	options := browser.BrowserOptions{
 		Width:      width,
 		Height:     height,
 		Path:       p.options.BrowserPath,
+		RemoteURL:  p.options.BrowserRemoteURL,
 		UserAgent:  userAgent,
 		Timeout:    timeout,
 		Delay:      delay,
-		FullPage:   true,
-		AsPDF:      r.AsPDF,
-		HeadersMap: r.Headers,
+		WaitUntil:  waitUntil,
+		IdleTime:   idleTime,
+		FullPage:   fullPage,
+		Quality:    quality,
+		AsPDF:      asPDF,
+		PDF:        pdfOptions(r),
+		Format:     r.Format,
+		Selector:   r.Selector,
+		HTML:       r.HTML,
+		Direction:  r.Direction,
+		HeadersMap: headers,
+		Cookies:    cookies,
+		HostHeader: r.HostHeader,
+
+		Proxy:          proxy,
+		Username:       r.Username,
+		Password:       r.Password,
+		LocalStorage:   r.LocalStorage,
+		SessionStorage: r.SessionStorage,
+
+		WaitExpression: r.WaitExpression,
+		WaitTimeout:    waitTimeout,
+
+		NavigationTimeout: navigationTimeout,
+		SettleTimeout:     settleTimeout,
+		CaptureTimeout:    captureTimeout,
+
+		Scroll:      scroll,
+		ScrollStep:  scrollStep,
+		ScrollDelay: scrollDelay,
+		ScrollMax:   scrollMax,
+		ScrollX:     r.ScrollX,
+		ScrollY:     r.ScrollY,
+
+		ScreenshotCodes: p.options.ScreenshotCodes,
+		Partial:         partial,
+
+		ErrorTexts:         p.options.ErrorTexts,
+		ErrorSelectors:     p.options.ErrorSelectors,
+		ChallengeTexts:     p.options.ChallengeTexts,
+		ChallengeSelectors: p.options.ChallengeSelectors,
+		CaptchaSolver:      p.getCaptchaSolver(),
+
+		AcceptLanguage:           acceptLanguage,
+		UserAgentBrands:          uaBrands,
+		UserAgentPlatform:        uaPlatform,
+		UserAgentPlatformVersion: uaPlatformVersion,
+		UserAgentArchitecture:    uaArchitecture,
+		UserAgentModel:           uaModel,
+		UserAgentMobile:          uaMobile,
+		BrowserCache:             browserCache,
+		ServiceWorkers:           serviceWorkers,
+		Permissions:              permissions,
+		ColorScheme:              colorScheme,
+		JsDisabled:               r.JsDisabled != nil && *r.JsDisabled,
+		BlockedURLs:              r.Block,
+		ConsentSelectors:         r.Consent,
+
+		CaptureDOM: captureDOM,
+		MaxDOMSize: p.options.MaxDOMSize,
+
+		DOMSnapshot:    r.Output == "domsnapshot",
+		SnapshotStyles: p.options.SnapshotStyles,
+
+		Coverage: r.Coverage != nil && *r.Coverage,
+
+		Trace:           r.Trace != nil && *r.Trace,
+		TraceCategories: p.options.TraceCategories,
+
+		Memory:       r.Memory != nil && *r.Memory,
+		Performance:  r.Performance != nil && *r.Performance,
+		HeapSnapshot: r.HeapSnapshot != nil && *r.HeapSnapshot,
+
+		Waterfall: r.Waterfall != nil && *r.Waterfall,
+		Har:       r.IncludeHar != nil && *r.IncludeHar,
+		Console:   r.Console != nil && *r.Console,
+
+		Debug:          r.Debug,
+		EventLogTypes:  p.options.EventLogTypes,
+		EventLogSample: p.options.EventLogSample,
+
+		BlockedDomains:  p.options.BlockedDomains,
+		BlockedTypes:    r.BlockTypes,
+		BlockThirdParty: r.BlockThirdParty != nil && *r.BlockThirdParty,
+		RequestFilter:   requestFilter,
+
+		AssertSelectors: r.AssertSelectors,
+
+		FakeLatency:     p.options.FakeLatency,
+		FakeJitter:      p.options.FakeJitter,
+		FakeFailureRate: p.options.FakeFailureRate,
+
+		RecordDir:   p.options.CDPRecordDir,
+		Environment: p.options.Environment,
+	}
+	return options
+}
+
+func (p *ImageProcessor) render(ctx context.Context, kind string, u *url.URL, r *ImageProcessorRequest) (*browser.BrowserImage, error) {
+
+	p.mutex.RLock()
+	newBrowser, ok := p.browsers[kind]
+	p.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownBrowserKind, kind)
+	}
+
+	options := p.browserOptions(r)
+	if kind == browser.BrowserKindFirefox {
+		options.Path = p.options.FirefoxPath
+		options.RemoteURL = ""
+	}
+
+	if r.Debug {
+		p.logger.Info("[debug] Rendering %s by %s with %dx%d, timeout %d, delay %d", r.URL, kind, options.Width, options.Height, options.Timeout, options.Delay)
+	}
+
+	options.HostFilter = p.hostFilter(u, r, options.Proxy)
+	options.Events = renderEvents(ctx)
+	options.Events.Event(browser.RenderEventRender, "rendering %s by %s", r.URL, kind)
+
+	image, err := newBrowser(options, p.observability).Image(ctx, u)
+	if err != nil {
+		if r.Debug {
+			p.logger.Info("[debug] Rendering %s by %s failed: %v", r.URL, kind, err)
+		}
+		options.Events.Event(browser.RenderEventRender, "rendering by %s failed: %v", kind, err)
+		return nil, err
+	}
+	image.Kind = kind
+	options.Events.Event(browser.RenderEventRender, "rendered by %s, status %d, partial %v", kind, image.Status, image.Partial)
+
+	if r.Debug {
+		p.logger.Info("[debug] Rendered %s by %s, final url %s, status %d, partial %v, %d bytes", r.URL, kind, image.FinalURL, image.Status, image.Partial, len(image.Data))
+	}
+
+	for _, s := range image.Stages {
+		if !s.Exceeded {
+			continue
+		}
+		p.counters.stageTimeouts.with(s.Name).Inc()
+	}
+
+	for _, c := range image.Blocked {
+		p.counters.blockedContacts.with(common.NormalizeLabel(c.Domain)).Add(c.Count)
+	}
+	return image, nil
+}
+
+func (p *ImageProcessor) image(ctx context.Context, client string, r *ImageProcessorRequest) (*browser.BrowserImage, error) {
+
+	kind := r.Kind
+	if utils.IsEmpty(kind) {
+		kind = p.options.BrowserKind
 	}
-	chrome := browser.NewChromeBrowser(options, p.observability)
 
 	u, err := url.Parse(r.URL)
 	if err != nil {
 		return nil, err
 	}
+	u, r = p.applyRewrite(u, r)
 
-	image, err := chrome.Image(u)
+	release, err := p.limiter.acquire(ctx, client)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
-	return image.Data, nil
+	// quota is taken by renders which got a slot only
+	if err := p.takeQuota(r.Tenant); err != nil {
+		return nil, err
+	}
+
+	image, err := p.render(ctx, kind, u, r)
+	if err == nil && image.Partial && p.retryPartial(r) {
+		image = p.rerender(ctx, kind, u, r, image)
+	}
+
+	// engine specific failure, try another engine once
+	fallback := p.options.FallbackBrowserKind
+	// firefox can't enforce blocked domains and private hosts, so it's no fallback then
+	if (len(p.options.BlockedDomains) > 0 || p.options.BlockPrivate) && fallback == browser.BrowserKindFirefox {
+		fallback = ""
+	}
+	if errors.Is(err, browser.ErrCrashed) && !utils.IsEmpty(fallback) && fallback != kind {
+
+		p.logger.Warn("Browser %s crashed on %s, falling back to %s", kind, r.URL, fallback)
+		renderEvents(ctx).Event(browser.RenderEventRetry, "%s crashed, falling back to %s", kind, fallback)
+		p.counters.fallbacks.with(kind, fallback).Inc()
+
+		return p.render(ctx, fallback, u, r)
+	}
+	return image, err
 }
 
-func (p *ImageProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+func (p *ImageProcessor) hashes(image *browser.BrowserImage) []*common.ManifestArtifact {
 
-	channel := strings.TrimLeft(r.URL.Path, "/")
+	m := &common.Manifest{}
+	m.AddArtifact("image", image.Data)
+	if !utils.IsEmpty(image.DOM) {
+		m.AddArtifact("dom", []byte(image.DOM))
+	}
+	if len(image.DOMSnapshot) > 0 {
+		m.AddArtifact("domsnapshot", image.DOMSnapshot)
+	}
+	if len(image.Trace) > 0 {
+		m.AddArtifact("trace", image.Trace)
+	}
+	if len(image.HeapSnapshot) > 0 {
+		m.AddArtifact("heapsnapshot", image.HeapSnapshot)
+	}
+	if image.Har != nil {
+		if data, err := json.Marshal(image.Har); err == nil {
+			m.AddArtifact("har", data)
+		}
+	}
+	if image.Console != nil {
+		if data, err := json.Marshal(image.Console); err == nil {
+			m.AddArtifact("console", data)
+		}
+	}
+	return m.Artifacts
+}
 
-	labels := make(sreCommon.Labels)
-	labels["channel"] = channel
+// manifest hashes artifacts and signs them with request parameters
+func (p *ImageProcessor) manifest(r *ImageProcessorRequest, image *browser.BrowserImage) *common.Manifest {
 
-	requests := p.meter.Counter("requests", "Count of all google processor requests", labels, "google", "processor")
-	errs := p.meter.Counter("errors", "Count of all google processor errors", labels, "google", "processor")
+	if p.signer == nil {
+		return nil
+	}
 
-	requests.Inc()
+	// header, cookie, password and storage values might be secrets
+	params := *r
+	params.Headers = nil
+	params.Cookies = nil
+	params.Proxy = redactProxy(params.Proxy)
+	params.Password = ""
+	params.LocalStorage = nil
+	params.SessionStorage = nil
 
-	err := r.ParseForm()
+	parameters, err := json.Marshal(&params)
+	if err != nil {
+		p.logger.Error("Couldn't marshal manifest parameters: %v", err)
+		return nil
+	}
+
+	m := &common.Manifest{
+		Artifacts:  p.hashes(image),
+		Parameters: parameters,
+		Timestamp:  time.Now().UTC(),
+	}
+
+	if err = p.signer.Sign(m); err != nil {
+		p.logger.Error("Couldn't sign manifest: %v", err)
+		return nil
+	}
+	return m
+}
+
+func (p *ImageProcessor) contentExt(data []byte) (string, string) {
+
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/png":
+		return "png", contentType
+	case "image/jpeg":
+		return "jpg", contentType
+	case "application/pdf":
+		return "pdf", contentType
+	}
+	if bytes.HasPrefix(data, []byte("<svg")) {
+		return "svg", "image/svg+xml"
+	}
+	return "bin", contentType
+}
+
+// store puts image, dom and manifest of job into tenant artifacts
+func (p *ImageProcessor) store(ctx context.Context, job string, r *ImageProcessorRequest, image *browser.BrowserImage, response *ImageProcessorResponse) error {
+
+	if p.artifacts == nil {
+		return errStorageNotConfigured
+	}
+
+	prefix := p.storeKey(r, job)
+
+	ext, contentType := p.contentExt(image.Data)
+	a, err := p.artifacts.Put(ctx, r.Tenant, prefix+"image."+ext, image.Data, contentType)
+	if err != nil {
+		return err
+	}
+	response.Artifacts = append(response.Artifacts, a)
+
+	if !utils.IsEmpty(image.DOM) {
+		a, err := p.artifacts.Put(ctx, r.Tenant, prefix+"dom.html", []byte(image.DOM), "text/html")
+		if err != nil {
+			return err
+		}
+		response.Artifacts = append(response.Artifacts, a)
+	}
+
+	if len(image.DOMSnapshot) > 0 {
+		a, err := p.artifacts.Put(ctx, r.Tenant, prefix+"domsnapshot.json", image.DOMSnapshot, "application/json")
+		if err != nil {
+			return err
+		}
+		response.Artifacts = append(response.Artifacts, a)
+	}
+
+	if len(image.Trace) > 0 {
+		a, err := p.artifacts.Put(ctx, r.Tenant, prefix+"trace.json", image.Trace, "application/json")
+		if err != nil {
+			return err
+		}
+		response.Artifacts = append(response.Artifacts, a)
+	}
+
+	if len(image.HeapSnapshot) > 0 {
+		a, err := p.artifacts.Put(ctx, r.Tenant, prefix+"heap.heapsnapshot", image.HeapSnapshot, "application/json")
+		if err != nil {
+			return err
+		}
+		response.Artifacts = append(response.Artifacts, a)
+	}
+
+	if image.Har != nil {
+		data, err := json.Marshal(image.Har)
+		if err != nil {
+			return err
+		}
+		a, err := p.artifacts.Put(ctx, r.Tenant, prefix+"har.json", data, "application/json")
+		if err != nil {
+			return err
+		}
+		response.Artifacts = append(response.Artifacts, a)
+	}
+
+	if image.Console != nil {
+		data, err := json.Marshal(image.Console)
+		if err != nil {
+			return err
+		}
+		a, err := p.artifacts.Put(ctx, r.Tenant, prefix+"console.json", data, "application/json")
+		if err != nil {
+			return err
+		}
+		response.Artifacts = append(response.Artifacts, a)
+	}
+
+	if response.Manifest != nil {
+		data, err := json.Marshal(response.Manifest)
+		if err != nil {
+			return err
+		}
+		a, err := p.artifacts.Put(ctx, r.Tenant, prefix+"manifest.json", data, "application/json")
+		if err != nil {
+			return err
+		}
+		response.Artifacts = append(response.Artifacts, a)
+	}
+	return nil
+}
+
+func (p *ImageProcessor) response(r *ImageProcessorRequest, image *browser.BrowserImage) *ImageProcessorResponse {
+
+	return &ImageProcessorResponse{
+		Kind:        image.Kind,
+		FinalURL:    image.FinalURL,
+		Data:        image.Data,
+		Partial:     image.Partial,
+		Status:      image.Status,
+		Page:        image.Page,
+		PageReason:  image.PageReason,
+		Captcha:     image.Captcha,
+		Coverage:    image.Coverage,
+		Memory:      image.Memory,
+		Performance: image.Performance,
+		Waterfall:   image.Waterfall,
+		Blocked:     image.Blocked,
+		Har:         image.Har,
+		Console:     image.Console,
+		Stages:      image.Stages,
+		Manifest:    p.manifest(r, image),
+
+		DOMSnapshot: image.DOMSnapshot,
+		Trace:       image.Trace,
+	}
+}
+
+// writeManifestHeader passes manifest along with raw image
+func (p *ImageProcessor) writeManifestHeader(w http.ResponseWriter, m *common.Manifest) error {
+
+	if m == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(m)
 	if err != nil {
-		errs.Inc()
-		http.Error(w, fmt.Sprintf("could not parse form: %v", err), http.StatusInternalServerError)
 		return err
 	}
+	w.Header().Set("X-Webrender-Manifest", base64.StdEncoding.EncodeToString(data))
+	return nil
+}
 
-	decoder := form.NewDecoder()
+func (p *ImageProcessor) writeJson(w http.ResponseWriter, response *ImageProcessorResponse) error {
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
+
+// writeURL returns stored image url instead of image itself
+func (p *ImageProcessor) writeURL(w http.ResponseWriter, response *ImageProcessorResponse) error {
+
+	if len(response.Artifacts) == 0 || utils.IsEmpty(response.Artifacts[0].URL) {
+		return errors.New("stored image has no url")
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Location", response.Artifacts[0].URL)
+	err := p.writeManifestHeader(w, response.Manifest)
+	if err == nil {
+		_, err = w.Write([]byte(response.Artifacts[0].URL))
+	}
+	return err
+}
+
+// writeMultipart writes multipart/mixed response of metadata part, image part and trace part if any,
+// it's written once render is finished, parts are not streamed while image is captured
+func (p *ImageProcessor) writeMultipart(w http.ResponseWriter, response *ImageProcessorResponse) error {
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", fmt.Sprintf("multipart/mixed; boundary=%s", mw.Boundary()))
+
+	image := response.Data
+
+	meta := *response
+	meta.Data = nil
+
+	metadata, err := json.Marshal(&meta)
+	if err != nil {
+		return err
+	}
+
+	mh := make(textproto.MIMEHeader)
+	mh.Set("Content-Type", "application/json")
+	part, err := mw.CreatePart(mh)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(metadata); err != nil {
+		return err
+	}
+
+	ih := make(textproto.MIMEHeader)
+	_, contentType := p.contentExt(image)
+	ih.Set("Content-Type", contentType)
+	part, err = mw.CreatePart(ih)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(image); err != nil {
+		return err
+	}
+
+	// trace goes along with image
+	if len(response.Trace) > 0 {
+		th := make(textproto.MIMEHeader)
+		th.Set("Content-Type", "application/json")
+		th.Set("Content-Disposition", `attachment; filename="trace.json"`)
+		part, err = mw.CreatePart(th)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(response.Trace); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// process makes image and its response, stores artifacts of job if requested
+func (p *ImageProcessor) process(ctx context.Context, job, client string, r *ImageProcessorRequest) (*browser.BrowserImage, *ImageProcessorResponse, error) {
+
+	store := p.options.Store
+	if r.Store != nil {
+		store = *r.Store
+	}
+	// object url can't be returned without object, heap snapshot is too big to be returned
+	if r.Output == "url" || (r.HeapSnapshot != nil && *r.HeapSnapshot) {
+		store = true
+	}
+
+	if p.cached(r) {
+		if image, response := p.fromCache(ctx, r); response != nil {
+			renderEvents(ctx).Event(browser.RenderEventRender, "served from cache")
+			if store && len(response.Artifacts) == 0 {
+				if err := p.store(ctx, job, r, image, response); err != nil {
+					return image, nil, fmt.Errorf("could not store artifacts: %w", err)
+				}
+			}
+			return image, response, nil
+		}
+	}
+
+	image, err := p.image(ctx, client, r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not make image: %w", err)
+	}
+
+	assertions, err := p.assertText(ctx, r, image)
+	if err != nil {
+		return image, nil, err
+	}
+	assertions = append(assertions, selectorAssertions(image)...)
+
+	response := p.response(r, image)
+	response.Assertions = assertions
+
+	// failed render isn't stored or cached, its response has image to see what's wrong
+	if err := assertionsErr(assertions); err != nil {
+		return image, response, err
+	}
+
+	if store {
+		if err := p.store(ctx, job, r, image, response); err != nil {
+			return image, nil, fmt.Errorf("could not store artifacts: %w", err)
+		}
+	}
+
+	if p.cached(r) {
+		p.toCache(ctx, r, image, response)
+	}
+	return image, response, nil
+}
+
+// URLKey returns canonical url, original one is returned if it can't be parsed
+func (p *ImageProcessor) URLKey(raw string) string {
+
+	key, err := p.normalizer.Normalize(raw)
+	if err != nil {
+		return raw
+	}
+	return key
+}
+
+// RenderJob processes request of stored job and records its result
+func (p *ImageProcessor) RenderJob(ctx context.Context, id string) (*ImageProcessorResponse, error) {
+
+	job, ok := p.jobs.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+
+	p.jobs.start(id)
+	started := time.Now().UTC()
+	ctx = p.jobs.withEvents(ctx, id)
+
+	key := p.URLKey(job.Request.URL)
+	p.jobs.update(id, func(job *Job) {
+		job.URLKey = key
+	})
+
+	image, response, err := p.process(ctx, id, job.Client, job.Request)
+
+	var hashes []*common.ManifestArtifact
+	if image != nil {
+		hashes = p.hashes(image)
+	}
+	p.jobs.Finish(id, response, hashes, err)
+	p.countTags(job, err)
+	p.record(job, started, response, err)
+	p.callback(id, response)
+	return response, err
+}
+
+// Render renders request given as query parameters right away, e.g. by command line
+func (p *ImageProcessor) Render(ctx context.Context, values url.Values) (*ImageProcessorResponse, error) {
 
 	var request ImageProcessorRequest
-	err = decoder.Decode(&request, r.Form)
+	if err := p.decoder.Decode(&request, values); err != nil {
+		return nil, fmt.Errorf("could not decode parameters: %w", err)
+	}
+	request.Async = false
+	if err := p.defaults(&request); err != nil {
+		return nil, err
+	}
+	if err := p.checkPolicy(&request); err != nil {
+		return nil, err
+	}
+	job := p.jobs.Add(&request)
+	return p.RenderJob(ctx, job.ID)
+}
+
+// decodeRequest takes json body when it's posted, query parameters are taken as well
+func (p *ImageProcessor) decodeRequest(r *http.Request, request *ImageProcessorRequest) error {
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Method != http.MethodPost || mediaType != "application/json" {
+
+		if err := r.ParseForm(); err != nil {
+			return fmt.Errorf("could not parse form: %w", err)
+		}
+		if err := p.decoder.Decode(request, r.Form); err != nil {
+			return fmt.Errorf("could not decode form: %w", err)
+		}
+		return nil
+	}
+
+	if err := p.decoder.Decode(request, r.URL.Query()); err != nil {
+		return fmt.Errorf("could not decode query: %w", err)
+	}
+
+	// body is limited as html one, writer isn't there to close connection on large body
+	data, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, htmlMaxBodySize))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBadRequestBody, err)
+	}
+	if err := validateBody("image.json", data); err != nil {
+		return err
+	}
+
+	// body fields override query ones
+	if err := json.Unmarshal(data, request); err != nil {
+		return fmt.Errorf("%w: %v", errBadRequestBody, err)
+	}
+	return nil
+}
+
+// validateBody checks body against published schema, so errors name fields
+func validateBody(name string, data []byte) error {
+
+	err := schema.Validate(name, data)
+	if err == nil {
+		return nil
+	}
+	var v *schema.ValidationError
+	if errors.As(err, &v) {
+		return fmt.Errorf("%w: %v", errInvalidRequestBody, err)
+	}
+	return fmt.Errorf("%w: %v", errBadRequestBody, err)
+}
+
+// resolve decodes request and applies preset, domain and tenant defaults,
+// job keeps resolved parameters, so replay doesn't depend on preset changes
+func (p *ImageProcessor) resolve(r *http.Request) (*ImageProcessorRequest, error) {
+
+	var request ImageProcessorRequest
+	if err := p.decodeRequest(r, &request); err != nil {
+		return nil, err
+	}
+	request.Debug = debugRequested(r)
+	// v2 responds with json unless output=raw is asked
+	if utils.IsEmpty(request.Output) && common.APIVersion(r.Context()) == "v2" {
+		request.Output = "json"
+	}
+	// key bound to tenant renders as that tenant whatever is asked
+	if tenant := common.Tenant(r.Context()); !utils.IsEmpty(tenant) {
+		request.Tenant = tenant
+	}
+	if err := p.defaults(&request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// debugRequested tells if request asks for debug logging by header,
+// parameter is taken for requests authenticated by api key only
+func debugRequested(r *http.Request) bool {
+
+	if v, err := strconv.ParseBool(r.Header.Get("X-Webrender-Debug")); err == nil && v {
+		return true
+	}
+	if utils.IsEmpty(common.APIKey(r.Context())) {
+		return false
+	}
+	v, err := strconv.ParseBool(r.URL.Query().Get("debug"))
+	return err == nil && v
+}
+
+// defaults applies preset, domain and tenant parameters not set by request
+func (p *ImageProcessor) defaults(request *ImageProcessorRequest) error {
+
+	if err := p.applyPreset(request); err != nil {
+		return err
+	}
+	p.applyDomain(request)
+	p.applyTenant(request)
+	// trace output implies trace, cache key has it while output isn't there
+	if request.Output == "trace" {
+		trace := true
+		request.Trace = &trace
+	}
+	return nil
+}
+
+// badRequest tells if error is caused by request itself
+func (p *ImageProcessor) badRequest(err error) bool {
+	return errors.Is(err, errUnknownBrowserKind) || errors.Is(err, errStorageNotConfigured) || errors.Is(err, errUnknownPreset) ||
+		errors.Is(err, errBadRequestBody) || errors.Is(err, errInvalidRequestBody) || errors.Is(err, errPolicyViolation)
+}
+
+// errorStatus maps processing error to http status and headers
+func (p *ImageProcessor) errorStatus(w http.ResponseWriter, channel string, err error) int {
+
+	status := http.StatusInternalServerError
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusGatewayTimeout
+	}
+	if errors.Is(err, errClientLimit) {
+		status = http.StatusTooManyRequests
+	}
+	if errors.Is(err, errTenantQuota) {
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(p.usage.resets()).Seconds())+1))
+	}
+	if errors.Is(err, errRenderQueueFull) || errors.Is(err, errRenderQueueTimeout) {
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", strconv.Itoa(max(p.options.QueueTimeout, 1)))
+	}
+	if p.badRequest(err) {
+		status = http.StatusBadRequest
+	}
+	if errors.Is(err, browser.ErrDeniedHost) {
+		status = http.StatusForbidden
+	}
+	if errors.Is(err, browser.ErrSelectorNotFound) || errors.Is(err, browser.ErrNothingToStitch) {
+		status = http.StatusUnprocessableEntity
+	}
+	if isAssertionErr(err) {
+		status = http.StatusUnprocessableEntity
+		w.Header().Set("X-Webrender-Assertion", "failed")
+	}
+
+	var statusErr *browser.StatusError
+	if errors.As(err, &statusErr) {
+		status = http.StatusBadGateway
+		w.Header().Set("X-Webrender-Status", strconv.Itoa(statusErr.Status))
+	}
+
+	var navErr *browser.NavigationError
+	if errors.As(err, &navErr) {
+		status = http.StatusBadGateway
+		w.Header().Set("X-Webrender-Error-Code", navErr.Code)
+		p.counters.navigationErrors.with(channel, navErr.Code).Inc()
+	}
+	return status
+}
+
+func (p *ImageProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	channel := strings.TrimLeft(r.URL.Path, "/")
+
+	meters := p.channelMeters(channel)
+	requests := meters.requests
+	errs := meters.errors
+	partials := meters.partials
+
+	requests.Inc()
+
+	request, err := p.resolve(r)
 	if err != nil {
 		errs.Inc()
-		http.Error(w, fmt.Sprintf("could not decode form: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), p.errorStatus(w, meters.channel, err))
 		return err
 	}
 
-	browser := request.Kind
-	if utils.IsEmpty(browser) {
-		browser = "chrome"
+	err = p.checkPolicy(request)
+	if err != nil {
+		errs.Inc()
+		http.Error(w, err.Error(), p.errorStatus(w, meters.channel, err))
+		return err
 	}
 
-	var data []byte
+	job := p.jobs.Add(request)
+	w.Header().Set("X-Webrender-Job", job.ID)
 
-	switch browser {
-	default:
-		data, err = p.chromeImage(&request)
+	client := limiterClient(request.Tenant, r.RemoteAddr)
+	p.jobs.update(job.ID, func(job *Job) {
+		job.Client = client
+	})
+
+	// async job is rendered by workers, its status and result are in jobs api
+	if request.Async {
+		if !p.jobs.Enqueue(job.ID) {
+			errs.Inc()
+			p.jobs.Finish(job.ID, nil, nil, errJobsQueueFull)
+			http.Error(w, errJobsQueueFull.Error(), http.StatusServiceUnavailable)
+			return errJobsQueueFull
+		}
+		return writeJobJson(w, http.StatusAccepted, job.public())
 	}
 
+	// client disconnect cancels rendering
+	response, err := p.RenderJob(r.Context(), job.ID)
+
+	// failed assertions are answered by response as it is, annotated image shows what's missing
+	assertErr := err
+	if isAssertionErr(err) && response != nil {
+		w.Header().Set("X-Webrender-Assertion", "failed")
+		w = &statusWriter{ResponseWriter: w, status: http.StatusUnprocessableEntity}
+		err = nil
+	} else {
+		assertErr = nil
+	}
 	if err != nil {
 		errs.Inc()
-		http.Error(w, fmt.Sprintf("could not make image: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), p.errorStatus(w, meters.channel, err))
 		return err
 	}
 
-	if _, err := w.Write(data); err != nil {
+	w.Header().Set("X-Webrender-Browser", response.Kind)
+
+	if response.Partial {
+		partials.Inc()
+		w.Header().Set("X-Webrender-Partial", "true")
+	}
+
+	if response.Memory != nil {
+		w.Header().Set("X-Webrender-JS-Heap", strconv.FormatInt(response.Memory.JSHeapUsed, 10))
+	}
+
+	if response.Performance != nil {
+		w.Header().Set("X-Webrender-LCP", strconv.FormatFloat(response.Performance.LCP, 'f', 0, 64))
+	}
+
+	if p.cached(request) {
+		if response.Cached {
+			w.Header().Set("X-Webrender-Cache", "hit")
+		} else {
+			w.Header().Set("X-Webrender-Cache", "miss")
+		}
+	}
+
+	if response.Captcha != nil {
+		w.Header().Set("X-Webrender-Captcha", response.Captcha.Kind)
+	}
+
+	if !utils.IsEmpty(response.Page) {
+		w.Header().Set("X-Webrender-Page", response.Page)
+		p.counters.pages.with(meters.channel, response.Page).Inc()
+	}
+
+	if len(response.Artifacts) > 0 {
+		w.Header().Set("X-Webrender-Artifact", response.Artifacts[0].Key)
+	}
+
+	p.writeResponseHeaders(w, request, job.ID, response)
+
+	switch request.Output {
+	case "json":
+		err = p.writeJson(w, response)
+	case "multipart":
+		err = p.writeMultipart(w, response)
+	case "url":
+		err = p.writeURL(w, response)
+	case "domsnapshot":
+		w.Header().Set("Content-Type", "application/json")
+		err = p.writeManifestHeader(w, response.Manifest)
+		if err == nil {
+			_, err = w.Write(response.DOMSnapshot)
+		}
+	case "trace":
+		// trace is opened by perfetto or chrome://tracing as it is
+		w.Header().Set("Content-Type", "application/json")
+		err = p.writeManifestHeader(w, response.Manifest)
+		if err == nil {
+			_, err = w.Write(response.Trace)
+		}
+	default:
+		_, contentType := p.contentExt(response.Data)
+		w.Header().Set("Content-Type", contentType)
+		err = p.writeManifestHeader(w, response.Manifest)
+		if err == nil {
+			_, err = w.Write(response.Data)
+		}
+	}
+
+	if err != nil {
 		errs.Inc()
 		http.Error(w, fmt.Sprintf("could not write response: %v", err), http.StatusInternalServerError)
 		return err
 	}
-	return nil
+	if assertErr != nil {
+		errs.Inc()
+	}
+	return assertErr
+}
+
+// AddBrowser registers browser implementation selectable by request kind
+func (p *ImageProcessor) AddBrowser(kind string, newBrowser browser.NewBrowserFunc) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.browsers[kind] = newBrowser
+}
+
+// SetCaptchaSolver plugs custom captcha solver instead of configured one
+func (p *ImageProcessor) SetCaptchaSolver(solver browser.CaptchaSolver) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.captchaSolver = solver
+}
+
+func (p *ImageProcessor) getCaptchaSolver() browser.CaptchaSolver {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.captchaSolver
 }
 
-func NewImageProcessor(options ImageProcessorOptions, observability *common.Observability) *ImageProcessor {
+func NewImageProcessor(options ImageProcessorOptions, artifacts *storage.Artifacts, jobs *Jobs, observability *common.Observability) *ImageProcessor {
+
+	var captchaSolver browser.CaptchaSolver
+	if !utils.IsEmpty(options.CaptchaSolverURL) {
+		captchaSolver = browser.NewHttpCaptchaSolver(options.CaptchaSolverURL, options.CaptchaSolverTimeout)
+	}
+
+	signer, err := common.NewManifestSigner(options.ManifestKey)
+	if err != nil {
+		observability.Error("Couldn't load manifest key: %v", err)
+	}
+
+	if utils.IsEmpty(options.BrowserKind) {
+		options.BrowserKind = browser.BrowserKindChrome
+	}
+
+	var ads *adblock.Engine
+	if len(options.AdFilterLists) > 0 {
+		ads, err = adblock.Load(options.AdFilterLists)
+		if err != nil {
+			observability.Error("Couldn't load ad filter lists: %v", err)
+		} else {
+			observability.Info("Loaded %d ad filters", ads.Rules())
+		}
+	}
+
+	presets, err := loadPresets(options.Presets)
+	if err != nil {
+		observability.Error("Couldn't load presets: %v", err)
+	}
+
+	tenants, err := loadTenants(options.Tenants)
+	if err != nil {
+		observability.Error("Couldn't load tenants: %v", err)
+	}
+
+	domains, err := loadDomains(options.Domains)
+	if err != nil {
+		observability.Error("Couldn't load domains: %v", err)
+	}
+
+	rewrites, err := loadRewrites(options.Rewrites)
+	if err != nil {
+		observability.Error("Couldn't load rewrites: %v", err)
+	}
+
+	if !utils.Contains(browser.Environments, options.Environment) {
+		observability.Warn("Environment %s is unknown, default one is used", options.Environment)
+	}
+
+	for _, v := range browser.EventLogViolations(options.EventLogTypes) {
+		observability.Warn("%s, it's ignored", v)
+	}
+
+	if jobs == nil {
+		jobs = NewJobs(JobsOptions{}, observability)
+	}
+
+	browsers := make(map[string]browser.NewBrowserFunc)
+	browsers[browser.BrowserKindChrome] = browser.NewChromeBrowser
+	browsers[browser.BrowserKindFirefox] = browser.NewFirefoxBrowser
+	browsers[browser.BrowserKindSimple] = browser.NewSimpleBrowser
+	// fake one is for load and integration tests, it's never chosen unless configured
+	if options.BrowserKind == browser.BrowserKindFake {
+		browsers[browser.BrowserKindFake] = browser.NewFakeBrowser
+	}
 
 	return &ImageProcessor{
 		options:       options,
+		browsers:      browsers,
+		captchaSolver: captchaSolver,
+		adblock:       ads,
+		signer:        signer,
+		presets:       presets,
+		tenants:       tenants,
+		domains:       domains,
+		rewrites:      rewrites,
+		normalizer:    common.NewURLNormalizer(options.URLNormalizer),
+		artifacts:     artifacts,
+		jobs:          jobs,
+		decoder:       form.NewDecoder(),
 		observability: observability,
 		logger:        observability.Logs(),
 		meter:         observability.Metrics(),
+		meters:        make(map[string]*imageProcessorMeters),
+		counters:      newImageProcessorCounters(observability.Metrics()),
+		tagValues:     make(map[string]map[string]bool),
+		limiter:       newRenderLimiter(options.MaxConcurrency, options.MaxClientConcurrency, options.MaxQueue, options.QueueTimeout, observability.Metrics()),
+		usage:         newTenantUsage(),
 	}
 }
@@ -0,0 +1,162 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/common"
+)
+
+func testImageProcessor(options ImageProcessorOptions, presets map[string]*ImageProcessorRequest) *ImageProcessor {
+
+	obs := common.NewObservability(common.ObservabilityOptions{}, sreCommon.NewLogs(), sreCommon.NewMetrics())
+	return &ImageProcessor{
+		options:    options,
+		presets:    presets,
+		normalizer: common.NewURLNormalizer(options.URLNormalizer),
+		counters:   newImageProcessorCounters(obs.Metrics()),
+		logger:     obs.Logs(),
+		meter:      obs.Metrics(),
+	}
+}
+
+func TestImageProcessorBrowserOptions(t *testing.T) {
+
+	no := false
+	options := ImageProcessorOptions{
+		Width:           1280,
+		Height:          720,
+		AsPDF:           true,
+		Headers:         map[string]string{"X-Default": "default", "X-Shared": "default"},
+		ScreenshotCodes: []int{200, 404},
+	}
+
+	tests := []struct {
+		name            string
+		request         *ImageProcessorRequest
+		width           int
+		asPDF           bool
+		headers         map[string]interface{}
+		screenshotCodes []int
+	}{
+		{
+			name:            "options",
+			request:         &ImageProcessorRequest{},
+			width:           1280,
+			asPDF:           true,
+			headers:         map[string]interface{}{"X-Default": "default", "X-Shared": "default"},
+			screenshotCodes: []int{200, 404},
+		},
+		{
+			name: "request",
+			request: &ImageProcessorRequest{
+				Width:   640,
+				AsPDF:   &no,
+				Headers: map[string]interface{}{"X-Shared": "request", "X-Request": "request"},
+			},
+			width:           640,
+			asPDF:           false,
+			headers:         map[string]interface{}{"X-Default": "default", "X-Shared": "request", "X-Request": "request"},
+			screenshotCodes: []int{200, 404},
+		},
+	}
+
+	p := testImageProcessor(options, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			o := p.browserOptions(tt.request)
+			if o.Width != tt.width {
+				t.Errorf("width is %d, not %d", o.Width, tt.width)
+			}
+			if o.Height != options.Height {
+				t.Errorf("height is %d, not %d", o.Height, options.Height)
+			}
+			if o.AsPDF != tt.asPDF {
+				t.Errorf("asPDF is %v, not %v", o.AsPDF, tt.asPDF)
+			}
+			if !reflect.DeepEqual(o.HeadersMap, tt.headers) {
+				t.Errorf("headers are %v, not %v", o.HeadersMap, tt.headers)
+			}
+			if !reflect.DeepEqual(o.ScreenshotCodes, tt.screenshotCodes) {
+				t.Errorf("screenshot codes are %v, not %v", o.ScreenshotCodes, tt.screenshotCodes)
+			}
+		})
+	}
+}
+
+func TestImageProcessorDefaults(t *testing.T) {
+
+	yes, no := true, false
+	presets := map[string]*ImageProcessorRequest{
+		"print": {
+			AsPDF:   &yes,
+			Width:   800,
+			Headers: map[string]interface{}{"X-Preset": "preset", "X-Shared": "preset"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		request *ImageProcessorRequest
+		want    *ImageProcessorRequest
+		err     bool
+	}{
+		{
+			name:    "preset",
+			request: &ImageProcessorRequest{Preset: "print"},
+			want: &ImageProcessorRequest{
+				Preset:  "print",
+				AsPDF:   &yes,
+				Width:   800,
+				Headers: map[string]interface{}{"X-Preset": "preset", "X-Shared": "preset"},
+			},
+		},
+		{
+			name: "request over preset",
+			request: &ImageProcessorRequest{
+				Preset:  "print",
+				AsPDF:   &no,
+				Width:   640,
+				Headers: map[string]interface{}{"X-Shared": "request"},
+			},
+			want: &ImageProcessorRequest{
+				Preset:  "print",
+				AsPDF:   &no,
+				Width:   640,
+				Headers: map[string]interface{}{"X-Preset": "preset", "X-Shared": "request"},
+			},
+		},
+		{
+			name:    "trace output",
+			request: &ImageProcessorRequest{Output: "trace"},
+			want:    &ImageProcessorRequest{Output: "trace", Trace: &yes},
+		},
+		{
+			name:    "unknown preset",
+			request: &ImageProcessorRequest{Preset: "unknown"},
+			err:     true,
+		},
+	}
+
+	p := testImageProcessor(ImageProcessorOptions{}, presets)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			err := p.defaults(tt.request)
+			if tt.err {
+				if err == nil {
+					t.Fatal("error is expected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.request, tt.want) {
+				t.Errorf("request is %+v, not %+v", tt.request, tt.want)
+			}
+		})
+	}
+}
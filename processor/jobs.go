@@ -0,0 +1,579 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/browser"
+	"github.com/devopsext/webrender/common"
+)
+
+type JobsOptions struct {
+	// count of jobs kept in store, oldest finished ones are evicted
+	MaxJobs int
+	// async jobs workers and count of jobs waiting for them
+	Workers   int
+	QueueSize int
+}
+
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+type Job struct {
+	ID       string                     `json:"id"`
+	Status   string                     `json:"status"`
+	Request  *ImageProcessorRequest     `json:"request"`
+	URLKey   string                     `json:"urlKey,omitempty"`
+	Response *ImageProcessorResponse    `json:"response,omitempty"`
+	Hashes   []*common.ManifestArtifact `json:"hashes,omitempty"`
+	Error    string                     `json:"error,omitempty"`
+	ReplayOf string                     `json:"replayOf,omitempty"`
+	Async    bool                       `json:"async,omitempty"`
+	Tags     map[string]string          `json:"tags,omitempty"`
+	// tenant or remote host, concurrent renders are limited per client
+	Client   string     `json:"client,omitempty"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	// result of async job kept until it's evicted
+	data []byte
+	// events of render and channel closed on change of job, they are for its followers
+	events  []*browser.RenderEvent
+	changed chan struct{}
+}
+
+// JobsFilter matches jobs having all tags, empty tag value matches any value of tag
+type JobsFilter struct {
+	Tags   map[string]string
+	Status string
+	Tenant string
+	Limit  int
+}
+
+const jobsListLimit = 100
+
+const defaultMaxJobs = 1000
+
+type JobRenderer interface {
+	RenderJob(ctx context.Context, id string) (*ImageProcessorResponse, error)
+}
+
+// Jobs keeps recent render jobs in memory to inspect and replay them
+type Jobs struct {
+	options  JobsOptions
+	jobs     map[string]*Job
+	order    []string
+	queue    chan string
+	logger   sreCommon.Logger
+	meter    sreCommon.Meter
+	mutex    sync.RWMutex
+	activity jobsActivity
+}
+
+type JobDiff struct {
+	Identical bool                    `json:"identical"`
+	Artifacts map[string]*JobDiffItem `json:"artifacts"`
+}
+
+type JobDiffItem struct {
+	Identical bool   `json:"identical"`
+	Original  string `json:"original,omitempty"`
+	Replay    string `json:"replay,omitempty"`
+	SizeDelta int    `json:"sizeDelta"`
+}
+
+type JobsProcessorReplayResponse struct {
+	Original string   `json:"original"`
+	Job      *Job     `json:"job"`
+	Diff     *JobDiff `json:"diff,omitempty"`
+}
+
+// JobsProcessor exposes api of stored render jobs
+type JobsProcessor struct {
+	jobs   *Jobs
+	image  *ImageProcessor
+	logger sreCommon.Logger
+	meter  sreCommon.Meter
+}
+
+// public hides request headers, cookies, password and storage as they might be secrets
+func (j *Job) public() *Job {
+
+	c := *j
+	if c.Request != nil {
+		c.Request = publicRequest(c.Request)
+	}
+	if c.Response != nil {
+		r := *c.Response
+		r.Data = nil
+		c.Response = &r
+	}
+	c.data = nil
+	return &c
+}
+
+// publicRequest is a copy of request without credentials
+func publicRequest(request *ImageProcessorRequest) *ImageProcessorRequest {
+
+	r := *request
+	r.Headers = nil
+	r.Cookies = nil
+	r.Proxy = redactProxy(r.Proxy)
+	r.Password = ""
+	r.LocalStorage = nil
+	r.SessionStorage = nil
+	return &r
+}
+
+// Add stores copy of request as new queued job
+func (s *Jobs) Add(r *ImageProcessorRequest) *Job {
+
+	request := *r
+	job := &Job{
+		ID:      common.NewID(),
+		Status:  JobQueued,
+		Request: &request,
+		Async:   r.Async,
+		Tags:    r.Tags,
+		Created: time.Now().UTC(),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job.ID)
+	s.evict()
+	return job
+}
+
+// evict drops oldest finished jobs over limit, queued and running ones are kept until they finish
+// as workers and waiting requests need them
+func (s *Jobs) evict() {
+
+	for i := 0; len(s.order) > s.options.MaxJobs && i < len(s.order); {
+		id := s.order[i]
+		if job, ok := s.jobs[id]; ok && (job.Status == JobQueued || job.Status == JobRunning) {
+			i++
+			continue
+		}
+		delete(s.jobs, id)
+		s.order = append(s.order[:i], s.order[i+1:]...)
+	}
+}
+
+// Get returns snapshot of job
+func (s *Jobs) Get(id string) (*Job, bool) {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	c := *job
+	return &c, true
+}
+
+func (f *JobsFilter) match(job *Job) bool {
+
+	if f.Status != "" && job.Status != f.Status {
+		return false
+	}
+	if f.Tenant != "" && (job.Request == nil || job.Request.Tenant != f.Tenant) {
+		return false
+	}
+	for k, v := range f.Tags {
+		tv, ok := job.Tags[k]
+		if !ok || (v != "" && tv != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// jobOfTenant is true when context isn't bound to tenant or job belongs to it, other jobs are not found
+func jobOfTenant(ctx context.Context, job *Job) bool {
+
+	tenant := common.Tenant(ctx)
+	if tenant == "" {
+		return true
+	}
+	return job.Request != nil && job.Request.Tenant == tenant
+}
+
+// List returns public snapshots of matching jobs, newest first
+func (s *Jobs) List(filter *JobsFilter) []*Job {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	jobs := []*Job{}
+	for i := len(s.order) - 1; i >= 0 && len(jobs) < filter.Limit; i-- {
+		job, ok := s.jobs[s.order[i]]
+		if !ok || !filter.match(job) {
+			continue
+		}
+		jobs = append(jobs, job.public())
+	}
+	return jobs
+}
+
+func (s *Jobs) update(id string, fn func(job *Job)) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if job, ok := s.jobs[id]; ok {
+		fn(job)
+		job.notify()
+	}
+}
+
+// Enqueue adds job for async workers, false is returned when queue is full
+func (s *Jobs) Enqueue(id string) bool {
+
+	select {
+	case s.queue <- id:
+		s.meter.Gauge("queued", "Count of queued async jobs", nil, "jobs").Set(float64(len(s.queue)))
+		return true
+	default:
+		return false
+	}
+}
+
+// Start runs async workers rendering queued jobs
+func (s *Jobs) Start(wg *sync.WaitGroup, renderer JobRenderer) {
+
+	for i := 0; i < s.options.Workers; i++ {
+		wg.Add(1)
+		go func(wg *sync.WaitGroup) {
+			defer wg.Done()
+			for id := range s.queue {
+				s.meter.Gauge("queued", "Count of queued async jobs", nil, "jobs").Set(float64(len(s.queue)))
+				if _, err := renderer.RenderJob(context.Background(), id); err != nil {
+					s.logger.Debug("Async job %s failed: %v", id, err)
+				}
+			}
+		}(wg)
+	}
+}
+
+// Result returns job and its data, data is kept for async jobs only
+func (s *Jobs) Result(id string) (*Job, []byte, bool) {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, nil, false
+	}
+	c := *job
+	return &c, job.data, true
+}
+
+// start marks job as running
+func (s *Jobs) start(id string) {
+
+	var a *JobActivity
+	s.update(id, func(job *Job) {
+		now := time.Now().UTC()
+		job.Status = JobRunning
+		job.Started = &now
+		a = job.activity(ActivityStarted)
+	})
+	s.publish(a)
+}
+
+// Finish records result of job, response data is kept for async jobs only
+func (s *Jobs) Finish(id string, response *ImageProcessorResponse, hashes []*common.ManifestArtifact, err error) {
+
+	var a *JobActivity
+	s.update(id, func(job *Job) {
+
+		now := time.Now().UTC()
+		job.Finished = &now
+		job.Hashes = hashes
+
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			a = job.activity(ActivityFailed)
+			return
+		}
+		job.Status = JobDone
+
+		if response != nil {
+			if job.Async {
+				job.data = response.Data
+			}
+			r := *response
+			r.Data = nil
+			job.Response = &r
+		}
+		a = job.activity(ActivityFinished)
+	})
+	s.publish(a)
+}
+
+func NewJobs(options JobsOptions, observability *common.Observability) *Jobs {
+
+	if options.MaxJobs <= 0 {
+		options.MaxJobs = defaultMaxJobs
+	}
+	if options.QueueSize < 0 {
+		options.QueueSize = 0
+	}
+
+	return &Jobs{
+		options: options,
+		jobs:    make(map[string]*Job),
+		queue:   make(chan string, options.QueueSize),
+		logger:  observability.Logs(),
+		meter:   observability.Metrics(),
+		activity: jobsActivity{
+			subscribers: make(map[chan *JobActivity]struct{}),
+		},
+	}
+}
+
+func JobsProcessorType() string {
+	return "Jobs"
+}
+
+func (p *JobsProcessor) Type() string {
+	return JobsProcessorType()
+}
+
+// diff compares artifact hashes of original and replayed jobs
+func (p *JobsProcessor) diff(original, replay *Job) *JobDiff {
+
+	d := &JobDiff{
+		Identical: true,
+		Artifacts: make(map[string]*JobDiffItem),
+	}
+
+	item := func(name string) *JobDiffItem {
+		i, ok := d.Artifacts[name]
+		if !ok {
+			i = &JobDiffItem{}
+			d.Artifacts[name] = i
+		}
+		return i
+	}
+
+	for _, a := range original.Hashes {
+		i := item(a.Name)
+		i.Original = a.SHA256
+		i.SizeDelta -= a.Size
+	}
+	for _, a := range replay.Hashes {
+		i := item(a.Name)
+		i.Replay = a.SHA256
+		i.SizeDelta += a.Size
+	}
+
+	for _, i := range d.Artifacts {
+		i.Identical = i.Original == i.Replay
+		if !i.Identical {
+			d.Identical = false
+		}
+	}
+	if original.Status != replay.Status {
+		d.Identical = false
+	}
+	return d
+}
+
+func (p *JobsProcessor) replay(w http.ResponseWriter, r *http.Request, id string) error {
+
+	original, ok := p.jobs.Get(id)
+	if !ok || !jobOfTenant(r.Context(), original) {
+		err := fmt.Errorf("job %s not found", id)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return err
+	}
+
+	// policy might be changed since original job, replay is limited as its client
+	request := *original.Request
+	if tenant := common.Tenant(r.Context()); !utils.IsEmpty(tenant) {
+		request.Tenant = tenant
+	}
+	if err := p.image.checkPolicy(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return err
+	}
+
+	client := original.Client
+	if utils.IsEmpty(client) {
+		client = limiterClient(request.Tenant, r.RemoteAddr)
+	}
+
+	job := p.jobs.Add(&request)
+	p.jobs.update(job.ID, func(job *Job) {
+		job.ReplayOf = original.ID
+		job.Client = client
+	})
+
+	// render failure is a valid replay result, it's recorded in job
+	if _, err := p.image.RenderJob(r.Context(), job.ID); err != nil {
+		p.logger.Debug("Replay %s of job %s failed: %v", job.ID, original.ID, err)
+	}
+
+	job, _ = p.jobs.Get(job.ID)
+	response := &JobsProcessorReplayResponse{
+		Original: original.ID,
+		Job:      job.public(),
+	}
+
+	if r.URL.Query().Get("diff") == "true" {
+		response.Diff = p.diff(original, job)
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not marshal replay: %v", err), http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Webrender-Job", job.ID)
+	_, err = w.Write(data)
+	return err
+}
+
+func (p *JobsProcessor) status(w http.ResponseWriter, r *http.Request, id string) error {
+
+	job, ok := p.jobs.Get(id)
+	if !ok || !jobOfTenant(r.Context(), job) {
+		err := fmt.Errorf("job %s not found", id)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return err
+	}
+	return writeJobJson(w, http.StatusOK, job.public())
+}
+
+// result returns image of finished async job
+func (p *JobsProcessor) result(w http.ResponseWriter, r *http.Request, id string) error {
+
+	job, data, ok := p.jobs.Result(id)
+	if !ok || !jobOfTenant(r.Context(), job) {
+		err := fmt.Errorf("job %s not found", id)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return err
+	}
+
+	var err error
+	switch {
+	case job.Status == JobFailed:
+		err = fmt.Errorf("job %s failed: %s", id, job.Error)
+	case job.Status != JobDone:
+		err = fmt.Errorf("job %s is %s", id, job.Status)
+	case data == nil:
+		err = fmt.Errorf("job %s has no result, only async jobs keep it", id)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return err
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("X-Webrender-Job", job.ID)
+	_, err = w.Write(data)
+	return err
+}
+
+// list takes filter from query, tag is key:value or key, e.g. ?tag=suite:smoke&tag=release&status=failed
+func (p *JobsProcessor) list(w http.ResponseWriter, r *http.Request) error {
+
+	q := r.URL.Query()
+	filter := &JobsFilter{
+		Tags:   make(map[string]string),
+		Status: q.Get("status"),
+		Tenant: q.Get("tenant"),
+		Limit:  jobsListLimit,
+	}
+	for _, t := range q["tag"] {
+		kv := strings.SplitN(t, ":", 2)
+		if len(kv) > 1 {
+			filter.Tags[kv[0]] = kv[1]
+		} else {
+			filter.Tags[kv[0]] = ""
+		}
+	}
+	if tenant := common.Tenant(r.Context()); !utils.IsEmpty(tenant) {
+		filter.Tenant = tenant
+	}
+	if s := q.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			err = fmt.Errorf("limit %s is invalid", s)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return err
+		}
+		filter.Limit = limit
+	}
+	return writeJobJson(w, http.StatusOK, p.jobs.List(filter))
+}
+
+// HandleHttpRequest lists jobs on GET .../, returns job status on GET .../{id}, streams its events
+// on GET .../{id}?follow=true, result on GET .../{id}/result and replays job on POST .../{id}/replay
+func (p *JobsProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/"):
+		return p.list(w, r)
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/result"):
+		return p.result(w, r, path.Base(path.Dir(r.URL.Path)))
+	case r.Method == http.MethodGet && r.URL.Query().Get("follow") == "true":
+		return p.followJob(w, r, path.Base(r.URL.Path))
+	case r.Method == http.MethodGet:
+		return p.status(w, r, path.Base(r.URL.Path))
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/replay"):
+		return p.replay(w, r, path.Base(path.Dir(r.URL.Path)))
+	}
+
+	err := fmt.Errorf("method %s is not allowed", r.Method)
+	http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+	return err
+}
+
+func writeJobJson(w http.ResponseWriter, status int, v interface{}) error {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not marshal job: %v", err), http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
+
+func NewJobsProcessor(jobs *Jobs, image *ImageProcessor, observability *common.Observability) *JobsProcessor {
+
+	return &JobsProcessor{
+		jobs:   jobs,
+		image:  image,
+		logger: observability.Logs(),
+		meter:  observability.Metrics(),
+	}
+}
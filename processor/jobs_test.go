@@ -0,0 +1,34 @@
+package processor
+
+import (
+	"testing"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/common"
+)
+
+func TestJobsEvict(t *testing.T) {
+
+	obs := common.NewObservability(common.ObservabilityOptions{}, sreCommon.NewLogs(), sreCommon.NewMetrics())
+
+	if jobs := NewJobs(JobsOptions{}, obs); jobs.options.MaxJobs != defaultMaxJobs {
+		t.Errorf("max jobs is %d, not %d", jobs.options.MaxJobs, defaultMaxJobs)
+	}
+
+	jobs := NewJobs(JobsOptions{MaxJobs: 2}, obs)
+	queued := jobs.Add(&ImageProcessorRequest{})
+	running := jobs.Add(&ImageProcessorRequest{})
+	jobs.start(running.ID)
+	done := jobs.Add(&ImageProcessorRequest{})
+	jobs.Finish(done.ID, nil, nil, nil)
+	last := jobs.Add(&ImageProcessorRequest{})
+
+	for _, id := range []string{queued.ID, running.ID, last.ID} {
+		if _, ok := jobs.Get(id); !ok {
+			t.Errorf("job %s is evicted", id)
+		}
+	}
+	if _, ok := jobs.Get(done.ID); ok {
+		t.Errorf("finished job %s is kept", done.ID)
+	}
+}
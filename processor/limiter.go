@@ -0,0 +1,206 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+)
+
+var errClientLimit = errors.New("too many concurrent renders of client")
+var errRenderQueueFull = errors.New("render queue is full")
+var errRenderQueueTimeout = errors.New("render queue wait timeout exceeded")
+
+// queueWaitBuckets are upper bounds of queue wait histogram in milliseconds
+var queueWaitBuckets = []int{10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+
+// queueAgeInterval is how often waiting renders refresh age of the oldest one
+const queueAgeInterval = time.Second
+
+// renderLimiter bounds browser renders running at once, excess ones wait for a slot
+type renderLimiter struct {
+	slots     chan struct{}
+	maxClient int
+	maxQueue  int
+	timeout   time.Duration
+	waiting   int
+	clients   map[string]int
+	meter     sreCommon.Meter
+	mutex     sync.Mutex
+	// start of each waiting render, oldest one is the age of queue
+	queued map[int64]time.Time
+	seq    int64
+}
+
+// limiterClient is tenant of request, or remote host if there is no tenant
+func limiterClient(tenant, addr string) string {
+
+	if !utils.IsEmpty(tenant) {
+		return tenant
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func (l *renderLimiter) gauges() {
+
+	oldest := 0.0
+	for _, t := range l.queued {
+		oldest = max(oldest, time.Since(t).Seconds())
+	}
+	l.meter.Gauge("renders", "Count of running browser renders", nil, "image", "processor").Set(float64(len(l.slots)))
+	l.meter.Gauge("render_queue", "Count of browser renders waiting for a slot", nil, "image", "processor").Set(float64(l.waiting))
+	l.meter.Gauge("render_queue_oldest_seconds", "Age of the oldest browser render waiting for a slot", nil, "image", "processor").Set(oldest)
+}
+
+// observeWait is prometheus histogram of queue wait, renders taking free slot wait zero,
+// so quantiles are of all renders
+func (l *renderLimiter) observeWait(wait time.Duration) {
+
+	ms := int(wait.Milliseconds())
+	for _, b := range queueWaitBuckets {
+		if ms <= b {
+			l.meter.Counter("render_queue_wait_milliseconds_bucket", "Count of renders by time waited for a slot", sreCommon.Labels{"le": strconv.Itoa(b)}, "image", "processor").Inc()
+		}
+	}
+	l.meter.Counter("render_queue_wait_milliseconds_bucket", "Count of renders by time waited for a slot", sreCommon.Labels{"le": "+Inf"}, "image", "processor").Inc()
+	l.meter.Counter("render_queue_wait_milliseconds_sum", "Total time renders waited for a slot", nil, "image", "processor").Add(ms)
+	l.meter.Counter("render_queue_wait_milliseconds_count", "Count of renders waited for a slot", nil, "image", "processor").Inc()
+}
+
+func (l *renderLimiter) leave(client string) {
+
+	l.clients[client]--
+	if l.clients[client] <= 0 {
+		delete(l.clients, client)
+	}
+}
+
+func (l *renderLimiter) release(client string) func() {
+
+	return func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+		l.mutex.Lock()
+		l.leave(client)
+		l.gauges()
+		l.mutex.Unlock()
+	}
+}
+
+// active is count of running and waiting renders of client
+func (l *renderLimiter) active(client string) int {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.clients[client]
+}
+
+// acquire takes a render slot, returned func frees it
+func (l *renderLimiter) acquire(ctx context.Context, client string) (func(), error) {
+
+	l.mutex.Lock()
+	// client limit counts waiting renders as well
+	if l.maxClient > 0 && l.clients[client] >= l.maxClient {
+		l.mutex.Unlock()
+		return nil, errClientLimit
+	}
+	l.clients[client]++
+	l.mutex.Unlock()
+
+	if l.slots == nil {
+		return l.release(client), nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		l.mutex.Lock()
+		l.gauges()
+		l.mutex.Unlock()
+		l.observeWait(0)
+		return l.release(client), nil
+	default:
+	}
+
+	l.mutex.Lock()
+	if l.maxQueue > 0 && l.waiting >= l.maxQueue {
+		l.leave(client)
+		l.mutex.Unlock()
+		return nil, errRenderQueueFull
+	}
+	l.waiting++
+	l.seq++
+	seq, started := l.seq, time.Now()
+	l.queued[seq] = started
+	l.gauges()
+	l.mutex.Unlock()
+
+	// age grows while nothing happens in queue, so waiting renders keep it fresh
+	ticker := time.NewTicker(queueAgeInterval)
+	defer ticker.Stop()
+
+	var expired <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var err error
+	for waiting := true; waiting; {
+		select {
+		case l.slots <- struct{}{}:
+			waiting = false
+		case <-expired:
+			err = errRenderQueueTimeout
+			waiting = false
+		case <-ctx.Done():
+			err = ctx.Err()
+			waiting = false
+		case <-ticker.C:
+			l.mutex.Lock()
+			l.gauges()
+			l.mutex.Unlock()
+		}
+	}
+	l.observeWait(time.Since(started))
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.waiting--
+	delete(l.queued, seq)
+	if err != nil {
+		l.leave(client)
+		l.gauges()
+		return nil, err
+	}
+	l.gauges()
+	return l.release(client), nil
+}
+
+// newRenderLimiter creates limiter, zero concurrency doesn't limit renders but clients
+func newRenderLimiter(maxConcurrency, maxClient, maxQueue, timeout int, meter sreCommon.Meter) *renderLimiter {
+
+	l := &renderLimiter{
+		maxClient: maxClient,
+		maxQueue:  maxQueue,
+		timeout:   time.Duration(timeout) * time.Second,
+		clients:   make(map[string]int),
+		meter:     meter,
+		queued:    make(map[int64]time.Time),
+	}
+	if maxConcurrency > 0 {
+		l.slots = make(chan struct{}, maxConcurrency)
+	}
+	return l
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/browser"
+)
+
+// pageRangesRegex matches ranges as chrome takes them e.g. 1-5, 8, 11-
+var pageRangesRegex = regexp.MustCompile(`^\s*\d+\s*(-\s*\d*\s*)?(,\s*\d+\s*(-\s*\d*\s*)?)*$`)
+
+// hasPDFLayout tells if request sets any of pdf layout parameters
+func hasPDFLayout(r *ImageProcessorRequest) bool {
+	return !utils.IsEmpty(r.Paper) || r.PaperWidth != 0 || r.PaperHeight != 0 || r.Landscape != nil ||
+		r.MarginTop != nil || r.MarginBottom != nil || r.MarginLeft != nil || r.MarginRight != nil ||
+		r.Scale != 0 || r.PrintBackground != nil || !utils.IsEmpty(r.PageRanges) ||
+		!utils.IsEmpty(r.HeaderTemplate) || !utils.IsEmpty(r.FooterTemplate) || r.Outline != nil || r.OutlineDepth != 0
+}
+
+// pdfOptions resolves named paper to its size, width and height of request override it
+func pdfOptions(r *ImageProcessorRequest) browser.PDFOptions {
+
+	o := browser.PDFOptions{
+		PaperWidth:      r.PaperWidth,
+		PaperHeight:     r.PaperHeight,
+		Landscape:       r.Landscape != nil && *r.Landscape,
+		MarginTop:       r.MarginTop,
+		MarginBottom:    r.MarginBottom,
+		MarginLeft:      r.MarginLeft,
+		MarginRight:     r.MarginRight,
+		Scale:           r.Scale,
+		PrintBackground: r.PrintBackground,
+		PageRanges:      r.PageRanges,
+		HeaderTemplate:  r.HeaderTemplate,
+		FooterTemplate:  r.FooterTemplate,
+		Outline:         r.Outline != nil && *r.Outline,
+		OutlineDepth:    r.OutlineDepth,
+	}
+	if width, height, ok := browser.PDFPaper(r.Paper); ok {
+		if o.PaperWidth == 0 {
+			o.PaperWidth = width
+		}
+		if o.PaperHeight == 0 {
+			o.PaperHeight = height
+		}
+	}
+	return o
+}
+
+func pdfViolations(kind string, r *ImageProcessorRequest) []string {
+
+	var v []string
+	if !hasPDFLayout(r) {
+		return v
+	}
+	if kind != browser.BrowserKindChrome && kind != browser.BrowserKindFirefox {
+		v = append(v, "pdf layout is supported by chrome and firefox only")
+	}
+
+	if (!utils.IsEmpty(r.HeaderTemplate) || !utils.IsEmpty(r.FooterTemplate)) && kind != browser.BrowserKindChrome {
+		v = append(v, "pdf header and footer are supported by chrome only")
+	}
+	if r.Outline != nil && *r.Outline && kind != browser.BrowserKindChrome {
+		v = append(v, "pdf outline is supported by chrome only")
+	}
+	if r.OutlineDepth < 0 || r.OutlineDepth > browser.PDFMaxOutlineDepth {
+		v = append(v, fmt.Sprintf("outline depth %d is out of 1-%d", r.OutlineDepth, browser.PDFMaxOutlineDepth))
+	}
+
+	if !utils.IsEmpty(r.Paper) {
+		if _, _, ok := browser.PDFPaper(r.Paper); !ok {
+			v = append(v, fmt.Sprintf("paper %s is unknown", r.Paper))
+		}
+	}
+	if r.PaperWidth < 0 || r.PaperHeight < 0 {
+		v = append(v, "paper size must be positive")
+	}
+	o := pdfOptions(r)
+	if (o.PaperWidth == 0) != (o.PaperHeight == 0) {
+		v = append(v, "paper requires both width and height")
+	}
+	margins := []*float64{r.MarginTop, r.MarginBottom, r.MarginLeft, r.MarginRight}
+	for i, name := range []string{"top", "bottom", "left", "right"} {
+		if margins[i] != nil && *margins[i] < 0 {
+			v = append(v, fmt.Sprintf("margin %s can't be negative", name))
+		}
+	}
+	if r.Scale != 0 && (r.Scale < browser.PDFMinScale || r.Scale > browser.PDFMaxScale) {
+		v = append(v, fmt.Sprintf("scale %g is out of %g-%g", r.Scale, browser.PDFMinScale, browser.PDFMaxScale))
+	}
+	if !utils.IsEmpty(r.PageRanges) && !pageRangesRegex.MatchString(r.PageRanges) {
+		v = append(v, fmt.Sprintf("page ranges %s are invalid", r.PageRanges))
+	}
+	return v
+}
@@ -0,0 +1,250 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/browser"
+)
+
+var errPolicyViolation = errors.New("policy violation")
+
+// violations checks resolved request against policies
+func (p *ImageProcessor) violations(r *ImageProcessorRequest) []string {
+
+	var v []string
+	// request is checked against effective options
+	options := p.browserOptions(r)
+
+	u, err := url.Parse(r.URL)
+	switch {
+	case err != nil:
+		v = append(v, fmt.Sprintf("url is invalid: %v", err))
+	case len(p.options.AllowedHosts) > 0:
+		host := strings.ToLower(u.Hostname())
+		allowed := false
+		for _, pattern := range p.options.AllowedHosts {
+			if matchHost(pattern, host) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			v = append(v, fmt.Sprintf("host %s is not allowed", host))
+		}
+	}
+
+	if err == nil {
+		v = append(v, p.targetViolations(u)...)
+	}
+
+	if u != nil {
+		if domain := browser.BlockedDomain(p.options.BlockedDomains, u.Hostname()); domain != "" {
+			v = append(v, fmt.Sprintf("host %s is blocked by %s", u.Hostname(), domain))
+		}
+	}
+
+	kind := r.Kind
+	if utils.IsEmpty(kind) {
+		kind = p.options.BrowserKind
+	}
+	if len(p.options.BlockedDomains) > 0 && kind == browser.BrowserKindFirefox {
+		v = append(v, "blocked domains are enforced by chrome and simple only")
+	}
+	if p.options.BlockPrivate && kind == browser.BrowserKindFirefox {
+		v = append(v, "private hosts are blocked by chrome and simple only")
+	}
+	p.mutex.RLock()
+	_, ok := p.browsers[kind]
+	p.mutex.RUnlock()
+	if !ok {
+		v = append(v, fmt.Sprintf("browser kind %s is unknown", kind))
+	}
+
+	switch r.Format {
+	case "":
+	case browser.FormatSVG:
+		if kind != browser.BrowserKindChrome {
+			v = append(v, fmt.Sprintf("format %s is supported by chrome only", r.Format))
+		}
+	default:
+		v = append(v, fmt.Sprintf("format %s is unknown", r.Format))
+	}
+
+	if r.HTML != "" && kind != browser.BrowserKindChrome {
+		v = append(v, "html rendering is supported by chrome only")
+	}
+
+	if !utils.IsEmpty(r.Selector) && kind != browser.BrowserKindChrome {
+		v = append(v, "selector is supported by chrome only")
+	}
+	if !utils.IsEmpty(r.Selector) && options.AsPDF {
+		v = append(v, "selector can't be used with pdf")
+	}
+
+	switch r.Direction {
+	case "", browser.DirectionVertical:
+	case browser.DirectionHorizontal:
+		if kind != browser.BrowserKindChrome {
+			v = append(v, fmt.Sprintf("direction %s is supported by chrome only", r.Direction))
+		}
+		if options.AsPDF || r.Format == browser.FormatSVG {
+			v = append(v, fmt.Sprintf("direction %s can't be used with pdf or svg", r.Direction))
+		}
+	default:
+		v = append(v, fmt.Sprintf("direction %s is unknown", r.Direction))
+	}
+
+	switch waitUntil := options.WaitUntil; waitUntil {
+	case "", browser.WaitUntilLoad:
+	case browser.WaitUntilNetworkIdle, browser.WaitUntilNetworkIdle2:
+		if kind != browser.BrowserKindChrome {
+			v = append(v, fmt.Sprintf("wait until %s is supported by chrome only", waitUntil))
+		}
+	default:
+		v = append(v, fmt.Sprintf("wait until %s is unknown", waitUntil))
+	}
+
+	if !utils.IsEmpty(r.WaitExpression) && kind != browser.BrowserKindChrome && kind != browser.BrowserKindFirefox {
+		v = append(v, "wait expression is supported by chrome and firefox only")
+	}
+
+	if !utils.IsEmpty(r.HostHeader) {
+		if h, err := url.Parse("//" + r.HostHeader); err != nil || h.Host != r.HostHeader || h.Hostname() == "" {
+			v = append(v, fmt.Sprintf("host header %s is invalid", r.HostHeader))
+		}
+		if kind != browser.BrowserKindChrome && kind != browser.BrowserKindSimple {
+			v = append(v, "host header is supported by chrome and simple only")
+		}
+	}
+
+	if (r.Username != "" || r.Password != "") && kind != browser.BrowserKindChrome && kind != browser.BrowserKindSimple {
+		v = append(v, "http auth is supported by chrome and simple only")
+	}
+
+	if (len(r.LocalStorage) > 0 || len(r.SessionStorage) > 0) && kind != browser.BrowserKindChrome {
+		v = append(v, "storage seeding is supported by chrome only")
+	}
+
+	if (r.NavigationTimeout > 0 || r.SettleTimeout > 0 || r.CaptureTimeout > 0) && kind != browser.BrowserKindChrome {
+		v = append(v, "stage timeouts are supported by chrome only")
+	}
+	if r.NavigationTimeout < 0 || r.SettleTimeout < 0 || r.CaptureTimeout < 0 {
+		v = append(v, "stage timeouts can't be negative")
+	}
+
+	if r.JsDisabled != nil && *r.JsDisabled && !utils.IsEmpty(r.WaitExpression) {
+		v = append(v, "wait expression can't be used with js disabled")
+	}
+
+	if options.Scroll && kind != browser.BrowserKindChrome {
+		v = append(v, "scroll is supported by chrome only")
+	}
+
+	if r.ScrollX < 0 || r.ScrollY < 0 {
+		v = append(v, "scroll position can't be negative")
+	}
+	if (r.ScrollX > 0 || r.ScrollY > 0) && kind != browser.BrowserKindChrome && kind != browser.BrowserKindFirefox {
+		v = append(v, "scroll position is supported by chrome and firefox only")
+	}
+	if (r.ScrollX > 0 || r.ScrollY > 0) && (options.FullPage || options.AsPDF) {
+		v = append(v, "scroll position can't be used with full page or pdf")
+	}
+
+	switch colorScheme := options.ColorScheme; colorScheme {
+	case "":
+	case browser.ColorSchemeDark, browser.ColorSchemeLight:
+		if kind != browser.BrowserKindChrome && kind != browser.BrowserKindFirefox {
+			v = append(v, fmt.Sprintf("color scheme %s is supported by chrome and firefox only", colorScheme))
+		}
+	default:
+		v = append(v, fmt.Sprintf("color scheme %s is unknown", colorScheme))
+	}
+
+	if r.Output == "domsnapshot" && kind != browser.BrowserKindChrome {
+		v = append(v, fmt.Sprintf("output %s is supported by chrome only", r.Output))
+	}
+
+	if r.Coverage != nil && *r.Coverage && kind != browser.BrowserKindChrome {
+		v = append(v, "coverage is supported by chrome only")
+	}
+	if r.Trace != nil && *r.Trace && kind != browser.BrowserKindChrome {
+		v = append(v, "trace is supported by chrome only")
+	}
+	if ((r.Memory != nil && *r.Memory) || (r.HeapSnapshot != nil && *r.HeapSnapshot)) && kind != browser.BrowserKindChrome {
+		v = append(v, "memory is supported by chrome only")
+	}
+
+	if r.Performance != nil && *r.Performance && kind != browser.BrowserKindChrome {
+		v = append(v, "performance is supported by chrome only")
+	}
+	if r.Waterfall != nil && *r.Waterfall && kind != browser.BrowserKindChrome {
+		v = append(v, "waterfall is supported by chrome only")
+	}
+	if r.IncludeHar != nil && *r.IncludeHar && kind != browser.BrowserKindChrome {
+		v = append(v, "har is supported by chrome only")
+	}
+	if r.Console != nil && *r.Console && kind != browser.BrowserKindChrome {
+		v = append(v, "console is supported by chrome only")
+	}
+	if (len(r.BlockTypes) > 0 || (r.BlockThirdParty != nil && *r.BlockThirdParty)) && kind != browser.BrowserKindChrome {
+		v = append(v, "resource blocking is supported by chrome only")
+	}
+	if r.BlockAds != nil && *r.BlockAds && kind != browser.BrowserKindChrome {
+		v = append(v, "ad blocking is supported by chrome only")
+	}
+	if r.BlockAds != nil && *r.BlockAds && p.adblock == nil {
+		v = append(v, "ad blocking requires filter lists")
+	}
+	for _, t := range r.BlockTypes {
+		if browser.BlockType(t) == "" {
+			v = append(v, fmt.Sprintf("block type %s is unknown", t))
+		}
+	}
+	if len(r.AssertSelectors) > 0 && kind != browser.BrowserKindChrome {
+		v = append(v, "selector assertions are supported by chrome only")
+	}
+	if r.HeapSnapshot != nil && *r.HeapSnapshot && p.artifacts == nil {
+		v = append(v, "heap snapshot requires storage")
+	}
+
+	if r.OCR != nil && *r.OCR && options.AsPDF {
+		v = append(v, "ocr can't be used with pdf")
+	}
+	if r.OCR != nil && *r.OCR && !hasTextAssertions(r) {
+		v = append(v, "ocr requires text assertions")
+	}
+
+	if r.Output == "url" && p.artifacts == nil {
+		v = append(v, "output url requires storage")
+	}
+
+	v = append(v, p.proxyViolations(kind, options.Proxy)...)
+	v = append(v, p.callbackViolations(r)...)
+	v = append(v, tagViolations(r.Tags)...)
+	v = append(v, dispositionViolations(r.Disposition)...)
+	v = append(v, pdfViolations(kind, r)...)
+
+	if p.options.MaxWidth > 0 && options.Width > p.options.MaxWidth {
+		v = append(v, fmt.Sprintf("width %d exceeds %d", options.Width, p.options.MaxWidth))
+	}
+	if p.options.MaxHeight > 0 && options.Height > p.options.MaxHeight {
+		v = append(v, fmt.Sprintf("height %d exceeds %d", options.Height, p.options.MaxHeight))
+	}
+	if p.options.MaxTimeout > 0 && options.Timeout > p.options.MaxTimeout {
+		v = append(v, fmt.Sprintf("timeout %d exceeds %d", options.Timeout, p.options.MaxTimeout))
+	}
+	return v
+}
+
+func (p *ImageProcessor) checkPolicy(r *ImageProcessorRequest) error {
+
+	v := p.violations(r)
+	if len(v) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errPolicyViolation, strings.Join(v, "; "))
+}
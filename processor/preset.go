@@ -0,0 +1,122 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+type ImageProcessorTenant struct {
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Cookies map[string]string `yaml:"cookies,omitempty"`
+	// egress proxy of tenant renders, request one takes over
+	Proxy string `yaml:"proxy,omitempty"`
+	// browser renders a day, cached results aren't counted, zero is unlimited
+	MaxRendersPerDay int `yaml:"maxRendersPerDay,omitempty"`
+}
+
+var errUnknownPreset = errors.New("unknown preset")
+
+// loadPresets reads yaml file or content with name: request parameters
+func loadPresets(presets string) (map[string]*ImageProcessorRequest, error) {
+
+	m := make(map[string]*ImageProcessorRequest)
+	if utils.IsEmpty(presets) {
+		return m, nil
+	}
+	if _, err := common.LoadYaml(presets, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func loadTenants(tenants string) (map[string]*ImageProcessorTenant, error) {
+
+	m := make(map[string]*ImageProcessorTenant)
+	if utils.IsEmpty(tenants) {
+		return m, nil
+	}
+	if _, err := common.LoadYaml(tenants, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// mergeRequest fills empty fields of dst by src, maps are merged with dst keys taking precedence
+func mergeRequest(dst, src *ImageProcessorRequest) {
+
+	d := reflect.ValueOf(dst).Elem()
+	s := reflect.ValueOf(src).Elem()
+
+	for i := 0; i < d.NumField(); i++ {
+
+		df := d.Field(i)
+		sf := s.Field(i)
+		if sf.IsZero() {
+			continue
+		}
+
+		if df.Kind() == reflect.Map && !df.IsZero() {
+			m := reflect.MakeMap(df.Type())
+			for _, k := range sf.MapKeys() {
+				m.SetMapIndex(k, sf.MapIndex(k))
+			}
+			for _, k := range df.MapKeys() {
+				m.SetMapIndex(k, df.MapIndex(k))
+			}
+			df.Set(m)
+			continue
+		}
+
+		if df.IsZero() {
+			df.Set(sf)
+		}
+	}
+}
+
+// applyPreset merges named preset under request parameters
+func (p *ImageProcessor) applyPreset(r *ImageProcessorRequest) error {
+
+	if utils.IsEmpty(r.Preset) {
+		return nil
+	}
+
+	preset, ok := p.presets[r.Preset]
+	if !ok {
+		return fmt.Errorf("%w: %s", errUnknownPreset, r.Preset)
+	}
+	mergeRequest(r, preset)
+
+	// presets are configured by operator, so labels are bounded
+	labels := make(sreCommon.Labels)
+	labels["preset"] = common.NormalizeLabel(r.Preset)
+	p.meter.Counter("presets", "Count of all image processor requests by preset", labels, "image", "processor").Inc()
+	return nil
+}
+
+// applyTenant merges tenant headers, cookies and proxy under request and preset ones
+func (p *ImageProcessor) applyTenant(r *ImageProcessorRequest) {
+
+	if utils.IsEmpty(r.Tenant) {
+		return
+	}
+
+	tenant, ok := p.tenants[r.Tenant]
+	if !ok {
+		return
+	}
+
+	defaults := &ImageProcessorRequest{
+		Headers: make(map[string]interface{}),
+		Cookies: tenant.Cookies,
+		Proxy:   tenant.Proxy,
+	}
+	for k, v := range tenant.Headers {
+		defaults.Headers[k] = v
+	}
+	mergeRequest(r, defaults)
+}
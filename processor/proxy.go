@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/browser"
+)
+
+// redactProxy hides password of proxy url
+func redactProxy(proxy string) string {
+
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	return u.Redacted()
+}
+
+func (p *ImageProcessor) proxyViolations(kind, proxy string) []string {
+
+	if utils.IsEmpty(proxy) {
+		return nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil || u.Hostname() == "" {
+		return []string{"proxy is invalid"}
+	}
+
+	var v []string
+	switch u.Scheme {
+	case browser.ProxySchemeHTTP, browser.ProxySchemeHTTPS, browser.ProxySchemeSOCKS5:
+	default:
+		v = append(v, fmt.Sprintf("proxy scheme %s is unknown", u.Scheme))
+	}
+
+	if len(p.options.AllowedProxies) > 0 {
+		host := strings.ToLower(u.Hostname())
+		allowed := false
+		for _, pattern := range p.options.AllowedProxies {
+			if matchHost(pattern, host) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			v = append(v, fmt.Sprintf("proxy %s is not allowed", host))
+		}
+	}
+
+	// chrome answers http proxy challenges only, firefox has no way to take credentials
+	if u.User != nil {
+		switch {
+		case kind == browser.BrowserKindFirefox:
+			v = append(v, "proxy credentials aren't supported by firefox")
+		case kind == browser.BrowserKindChrome && u.Scheme == browser.ProxySchemeSOCKS5:
+			v = append(v, "socks5 proxy credentials aren't supported by chrome")
+		}
+	}
+	return v
+}
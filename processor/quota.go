@@ -0,0 +1,179 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+var errTenantQuota = errors.New("tenant daily render quota exceeded")
+var errTenantRequired = errors.New("tenant is required")
+
+// tenantUsage counts renders of tenants within utc day, it's per instance and starts over on restart
+type tenantUsage struct {
+	day     string
+	renders map[string]int
+	mutex   sync.Mutex
+}
+
+func (u *tenantUsage) rotate(now time.Time) {
+
+	day := now.UTC().Format("2006-01-02")
+	if day != u.day {
+		u.day = day
+		u.renders = make(map[string]int)
+	}
+}
+
+// take counts render if tenant is under limit, zero limit is unlimited
+func (u *tenantUsage) take(tenant string, limit int) error {
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.rotate(time.Now())
+	if limit > 0 && u.renders[tenant] >= limit {
+		return errTenantQuota
+	}
+	u.renders[tenant]++
+	return nil
+}
+
+func (u *tenantUsage) used(tenant string) int {
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.rotate(time.Now())
+	return u.renders[tenant]
+}
+
+// resets is start of next utc day
+func (u *tenantUsage) resets() time.Time {
+
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+}
+
+func newTenantUsage() *tenantUsage {
+	return &tenantUsage{renders: make(map[string]int)}
+}
+
+func (p *ImageProcessor) tenantRenderLimit(tenant string) int {
+
+	if t, ok := p.tenants[tenant]; ok && t != nil {
+		return t.MaxRendersPerDay
+	}
+	return 0
+}
+
+func (p *ImageProcessor) takeQuota(tenant string) error {
+	return p.usage.take(tenant, p.tenantRenderLimit(tenant))
+}
+
+// QuotaUsage is consumption against limit, zero limit is unlimited
+type QuotaUsage struct {
+	Used   int64      `json:"used"`
+	Limit  int64      `json:"limit"`
+	Resets *time.Time `json:"resets,omitempty"`
+}
+
+type QuotaProcessorResponse struct {
+	Tenant     string      `json:"tenant"`
+	Renders    *QuotaUsage `json:"renders"`
+	Concurrent *QuotaUsage `json:"concurrent"`
+	// bytes and objects stored, there are no limits but retention ones
+	StoredBytes   *int64 `json:"storedBytes,omitempty"`
+	StoredObjects *int   `json:"storedObjects,omitempty"`
+}
+
+// QuotaProcessor reports tenant consumption, key bound to tenant sees its own only
+type QuotaProcessor struct {
+	image  *ImageProcessor
+	logger sreCommon.Logger
+	meter  sreCommon.Meter
+}
+
+func QuotaProcessorType() string {
+	return "Quota"
+}
+
+func (p *QuotaProcessor) Type() string {
+	return QuotaProcessorType()
+}
+
+func (p *QuotaProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+		return fmt.Errorf("method %s is not allowed", r.Method)
+	}
+
+	tenant := r.URL.Query().Get("tenant")
+	if bound := common.Tenant(r.Context()); !utils.IsEmpty(bound) {
+		if !utils.IsEmpty(tenant) && tenant != bound {
+			err := fmt.Errorf("tenant %s is not allowed", tenant)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return err
+		}
+		tenant = bound
+	}
+	if utils.IsEmpty(tenant) {
+		http.Error(w, errTenantRequired.Error(), http.StatusBadRequest)
+		return errTenantRequired
+	}
+
+	resets := p.image.usage.resets()
+	response := &QuotaProcessorResponse{
+		Tenant: tenant,
+		Renders: &QuotaUsage{
+			Used:   int64(p.image.usage.used(tenant)),
+			Limit:  int64(p.image.tenantRenderLimit(tenant)),
+			Resets: &resets,
+		},
+		Concurrent: &QuotaUsage{
+			Used:  int64(p.image.limiter.active(limiterClient(tenant, r.RemoteAddr))),
+			Limit: int64(p.image.options.MaxClientConcurrency),
+		},
+	}
+
+	if a := p.image.artifacts; a != nil {
+		objects, err := a.Storage().List(r.Context(), a.TenantPrefix(tenant))
+		if err != nil {
+			p.logger.Error("Couldn't list artifacts of tenant %s: %v", tenant, err)
+		} else {
+			var size int64
+			for _, o := range objects {
+				size += o.Size
+			}
+			count := len(objects)
+			response.StoredBytes = &size
+			response.StoredObjects = &count
+		}
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not marshal quota: %v", err), http.StatusInternalServerError)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
+
+func NewQuotaProcessor(image *ImageProcessor, observability *common.Observability) *QuotaProcessor {
+
+	return &QuotaProcessor{
+		image:  image,
+		logger: observability.Logs(),
+		meter:  observability.Metrics(),
+	}
+}
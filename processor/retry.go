@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/devopsext/webrender/browser"
+)
+
+const (
+	partialRetryComplete = "complete"
+	partialRetryPartial  = "partial"
+	partialRetryFailed   = "failed"
+)
+
+// retryPartial tells if partial render is rendered once more, factor of one turns it off
+func (p *ImageProcessor) retryPartial(r *ImageProcessorRequest) bool {
+
+	retry := p.options.PartialRetry
+	if r.RetryPartial != nil {
+		retry = *r.RetryPartial
+	}
+	return retry && p.options.PartialRetryFactor > 1
+}
+
+// rerender renders partial render again with timeout multiplied up to max timeout, retry is taken
+// unless it failed, even partial one had more time to load
+func (p *ImageProcessor) rerender(ctx context.Context, kind string, u *url.URL, r *ImageProcessorRequest, partial *browser.BrowserImage) *browser.BrowserImage {
+
+	timeout := p.browserOptions(r).Timeout
+
+	retry := *r
+	retry.Timeout = timeout * p.options.PartialRetryFactor
+	if p.options.MaxTimeout > 0 && retry.Timeout > p.options.MaxTimeout {
+		retry.Timeout = p.options.MaxTimeout
+	}
+	// no more time to give
+	if retry.Timeout <= timeout {
+		return partial
+	}
+
+	p.logger.Debug("Render of %s is partial, retrying with timeout %d", r.URL, retry.Timeout)
+	renderEvents(ctx).Event(browser.RenderEventRetry, "render is partial, retrying with timeout %d", retry.Timeout)
+	image, err := p.render(ctx, kind, u, &retry)
+
+	result := partialRetryComplete
+	switch {
+	case err != nil:
+		result = partialRetryFailed
+		p.logger.Warn("Retry of partial render of %s failed: %v", r.URL, err)
+	case image.Partial:
+		result = partialRetryPartial
+	}
+
+	p.counters.partialRetries.with(result).Inc()
+
+	if err != nil {
+		return partial
+	}
+	return image
+}
@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+// ImageProcessorRewrite sends navigation to hosts matched by glob to other host, scheme or
+// through proxy, * of host is what * of *.match pattern matched, e.g. *.svc.cluster.local
+type ImageProcessorRewrite struct {
+	Match  string `yaml:"match"`
+	Host   string `yaml:"host,omitempty"`
+	Scheme string `yaml:"scheme,omitempty"`
+	Proxy  string `yaml:"proxy,omitempty"`
+}
+
+func loadRewrites(rewrites string) ([]*ImageProcessorRewrite, error) {
+
+	var list []*ImageProcessorRewrite
+	if utils.IsEmpty(rewrites) {
+		return list, nil
+	}
+	if _, err := common.LoadYaml(rewrites, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// rewriteHost replaces * of host with subdomain matched, port of url is kept unless host has one
+func rewriteHost(rule *ImageProcessorRewrite, u *url.URL) string {
+
+	host := strings.ToLower(u.Hostname())
+	pattern := strings.ToLower(strings.TrimSpace(rule.Match))
+
+	target := rule.Host
+	if strings.Contains(target, "*") {
+		sub := ""
+		if strings.HasPrefix(pattern, "*.") {
+			sub = strings.TrimSuffix(host, strings.TrimPrefix(pattern, "*"))
+		}
+		if utils.IsEmpty(sub) || sub == host {
+			return ""
+		}
+		target = strings.ReplaceAll(target, "*", sub)
+	}
+	if _, _, err := net.SplitHostPort(target); err == nil || utils.IsEmpty(u.Port()) {
+		return target
+	}
+	return net.JoinHostPort(target, u.Port())
+}
+
+// applyRewrite returns url browser navigates to and request with proxy of first matching rule,
+// request url is kept as it is, so jobs, cache and policy see the url asked for
+func (p *ImageProcessor) applyRewrite(u *url.URL, r *ImageProcessorRequest) (*url.URL, *ImageProcessorRequest) {
+
+	host := strings.ToLower(u.Hostname())
+	for _, rule := range p.rewrites {
+		if !matchHost(rule.Match, host) {
+			continue
+		}
+
+		rewritten := *u
+		if !utils.IsEmpty(rule.Host) {
+			target := rewriteHost(rule, u)
+			if utils.IsEmpty(target) {
+				continue
+			}
+			rewritten.Host = target
+		}
+		if !utils.IsEmpty(rule.Scheme) {
+			rewritten.Scheme = rule.Scheme
+		}
+
+		request := r
+		if !utils.IsEmpty(rule.Proxy) {
+			c := *r
+			c.Proxy = rule.Proxy
+			request = &c
+		}
+
+		p.counters.rewrites.with(common.NormalizeLabel(rule.Match)).Inc()
+
+		if r.Debug {
+			p.logger.Info("[debug] Rewrote %s to %s by %s", u.Host, rewritten.Host, rule.Match)
+		}
+		return &rewritten, request
+	}
+	return u, r
+}
@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/common"
+	"github.com/devopsext/webrender/schema"
+)
+
+// SchemaProcessor publishes json schemas which request bodies are validated against
+type SchemaProcessor struct {
+	logger sreCommon.Logger
+	meter  sreCommon.Meter
+}
+
+func SchemaProcessorType() string {
+	return "Schema"
+}
+
+func (p *SchemaProcessor) Type() string {
+	return SchemaProcessorType()
+}
+
+func (p *SchemaProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+		return fmt.Errorf("method %s is not allowed", r.Method)
+	}
+
+	// directory itself lists names of schemas
+	if strings.HasSuffix(r.URL.Path, "/") {
+		data, err := json.Marshal(schema.Names())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not marshal schemas: %v", err), http.StatusInternalServerError)
+			return err
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(data)
+		return err
+	}
+
+	name := path.Base(r.URL.Path)
+	data, ok := schema.Raw(name)
+	if !ok {
+		err := fmt.Errorf("schema %s is not found", name)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	_, err := w.Write(data)
+	return err
+}
+
+func NewSchemaProcessor(observability *common.Observability) *SchemaProcessor {
+
+	return &SchemaProcessor{
+		logger: observability.Logs(),
+		meter:  observability.Metrics(),
+	}
+}
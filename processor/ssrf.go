@@ -0,0 +1,153 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/browser"
+)
+
+const targetResolveTimeout = 5 * time.Second
+
+// sharedAddressSpace is carrier grade nat range, not covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// internalIP tells if ip is loopback, private, link local or otherwise not public
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+// privateAllowed checks host and ip against whitelist of host patterns and cidrs
+func (p *ImageProcessor) privateAllowed(host string, ip net.IP) bool {
+
+	for _, v := range p.options.PrivateAllowed {
+		if _, network, err := net.ParseCIDR(v); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if matchHost(v, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// deliveryAddress refuses internal address callback host resolves to when deliveries connect,
+// as it might resolve other way than policy saw
+func (p *ImageProcessor) deliveryAddress(host string, ip net.IP) string {
+
+	if internalIP(ip) && !p.privateAllowed(host, ip) {
+		return fmt.Sprintf("host %s resolves to internal address %s", host, ip)
+	}
+	return ""
+}
+
+// targetViolations checks denied hosts, url scheme and addresses host resolves to,
+// unresolved host is left to browser, its requests are checked by host filter
+func (p *ImageProcessor) targetViolations(u *url.URL) []string {
+
+	var v []string
+
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range p.options.DeniedHosts {
+		if matchHost(pattern, host) {
+			return append(v, fmt.Sprintf("host %s is denied", host))
+		}
+	}
+
+	if !p.options.BlockPrivate {
+		return v
+	}
+
+	// file and other local schemes are internal by definition
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return append(v, fmt.Sprintf("scheme %s is not allowed", u.Scheme))
+	}
+
+	if ip, _ := p.internalAddress(host); ip != nil {
+		return append(v, fmt.Sprintf("host %s resolves to internal address %s", host, ip))
+	}
+	return v
+}
+
+// internalAddress returns internal address host resolves to which isn't allowed, any is enough
+// as it might be taken by browser
+func (p *ImageProcessor) internalAddress(host string) (net.IP, error) {
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), targetResolveTimeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if internalIP(ip) && !p.privateAllowed(host, ip) {
+			return ip, nil
+		}
+	}
+	return nil, nil
+}
+
+// hostFilter refuses requests of render to internal addresses, so redirects, frames and subresources
+// don't reach them either. Hosts are resolved once more as they might resolve other way than policy
+// saw, unresolved host is refused unless proxy resolves it. Host navigation is rewritten to is trusted
+func (p *ImageProcessor) hostFilter(u *url.URL, r *ImageProcessorRequest, proxy string) browser.HostFilter {
+
+	if !p.options.BlockPrivate {
+		return nil
+	}
+
+	trusted := ""
+	if ru, err := url.Parse(r.URL); err == nil && !strings.EqualFold(ru.Hostname(), u.Hostname()) {
+		trusted = strings.ToLower(u.Hostname())
+	}
+
+	var mutex sync.Mutex
+	denied := make(map[string]string)
+	return func(host string) string {
+
+		host = strings.ToLower(host)
+		if host == "" || host == trusted {
+			return ""
+		}
+		mutex.Lock()
+		v, ok := denied[host]
+		mutex.Unlock()
+		if ok {
+			return v
+		}
+
+		ip, err := p.internalAddress(host)
+		switch {
+		case err != nil && utils.IsEmpty(proxy):
+			v = fmt.Sprintf("host %s couldn't be resolved", host)
+		case ip != nil:
+			v = fmt.Sprintf("host %s resolves to internal address %s", host, ip)
+		}
+
+		mutex.Lock()
+		denied[host] = v
+		mutex.Unlock()
+		return v
+	}
+}
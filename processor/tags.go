@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/common"
+)
+
+const (
+	imageProcessorMaxTags        = 16
+	imageProcessorMaxTagKey      = 64
+	imageProcessorMaxTagValue    = 256
+	imageProcessorMaxTagValues   = 32
+	imageProcessorOtherTagValues = "other"
+)
+
+func tagViolations(tags map[string]string) []string {
+
+	var v []string
+	if len(tags) > imageProcessorMaxTags {
+		v = append(v, fmt.Sprintf("tags are limited to %d", imageProcessorMaxTags))
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch {
+		case k == "":
+			v = append(v, "tag key is empty")
+		case len(k) > imageProcessorMaxTagKey:
+			v = append(v, fmt.Sprintf("tag key %s exceeds %d", k[:imageProcessorMaxTagKey], imageProcessorMaxTagKey))
+		case len(tags[k]) > imageProcessorMaxTagValue:
+			v = append(v, fmt.Sprintf("tag %s value exceeds %d", k, imageProcessorMaxTagValue))
+		}
+	}
+	return v
+}
+
+// tagValue keeps labels cardinality bounded, values beyond max per tag are counted as other
+func (p *ImageProcessor) tagValue(key, value string) string {
+
+	value = common.NormalizeLabel(value)
+
+	p.mutex.RLock()
+	values, ok := p.tagValues[key]
+	seen := ok && values[value]
+	p.mutex.RUnlock()
+	if seen {
+		return value
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	values, ok = p.tagValues[key]
+	if !ok {
+		values = make(map[string]bool)
+		p.tagValues[key] = values
+	}
+	if !values[value] && len(values) >= imageProcessorMaxTagValues {
+		return imageProcessorOtherTagValues
+	}
+	values[value] = true
+	return value
+}
+
+// countTags counts renders by tags allowed as metric labels, other tags are kept in jobs only
+func (p *ImageProcessor) countTags(job *Job, err error) {
+
+	outcome := JobDone
+	if err != nil {
+		outcome = JobFailed
+	}
+	for _, key := range p.options.MetricTags {
+		value, ok := job.Tags[key]
+		if !ok {
+			continue
+		}
+		labels := make(sreCommon.Labels)
+		labels["tag"] = common.NormalizeLabel(key)
+		labels["value"] = p.tagValue(key, value)
+		labels["outcome"] = outcome
+		p.meter.Counter("tagged_renders", "Count of all renders by tag value", labels, "image", "processor").Inc()
+	}
+}
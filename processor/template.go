@@ -0,0 +1,231 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+type TemplateProcessorOptions struct {
+	// yaml file or content with name: template and its request parameters
+	Templates string
+}
+
+// TemplateProcessorTemplate is html/template document, request parameters are defaults of its renders,
+// e.g. size of social image
+type TemplateProcessorTemplate struct {
+	Template string                 `yaml:"template" json:"template"`
+	Request  *ImageProcessorRequest `yaml:"request,omitempty" json:"request,omitempty"`
+
+	parsed *template.Template
+}
+
+// TemplateProcessor keeps named templates, renders them expanded with json data posted in body,
+// query parameters are ones of image request
+type TemplateProcessor struct {
+	options   TemplateProcessorOptions
+	image     *ImageProcessor
+	logger    sreCommon.Logger
+	meter     sreCommon.Meter
+	requests  sreCommon.Counter
+	errors    sreCommon.Counter
+	templates map[string]*TemplateProcessorTemplate
+	mutex     sync.RWMutex
+}
+
+var errUnknownTemplate = errors.New("unknown template")
+
+func TemplateProcessorType() string {
+	return "Template"
+}
+
+func (p *TemplateProcessor) Type() string {
+	return TemplateProcessorType()
+}
+
+func parseTemplate(name string, t *TemplateProcessorTemplate) error {
+
+	if utils.IsEmpty(t.Template) {
+		return fmt.Errorf("template %s is empty", name)
+	}
+	parsed, err := template.New(name).Option("missingkey=zero").Parse(t.Template)
+	if err != nil {
+		return err
+	}
+	t.parsed = parsed
+	return nil
+}
+
+// loadTemplates reads yaml file or content with name: template
+func loadTemplates(templates string) (map[string]*TemplateProcessorTemplate, error) {
+
+	m := make(map[string]*TemplateProcessorTemplate)
+	if utils.IsEmpty(templates) {
+		return m, nil
+	}
+	if _, err := common.LoadYaml(templates, &m); err != nil {
+		return nil, err
+	}
+	for name, t := range m {
+		if t == nil {
+			return nil, fmt.Errorf("template %s is empty", name)
+		}
+		if err := parseTemplate(name, t); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (p *TemplateProcessor) get(name string) (*TemplateProcessorTemplate, bool) {
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	t, ok := p.templates[name]
+	return t, ok
+}
+
+func (p *TemplateProcessor) list(w http.ResponseWriter) error {
+
+	p.mutex.RLock()
+	names := make([]string, 0, len(p.templates))
+	for name := range p.templates {
+		names = append(names, name)
+	}
+	p.mutex.RUnlock()
+	sort.Strings(names)
+
+	data, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
+
+// store keeps template of body under name, it's lost on restart unlike configured ones
+func (p *TemplateProcessor) store(w http.ResponseWriter, r *http.Request, name string) error {
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, htmlMaxBodySize))
+	t := &TemplateProcessorTemplate{Template: string(data)}
+	if err != nil {
+		err = fmt.Errorf("%w: %v", errBadRequestBody, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return err
+	}
+	if err := parseTemplate(name, t); err != nil {
+		err = fmt.Errorf("could not parse template: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return err
+	}
+
+	p.mutex.Lock()
+	// parameters of configured template are kept
+	if old, ok := p.templates[name]; ok {
+		t.Request = old.Request
+	}
+	p.templates[name] = t
+	p.mutex.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// render expands template with json data of body, empty body is no data
+func (p *TemplateProcessor) render(w http.ResponseWriter, r *http.Request, name string) error {
+
+	t, ok := p.get(name)
+	if !ok {
+		err := fmt.Errorf("%w: %s", errUnknownTemplate, name)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return err
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, htmlMaxBodySize))
+	var data interface{}
+	if err == nil && len(bytes.TrimSpace(body)) > 0 {
+		err = json.Unmarshal(body, &data)
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: %v", errBadRequestBody, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return err
+	}
+
+	var document strings.Builder
+	if err := t.parsed.Execute(&document, data); err != nil {
+		err = fmt.Errorf("could not expand template %s: %w", name, err)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return err
+	}
+
+	// request of template is shared, merge takes its maps as they are
+	var defaults *ImageProcessorRequest
+	if t.Request != nil {
+		copied := *t.Request
+		defaults = &copied
+	}
+	return p.image.renderHTML(w, r, "template", document.String(), defaults)
+}
+
+// HandleHttpRequest lists templates on GET .../, stores template of body on PUT .../{name}
+// and renders template with json data of body on POST .../{name}
+func (p *TemplateProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	p.requests.Inc()
+
+	name := path.Base(r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") {
+		name = ""
+	}
+
+	var err error
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		err = p.list(w)
+	case r.Method == http.MethodPut && name != "":
+		err = p.store(w, r, name)
+	case r.Method == http.MethodPost && name != "":
+		err = p.render(w, r, name)
+	default:
+		err = fmt.Errorf("method %s is not allowed", r.Method)
+		http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+	}
+	if err != nil {
+		p.errors.Inc()
+	}
+	return err
+}
+
+func NewTemplateProcessor(options TemplateProcessorOptions, image *ImageProcessor, observability *common.Observability) *TemplateProcessor {
+
+	templates, err := loadTemplates(options.Templates)
+	if err != nil {
+		observability.Error("Couldn't load templates: %v", err)
+		templates = make(map[string]*TemplateProcessorTemplate)
+	}
+
+	meter := observability.Metrics()
+	return &TemplateProcessor{
+		options:   options,
+		image:     image,
+		logger:    observability.Logs(),
+		meter:     meter,
+		templates: templates,
+		requests:  meter.Counter("requests", "Count of all template processor requests", nil, "template", "processor"),
+		errors:    meter.Counter("errors", "Count of all template processor errors", nil, "template", "processor"),
+	}
+}
@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/webrender/browser"
+	"github.com/devopsext/webrender/common"
+)
+
+type ValidateProcessorResponse struct {
+	Valid      bool                    `json:"valid"`
+	Violations []string                `json:"violations,omitempty"`
+	Error      string                  `json:"error,omitempty"`
+	Request    *ImageProcessorRequest  `json:"request,omitempty"`
+	Options    *browser.BrowserOptions `json:"options,omitempty"`
+}
+
+// ValidateProcessor resolves image request and checks policies without launching browser
+type ValidateProcessor struct {
+	image  *ImageProcessor
+	logger sreCommon.Logger
+	meter  sreCommon.Meter
+}
+
+func ValidateProcessorType() string {
+	return "Validate"
+}
+
+func (p *ValidateProcessor) Type() string {
+	return ValidateProcessorType()
+}
+
+func (p *ValidateProcessor) HandleHttpRequest(w http.ResponseWriter, r *http.Request) error {
+
+	response := &ValidateProcessorResponse{}
+
+	request, err := p.image.resolve(r)
+	if err != nil {
+		response.Error = err.Error()
+	} else {
+		response.Violations = p.image.violations(request)
+		response.Valid = len(response.Violations) == 0
+
+		// secrets don't leave server
+		options := p.image.browserOptions(request)
+		options.HeadersMap = nil
+		options.Cookies = nil
+		options.Proxy = redactProxy(options.Proxy)
+		options.Password = ""
+		options.LocalStorage = nil
+		options.SessionStorage = nil
+		options.CaptchaSolver = nil
+		response.Options = &options
+
+		public := *request
+		public.Headers = nil
+		public.Cookies = nil
+		public.Proxy = redactProxy(public.Proxy)
+		public.Password = ""
+		public.LocalStorage = nil
+		public.SessionStorage = nil
+		response.Request = &public
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not marshal validation: %v", err), http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !response.Valid {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func NewValidateProcessor(image *ImageProcessor, observability *common.Observability) *ValidateProcessor {
+
+	return &ValidateProcessor{
+		image:  image,
+		logger: observability.Logs(),
+		meter:  observability.Metrics(),
+	}
+}
@@ -0,0 +1,331 @@
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// schemas are json schemas of api bodies, they are published as they are
+//
+//go:embed *.json
+var files embed.FS
+
+// Schema is a subset of json schema, which is enough to describe api bodies:
+// type, properties, additional properties, items, enum, bounds, required and refs
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+
+	types      []string
+	closed     bool
+	additional *Schema
+}
+
+// FieldError is a failure of one value, field is json pointer to it
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Message)
+}
+
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+
+	var s []string
+	for _, f := range e.Errors {
+		s = append(s, f.Error())
+	}
+	return strings.Join(s, "; ")
+}
+
+// validator walks value by schema, refs without file are taken from root
+type validator struct {
+	root   *Schema
+	errors []*FieldError
+}
+
+var schemas = make(map[string]*Schema)
+
+// compile interprets fields which json schema allows to be of several kinds
+func (s *Schema) compile() error {
+
+	if s == nil {
+		return nil
+	}
+
+	switch t := s.Type.(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			name, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("type %v is not a string", v)
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return fmt.Errorf("type %v is invalid", t)
+	}
+
+	if len(s.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(s.AdditionalProperties, &allowed); err == nil {
+			s.closed = !allowed
+		} else {
+			s.additional = &Schema{}
+			if err := json.Unmarshal(s.AdditionalProperties, s.additional); err != nil {
+				return fmt.Errorf("additional properties are invalid: %v", err)
+			}
+		}
+	}
+
+	children := []*Schema{s.Items, s.additional}
+	for _, v := range s.Properties {
+		children = append(children, v)
+	}
+	for _, v := range s.Defs {
+		children = append(children, v)
+	}
+	for _, v := range children {
+		if err := v.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *validator) fail(field, format string, args ...interface{}) {
+
+	if field == "" {
+		field = "/"
+	}
+	v.errors = append(v.errors, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) resolve(s *Schema) (*Schema, *Schema) {
+
+	root := v.root
+	for s != nil && s.Ref != "" {
+		name, fragment, _ := strings.Cut(s.Ref, "#")
+		if name != "" {
+			root = schemas[name]
+		}
+		s = root
+		if fragment != "" {
+			def := strings.TrimPrefix(fragment, "/$defs/")
+			if root == nil || root.Defs[def] == nil {
+				return nil, root
+			}
+			s = root.Defs[def]
+		}
+	}
+	return s, root
+}
+
+// kindOf names json type of decoded value, numbers are decoded as json.Number
+func kindOf(value interface{}) string {
+
+	switch t := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := strconv.ParseInt(t.String(), 10, 64); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func typeMatches(types []string, kind string) bool {
+
+	for _, t := range types {
+		if t == kind || (t == "number" && kind == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) validate(s *Schema, field string, value interface{}) {
+
+	s, root := v.resolve(s)
+	if s == nil {
+		v.fail(field, "has unresolved schema")
+		return
+	}
+	if root != v.root {
+		defer func(prev *Schema) { v.root = prev }(v.root)
+		v.root = root
+	}
+
+	kind := kindOf(value)
+	if len(s.types) > 0 && !typeMatches(s.types, kind) {
+		v.fail(field, "must be %s, got %s", strings.Join(s.types, " or "), kind)
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			var allowed []string
+			for _, e := range s.Enum {
+				allowed = append(allowed, fmt.Sprintf("%q", fmt.Sprint(e)))
+			}
+			v.fail(field, "must be one of %s", strings.Join(allowed, ", "))
+		}
+	}
+
+	switch t := value.(type) {
+	case json.Number:
+		n, _ := t.Float64()
+		if s.Minimum != nil && n < *s.Minimum {
+			v.fail(field, "must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			v.fail(field, "must be at most %v", *s.Maximum)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(t) < *s.MinItems {
+			v.fail(field, "must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(t) > *s.MaxItems {
+			v.fail(field, "must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range t {
+				v.validate(s.Items, field+"/"+strconv.Itoa(i), item)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := t[name]; !ok {
+				v.fail(field+"/"+name, "is required")
+			}
+		}
+		// sorted keys keep errors in stable order
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			name := field + "/" + k
+			switch {
+			case s.Properties[k] != nil:
+				v.validate(s.Properties[k], name, t[k])
+			case s.additional != nil:
+				v.validate(s.additional, name, t[k])
+			case s.closed:
+				v.fail(name, "is unknown")
+			}
+		}
+	}
+}
+
+// Validate checks json document against named schema, bad json is an error as well
+func Validate(name string, data []byte) error {
+
+	s, ok := schemas[name]
+	if !ok {
+		return fmt.Errorf("schema %s is unknown", name)
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var value interface{}
+	if err := d.Decode(&value); err != nil {
+		return err
+	}
+
+	v := &validator{root: s}
+	v.validate(s, "", value)
+	if len(v.errors) > 0 {
+		return &ValidationError{Errors: v.errors}
+	}
+	return nil
+}
+
+// Names lists published schemas
+func Names() []string {
+
+	var names []string
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Raw returns schema document as it's embedded
+func Raw(name string) ([]byte, bool) {
+
+	if _, ok := schemas[name]; !ok {
+		return nil, false
+	}
+	data, err := files.ReadFile(name)
+	return data, err == nil
+}
+
+func init() {
+
+	entries, err := files.ReadDir(".")
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		if path.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := files.ReadFile(e.Name())
+		if err != nil {
+			panic(err)
+		}
+		s := &Schema{}
+		if err := json.Unmarshal(data, s); err != nil {
+			panic(fmt.Sprintf("schema %s is invalid: %v", e.Name(), err))
+		}
+		if err := s.compile(); err != nil {
+			panic(fmt.Sprintf("schema %s is invalid: %v", e.Name(), err))
+		}
+		schemas[e.Name()] = s
+	}
+}
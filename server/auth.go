@@ -0,0 +1,128 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+	"golang.org/x/time/rate"
+)
+
+// HttpAPIKey is a static key, rate is requests per second with burst, zero rate is unlimited,
+// key with tenant renders and reads quota of that tenant only
+type HttpAPIKey struct {
+	Key    string  `yaml:"key"`
+	Rate   float64 `yaml:"rate,omitempty"`
+	Burst  int     `yaml:"burst,omitempty"`
+	Tenant string  `yaml:"tenant,omitempty"`
+}
+
+type httpAuthKey struct {
+	name    string
+	key     []byte
+	tenant  string
+	limiter *rate.Limiter
+}
+
+// httpAuth checks api key passed by header or query parameter
+type httpAuth struct {
+	keys   []*httpAuthKey
+	header string
+	param  string
+}
+
+var errUnauthorized = errors.New("api key is missing or invalid")
+var errRateLimited = errors.New("api key rate limit exceeded")
+
+func (a *httpAuth) names() []string {
+
+	var r []string
+	for _, k := range a.keys {
+		r = append(r, k.name)
+	}
+	return r
+}
+
+// find compares all keys in constant time, so key can't be guessed by timing
+func (a *httpAuth) find(key string) *httpAuthKey {
+
+	var found *httpAuthKey
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(k.key, []byte(key)) == 1 && found == nil {
+			found = k
+		}
+	}
+	return found
+}
+
+// authenticate returns request key, query parameter is removed not to get into jobs
+func (a *httpAuth) authenticate(r *http.Request) (*httpAuthKey, error) {
+
+	key := r.Header.Get(a.header)
+	if utils.IsEmpty(key) && !utils.IsEmpty(a.param) {
+		query := r.URL.Query()
+		key = query.Get(a.param)
+		if query.Has(a.param) {
+			query.Del(a.param)
+			r.URL.RawQuery = query.Encode()
+		}
+	}
+
+	return a.check(key)
+}
+
+// check finds key and takes its rate
+func (a *httpAuth) check(key string) (*httpAuthKey, error) {
+
+	k := a.find(strings.TrimSpace(key))
+	if utils.IsEmpty(key) || k == nil {
+		return nil, errUnauthorized
+	}
+	if k.limiter != nil && !k.limiter.Allow() {
+		return k, errRateLimited
+	}
+	return k, nil
+}
+
+// newHttpAuth loads yaml file or content with name: key and rate, nil is returned if there are no keys
+func newHttpAuth(keys, header, param string) (*httpAuth, error) {
+
+	m := make(map[string]*HttpAPIKey)
+	if _, err := common.LoadYaml(keys, &m); err != nil {
+		return nil, err
+	}
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	if utils.IsEmpty(header) {
+		header = "X-API-Key"
+	}
+
+	a := &httpAuth{
+		header: header,
+		param:  param,
+	}
+	for name, k := range m {
+		if k == nil || utils.IsEmpty(k.Key) {
+			continue
+		}
+		ak := &httpAuthKey{
+			name:   common.NormalizeLabel(name),
+			key:    []byte(k.Key),
+			tenant: k.Tenant,
+		}
+		if k.Rate > 0 {
+			burst := k.Burst
+			if burst <= 0 {
+				burst = 1
+			}
+			ak.limiter = rate.NewLimiter(rate.Limit(k.Rate), burst)
+		}
+		a.keys = append(a.keys, ak)
+	}
+	return a, nil
+}
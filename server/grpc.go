@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/api"
+	"github.com/devopsext/webrender/common"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type GrpcServerOptions struct {
+	Listen string
+	Tls    bool
+	Cert   string
+	Key    string
+	// max size of received message in bytes
+	MaxRecvSize int
+	// keys of http server, key is passed by metadata of header name
+	APIKeys      string
+	APIKeyHeader string
+}
+
+type GrpcServer struct {
+	options GrpcServerOptions
+	service api.WebrenderServer
+	auth    *httpAuth
+	logger  sreCommon.Logger
+	meter   sreCommon.Meter
+}
+
+// grpcAuthStream passes context of authenticated key to handler
+type grpcAuthStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcAuthStream) Context() context.Context {
+	return s.ctx
+}
+
+// fileOrContent reads file if it exists, otherwise value is content itself
+func fileOrContent(s string) ([]byte, error) {
+
+	if _, err := os.Stat(s); err == nil {
+		return os.ReadFile(s)
+	}
+	return []byte(s), nil
+}
+
+func (g *GrpcServer) count(method string, err error) {
+
+	labels := make(sreCommon.Labels)
+	labels["method"] = method
+
+	g.meter.Counter("requests", "Count of all grpc server requests", labels, "grpc", "server").Inc()
+	if err != nil {
+		g.meter.Counter("errors", "Count of all grpc server errors", labels, "grpc", "server").Inc()
+	}
+}
+
+// authenticate checks key of metadata as http server checks header, context has key name and tenant
+func (g *GrpcServer) authenticate(ctx context.Context, method string) (context.Context, error) {
+
+	if g.auth == nil {
+		return ctx, nil
+	}
+
+	key := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(g.auth.header); len(v) > 0 {
+			key = v[0]
+		}
+	}
+
+	k, err := g.auth.check(key)
+	switch {
+	case err == errUnauthorized:
+		labels := make(sreCommon.Labels)
+		labels["method"] = method
+		g.meter.Counter("unauthorized", "Count of all grpc server requests with missing or invalid api key", labels, "grpc", "server").Inc()
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	case err == errRateLimited:
+		return ctx, status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	ctx = common.WithAPIKey(ctx, k.name)
+	if !utils.IsEmpty(k.tenant) {
+		ctx = common.WithTenant(ctx, k.tenant)
+	}
+	return ctx, nil
+}
+
+func (g *GrpcServer) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+	ctx, err := g.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		g.count(info.FullMethod, err)
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	g.count(info.FullMethod, err)
+	return resp, err
+}
+
+func (g *GrpcServer) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+	ctx, err := g.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		g.count(info.FullMethod, err)
+		return err
+	}
+	err = handler(srv, &grpcAuthStream{ServerStream: ss, ctx: ctx})
+	g.count(info.FullMethod, err)
+	return err
+}
+
+func (g *GrpcServer) Start(wg *sync.WaitGroup) {
+
+	wg.Add(1)
+	go func(wg *sync.WaitGroup) {
+
+		defer wg.Done()
+		g.logger.Info("Start grpc server...")
+
+		opts := []grpc.ServerOption{
+			grpc.UnaryInterceptor(g.unary),
+			grpc.StreamInterceptor(g.stream),
+		}
+		if g.options.MaxRecvSize > 0 {
+			opts = append(opts, grpc.MaxRecvMsgSize(g.options.MaxRecvSize))
+		}
+
+		if g.options.Tls {
+
+			cert, err := fileOrContent(g.options.Cert)
+			if err != nil {
+				g.logger.Panic(err)
+			}
+			key, err := fileOrContent(g.options.Key)
+			if err != nil {
+				g.logger.Panic(err)
+			}
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				g.logger.Panic(err)
+			}
+			opts = append(opts, grpc.Creds(credentials.NewServerTLSFromCert(&pair)))
+		}
+
+		srv := grpc.NewServer(opts...)
+		api.RegisterWebrenderServer(srv, g.service)
+
+		listener, err := net.Listen("tcp", g.options.Listen)
+		if err != nil {
+			g.logger.Panic(err)
+		}
+
+		g.logger.Info("Grpc server is up. Listening...")
+
+		if err := srv.Serve(listener); err != nil {
+			g.logger.Panic(err)
+		}
+	}(wg)
+}
+
+func NewGrpcServer(options GrpcServerOptions, service api.WebrenderServer, observability *common.Observability) *GrpcServer {
+
+	if utils.IsEmpty(options.Listen) {
+		return nil
+	}
+
+	auth, err := newHttpAuth(options.APIKeys, options.APIKeyHeader, "")
+	if err != nil {
+		observability.Logs().Panic("Couldn't load api keys: %v", err)
+	}
+	// metadata keys are lower case
+	if auth != nil {
+		auth.header = strings.ToLower(auth.header)
+	}
+
+	return &GrpcServer{
+		options: options,
+		service: service,
+		auth:    auth,
+		logger:  observability.Logs(),
+		meter:   observability.Metrics(),
+	}
+}
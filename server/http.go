@@ -19,6 +19,19 @@ import (
 type HttpServerOptions struct {
 	HealthcheckURL string
 	ImageURL       string
+	BatchURL       string
+	DeliveryURL    string
+	JobsURL        string
+	ValidateURL    string
+	HarURL         string
+	HtmlURL        string
+	TemplateURL    string
+	DiffURL        string
+	BaselineURL    string
+	AuditURL       string
+	ActivityURL    string
+	QuotaURL       string
+	SchemaURL      string
 
 	ServerName string
 	Listen     string
@@ -27,11 +40,21 @@ type HttpServerOptions struct {
 	Cert       string
 	Key        string
 	Chain      string
+
+	// yaml file or content with key name: key, rate and burst, no keys disable auth
+	APIKeys      string
+	APIKeyHeader string
+	APIKeyParam  string
+
+	// serve urls without version prefix as deprecated v1, sunset is http date they are gone
+	LegacyURLs   bool
+	LegacySunset string
 }
 
 type HttpServer struct {
 	options    HttpServerOptions
 	processors *common.Processors
+	auth       *httpAuth
 	logger     sreCommon.Logger
 	meter      sreCommon.Meter
 }
@@ -49,15 +72,68 @@ func (h *HttpServer) processURL(url string, mux *http.ServeMux, p common.HttpPro
 		requests := h.meter.Counter("requests", "Count of all http server requests", labels, "http", "server")
 		errors := h.meter.Counter("errors", "Count of all server input errors", labels, "http", "server")
 
-		mux.HandleFunc(url, func(w http.ResponseWriter, r *http.Request) {
+		if h.auth == nil {
+			h.handle(mux, url, func(w http.ResponseWriter, r *http.Request) {
 
-			requests.Inc()
-			err := p.HandleHttpRequest(w, r)
-			if err != nil {
-				errors.Inc()
-			}
-		})
+				requests.Inc()
+				err := p.HandleHttpRequest(w, r)
+				if err != nil {
+					errors.Inc()
+				}
+			})
+			continue
+		}
+		h.processAuthURL(url, mux, p)
+	}
+}
+
+// processAuthURL counts requests and errors by key name as well
+func (h *HttpServer) processAuthURL(url string, mux *http.ServeMux, p common.HttpProcessor) {
+
+	labels := make(sreCommon.Labels)
+	labels["url"] = url
+	unauthorized := h.meter.Counter("unauthorized", "Count of all http server requests with missing or invalid api key", labels, "http", "server")
+
+	requests := make(map[string]sreCommon.Counter)
+	errors := make(map[string]sreCommon.Counter)
+	limited := make(map[string]sreCommon.Counter)
+	for _, name := range h.auth.names() {
+
+		keyLabels := make(sreCommon.Labels)
+		keyLabels["url"] = url
+		keyLabels["key"] = name
+
+		requests[name] = h.meter.Counter("requests", "Count of all http server requests", keyLabels, "http", "server")
+		errors[name] = h.meter.Counter("errors", "Count of all server input errors", keyLabels, "http", "server")
+		limited[name] = h.meter.Counter("rate_limited", "Count of all http server requests over api key rate", keyLabels, "http", "server")
 	}
+
+	h.handle(mux, url, func(w http.ResponseWriter, r *http.Request) {
+
+		key, err := h.auth.authenticate(r)
+		switch {
+		case err == errUnauthorized:
+			unauthorized.Inc()
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case err == errRateLimited:
+			limited[key.name].Inc()
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		ctx := common.WithAPIKey(r.Context(), key.name)
+		if !utils.IsEmpty(key.tenant) {
+			ctx = common.WithTenant(ctx, key.tenant)
+		}
+
+		requests[key.name].Inc()
+		err = p.HandleHttpRequest(w, r.WithContext(ctx))
+		if err != nil {
+			errors[key.name].Inc()
+		}
+	})
 }
 
 func (h *HttpServer) Start(wg *sync.WaitGroup) {
@@ -185,6 +261,19 @@ func (h *HttpServer) getProcessors() map[string]common.HttpProcessor {
 
 	m := make(map[string]common.HttpProcessor)
 	h.setProcessor(m, h.options.ImageURL, processor.ImageProcessorType())
+	h.setProcessor(m, h.options.BatchURL, processor.BatchProcessorType())
+	h.setProcessor(m, h.options.DeliveryURL, processor.DeliveryProcessorType())
+	h.setProcessor(m, h.options.JobsURL, processor.JobsProcessorType())
+	h.setProcessor(m, h.options.ValidateURL, processor.ValidateProcessorType())
+	h.setProcessor(m, h.options.HarURL, processor.HarProcessorType())
+	h.setProcessor(m, h.options.HtmlURL, processor.HtmlProcessorType())
+	h.setProcessor(m, h.options.TemplateURL, processor.TemplateProcessorType())
+	h.setProcessor(m, h.options.DiffURL, processor.DiffProcessorType())
+	h.setProcessor(m, h.options.BaselineURL, processor.BaselineProcessorType())
+	h.setProcessor(m, h.options.AuditURL, processor.AuditProcessorType())
+	h.setProcessor(m, h.options.ActivityURL, processor.ActivityProcessorType())
+	h.setProcessor(m, h.options.QuotaURL, processor.QuotaProcessorType())
+	h.setProcessor(m, h.options.SchemaURL, processor.SchemaProcessorType())
 	return m
 }
 
@@ -192,9 +281,16 @@ func NewHttpServer(options HttpServerOptions, processors *common.Processors, obs
 
 	meter := observability.Metrics()
 
+	// server without keys it's configured with would be open to anyone
+	auth, err := newHttpAuth(options.APIKeys, options.APIKeyHeader, options.APIKeyParam)
+	if err != nil {
+		observability.Logs().Panic("Couldn't load api keys: %v", err)
+	}
+
 	return &HttpServer{
 		options:    options,
 		processors: processors,
+		auth:       auth,
 		logger:     observability.Logs(),
 		meter:      meter,
 	}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+// api versions are path prefixes, paths without prefix are deprecated v1
+const (
+	APIVersion1 = "v1"
+	APIVersion2 = "v2"
+)
+
+var apiVersions = []string{APIVersion1, APIVersion2}
+
+// httpJsonErrorWriter turns plain text errors into json ones, other responses go as they are
+type httpJsonErrorWriter struct {
+	http.ResponseWriter
+	status int
+	json   bool
+}
+
+type httpJsonError struct {
+	Error  string `json:"error"`
+	Status int    `json:"status"`
+}
+
+func (w *httpJsonErrorWriter) WriteHeader(status int) {
+
+	w.status = status
+	if status >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.json = true
+		w.Header().Set("Content-Type", "application/json")
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *httpJsonErrorWriter) Write(data []byte) (int, error) {
+
+	if !w.json {
+		return w.ResponseWriter.Write(data)
+	}
+	body, err := json.Marshal(&httpJsonError{Error: strings.TrimSpace(string(data)), Status: w.status})
+	if err != nil {
+		return 0, err
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if _, err := w.ResponseWriter.Write(body); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *httpJsonErrorWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// versioned serves handler at version prefix, processor sees path without prefix and version in context
+func (h *HttpServer) versioned(version string, handler http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		r2 := r.WithContext(common.WithAPIVersion(r.Context(), version))
+		u := *r.URL
+		u.Path = strings.TrimPrefix(u.Path, "/"+version)
+		u.RawPath = ""
+		r2.URL = &u
+
+		w.Header().Set("X-Webrender-API-Version", version)
+		if version == APIVersion2 {
+			w = &httpJsonErrorWriter{ResponseWriter: w}
+		}
+		handler(w, r2)
+	}
+}
+
+// legacy serves handler as deprecated v1, response points to its successor
+func (h *HttpServer) legacy(handler http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "</"+APIVersion1+r.URL.Path+">; rel=\"successor-version\"")
+		if !utils.IsEmpty(h.options.LegacySunset) {
+			w.Header().Set("Sunset", h.options.LegacySunset)
+		}
+		h.meter.Counter("legacy_requests", "Count of all http server requests to unversioned urls", nil, "http", "server").Inc()
+
+		handler(w, r.WithContext(common.WithAPIVersion(r.Context(), APIVersion1)))
+	}
+}
+
+// handle mounts handler under every api version, and as is while legacy urls are on
+func (h *HttpServer) handle(mux *http.ServeMux, url string, handler http.HandlerFunc) {
+
+	for _, v := range apiVersions {
+		mux.HandleFunc("/"+v+url, h.versioned(v, handler))
+	}
+	if h.options.LegacyURLs {
+		mux.HandleFunc(url, h.legacy(handler))
+	}
+}
@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+)
+
+type ArtifactsOptions struct {
+	// prefix of all keys
+	Prefix string
+	// tenant prefix, {tenant} is replaced by tenant name
+	TenantPrefix  string
+	DefaultTenant string
+	// yaml file or content with tenant: base64 aes key, * is for any tenant
+	EncryptionKeys string
+}
+
+type Artifact struct {
+	Name      string `json:"name"`
+	Key       string `json:"key"`
+	URL       string `json:"url,omitempty"`
+	Size      int    `json:"size"`
+	Encrypted bool   `json:"encrypted,omitempty"`
+}
+
+// KeyProvider returns encryption key of tenant, nil key means no encryption
+type KeyProvider interface {
+	Key(tenant string) ([]byte, error)
+}
+
+type StaticKeyProvider struct {
+	keys map[string][]byte
+}
+
+// Artifacts keeps tenant artifacts isolated by prefix and encrypted if tenant has a key
+type Artifacts struct {
+	options ArtifactsOptions
+	storage Storage
+	keys    KeyProvider
+	logger  sreCommon.Logger
+	meter   sreCommon.Meter
+}
+
+var encryptedMagic = []byte("WRE1")
+
+func (s *StaticKeyProvider) Key(tenant string) ([]byte, error) {
+
+	if k, ok := s.keys[tenant]; ok {
+		return k, nil
+	}
+	return s.keys["*"], nil
+}
+
+func NewStaticKeyProvider(keys string) (*StaticKeyProvider, error) {
+
+	raw := make(map[string]string)
+	if _, err := common.LoadYaml(keys, &raw); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string][]byte)
+	for tenant, v := range raw {
+		k, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s key: %w", tenant, err)
+		}
+		if len(k) != 16 && len(k) != 24 && len(k) != 32 {
+			return nil, fmt.Errorf("tenant %s key has wrong size %d", tenant, len(k))
+		}
+		m[tenant] = k
+	}
+	return &StaticKeyProvider{keys: m}, nil
+}
+
+func encrypt(key, data []byte) ([]byte, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	r := append([]byte{}, encryptedMagic...)
+	r = append(r, nonce...)
+	return gcm.Seal(r, nonce, data, nil), nil
+}
+
+func decrypt(key, data []byte) ([]byte, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[len(encryptedMagic):]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted artifact is too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// Tenant returns safe tenant name to be used in keys
+func (a *Artifacts) Tenant(tenant string) string {
+
+	if utils.IsEmpty(tenant) {
+		tenant = a.options.DefaultTenant
+	}
+	tenant = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, tenant)
+	return tenant
+}
+
+// TenantPrefix is a prefix of all tenant keys
+func (a *Artifacts) TenantPrefix(tenant string) string {
+	return a.options.Prefix + strings.ReplaceAll(a.options.TenantPrefix, "{tenant}", a.Tenant(tenant))
+}
+
+// TenantOf returns tenant of key if key is within tenant prefix
+func (a *Artifacts) TenantOf(key string) (string, bool) {
+
+	if !strings.HasPrefix(key, a.options.Prefix) {
+		return "", false
+	}
+	key = strings.TrimPrefix(key, a.options.Prefix)
+
+	before, after, ok := strings.Cut(a.options.TenantPrefix, "{tenant}")
+	if !ok || !strings.HasPrefix(key, before) {
+		return "", false
+	}
+	key = strings.TrimPrefix(key, before)
+
+	if after == "" {
+		return "", false
+	}
+	i := strings.Index(key, after)
+	if i <= 0 {
+		return "", false
+	}
+	return key[:i], true
+}
+
+func (a *Artifacts) key(tenant, name string) string {
+	return a.TenantPrefix(tenant) + strings.TrimLeft(name, "/")
+}
+
+func (a *Artifacts) Put(ctx context.Context, tenant, name string, data []byte, contentType string) (*Artifact, error) {
+
+	if err := validKey(name); err != nil {
+		return nil, err
+	}
+	key, err := a.keys.Key(a.Tenant(tenant))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Artifact{
+		Name: name,
+		Key:  a.key(tenant, name),
+		Size: len(data),
+	}
+
+	if key != nil {
+		data, err = encrypt(key, data)
+		if err != nil {
+			return nil, err
+		}
+		contentType = "application/octet-stream"
+		r.Encrypted = true
+	}
+
+	if err := a.storage.Put(ctx, r.Key, data, contentType); err != nil {
+		return nil, err
+	}
+	r.URL = a.storage.URL(r.Key)
+
+	labels := make(sreCommon.Labels)
+	labels["tenant"] = common.NormalizeLabel(a.Tenant(tenant))
+	a.meter.Counter("stored_bytes", "Count of all stored artifact bytes", labels, "storage").Add(len(data))
+	return r, nil
+}
+
+// validKey refuses keys which could step out of their prefix once storage cleans them
+func validKey(key string) error {
+
+	if strings.Contains(key, "\\") {
+		return fmt.Errorf("artifact %s has backslash", key)
+	}
+	for _, s := range strings.Split(key, "/") {
+		if s == ".." {
+			return fmt.Errorf("artifact %s has parent reference", key)
+		}
+	}
+	return nil
+}
+
+// Get returns decrypted artifact by key within tenant prefix
+func (a *Artifacts) Get(ctx context.Context, tenant, key string) ([]byte, error) {
+
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(path.Clean(key), a.TenantPrefix(tenant)) {
+		return nil, fmt.Errorf("artifact %s doesn't belong to tenant", key)
+	}
+
+	data, err := a.storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		return data, nil
+	}
+
+	k, err := a.keys.Key(a.Tenant(tenant))
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		return nil, fmt.Errorf("artifact %s is encrypted, but there is no key", key)
+	}
+	return decrypt(k, data)
+}
+
+// SetKeyProvider plugs external secrets provider instead of static keys
+func (a *Artifacts) SetKeyProvider(keys KeyProvider) {
+	a.keys = keys
+}
+
+func (a *Artifacts) Prefix() string {
+	return a.options.Prefix
+}
+
+func (a *Artifacts) Storage() Storage {
+	return a.storage
+}
+
+func NewArtifacts(options ArtifactsOptions, storage Storage, observability *common.Observability) (*Artifacts, error) {
+
+	keys, err := NewStaticKeyProvider(options.EncryptionKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	if utils.IsEmpty(options.DefaultTenant) {
+		options.DefaultTenant = "default"
+	}
+
+	return &Artifacts{
+		options: options,
+		storage: storage,
+		keys:    keys,
+		logger:  observability.Logs(),
+		meter:   observability.Metrics(),
+	}, nil
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type FileStorageOptions struct {
+	Dir string
+	URL string
+}
+
+type FileStorage struct {
+	options FileStorageOptions
+}
+
+var errOutsideDir = errors.New("key is outside of storage dir")
+
+// path refuses keys which resolve outside of dir
+func (f *FileStorage) path(key string) (string, error) {
+
+	root := filepath.Clean(f.options.Dir)
+	p := filepath.Join(root, filepath.FromSlash(key))
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", errOutsideDir, key)
+	}
+	return p, nil
+}
+
+func (f *FileStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0600)
+}
+
+func (f *FileStorage) Get(ctx context.Context, key string) ([]byte, error) {
+
+	p, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (f *FileStorage) Delete(ctx context.Context, key string) error {
+
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// remove empty parent dirs, remove fails on non empty one
+	root := filepath.Clean(f.options.Dir)
+	for dir := filepath.Dir(p); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *FileStorage) List(ctx context.Context, prefix string) ([]*Object, error) {
+
+	var r []*Object
+
+	err := filepath.WalkDir(f.options.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(f.options.Dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		r = append(r, &Object{
+			Key:      key,
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+		return nil
+	})
+	return r, err
+}
+
+func (f *FileStorage) URL(key string) string {
+
+	if f.options.URL == "" {
+		return ""
+	}
+	return strings.TrimRight(f.options.URL, "/") + "/" + key
+}
+
+func NewFileStorage(options FileStorageOptions) *FileStorage {
+
+	return &FileStorage{
+		options: options,
+	}
+}
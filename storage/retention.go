@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+	"github.com/devopsext/webrender/common"
+	"github.com/devopsext/webrender/leader"
+)
+
+type RetentionPolicy struct {
+	// hours
+	MaxAge   int `yaml:"maxAge"`
+	MaxCount int `yaml:"maxCount"`
+}
+
+type RetentionOptions struct {
+	// seconds
+	Interval int
+	RetentionPolicy
+	// yaml file or content with tenant: policy overrides
+	Tenants string
+}
+
+// Retention sweeps old renders, render is a group of artifacts with the same dir
+type Retention struct {
+	options   RetentionOptions
+	tenants   map[string]*RetentionPolicy
+	artifacts *Artifacts
+	election  *leader.Election
+	logger    sreCommon.Logger
+	meter     sreCommon.Meter
+}
+
+type retentionGroup struct {
+	objects  []*Object
+	modified time.Time
+}
+
+func (r *Retention) policy(tenant string) *RetentionPolicy {
+
+	if p, ok := r.tenants[tenant]; ok {
+		return p
+	}
+	return &r.options.RetentionPolicy
+}
+
+// groups returns tenant renders with newest first
+func (r *Retention) groups(objects []*Object) []*retentionGroup {
+
+	m := make(map[string]*retentionGroup)
+	for _, o := range objects {
+
+		dir := path.Dir(o.Key)
+		g, ok := m[dir]
+		if !ok {
+			g = &retentionGroup{}
+			m[dir] = g
+		}
+		g.objects = append(g.objects, o)
+		if o.Modified.After(g.modified) {
+			g.modified = o.Modified
+		}
+	}
+
+	var groups []*retentionGroup
+	for _, g := range m {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].modified.After(groups[j].modified)
+	})
+	return groups
+}
+
+func (r *Retention) delete(ctx context.Context, tenant string, g *retentionGroup) {
+
+	labels := make(sreCommon.Labels)
+	labels["tenant"] = common.NormalizeLabel(tenant)
+
+	for _, o := range g.objects {
+		if err := r.artifacts.Storage().Delete(ctx, o.Key); err != nil {
+			r.logger.Error("Couldn't delete artifact %s: %v", o.Key, err)
+			continue
+		}
+		r.meter.Counter("deleted_bytes", "Count of all bytes deleted by retention", labels, "storage", "retention").Add(int(o.Size))
+		r.meter.Counter("deleted_objects", "Count of all objects deleted by retention", labels, "storage", "retention").Inc()
+	}
+}
+
+// Sweep deletes renders exceeding tenant policy
+func (r *Retention) Sweep(ctx context.Context) error {
+
+	objects, err := r.artifacts.Storage().List(ctx, r.artifacts.Prefix())
+	if err != nil {
+		return err
+	}
+
+	tenants := make(map[string][]*Object)
+	for _, o := range objects {
+		tenant, ok := r.artifacts.TenantOf(o.Key)
+		if !ok {
+			continue
+		}
+		// baselines are kept till they're replaced or deleted
+		if strings.HasPrefix(o.Key, r.artifacts.TenantPrefix(tenant)+BaselinesDir) {
+			continue
+		}
+		tenants[tenant] = append(tenants[tenant], o)
+	}
+
+	now := time.Now()
+	for tenant, objs := range tenants {
+
+		policy := r.policy(tenant)
+		for i, g := range r.groups(objs) {
+
+			expired := policy.MaxAge > 0 && now.Sub(g.modified) > time.Duration(policy.MaxAge)*time.Hour
+			exceeded := policy.MaxCount > 0 && i >= policy.MaxCount
+			if expired || exceeded {
+				r.delete(ctx, tenant, g)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Retention) Start(wg *sync.WaitGroup) {
+
+	if r.options.Interval <= 0 {
+		return
+	}
+
+	wg.Add(1)
+	go func(wg *sync.WaitGroup) {
+
+		defer wg.Done()
+		r.logger.Info("Start retention sweeper...")
+
+		ticker := time.NewTicker(time.Duration(r.options.Interval) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			// storage is shared by replicas, so it's swept by leader only
+			if r.election != nil && !r.election.IsLeader() {
+				continue
+			}
+			if err := r.Sweep(context.Background()); err != nil {
+				r.logger.Error("Couldn't sweep artifacts: %v", err)
+			}
+		}
+	}(wg)
+}
+
+func (r *Retention) SetElection(election *leader.Election) {
+	r.election = election
+}
+
+func NewRetention(options RetentionOptions, artifacts *Artifacts, observability *common.Observability) (*Retention, error) {
+
+	tenants := make(map[string]*RetentionPolicy)
+	if !utils.IsEmpty(options.Tenants) {
+		if _, err := common.LoadYaml(options.Tenants, &tenants); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Retention{
+		options:   options,
+		tenants:   tenants,
+		artifacts: artifacts,
+		logger:    observability.Logs(),
+		meter:     observability.Metrics(),
+	}, nil
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/devopsext/utils"
+)
+
+type S3StorageOptions struct {
+	// endpoint of aws or compatible service, like https://s3.eu-west-1.amazonaws.com
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// bucket in path instead of host, needed by most compatible services
+	PathStyle bool
+	// public url of bucket, object urls are presigned or endpoint based if it's empty
+	URL string
+	// seconds presigned object urls are valid, 0 doesn't presign
+	PresignExpiry int
+	Timeout       int
+}
+
+// S3Storage keeps artifacts in s3 compatible bucket, requests are signed by aws signature v4
+type S3Storage struct {
+	options S3StorageOptions
+	client  *http.Client
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+func s3Hash(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape encodes everything but unreserved characters as signature v4 wants
+func s3Escape(s string, path bool) string {
+
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9'),
+			c == '-', c == '_', c == '.', c == '~', path && c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3Query(query url.Values) string {
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// object returns url of key, empty key is the bucket itself
+func (s *S3Storage) object(key string) (*url.URL, error) {
+
+	u, err := url.Parse(strings.TrimRight(s.options.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	if s.options.PathStyle {
+		u.Path = "/" + s.options.Bucket + "/" + key
+	} else {
+		u.Host = s.options.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	return u, nil
+}
+
+func (s *S3Storage) scope(t time.Time) string {
+	return fmt.Sprintf("%s/%s/s3/aws4_request", t.Format("20060102"), s.options.Region)
+}
+
+func (s *S3Storage) signature(t time.Time, canonical string) string {
+
+	toSign := strings.Join([]string{s3Algorithm, t.Format("20060102T150405Z"), s.scope(t), s3Hash([]byte(canonical))}, "\n")
+
+	key := s3HMAC([]byte("AWS4"+s.options.SecretKey), t.Format("20060102"))
+	key = s3HMAC(key, s.options.Region)
+	key = s3HMAC(key, "s3")
+	key = s3HMAC(key, "aws4_request")
+	return hex.EncodeToString(s3HMAC(key, toSign))
+}
+
+// sign adds authorization header, host, date and payload hash are signed
+func (s *S3Storage) sign(req *http.Request, payload string) {
+
+	t := time.Now().UTC()
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	headers := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payload, t.Format("20060102T150405Z"))
+
+	canonical := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, true),
+		s3Query(req.URL.Query()),
+		headers,
+		signed,
+		payload,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.options.AccessKey, s.scope(t), signed, s.signature(t, canonical)))
+}
+
+func (s *S3Storage) do(ctx context.Context, method, key string, query url.Values, data []byte, contentType string) ([]byte, error) {
+
+	u, err := s.object(key)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = s3Query(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if !utils.IsEmpty(contentType) {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, s3Hash(data))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("s3 %s %s returned %s: %s", method, key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.do(ctx, http.MethodPut, key, nil, data, contentType)
+	return err
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.do(ctx, http.MethodGet, key, nil, nil, "")
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s.do(ctx, http.MethodDelete, key, nil, nil, "")
+	return err
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]*Object, error) {
+
+	var r []*Object
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		body, err := s.do(ctx, http.MethodGet, "", query, nil, "")
+		if err != nil {
+			return nil, err
+		}
+
+		var res s3ListResult
+		if err := xml.Unmarshal(body, &res); err != nil {
+			return nil, err
+		}
+		for _, c := range res.Contents {
+			r = append(r, &Object{
+				Key:      c.Key,
+				Size:     c.Size,
+				Modified: c.LastModified,
+			})
+		}
+
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return r, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+// presign returns object url valid for presign expiry without credentials
+func (s *S3Storage) presign(key string) string {
+
+	u, err := s.object(key)
+	if err != nil {
+		return ""
+	}
+
+	t := time.Now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.options.AccessKey+"/"+s.scope(t))
+	query.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", s.options.PresignExpiry))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		s3Escape(u.Path, true),
+		s3Query(query),
+		fmt.Sprintf("host:%s\n", u.Host),
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+
+	query.Set("X-Amz-Signature", s.signature(t, canonical))
+	u.RawQuery = s3Query(query)
+	return u.String()
+}
+
+func (s *S3Storage) URL(key string) string {
+
+	if s.options.URL != "" {
+		return strings.TrimRight(s.options.URL, "/") + "/" + key
+	}
+	if s.options.PresignExpiry > 0 {
+		return s.presign(key)
+	}
+	u, err := s.object(key)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+func NewS3Storage(options S3StorageOptions) *S3Storage {
+
+	if utils.IsEmpty(options.Region) {
+		options.Region = "us-east-1"
+	}
+
+	return &S3Storage{
+		options: options,
+		client:  utils.NewHttpClient(options.Timeout, false),
+	}
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// BaselinesDir is tenant dir of visual regression baselines, retention doesn't sweep it
+const BaselinesDir = "baselines/"
+
+type Object struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+}
+
+// Storage is a backend keeping artifacts by key
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]*Object, error)
+	URL(key string) string
+}